@@ -35,10 +35,12 @@ func RunCLI() {
 			CommandHardReset,
 			CommandForcePassChange,
 			CommandFixHotness,
+			CommandTasks,
 			CommandAddAllUsersToCommunity,
 			CommandDeleteUnusedCommunities,
 			CommandNewBadge,
 			CommandDeleteUser,
+			CommandAltAccounts,
 			CommandInjectConfig,
 			CommandImagePath,
 		},
@@ -237,7 +239,7 @@ var CommandForcePassChange = &cli.Command{
 
 var CommandFixHotness = &cli.Command{
 	Name:  "fix-hotness",
-	Usage: "Fix hotness of all posts",
+	Usage: "Fix hotness (and the other ranking scores) of all posts",
 	Action: func(ctx *cli.Context) error {
 		pg, err := program.NewProgram(true)
 		if err != nil {
@@ -248,6 +250,63 @@ var CommandFixHotness = &cli.Command{
 	},
 }
 
+var CommandTasks = &cli.Command{
+	Name:  "tasks",
+	Usage: "Inspect and control the background tasks of the server",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List background tasks with their last and next runs",
+			Action: func(ctx *cli.Context) error {
+				pg, err := program.NewProgram(true)
+				if err != nil {
+					return err
+				}
+				defer pg.Close()
+				return pg.ListBackgroundTasks()
+			},
+		},
+		{
+			Name:      "run",
+			Usage:     "Run a background task now",
+			ArgsUsage: "<task name>",
+			Action: func(ctx *cli.Context) error {
+				pg, err := program.NewProgram(true)
+				if err != nil {
+					return err
+				}
+				defer pg.Close()
+				return pg.RunBackgroundTask(ctx.Args().First())
+			},
+		},
+		{
+			Name:      "pause",
+			Usage:     "Pause a background task",
+			ArgsUsage: "<task name>",
+			Action: func(ctx *cli.Context) error {
+				return pauseBackgroundTask(ctx, true)
+			},
+		},
+		{
+			Name:      "resume",
+			Usage:     "Resume a paused background task",
+			ArgsUsage: "<task name>",
+			Action: func(ctx *cli.Context) error {
+				return pauseBackgroundTask(ctx, false)
+			},
+		},
+	},
+}
+
+func pauseBackgroundTask(ctx *cli.Context, pause bool) error {
+	pg, err := program.NewProgram(true)
+	if err != nil {
+		return err
+	}
+	defer pg.Close()
+	return pg.PauseBackgroundTask(ctx.Args().First(), pause)
+}
+
 var CommandDeleteUser = &cli.Command{
 	Name:  "delete-user",
 	Usage: "Delete a user",
@@ -277,6 +336,39 @@ var CommandDeleteUser = &cli.Command{
 	},
 }
 
+var CommandAltAccounts = &cli.Command{
+	Name:      "alt-accounts",
+	Usage:     "List the accounts that share IP addresses with a user",
+	ArgsUsage: "<username>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Output format (table, json, or csv)",
+			Value: "table",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "Write the report to this file instead of stdout",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		pg, err := program.NewProgram(true)
+		if err != nil {
+			return err
+		}
+		defer pg.Close()
+
+		out := os.Stdout
+		if name := ctx.String("output"); name != "" {
+			if out, err = os.Create(name); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		return pg.AltAccountsReport(ctx.Args().First(), ctx.String("format"), out)
+	},
+}
+
 const defaultDays = 30
 
 var CommandDeleteUnusedCommunities = &cli.Command{
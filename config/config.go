@@ -2,11 +2,14 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/ratelimits"
+	"github.com/discuitnet/discuit/internal/taskrunner"
 	"gopkg.in/yaml.v2"
 )
 
@@ -27,10 +30,26 @@ type Config struct {
 	DBPassword string `yaml:"dbPassword"`
 	DBName     string `yaml:"dbName"`
 
+	// Optional read replicas of the primary DB, as MySQL DSNs (of the form
+	// user:password@tcp(host:port)/dbname). Some of the read-heavy API routes
+	// read from a replica, unless it's lagging behind the primary by more
+	// than DBReplicaMaxLag seconds.
+	DBReplicas      []string `yaml:"dbReplicas"`
+	DBReplicaMaxLag int      `yaml:"dbReplicaMaxLag"`
+
 	SessionCookieName string `yaml:"sessionCookieName"`
 
 	RedisAddress string `yaml:"redisAddress"`
 
+	// Responses to logged out users of some API routes (the first pages of
+	// feeds, community listings, and user profiles) are cached in Redis for
+	// these many seconds. A zero TTL disables caching of that kind of
+	// response.
+	CacheDisabled       bool `yaml:"cacheDisabled"`
+	CacheFeedsTTL       int  `yaml:"cacheFeedsTTL"`
+	CacheCommunitiesTTL int  `yaml:"cacheCommunitiesTTL"`
+	CacheUsersTTL       int  `yaml:"cacheUsersTTL"`
+
 	HMACSecret string `yaml:"hmacSecret"`
 
 	CSRFOff bool `yaml:"csrfOff"`
@@ -76,21 +95,66 @@ type Config struct {
 	SubstackURL    string `yaml:"substackURL"`
 
 	WelcomeCommunity string `yaml:"welcomeCommunity"`
+
+	// Schedules of the heavier background tasks, in any of the forms accepted
+	// by taskrunner.ParseSchedule (like "03:00 daily"), in server local time.
+	AnalyticsSchedule string `yaml:"analyticsSchedule"`
+	HotnessSchedule   string `yaml:"hotnessSchedule"`
+
+	// Vote counts and points are updated from the queue of recent votes every
+	// VoteFlushInterval seconds.
+	VoteFlushInterval int `yaml:"voteFlushInterval"`
+
+	// Restrictions on fetching user-supplied URLs (like those of link posts).
+	// List entries are hostnames (which match their subdomains as well), IP
+	// addresses, or CIDR ranges. If FetchAllowlist is not empty, only the
+	// hosts in it are fetched. Addresses that aren't publicly routable are
+	// fetched only if they're in FetchAllowlist.
+	FetchAllowlist    []string `yaml:"fetchAllowlist"`
+	FetchDenylist     []string `yaml:"fetchDenylist"`
+	FetchMaxRedirects int      `yaml:"fetchMaxRedirects"`
+	FetchMaxBodySize  int      `yaml:"fetchMaxBodySize"` // In bytes.
+
+	// Overrides, by name, of the default rate limit policies (see
+	// server.defaultRateLimits). The rules of a policy replace the default
+	// rules, and its groups ("new", "trusted", and "mods") are added to the
+	// default groups.
+	RateLimits map[string]*ratelimits.Policy `yaml:"rateLimits"`
+
+	// Either "redis" (the default) or "memory" (for a single server, and for
+	// tests).
+	RateLimitBackend string `yaml:"rateLimitBackend"`
+
+	// Users younger than RateLimitNewUserAge hours are in the "new" rate limit
+	// group, and those with at least RateLimitTrustedPoints points (if it's
+	// not zero) are in the "trusted" group.
+	RateLimitNewUserAge    int `yaml:"rateLimitNewUserAge"`
+	RateLimitTrustedPoints int `yaml:"rateLimitTrustedPoints"`
 }
 
 // Parse parses the yaml file at path and returns a Config.
 func Parse(path string) (*Config, error) {
 	c := &Config{
 		// Default values.
-		Addr:               ":8080",
-		DBUser:             "discuit",
-		SessionCookieName:  "SID",
-		RedisAddress:       ":6379",
-		PaginationLimit:    10,
-		PaginationLimitMax: 50,
-		DefaultFeedSort:    core.FeedSortHot,
-		MaxImageSize:       25 * (1 << 20),
-		MaxImagesPerPost:   10,
+		Addr:                ":8080",
+		DBUser:              "discuit",
+		SessionCookieName:   "SID",
+		RedisAddress:        ":6379",
+		CacheFeedsTTL:       30,
+		CacheCommunitiesTTL: 300,
+		CacheUsersTTL:       60,
+		PaginationLimit:     10,
+		PaginationLimitMax:  50,
+		DefaultFeedSort:     core.FeedSortHot,
+		MaxImageSize:        25 * (1 << 20),
+		MaxImagesPerPost:    10,
+		DBReplicaMaxLag:     2,
+		AnalyticsSchedule:   "hourly",
+		HotnessSchedule:     "04:00 daily",
+		VoteFlushInterval:   5,
+		FetchMaxRedirects:   5,
+		FetchMaxBodySize:    10 * (1 << 20),
+		RateLimitNewUserAge: 72,
 
 		// Required fields:
 		ForumCreationReqPoints: -1,
@@ -112,10 +176,18 @@ func Parse(path string) (*Config, error) {
 		"DISCUIT_DB_PASSWORD": &c.DBPassword,
 		"DISCUIT_DB_NAME":     &c.DBName,
 
+		"DISCUIT_DB_REPLICAS":        &c.DBReplicas, // Comma separated.
+		"DISCUIT_DB_REPLICA_MAX_LAG": &c.DBReplicaMaxLag,
+
 		"DISCUIT_SESSION_COOKIE_NAME": &c.SessionCookieName,
 
 		"DISCUIT_REDIS_ADDRESS": &c.RedisAddress,
 
+		"DISCUIT_CACHE_DISABLED":        &c.CacheDisabled,
+		"DISCUIT_CACHE_FEEDS_TTL":       &c.CacheFeedsTTL,
+		"DISCUIT_CACHE_COMMUNITIES_TTL": &c.CacheCommunitiesTTL,
+		"DISCUIT_CACHE_USERS_TTL":       &c.CacheUsersTTL,
+
 		"DISCUIT_HMAC_SECRET": &c.HMACSecret,
 
 		"DISCUIT_CSRF_OFF": &c.CSRFOff,
@@ -158,6 +230,20 @@ func Parse(path string) (*Config, error) {
 		"DISCUIT_SUBSTACK_URL":    &c.SubstackURL,
 
 		"DISCUIT_USE_HTTP_COOKIES": &c.UseHTTPCookies,
+
+		"DISCUIT_ANALYTICS_SCHEDULE": &c.AnalyticsSchedule,
+		"DISCUIT_HOTNESS_SCHEDULE":   &c.HotnessSchedule,
+
+		"DISCUIT_VOTE_FLUSH_INTERVAL": &c.VoteFlushInterval,
+
+		"DISCUIT_FETCH_ALLOWLIST":     &c.FetchAllowlist, // Comma separated.
+		"DISCUIT_FETCH_DENYLIST":      &c.FetchDenylist,  // Comma separated.
+		"DISCUIT_FETCH_MAX_REDIRECTS": &c.FetchMaxRedirects,
+		"DISCUIT_FETCH_MAX_BODY_SIZE": &c.FetchMaxBodySize,
+
+		"DISCUIT_RATE_LIMIT_BACKEND":        &c.RateLimitBackend,
+		"DISCUIT_RATE_LIMIT_NEW_USER_AGE":   &c.RateLimitNewUserAge,
+		"DISCUIT_RATE_LIMIT_TRUSTED_POINTS": &c.RateLimitTrustedPoints,
 	}
 
 	// Attempt to unmarshal the YAML file if it exists
@@ -188,6 +274,13 @@ func Parse(path string) (*Config, error) {
 				if b, err := strconv.ParseBool(value); err == nil {
 					*v = b
 				}
+			case *[]string:
+				*v = nil
+				for _, item := range strings.Split(value, ",") {
+					if item = strings.TrimSpace(item); item != "" {
+						*v = append(*v, item)
+					}
+				}
 			case *core.FeedSort:
 				if err := v.UnmarshalText([]byte(value)); err != nil {
 					return nil, err
@@ -205,6 +298,15 @@ func Parse(path string) (*Config, error) {
 	if c.MaxForumsPerUser == -1 {
 		return nil, errors.New("MaxForumsPerUser cannot be (-1)")
 	}
+	if _, err := taskrunner.ParseSchedule(c.AnalyticsSchedule); err != nil {
+		return nil, fmt.Errorf("analyticsSchedule: %w", err)
+	}
+	if _, err := taskrunner.ParseSchedule(c.HotnessSchedule); err != nil {
+		return nil, fmt.Errorf("hotnessSchedule: %w", err)
+	}
+	if c.VoteFlushInterval < 1 {
+		return nil, errors.New("voteFlushInterval must be at least 1")
+	}
 
 	return c, nil
 }
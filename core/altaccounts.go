@@ -0,0 +1,502 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	// The IP addresses of users are kept for this long (see PruneUserIPs).
+	userIPsRetention = time.Hour * 24 * 90
+
+	maxAltAccountsReportIPs      = 200
+	maxAltAccountsReportAccounts = 100
+
+	// Signals are computed only for this many of the accounts that share the
+	// most IP addresses with the user, since users behind shared IP addresses
+	// can share them with thousands of accounts.
+	maxAltAccountsReportCandidates = 200
+
+	// IP addresses shared by more than this many accounts (those of
+	// universities, mobile carriers, VPNs, and the like) are weak signals.
+	altAccountsCrowdedIPUsers = 20
+
+	// Accounts created within this long of each other are likelier to be
+	// alts.
+	altAccountsCreatedTogether = time.Hour * 24
+)
+
+// AltAccountSignalType is the type of a piece of evidence that two accounts
+// are of the same person.
+type AltAccountSignalType string
+
+const (
+	// The account was created from an IP address of the user.
+	AltAccountSignalCreatedIP = AltAccountSignalType("created_ip")
+
+	// The account was last seen from an IP address of the user.
+	AltAccountSignalLastSeenIP = AltAccountSignalType("last_seen_ip")
+
+	// The account was logged in from an IP address of the user.
+	AltAccountSignalSessionIP = AltAccountSignalType("session_ip")
+
+	// The account was logged in from an IP address of the user at the same
+	// time as the user.
+	AltAccountSignalTimeOverlap = AltAccountSignalType("time_overlap")
+
+	// The account and the user were created within a day of each other.
+	AltAccountSignalCreatedTogether = AltAccountSignalType("created_together")
+
+	// The account and the user are members of many of the same communities.
+	AltAccountSignalSharedCommunities = AltAccountSignalType("shared_communities")
+
+	// The account upvoted the posts or comments of the user, or vice versa.
+	AltAccountSignalVotes = AltAccountSignalType("votes")
+)
+
+// weight returns how strong a signal of type t is, from 0 to 1, before
+// adjustments.
+func (t AltAccountSignalType) weight() float64 {
+	switch t {
+	case AltAccountSignalCreatedIP:
+		return 0.5
+	case AltAccountSignalTimeOverlap:
+		return 0.5
+	case AltAccountSignalLastSeenIP, AltAccountSignalSessionIP:
+		return 0.25
+	case AltAccountSignalCreatedTogether:
+		return 0.15
+	case AltAccountSignalSharedCommunities, AltAccountSignalVotes:
+		return 0.3
+	}
+	return 0
+}
+
+// AltAccountSignal is a piece of evidence that an account is an alt of a
+// user.
+type AltAccountSignal struct {
+	Type   AltAccountSignalType `json:"type"`
+	IP     string               `json:"ip,omitempty"`
+	Detail string               `json:"detail,omitempty"`
+	Weight float64              `json:"weight"`
+}
+
+// UserIP is an IP address that a user was seen from.
+type UserIP struct {
+	IP        string    `json:"ip"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	NumUsers  int       `json:"noUsers"` // The number of accounts seen from the IP address.
+}
+
+// AltAccount is an account that might be an alt of another.
+type AltAccount struct {
+	User       *User     `json:"user"`
+	CreatedIP  *string   `json:"createdIP"`
+	LastSeen   time.Time `json:"lastSeen"`
+	LastSeenIP *string   `json:"lastSeenIP"`
+
+	// Confidence is the likelihood, from 0 to 1, that the account is an alt,
+	// as estimated from Signals. It's a lead for an investigation, not proof.
+	Confidence float64            `json:"confidence"`
+	Signals    []AltAccountSignal `json:"signals"`
+
+	SharedCommunities []string `json:"sharedCommunities"`
+	VotesOnUser       int      `json:"votesOnUser"` // Upvotes on the posts and comments of the user.
+	VotesByUser       int      `json:"votesByUser"` // Upvotes, by the user, on the posts and comments of the account.
+
+	ips map[string]bool // The IP addresses shared with the user.
+}
+
+func (a *AltAccount) addSignal(t AltAccountSignalType, ip, detail string, crowded bool) {
+	w := t.weight()
+	if crowded {
+		w /= 4
+	}
+	a.Signals = append(a.Signals, AltAccountSignal{Type: t, IP: ip, Detail: detail, Weight: w})
+}
+
+// computeConfidence sets a.Confidence by combining the weights of the signals
+// of a as independent pieces of evidence.
+func (a *AltAccount) computeConfidence() {
+	p := 1.0
+	for _, s := range a.Signals {
+		p *= 1 - s.Weight
+	}
+	a.Confidence = math.Round((1-p)*100) / 100
+}
+
+// AltAccountsReport is a report of the accounts that might be alts of a user.
+type AltAccountsReport struct {
+	User       *User         `json:"user"`
+	CreatedIP  *string       `json:"createdIP"`
+	LastSeenIP *string       `json:"lastSeenIP"`
+	IPs        []*UserIP     `json:"ips"` // The recent IP addresses of the user.
+	Accounts   []*AltAccount `json:"accounts"`
+	CreatedAt  time.Time     `json:"createdAt"`
+}
+
+// GetAltAccountsReport returns the accounts that share an IP address with
+// user (the address they were created from, the address they were last seen
+// from, or any address they were logged in from recently), with signals of how
+// likely they are to be alts of user, most likely first.
+func GetAltAccountsReport(ctx context.Context, db *sql.DB, user *User) (*AltAccountsReport, error) {
+	report := &AltAccountsReport{
+		User:       user,
+		CreatedIP:  user.CreatedIP,
+		LastSeenIP: user.LastSeenIP,
+		Accounts:   []*AltAccount{},
+		CreatedAt:  time.Now(),
+	}
+
+	ips, err := getUserIPs(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+	report.IPs = ips
+	if len(ips) == 0 {
+		return report, nil
+	}
+
+	userIPs := make(map[string]*UserIP, len(ips))
+	args := make([]any, len(ips))
+	for i, ip := range ips {
+		userIPs[ip.IP] = ip
+		args[i] = ip.IP
+	}
+	crowded := func(ip string) bool {
+		return userIPs[ip].NumUsers > altAccountsCrowdedIPUsers
+	}
+
+	accounts := make(map[uid.ID]*AltAccount)
+	account := func(id uid.ID) *AltAccount {
+		a, ok := accounts[id]
+		if !ok {
+			a = &AltAccount{ips: make(map[string]bool)}
+			accounts[id] = a
+		}
+		return a
+	}
+
+	candidates, err := getAltAccountCandidates(ctx, db, user.ID, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return report, nil
+	}
+	candidateArgs := make([]any, len(candidates))
+	for i, id := range candidates {
+		candidateArgs[i] = id
+	}
+	inCandidates := msql.InClauseQuestionMarks(len(candidates))
+
+	// The accounts seen from the IP addresses of user.
+	query := fmt.Sprintf(`
+		SELECT user_id, ip, first_seen, last_seen
+		FROM user_ips
+		WHERE ip IN %s AND user_id IN %s AND last_seen > ?`, msql.InClauseQuestionMarks(len(ips)), inCandidates)
+	rows, err := db.QueryContext(ctx, query, append(append(args, candidateArgs...), time.Now().Add(-userIPsRetention))...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			id                  uid.ID
+			ip                  string
+			firstSeen, lastSeen time.Time
+		)
+		if err := rows.Scan(&id, &ip, &firstSeen, &lastSeen); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a, userIP := account(id), userIPs[ip]
+		a.ips[ip] = true
+		if firstSeen.Before(userIP.LastSeen) && userIP.FirstSeen.Before(lastSeen) {
+			a.addSignal(AltAccountSignalTimeOverlap, ip, fmt.Sprintf("Seen from %s between %s and %s.", ip, firstSeen.Format(time.DateOnly), lastSeen.Format(time.DateOnly)), crowded(ip))
+		} else {
+			a.addSignal(AltAccountSignalSessionIP, ip, fmt.Sprintf("Seen from %s between %s and %s.", ip, firstSeen.Format(time.DateOnly), lastSeen.Format(time.DateOnly)), crowded(ip))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	// The accounts created from, or last seen from, the IP addresses of user.
+	in := msql.InClauseQuestionMarks(len(ips))
+	query = fmt.Sprintf("SELECT id, created_ip, last_seen_ip FROM users WHERE (created_ip IN %s OR last_seen_ip IN %s) AND id IN %s", in, in, inCandidates)
+	rows, err = db.QueryContext(ctx, query, append(append(args, args...), candidateArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			id                    uid.ID
+			createdIP, lastSeenIP msql.NullString
+		)
+		if err := rows.Scan(&id, &createdIP, &lastSeenIP); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a := account(id)
+		if ip := createdIP.String; userIPs[ip] != nil {
+			a.ips[ip] = true
+			a.addSignal(AltAccountSignalCreatedIP, ip, "Created from "+ip+".", crowded(ip))
+		}
+		if ip := lastSeenIP.String; userIPs[ip] != nil && !a.ips[ip] { // Not already a signal.
+			a.ips[ip] = true
+			a.addSignal(AltAccountSignalLastSeenIP, ip, "Last seen from "+ip+".", crowded(ip))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uid.ID, 0, len(accounts))
+	for id := range accounts {
+		ids = append(ids, id)
+	}
+	users, err := GetUsersByIDs(ctx, db, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	userCommunities, err := getUserCommunityNames(ctx, db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		a := accounts[u.ID]
+		a.User, a.CreatedIP, a.LastSeen, a.LastSeenIP = u, u.CreatedIP, u.LastSeen, u.LastSeenIP
+		if d := u.CreatedAt.Sub(user.CreatedAt).Abs(); d < altAccountsCreatedTogether {
+			a.addSignal(AltAccountSignalCreatedTogether, "", fmt.Sprintf("Created %s apart.", d.Round(time.Minute)), false)
+		}
+
+		communities, err := getUserCommunityNames(ctx, db, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		a.SharedCommunities = []string{}
+		for _, name := range communities {
+			if slices.Contains(userCommunities, name) {
+				a.SharedCommunities = append(a.SharedCommunities, name)
+			}
+		}
+		if union := len(userCommunities) + len(communities) - len(a.SharedCommunities); union > 0 && len(a.SharedCommunities) >= 3 {
+			ratio := float64(len(a.SharedCommunities)) / float64(union)
+			a.Signals = append(a.Signals, AltAccountSignal{
+				Type:   AltAccountSignalSharedCommunities,
+				Detail: fmt.Sprintf("%d shared communities (%.0f%% of all).", len(a.SharedCommunities), ratio*100),
+				Weight: AltAccountSignalSharedCommunities.weight() * ratio,
+			})
+		}
+
+		if a.VotesOnUser, err = countUpvotesOn(ctx, db, u.ID, user.ID); err != nil {
+			return nil, err
+		}
+		if a.VotesByUser, err = countUpvotesOn(ctx, db, user.ID, u.ID); err != nil {
+			return nil, err
+		}
+		if n := a.VotesOnUser + a.VotesByUser; n > 0 {
+			a.Signals = append(a.Signals, AltAccountSignal{
+				Type:   AltAccountSignalVotes,
+				Detail: fmt.Sprintf("%d upvotes on the user, %d upvotes by the user.", a.VotesOnUser, a.VotesByUser),
+				Weight: AltAccountSignalVotes.weight() * math.Min(1, float64(n)/10),
+			})
+		}
+
+		a.computeConfidence()
+		report.Accounts = append(report.Accounts, a)
+	}
+
+	slices.SortFunc(report.Accounts, func(a, b *AltAccount) int {
+		if a.Confidence != b.Confidence {
+			if a.Confidence > b.Confidence {
+				return -1
+			}
+			return 1
+		}
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	if len(report.Accounts) > maxAltAccountsReportAccounts {
+		report.Accounts = report.Accounts[:maxAltAccountsReportAccounts]
+	}
+	return report, nil
+}
+
+// getAltAccountCandidates returns the accounts, other than user, that share
+// any of the IP addresses ips (the recent addresses of user, as query
+// arguments) with user. At most maxAltAccountsReportCandidates accounts are
+// returned, those sharing the most addresses first.
+func getAltAccountCandidates(ctx context.Context, db *sql.DB, user uid.ID, ips []any) ([]uid.ID, error) {
+	in := msql.InClauseQuestionMarks(len(ips))
+	query := fmt.Sprintf(`
+		SELECT user_id
+		FROM (
+			SELECT user_id, ip FROM user_ips WHERE ip IN %s AND last_seen > ?
+			UNION ALL
+			SELECT id, created_ip FROM users WHERE created_ip IN %s
+			UNION ALL
+			SELECT id, last_seen_ip FROM users WHERE last_seen_ip IN %s
+		) AS shared
+		WHERE user_id <> ?
+		GROUP BY user_id
+		ORDER BY COUNT(DISTINCT ip) DESC
+		LIMIT ?`, in, in, in)
+	var args []any
+	args = append(append(args, ips...), time.Now().Add(-userIPsRetention))
+	args = append(append(args, ips...), ips...)
+	args = append(args, user, maxAltAccountsReportCandidates)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// getUserIPs returns the recent IP addresses of user, including the ones they
+// were created from and last seen from, the latest first.
+func getUserIPs(ctx context.Context, db *sql.DB, user *User) ([]*UserIP, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_ips.ip, user_ips.first_seen, user_ips.last_seen, (SELECT COUNT(*) FROM user_ips AS others WHERE others.ip = user_ips.ip)
+		FROM user_ips
+		WHERE user_ips.user_id = ? AND user_ips.last_seen > ?
+		ORDER BY user_ips.last_seen DESC
+		LIMIT ?`, user.ID, time.Now().Add(-userIPsRetention), maxAltAccountsReportIPs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ips := []*UserIP{}
+	seen := make(map[string]bool)
+	for rows.Next() {
+		ip := &UserIP{}
+		if err := rows.Scan(&ip.IP, &ip.FirstSeen, &ip.LastSeen, &ip.NumUsers); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+		seen[ip.IP] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, addr := range []*string{user.CreatedIP, user.LastSeenIP} {
+		if addr == nil || *addr == "" || seen[*addr] {
+			continue
+		}
+		ip := &UserIP{IP: *addr, FirstSeen: user.CreatedAt, LastSeen: user.LastSeen}
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE created_ip = ? OR last_seen_ip = ?", *addr, *addr).Scan(&ip.NumUsers); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+		seen[*addr] = true
+	}
+	return ips, nil
+}
+
+// getUserCommunityNames returns the names of the communities that user is a
+// member of.
+func getUserCommunityNames(ctx context.Context, db *sql.DB, user uid.ID) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT communities.name
+		FROM community_members
+		INNER JOIN communities ON communities.id = community_members.community_id
+		WHERE community_members.user_id = ?`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// countUpvotesOn returns the number of upvotes by voter on the posts and
+// comments of author.
+func countUpvotesOn(ctx context.Context, db *sql.DB, voter, author uid.ID) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM post_votes INNER JOIN posts ON posts.id = post_votes.post_id WHERE post_votes.user_id = ? AND post_votes.up = TRUE AND posts.user_id = ?)
+			+ (SELECT COUNT(*) FROM comment_votes INNER JOIN comments ON comments.id = comment_votes.comment_id WHERE comment_votes.user_id = ? AND comment_votes.up = TRUE AND comments.user_id = ?)`,
+		voter, author, voter, author).Scan(&n)
+	return n, err
+}
+
+// WriteCSV writes the accounts of r as CSV, with a header row, to w.
+func (r *AltAccountsReport) WriteCSV(w io.Writer) error {
+	ipString := func(ip *string) string {
+		if ip == nil {
+			return ""
+		}
+		return *ip
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"username", "id", "created_at", "created_ip", "last_seen", "last_seen_ip", "banned",
+		"confidence", "shared_ips", "signals", "shared_communities", "votes_on_user", "votes_by_user",
+	})
+	for _, a := range r.Accounts {
+		var signals []string
+		for _, s := range a.Signals {
+			signals = append(signals, fmt.Sprintf("%s (%.2f): %s", s.Type, s.Weight, s.Detail))
+		}
+		ips := make([]string, 0, len(a.ips))
+		for ip := range a.ips {
+			ips = append(ips, ip)
+		}
+		slices.Sort(ips)
+		cw.Write([]string{
+			a.User.Username,
+			a.User.ID.String(),
+			a.User.CreatedAt.Format(time.RFC3339),
+			ipString(a.CreatedIP),
+			a.LastSeen.Format(time.RFC3339),
+			ipString(a.LastSeenIP),
+			strconv.FormatBool(a.User.Banned),
+			strconv.FormatFloat(a.Confidence, 'f', 2, 64),
+			strings.Join(ips, " "),
+			strings.Join(signals, "; "),
+			strings.Join(a.SharedCommunities, " "),
+			strconv.Itoa(a.VotesOnUser),
+			strconv.Itoa(a.VotesByUser),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// PruneUserIPs deletes the IP addresses of users that weren't seen for a long
+// while.
+func PruneUserIPs(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM user_ips WHERE last_seen < ?", time.Now().Add(-userIPsRetention))
+	return err
+}
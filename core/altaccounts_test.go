@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestAltAccountConfidence(t *testing.T) {
+	cases := []struct {
+		signals []AltAccountSignalType
+		crowded bool
+		want    float64
+	}{
+		{nil, false, 0},
+		{[]AltAccountSignalType{AltAccountSignalCreatedIP}, false, 0.5},
+		{[]AltAccountSignalType{AltAccountSignalCreatedIP, AltAccountSignalTimeOverlap}, false, 0.75},
+		{[]AltAccountSignalType{AltAccountSignalCreatedIP}, true, 0.13},
+		{[]AltAccountSignalType{AltAccountSignalSessionIP, AltAccountSignalCreatedTogether}, false, 0.36},
+	}
+	for _, c := range cases {
+		a := &AltAccount{}
+		for _, s := range c.signals {
+			a.addSignal(s, "192.0.2.1", "", c.crowded)
+		}
+		a.computeConfidence()
+		if a.Confidence != c.want {
+			t.Errorf("signals %v (crowded: %v): got confidence %v, want %v", c.signals, c.crowded, a.Confidence, c.want)
+		}
+	}
+}
+
+func TestAltAccountsReportWriteCSV(t *testing.T) {
+	ip := "192.0.2.1"
+	a := &AltAccount{
+		User:              &User{Username: "alt"},
+		CreatedIP:         &ip,
+		SharedCommunities: []string{"golang", "news"},
+		VotesOnUser:       3,
+		ips:               map[string]bool{ip: true},
+	}
+	a.addSignal(AltAccountSignalCreatedIP, ip, "Created from "+ip+".", false)
+	a.computeConfidence()
+
+	var buf bytes.Buffer
+	if err := (&AltAccountsReport{Accounts: []*AltAccount{a}}).WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	header, row := records[0], records[1]
+	want := map[string]string{
+		"username":           "alt",
+		"created_ip":         ip,
+		"last_seen_ip":       "",
+		"confidence":         "0.50",
+		"shared_ips":         ip,
+		"shared_communities": "golang news",
+		"votes_on_user":      "3",
+	}
+	for i, col := range header {
+		if v, ok := want[col]; ok && row[i] != v {
+			t.Errorf("column %s: got %q, want %q", col, row[i], v)
+		}
+	}
+}
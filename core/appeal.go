@@ -0,0 +1,462 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxBanAppealMessageLength  = 2000 // in runes
+	maxBanAppealResponseLength = 2000 // in runes
+)
+
+var (
+	errNotBanned = httperr.NewBadRequest("not_banned", "You are not banned.")
+
+	errBanAppealExists = &httperr.Error{
+		HTTPStatus: http.StatusConflict,
+		Code:       "appeal_exists",
+		Message:    "You have already appealed this ban.",
+	}
+	errBanAppealReviewed = &httperr.Error{
+		HTTPStatus: http.StatusConflict,
+		Code:       "appeal_reviewed",
+		Message:    "The appeal has already been reviewed.",
+	}
+)
+
+// BanAppealType is the kind of ban that's appealed.
+type BanAppealType int
+
+const (
+	BanAppealTypeCommunity = BanAppealType(iota) // Appealed to the mods of the community.
+	BanAppealTypeSite                            // Appealed to the admins.
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (t BanAppealType) MarshalText() ([]byte, error) {
+	switch t {
+	case BanAppealTypeCommunity:
+		return []byte("community"), nil
+	case BanAppealTypeSite:
+		return []byte("site"), nil
+	}
+	return nil, fmt.Errorf("unknown ban appeal type: %d", t)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (t *BanAppealType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "community":
+		*t = BanAppealTypeCommunity
+	case "site":
+		*t = BanAppealTypeSite
+	default:
+		return fmt.Errorf("unknown ban appeal type: %s", text)
+	}
+	return nil
+}
+
+// BanAppealStatus is the state of the review of a ban appeal.
+type BanAppealStatus int
+
+const (
+	BanAppealStatusPending  = BanAppealStatus(iota)
+	BanAppealStatusAccepted // The user was unbanned.
+	BanAppealStatusDenied
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s BanAppealStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case BanAppealStatusPending:
+		return []byte("pending"), nil
+	case BanAppealStatusAccepted:
+		return []byte("accepted"), nil
+	case BanAppealStatusDenied:
+		return []byte("denied"), nil
+	}
+	return nil, fmt.Errorf("unknown ban appeal status: %d", s)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *BanAppealStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "pending":
+		*s = BanAppealStatusPending
+	case "accepted":
+		*s = BanAppealStatusAccepted
+	case "denied":
+		*s = BanAppealStatusDenied
+	default:
+		return httperr.NewBadRequest("invalid-appeal-status", "Invalid ban appeal status.")
+	}
+	return nil
+}
+
+// BanAppeal is an appeal, by a banned user, of a ban from a community or of a
+// site-wide ban. A ban may be appealed only once (see createBanAppeal).
+type BanAppeal struct {
+	ID   int           `json:"id"`
+	Type BanAppealType `json:"type"`
+
+	// BanID is the ID of the community ban (in the community_banned table)
+	// or of the suspension (see UserSuspension) appealed. It's 0 for site
+	// bans made without a suspension.
+	BanID int `json:"banId"`
+
+	UserID   uid.ID `json:"userId"`
+	Username string `json:"username"`
+
+	// CommunityID and CommunityName are set only for community ban appeals.
+	CommunityID   uid.NullID      `json:"communityId"`
+	CommunityName msql.NullString `json:"communityName"`
+
+	Message string          `json:"message"`
+	Status  BanAppealStatus `json:"status"`
+
+	// Response is the message of the reviewer to the user, if any.
+	Response   msql.NullString `json:"response"`
+	ReviewedBy uid.NullID      `json:"reviewedBy"`
+	ReviewedAt msql.NullTime   `json:"reviewedAt"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+const selectBanAppealsQuery = `
+	SELECT
+		ban_appeals.id,
+		ban_appeals.ban_type,
+		ban_appeals.ban_id,
+		ban_appeals.user_id,
+		users.username,
+		ban_appeals.community_id,
+		communities.name,
+		ban_appeals.message,
+		ban_appeals.status,
+		ban_appeals.response,
+		ban_appeals.reviewed_by,
+		ban_appeals.reviewed_at,
+		ban_appeals.created_at
+	FROM ban_appeals
+	INNER JOIN users ON users.id = ban_appeals.user_id
+	LEFT JOIN communities ON communities.id = ban_appeals.community_id `
+
+func selectBanAppeals(ctx context.Context, db *sql.DB, where string, args ...any) ([]*BanAppeal, error) {
+	rows, err := db.QueryContext(ctx, selectBanAppealsQuery+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appeals := []*BanAppeal{}
+	for rows.Next() {
+		a := &BanAppeal{}
+		err := rows.Scan(
+			&a.ID,
+			&a.Type,
+			&a.BanID,
+			&a.UserID,
+			&a.Username,
+			&a.CommunityID,
+			&a.CommunityName,
+			&a.Message,
+			&a.Status,
+			&a.Response,
+			&a.ReviewedBy,
+			&a.ReviewedAt,
+			&a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		appeals = append(appeals, a)
+	}
+	return appeals, rows.Err()
+}
+
+// GetBanAppeal returns the ban appeal with id.
+func GetBanAppeal(ctx context.Context, db *sql.DB, id int) (*BanAppeal, error) {
+	appeals, err := selectBanAppeals(ctx, db, "WHERE ban_appeals.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(appeals) == 0 {
+		return nil, httperr.NewNotFound("appeal-not-found", "Ban appeal not found.")
+	}
+	return appeals[0], nil
+}
+
+// GetCommunityBanAppeals returns the appeals of bans from community with
+// status, the latest first. The next returned is for fetching the next page of
+// appeals.
+func GetCommunityBanAppeals(ctx context.Context, db *sql.DB, community uid.ID, status BanAppealStatus, limit int, next *string) ([]*BanAppeal, *string, error) {
+	return getBanAppeals(ctx, db, "WHERE ban_appeals.community_id = ? AND ban_appeals.status = ? ", []any{community, status}, limit, next)
+}
+
+// GetSiteBanAppeals returns the appeals of site-wide bans with status, the
+// latest first. The next returned is for fetching the next page of appeals.
+func GetSiteBanAppeals(ctx context.Context, db *sql.DB, status BanAppealStatus, limit int, next *string) ([]*BanAppeal, *string, error) {
+	return getBanAppeals(ctx, db, "WHERE ban_appeals.ban_type = ? AND ban_appeals.status = ? ", []any{BanAppealTypeSite, status}, limit, next)
+}
+
+func getBanAppeals(ctx context.Context, db *sql.DB, where string, args []any, limit int, next *string) ([]*BanAppeal, *string, error) {
+	if next != nil {
+		nextID, err := strconv.Atoi(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-next", "Invalid next.")
+		}
+		where += "AND ban_appeals.id <= ? "
+		args = append(args, nextID)
+	}
+	args = append(args, limit+1)
+
+	appeals, err := selectBanAppeals(ctx, db, where+"ORDER BY ban_appeals.id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(appeals) > limit {
+		nextNext = new(string)
+		*nextNext = strconv.Itoa(appeals[limit].ID)
+		appeals = appeals[:limit]
+	}
+	return appeals, nextNext, nil
+}
+
+// communityBanID returns the ID of the ban of user from community, or 0 if
+// user is not banned from community. Expired bans are lifted.
+func communityBanID(ctx context.Context, db *sql.DB, community, user uid.ID) (int, error) {
+	if banned, err := IsUserBannedFromCommunity(ctx, db, community, user); err != nil || !banned {
+		return 0, err
+	}
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM community_banned WHERE community_id = ? AND user_id = ?", community, user).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// siteBanID returns the ID of the suspension of user (0 if user was banned
+// without one), and whether user is banned from the site at all. An expired
+// suspension is lifted.
+func siteBanID(ctx context.Context, db *sql.DB, user *User) (int, bool, error) {
+	if !user.Banned {
+		return 0, false, nil
+	}
+	s, err := GetActiveSuspension(ctx, db, user.ID)
+	if err != nil || s == nil {
+		return 0, err == nil, err
+	}
+	if s.expired(time.Now()) {
+		return 0, false, liftExpiredSuspension(ctx, db, s.ID, user.ID)
+	}
+	return s.ID, true, nil
+}
+
+// createBanAppeal creates a. A ban may be appealed only once. Since site bans
+// made without a suspension all have a BanID of 0, such bans are told apart by
+// bannedAt, the time of the ban, which is otherwise unused.
+func createBanAppeal(ctx context.Context, db *sql.DB, a *BanAppeal, bannedAt time.Time) (*BanAppeal, error) {
+	a.Message = utils.TruncateUnicodeString(strings.TrimSpace(a.Message), maxBanAppealMessageLength)
+	if a.Message == "" {
+		return nil, httperr.NewBadRequest("empty-appeal", "The appeal message cannot be empty.")
+	}
+
+	var id int64
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		// Locks the row of the user, so that concurrent appeals of the same
+		// ban cannot both pass the check below.
+		var locked uid.ID
+		if err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ? FOR UPDATE", a.UserID).Scan(&locked); err != nil {
+			return err
+		}
+		query := "SELECT COUNT(*) FROM ban_appeals WHERE ban_type = ? AND ban_id = ? AND user_id = ?"
+		args := []any{a.Type, a.BanID, a.UserID}
+		if a.BanID == 0 {
+			query += " AND created_at >= ?"
+			args = append(args, bannedAt)
+		}
+		var n int
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return errBanAppealExists
+		}
+
+		query, args = msql.BuildInsertQuery("ban_appeals", []msql.ColumnValue{
+			{Name: "ban_type", Value: a.Type},
+			{Name: "ban_id", Value: a.BanID},
+			{Name: "user_id", Value: a.UserID},
+			{Name: "community_id", Value: a.CommunityID},
+			{Name: "message", Value: a.Message},
+		})
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetBanAppeal(ctx, db, int(id))
+}
+
+// CreateCommunityBanAppeal creates an appeal, by user, of the ban of user from
+// community.
+func CreateCommunityBanAppeal(ctx context.Context, db *sql.DB, community *Community, user uid.ID, message string) (*BanAppeal, error) {
+	banID, err := communityBanID(ctx, db, community.ID, user)
+	if err != nil {
+		return nil, err
+	}
+	if banID == 0 {
+		return nil, errNotBanned
+	}
+	return createBanAppeal(ctx, db, &BanAppeal{
+		Type:        BanAppealTypeCommunity,
+		BanID:       banID,
+		UserID:      user,
+		CommunityID: uid.NullID{ID: community.ID, Valid: true},
+		Message:     message,
+	}, time.Time{})
+}
+
+// CreateSiteBanAppeal creates an appeal, by user, of the site-wide ban of
+// user.
+func CreateSiteBanAppeal(ctx context.Context, db *sql.DB, user *User, message string) (*BanAppeal, error) {
+	banID, banned, err := siteBanID(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+	if !banned {
+		return nil, errNotBanned
+	}
+	return createBanAppeal(ctx, db, &BanAppeal{
+		Type:    BanAppealTypeSite,
+		BanID:   banID,
+		UserID:  user.ID,
+		Message: message,
+	}, user.BannedAt.Time)
+}
+
+// CanReview reports whether user may accept or deny the appeal: the mods of
+// the community (and the admins) for community bans, and the admins for site
+// bans.
+func (a *BanAppeal) CanReview(ctx context.Context, db *sql.DB, user uid.ID) (bool, error) {
+	if a.Type == BanAppealTypeCommunity {
+		return UserModOrAdmin(ctx, db, a.CommunityID.ID, user)
+	}
+	return IsAdmin(db, &user)
+}
+
+// Accept lifts the appealed ban, if it's still in effect, and sends a
+// notification to the user. The response, which is optional, is shown to the
+// user.
+func (a *BanAppeal) Accept(ctx context.Context, db *sql.DB, reviewer uid.ID, response string) error {
+	if err := a.checkReviewable(ctx, db, reviewer); err != nil {
+		return err
+	}
+
+	// The user may since have been unbanned (or banned again, in which case
+	// the new ban is left alone).
+	switch a.Type {
+	case BanAppealTypeCommunity:
+		banID, err := communityBanID(ctx, db, a.CommunityID.ID, a.UserID)
+		if err != nil {
+			return err
+		}
+		if banID == a.BanID {
+			community, err := GetCommunityByID(ctx, db, a.CommunityID.ID, nil)
+			if err != nil {
+				return err
+			}
+			if err := community.UnbanUser(ctx, db, reviewer, a.UserID); err != nil {
+				return err
+			}
+		}
+	case BanAppealTypeSite:
+		user, err := GetUser(ctx, db, a.UserID, nil)
+		if err != nil {
+			return err
+		}
+		banID, banned, err := siteBanID(ctx, db, user)
+		if err != nil {
+			return err
+		}
+		if banned && banID == a.BanID {
+			if err := user.LiftSuspension(ctx, db, reviewer); err != nil {
+				return err
+			}
+		}
+	}
+
+	return a.setReviewed(ctx, db, BanAppealStatusAccepted, reviewer, response)
+}
+
+// Deny marks the appeal as denied, and sends a notification, with response, to
+// the user.
+func (a *BanAppeal) Deny(ctx context.Context, db *sql.DB, reviewer uid.ID, response string) error {
+	if strings.TrimSpace(response) == "" {
+		return httperr.NewBadRequest("empty-response", "A message is required to deny an appeal.")
+	}
+	if err := a.checkReviewable(ctx, db, reviewer); err != nil {
+		return err
+	}
+	return a.setReviewed(ctx, db, BanAppealStatusDenied, reviewer, response)
+}
+
+func (a *BanAppeal) checkReviewable(ctx context.Context, db *sql.DB, reviewer uid.ID) error {
+	if ok, err := a.CanReview(ctx, db, reviewer); err != nil {
+		return err
+	} else if !ok {
+		return errNotMod
+	}
+	if a.Status != BanAppealStatusPending {
+		return errBanAppealReviewed
+	}
+	return nil
+}
+
+func (a *BanAppeal) setReviewed(ctx context.Context, db *sql.DB, status BanAppealStatus, reviewer uid.ID, response string) error {
+	var resp msql.NullString
+	if response = strings.TrimSpace(response); response != "" {
+		resp = msql.NewNullString(utils.TruncateUnicodeString(response, maxBanAppealResponseLength))
+	}
+	now := time.Now()
+	res, err := db.ExecContext(ctx, "UPDATE ban_appeals SET status = ?, response = ?, reviewed_by = ?, reviewed_at = ? WHERE id = ? AND status = ?",
+		status, resp, reviewer, now, a.ID, BanAppealStatusPending)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errBanAppealReviewed
+	}
+
+	a.Status = status
+	a.Response = resp
+	a.ReviewedBy = uid.NullID{ID: reviewer, Valid: true}
+	a.ReviewedAt = msql.NewNullTime(now)
+
+	go func() {
+		if err := createBanAppealNotification(context.Background(), db, a); err != nil {
+			log.Println("Failed to create ban_appeal notification: ", err)
+		}
+	}()
+	return nil
+}
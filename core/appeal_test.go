@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+func TestBanAppealStatusText(t *testing.T) {
+	for _, s := range []BanAppealStatus{BanAppealStatusPending, BanAppealStatusAccepted, BanAppealStatusDenied} {
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got BanAppealStatus
+		if err := got.UnmarshalText(text); err != nil || got != s {
+			t.Errorf("status %d round-tripped (via %q) to %d (error: %v)", s, text, got, err)
+		}
+	}
+	var s BanAppealStatus
+	if err := s.UnmarshalText([]byte("lifted")); err == nil {
+		t.Error("invalid status unmarshaled without error")
+	}
+}
+
+func TestNotificationBanAppealView(t *testing.T) {
+	cases := []struct {
+		n         *NotificationBanAppeal
+		title, to string
+	}{
+		{
+			&NotificationBanAppeal{Type: BanAppealTypeCommunity, CommunityName: "golang", Accepted: true},
+			"Your appeal of your ban from **golang** was **accepted**", "/golang",
+		},
+		{
+			&NotificationBanAppeal{Type: BanAppealTypeSite, Response: msql.NewNullString("No.")},
+			"Your appeal of your site ban was **denied**", "/",
+		},
+	}
+	for _, c := range cases {
+		view, err := c.n.view(context.Background(), nil, TextFormatsMarkdown)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if view.Title != c.title || view.ToURL != c.to || view.Body != c.n.Response.String {
+			t.Errorf("got view %q (%s, body %q), want %q (%s, body %q)", view.Title, view.ToURL, view.Body, c.title, c.to, c.n.Response.String)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+var errBackgroundTaskNotFound = httperr.NewNotFound("task/not-found", "Background task not found.")
+
+// BackgroundTask is the last recorded state of a background task, as stored in
+// the background_tasks table. The table is kept in sync with the running
+// tasks by the server, and the paused and run_requested_at columns are used
+// to control the tasks from outside the server process.
+type BackgroundTask struct {
+	Name           string          `json:"name"`
+	Schedule       string          `json:"schedule"`
+	Paused         bool            `json:"paused"`
+	Running        bool            `json:"running"`
+	LastRunAt      msql.NullTime   `json:"lastRunAt"`
+	LastRunTookMs  int             `json:"lastRunTookMs"`
+	LastError      msql.NullString `json:"lastError"`
+	LastErrorAt    msql.NullTime   `json:"lastErrorAt"`
+	NextRunAt      msql.NullTime   `json:"nextRunAt"`
+	RunRequestedAt msql.NullTime   `json:"runRequestedAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+}
+
+var selectBackgroundTaskCols = []string{
+	"name",
+	"schedule",
+	"paused",
+	"running",
+	"last_run_at",
+	"last_run_took_ms",
+	"last_error",
+	"last_error_at",
+	"next_run_at",
+	"run_requested_at",
+	"updated_at",
+}
+
+// GetBackgroundTasks returns all the background tasks, ordered by name.
+func GetBackgroundTasks(ctx context.Context, db *sql.DB) ([]*BackgroundTask, error) {
+	query := msql.BuildSelectQuery("background_tasks", selectBackgroundTaskCols, nil, "ORDER BY name")
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanBackgroundTasks(rows)
+}
+
+// GetBackgroundTask returns the background task named name.
+func GetBackgroundTask(ctx context.Context, db *sql.DB, name string) (*BackgroundTask, error) {
+	query := msql.BuildSelectQuery("background_tasks", selectBackgroundTaskCols, nil, "WHERE name = ?")
+	rows, err := db.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanBackgroundTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, errBackgroundTaskNotFound
+	}
+	return tasks[0], nil
+}
+
+func scanBackgroundTasks(rows *sql.Rows) ([]*BackgroundTask, error) {
+	defer rows.Close()
+
+	var tasks []*BackgroundTask
+	for rows.Next() {
+		t := &BackgroundTask{}
+		if err := rows.Scan(
+			&t.Name,
+			&t.Schedule,
+			&t.Paused,
+			&t.Running,
+			&t.LastRunAt,
+			&t.LastRunTookMs,
+			&t.LastError,
+			&t.LastErrorAt,
+			&t.NextRunAt,
+			&t.RunRequestedAt,
+			&t.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// SaveBackgroundTaskStatus inserts or updates the runtime status of the task
+// t. The paused and run_requested_at columns are left untouched.
+func SaveBackgroundTaskStatus(ctx context.Context, db *sql.DB, t *BackgroundTask) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO background_tasks (name, schedule, running, last_run_at, last_run_took_ms, last_error, last_error_at, next_run_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			schedule = VALUES(schedule),
+			running = VALUES(running),
+			last_run_at = VALUES(last_run_at),
+			last_run_took_ms = VALUES(last_run_took_ms),
+			last_error = VALUES(last_error),
+			last_error_at = VALUES(last_error_at),
+			next_run_at = VALUES(next_run_at),
+			updated_at = VALUES(updated_at)`,
+		t.Name, t.Schedule, t.Running, t.LastRunAt, t.LastRunTookMs, t.LastError, t.LastErrorAt, t.NextRunAt, time.Now())
+	return err
+}
+
+// SetBackgroundTaskPaused pauses (or resumes, if paused is false) the
+// background task named name. The running server picks up the change within a
+// few seconds.
+func SetBackgroundTaskPaused(ctx context.Context, db *sql.DB, name string, paused bool) error {
+	res, err := db.ExecContext(ctx, "UPDATE background_tasks SET paused = ? WHERE name = ?", paused, name)
+	if err != nil {
+		return err
+	}
+	return backgroundTaskAffected(ctx, db, res, name)
+}
+
+// RequestBackgroundTaskRun asks the running server to run the background task
+// named name as soon as possible.
+func RequestBackgroundTaskRun(ctx context.Context, db *sql.DB, name string) error {
+	res, err := db.ExecContext(ctx, "UPDATE background_tasks SET run_requested_at = ? WHERE name = ?", time.Now(), name)
+	if err != nil {
+		return err
+	}
+	return backgroundTaskAffected(ctx, db, res, name)
+}
+
+// ClearBackgroundTaskRunRequest clears the run request of the task named name,
+// if it was made at or before t.
+func ClearBackgroundTaskRunRequest(ctx context.Context, db *sql.DB, name string, t time.Time) error {
+	_, err := db.ExecContext(ctx, "UPDATE background_tasks SET run_requested_at = NULL WHERE name = ? AND run_requested_at <= ?", name, t)
+	return err
+}
+
+func backgroundTaskAffected(ctx context.Context, db *sql.DB, res sql.Result, name string) error {
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+	// MySQL doesn't count rows that matched but weren't changed.
+	_, err := GetBackgroundTask(ctx, db, name)
+	return err
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core/sitesettings"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// maxLinkPosts is the maximum number of posts returned by getLinkPosts.
+const maxLinkPosts = 100
+
+var errDuplicateLink = &httperr.Error{
+	HTTPStatus: http.StatusConflict,
+	Code:       "post/duplicate-link",
+	Message:    "This link was posted in this community recently.",
+}
+
+// trackingParams are query parameters that are removed from the links of link
+// posts. A key ending with '*' matches every key with that prefix.
+var trackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+	"_hsenc",
+	"_hsmi",
+	"mkt_tok",
+	"oly_anon_id",
+	"oly_enc_id",
+	"vero_id",
+	"ref_src",
+	"ref_url",
+}
+
+// hostTrackingParams are tracking parameters that are removed only from the
+// links of the given hosts (because elsewhere they might mean something else).
+var hostTrackingParams = map[string][]string{
+	"youtube.com":      {"si", "feature", "pp"},
+	"open.spotify.com": {"si"},
+	"twitter.com":      {"s", "t"},
+	"x.com":            {"s", "t"},
+	"instagram.com":    {"igsh"},
+}
+
+// hostAliases maps hosts to the host that's the canonical form of them.
+var hostAliases = map[string]string{
+	"m.youtube.com":      "www.youtube.com",
+	"music.youtube.com":  "www.youtube.com",
+	"youtube.com":        "www.youtube.com",
+	"mobile.twitter.com": "twitter.com",
+	"m.facebook.com":     "www.facebook.com",
+	"old.reddit.com":     "www.reddit.com",
+	"np.reddit.com":      "www.reddit.com",
+	"m.reddit.com":       "www.reddit.com",
+	"reddit.com":         "www.reddit.com",
+}
+
+// isTrackingParam reports whether the query parameter key of a link of host is
+// a tracking parameter.
+func isTrackingParam(host, key string) bool {
+	key = strings.ToLower(key)
+	match := func(params []string) bool {
+		for _, p := range params {
+			if p == key || (strings.HasSuffix(p, "*") && strings.HasPrefix(key, p[:len(p)-1])) {
+				return true
+			}
+		}
+		return false
+	}
+	return match(trackingParams) || match(hostTrackingParams[strings.TrimPrefix(host, "www.")])
+}
+
+// canonicalURL returns the canonical form of the absolute URL u: the scheme
+// and the host are lower-cased, default ports and tracking parameters are
+// removed, known short and mobile forms of URLs are expanded to their full
+// forms, and the remaining query parameters are sorted.
+func canonicalURL(u *url.URL) *url.URL {
+	c := *u
+	c.User = nil
+	c.Scheme = strings.ToLower(c.Scheme)
+	host, port := strings.ToLower(c.Hostname()), c.Port()
+	if (c.Scheme == "http" && port == "80") || (c.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	host = strings.TrimSuffix(host, ".")
+	if alias, ok := hostAliases[host]; ok {
+		host = alias
+	}
+	if strings.HasSuffix(host, ".m.wikipedia.org") {
+		host = strings.TrimSuffix(host, ".m.wikipedia.org") + ".wikipedia.org"
+	}
+
+	query := c.RawQuery
+
+	// Short forms.
+	switch host {
+	case "youtu.be":
+		if id := strings.Trim(c.Path, "/"); id != "" && !strings.Contains(id, "/") {
+			host, c.Path, c.RawPath = "www.youtube.com", "/watch", ""
+			query = "v=" + url.QueryEscape(id) + "&" + query
+		}
+	case "www.youtube.com":
+		if id, ok := strings.CutPrefix(c.Path, "/shorts/"); ok && id != "" && !strings.Contains(id, "/") {
+			c.Path, c.RawPath = "/watch", ""
+			query = "v=" + url.QueryEscape(id) + "&" + query
+		}
+	case "redd.it":
+		if id := strings.Trim(c.Path, "/"); id != "" && !strings.Contains(id, "/") {
+			host, c.Path, c.RawPath = "www.reddit.com", "/comments/"+id, ""
+		}
+	}
+
+	if port != "" {
+		host += ":" + port
+	}
+	c.Host = host
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	// Hash-bang and hash-router fragments are a part of the address of the
+	// page, others aren't.
+	if !strings.HasPrefix(c.Fragment, "!") && !strings.HasPrefix(c.Fragment, "/") {
+		c.Fragment, c.RawFragment = "", ""
+	}
+
+	// Query parameters are filtered and sorted without decoding and
+	// re-encoding them, which could change their meaning.
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		if param == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if !isTrackingParam(c.Hostname(), key) {
+			params = append(params, param)
+		}
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		ki, _, _ := strings.Cut(params[i], "=")
+		kj, _, _ := strings.Cut(params[j], "=")
+		return ki < kj
+	})
+	c.RawQuery = strings.Join(params, "&")
+	c.ForceQuery = false
+	return &c
+}
+
+// linkHash returns the key by which the links of link posts are compared for
+// duplicates. u must be a canonical URL (see canonicalURL). Links that differ
+// only in their scheme, a "www." prefix of the host, or a trailing slash of
+// the path have the same key.
+func linkHash(u *url.URL) []byte {
+	c := *u
+	c.Scheme = ""
+	c.Host = strings.TrimPrefix(c.Host, "www.")
+	if c.Path != "/" {
+		c.Path = strings.TrimSuffix(path.Clean(c.Path), "/")
+	}
+	sum := sha256.Sum256([]byte(c.String()))
+	return sum[:]
+}
+
+// getLinkPosts returns the undeleted posts, latest first, whose link has the
+// hash (see linkHash). If community is not nil, only the posts of the
+// community, and if since is not zero, only the posts created after since,
+// are returned. The post exclude, if not nil, is left out. If community is
+// nil, the posts in private communities that viewer is not a member of are
+// left out too.
+func getLinkPosts(ctx context.Context, db *sql.DB, hash []byte, community *uid.ID, since time.Time, exclude *uid.ID, viewer *uid.ID) ([]*Post, error) {
+	query, args := "SELECT id FROM posts WHERE link_hash = ? AND deleted = FALSE", []any{hash}
+	if community != nil {
+		query += " AND community_id = ?"
+		args = append(args, *community)
+	} else {
+		hidden, hiddenArgs := hiddenCommunitiesQuery(viewer)
+		query += fmt.Sprintf(" AND community_id NOT IN (%s)", hidden)
+		args = append(args, hiddenArgs...)
+	}
+	if !since.IsZero() {
+		query += " AND created_at > ?"
+		args = append(args, since)
+	}
+	if exclude != nil {
+		query += " AND id <> ?"
+		args = append(args, *exclude)
+	}
+	query += " ORDER BY created_at DESC LIMIT ?"
+	args = append(args, maxLinkPosts)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*Post{}, nil
+	}
+
+	posts, err := GetPostsByIDs(ctx, db, viewer, false, ids...)
+	if err != nil && err != errPostNotFound {
+		return nil, err
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+	return posts, nil
+}
+
+// CheckDuplicateLink returns an error if link was posted in community within
+// the duplicate link window (see
+// sitesettings.SiteSettings.DuplicateLinkWindow).
+func CheckDuplicateLink(ctx context.Context, db *sql.DB, community uid.ID, link string) error {
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return err
+	}
+	window := settings.DuplicateLinkPeriod()
+	if window == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Hostname() == "" {
+		return nil // CreateLinkPost deals with it.
+	}
+	posts, err := getLinkPosts(ctx, db, linkHash(canonicalURL(u)), &community, time.Now().Add(-window), nil, nil)
+	if err != nil {
+		return err
+	}
+	if len(posts) > 0 {
+		return errDuplicateLink
+	}
+	return nil
+}
+
+// GetOtherDiscussions returns the other posts, in all communities, of the link
+// of the link post p.
+func (p *Post) GetOtherDiscussions(ctx context.Context, db *sql.DB, viewer *uid.ID) ([]*Post, error) {
+	if p.Type != PostTypeLink || p.Link == nil {
+		return []*Post{}, nil
+	}
+	u, err := url.Parse(p.Link.URL)
+	if err != nil {
+		return []*Post{}, nil
+	}
+	return getLinkPosts(ctx, db, linkHash(canonicalURL(u)), nil, time.Time{}, &p.ID, viewer)
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"HTTPS://Example.COM", "https://example.com/"},
+		{"http://example.com:80/a?b=1", "http://example.com/a?b=1"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"https://example.com/a?utm_source=x&id=5&fbclid=abc&UTM_Medium=y", "https://example.com/a?id=5"},
+		{"https://example.com/a?z=1&a=2&m=3", "https://example.com/a?a=2&m=3&z=1"},
+		{"https://example.com/a?q=a%20b&si=1", "https://example.com/a?q=a%20b&si=1"},
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://example.com/#/route", "https://example.com/#/route"},
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc&t=42", "https://www.youtube.com/watch?t=42&v=dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/shorts/abc123", "https://www.youtube.com/watch?v=abc123"},
+		{"https://redd.it/abc12", "https://www.reddit.com/comments/abc12"},
+		{"https://en.m.wikipedia.org/wiki/Go", "https://en.wikipedia.org/wiki/Go"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := canonicalURL(u).String(); got != test.want {
+			t.Errorf("canonicalURL(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestLinkHash(t *testing.T) {
+	hash := func(s string) []byte {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return linkHash(canonicalURL(u))
+	}
+	same := [][2]string{
+		{"http://www.example.com/news/1/", "https://example.com/news/1?utm_campaign=x"},
+		{"https://youtu.be/abc", "https://www.youtube.com/watch?v=abc"},
+	}
+	for _, s := range same {
+		if !bytes.Equal(hash(s[0]), hash(s[1])) {
+			t.Errorf("linkHash of %q and %q differ", s[0], s[1])
+		}
+	}
+	if bytes.Equal(hash("https://example.com/news/1"), hash("https://example.com/news/2")) {
+		t.Error("linkHash of different links are equal")
+	}
+}
@@ -57,6 +57,68 @@ func (t *ContentType) UnmarshalText(data []byte) error {
 	return nil
 }
 
+// CommentSort represents how the comments of a post are to be sorted.
+type CommentSort int
+
+const (
+	CommentSortTop = CommentSort(iota)
+	CommentSortNew
+	CommentSortOld
+	CommentSortControversial
+	CommentSortBest
+
+	// CommentSortQA puts the comments of the author of the post and of the
+	// mods of the community (the answers) before the rest, and then sorts by
+	// upvotes.
+	CommentSortQA
+)
+
+// Valid reports whether s is a valid CommentSort.
+func (s CommentSort) Valid() bool {
+	_, err := s.MarshalText()
+	return err == nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s CommentSort) MarshalText() ([]byte, error) {
+	switch s {
+	case CommentSortTop:
+		return []byte("top"), nil
+	case CommentSortNew:
+		return []byte("new"), nil
+	case CommentSortOld:
+		return []byte("old"), nil
+	case CommentSortControversial:
+		return []byte("controversial"), nil
+	case CommentSortBest:
+		return []byte("best"), nil
+	case CommentSortQA:
+		return []byte("qa"), nil
+	}
+	return nil, fmt.Errorf("cannot marshal unsupported CommentSort (%v)", int(s))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *CommentSort) UnmarshalText(text []byte) error {
+	switch t := string(text); t {
+	case "top":
+		*s = CommentSortTop
+	case "new":
+		*s = CommentSortNew
+	case "old":
+		*s = CommentSortOld
+	case "controversial":
+		*s = CommentSortControversial
+	case "best":
+		*s = CommentSortBest
+	case "qa":
+		*s = CommentSortQA
+	default:
+		return fmt.Errorf("cannot unmarshal unsupported CommentSort: %v", t)
+	}
+	return nil
+}
+
 // Comment is a comment of a post.
 type Comment struct {
 	ID               uid.ID        `json:"id"`
@@ -78,6 +140,8 @@ type Comment struct {
 	Upvotes          int           `json:"upvotes"`
 	Downvotes        int           `json:"downvotes"`
 	Points           int           `json:"-"`
+	Controversy      int           `json:"-"`
+	Best             int           `json:"-"`
 	CreatedAt        time.Time     `json:"createdAt"`
 	EditedAt         msql.NullTime `json:"editedAt"`
 
@@ -95,6 +159,9 @@ type Comment struct {
 
 	Author *User `json:"author,omitempty"`
 
+	// The author's user flair in the community.
+	AuthorFlair *Flair `json:"authorFlair"`
+
 	// Reports whether the author of this comment is muted by the viewer.
 	IsAuthorMuted bool `json:"isAuthorMuted,omitempty"`
 
@@ -126,6 +193,8 @@ func buildSelectCommentsQuery(loggedIn bool, where string) string {
 		"comments.upvotes",
 		"comments.downvotes",
 		"comments.points",
+		"comments.controversy",
+		"comments.best",
 		"comments.created_at",
 		"comments.edited_at",
 		"comments.deleted_at",
@@ -141,8 +210,24 @@ func buildSelectCommentsQuery(loggedIn bool, where string) string {
 }
 
 // Get comment returns a comment. If viewer is nil, viewer related fields of the
-// comment (like Comment.ViewerVoted) will be nil.
+// comment (like Comment.ViewerVoted) will be nil. If the comment is in a
+// private community that viewer cannot view, an error is returned.
 func GetComment(ctx context.Context, db *sql.DB, id uid.ID, viewer *uid.ID) (*Comment, error) {
+	comment, err := getComment(ctx, db, id, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := userCanViewCommunity(ctx, db, comment.CommunityID, viewer); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errCommunityPrivate
+	}
+	return comment, nil
+}
+
+// getComment is like GetComment, but it doesn't check whether viewer can view
+// the comment.
+func getComment(ctx context.Context, db *sql.DB, id uid.ID, viewer *uid.ID) (*Comment, error) {
 	var (
 		query = buildSelectCommentsQuery(viewer != nil, "WHERE comments.id = ?")
 		rows  *sql.Rows
@@ -213,6 +298,8 @@ func scanComments(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.I
 			&comment.Upvotes,
 			&comment.Downvotes,
 			&comment.Points,
+			&comment.Controversy,
+			&comment.Best,
 			&comment.CreatedAt,
 			&comment.EditedAt,
 			&comment.DeletedAt,
@@ -265,6 +352,9 @@ func scanComments(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.I
 	if err := populateCommentAuthors(ctx, db, comments, viewerAdmin); err != nil {
 		return nil, fmt.Errorf("failed to populate comments authors: %w", err)
 	}
+	if err := populateCommentsAuthorFlairs(ctx, db, comments); err != nil {
+		return nil, err
+	}
 
 	// If a comment is deleted and the viewer doesn't have the privilege to see
 	// it, strip the comment's values that relate to its author in any way.
@@ -320,7 +410,7 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 	)
 
 	if parentID != nil {
-		parent, err = GetComment(ctx, db, *parentID, nil)
+		parent, err = getComment(ctx, db, *parentID, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -423,8 +513,9 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 		return nil, err
 	}
 
-	// Send notifications.
-	if parent != nil && !parent.AuthorID.EqualsTo(author.ID) {
+	// Send notifications (unless the comment is hidden from everyone else).
+	notify := !author.IsShadowBanned()
+	if notify && parent != nil && !parent.AuthorID.EqualsTo(author.ID) {
 		go func() {
 			if err := CreateCommentReplyNotification(context.Background(), db, parent.AuthorID, parent.ID, id, author, post); err != nil {
 				log.Printf("Create reply notification failed: %v\n", err)
@@ -432,7 +523,7 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 		}()
 
 	}
-	if !post.AuthorID.EqualsTo(author.ID) && (parent == nil || !(parent.AuthorID.EqualsTo(post.AuthorID))) {
+	if notify && !post.AuthorID.EqualsTo(author.ID) && (parent == nil || !(parent.AuthorID.EqualsTo(post.AuthorID))) {
 		go func() {
 			if err := CreateNewCommentNotification(context.Background(), db, post, id, author); err != nil {
 				log.Printf("Create new_comment notification failed: %v\n", err)
@@ -440,7 +531,7 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 		}()
 	}
 
-	return GetComment(ctx, db, id, nil)
+	return getComment(ctx, db, id, nil)
 }
 
 // Save updates comment's body.
@@ -455,8 +546,20 @@ func (c *Comment) Save(ctx context.Context, db *sql.DB, user uid.ID) error {
 	c.Body = utils.TruncateUnicodeString(c.Body, maxCommentBodyLength)
 
 	now := time.Now()
-	query := "UPDATE comments SET body = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL"
-	_, err := db.ExecContext(ctx, query, c.Body, now, c.ID)
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var oldBody string
+		if err := tx.QueryRowContext(ctx, "SELECT body FROM comments WHERE id = ? FOR UPDATE", c.ID).Scan(&oldBody); err != nil {
+			return err
+		}
+		if oldBody != c.Body {
+			if err := saveRevisionTx(ctx, tx, db, ContentTypeComment, c.ID, c.CreatedAt, msql.NullString{}, msql.NewNullString(oldBody), user); err != nil {
+				return err
+			}
+		}
+		query := "UPDATE comments SET body = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL"
+		_, err := tx.ExecContext(ctx, query, c.Body, now, c.ID)
+		return err
+	})
 	if err == nil {
 		c.EditedAt.Valid = true
 		c.EditedAt.Time = now
@@ -583,26 +686,25 @@ func (c *Comment) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool) er
 		return errPostLocked
 	}
 
-	point := 1
-	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+	point, authorPoints := 1, 0
+	if !up {
+		point = -1
+	}
+	if up && !c.AuthorID.EqualsTo(user) {
+		authorPoints = 1
+	}
+	authorPoints, err := voterAuthorPoints(ctx, db, user, authorPoints)
+	if err != nil {
+		return err
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
 		if _, err := tx.ExecContext(ctx, "INSERT INTO comment_votes (comment_id, user_id, up) VALUES (?, ?, ?)", c.ID, user, up); err != nil {
 			if msql.IsErrDuplicateErr(err) {
 				return httperr.NewBadRequest("already-voted", "You've already voted on the comment.")
 			}
 			return err
 		}
-		query := "UPDATE comments SET points = points + ?"
-		if up {
-			query += ", upvotes = upvotes + 1"
-		} else {
-			point = -1
-			query += ", downvotes = downvotes + 1"
-		}
-		query += " WHERE id = ?"
-		if _, err := tx.ExecContext(ctx, query, point, c.ID); err != nil {
-			return err
-		}
-		return nil
+		return enqueueVote(ctx, tx, voteTargetComment, c.ID, c.AuthorID, authorPoints)
 	})
 	if err != nil {
 		return err
@@ -618,13 +720,9 @@ func (c *Comment) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool) er
 	c.ViewerVotedUp.Valid = true
 	c.ViewerVotedUp.Bool = up
 
-	// Attempt to update user's points.
-	if up && !c.AuthorID.EqualsTo(user) {
-		incrementUserPoints(ctx, db, c.AuthorID, 1)
-	}
-
-	// Attempt to create a notification (only for upvotes).
-	if !c.AuthorID.EqualsTo(user) && up {
+	// Attempt to create a notification (only for upvotes, and not for those of
+	// shadow-banned users).
+	if authorPoints > 0 {
 		go func() {
 			if err := CreateNewVotesNotification(context.Background(), db, c.AuthorID, c.CommunityName, false, c.ID); err != nil {
 				log.Printf("Failed creating new_votes notification: %v\n", err)
@@ -654,23 +752,22 @@ func (c *Comment) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error
 		return err
 	}
 
-	point := 1
-	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_votes WHERE id = ?", id); err != nil {
-			return err
-		}
-		query := "UPDATE comments SET points = points + ?"
-		if up {
-			point = -1
-			query += ", upvotes = upvotes - 1"
-		} else {
-			query += ", downvotes = downvotes - 1"
+	point, authorPoints := 1, 0
+	if up {
+		point = -1
+		if !c.AuthorID.EqualsTo(user) {
+			authorPoints = -1
 		}
-		query += " WHERE id = ?"
-		if _, err := tx.ExecContext(ctx, query, point, c.ID); err != nil {
+	}
+	authorPoints, err := voterAuthorPoints(ctx, db, user, authorPoints)
+	if err != nil {
+		return err
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_votes WHERE id = ?", id); err != nil {
 			return err
 		}
-		return nil
+		return enqueueVote(ctx, tx, voteTargetComment, c.ID, c.AuthorID, authorPoints)
 	})
 	if err != nil {
 		return err
@@ -685,11 +782,6 @@ func (c *Comment) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error
 	c.ViewerVoted.Valid = false
 	c.ViewerVotedUp.Valid = false
 
-	// Attempt to update user's points.
-	if up && !c.AuthorID.EqualsTo(user) {
-		incrementUserPoints(ctx, db, c.AuthorID, -1)
-	}
-
 	return nil
 }
 
@@ -716,23 +808,22 @@ func (c *Comment) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bo
 		return nil
 	}
 
-	points := 2
-	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+	points, authorPoints := 2, 0
+	if dbUp {
+		points = -2
+	}
+	if !c.AuthorID.EqualsTo(user) {
+		authorPoints = points / 2
+	}
+	authorPoints, err := voterAuthorPoints(ctx, db, user, authorPoints)
+	if err != nil {
+		return err
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
 		if _, err := tx.ExecContext(ctx, "UPDATE comment_votes SET up = ? WHERE id = ?", up, id); err != nil {
 			return err
 		}
-		query := "UPDATE comments SET points = points + ?"
-		if dbUp {
-			points = -2
-			query += ", upvotes = upvotes - 1, downvotes = downvotes + 1"
-		} else {
-			query += ", upvotes = upvotes + 1, downvotes = downvotes - 1"
-		}
-		query += " WHERE id = ?"
-		if _, err := tx.ExecContext(ctx, query, points, c.ID); err != nil {
-			return err
-		}
-		return nil
+		return enqueueVote(ctx, tx, voteTargetComment, c.ID, c.AuthorID, authorPoints)
 	})
 	if err != nil {
 		return err
@@ -748,15 +839,6 @@ func (c *Comment) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bo
 	c.Points += points
 	c.ViewerVotedUp = msql.NewNullBool(up)
 
-	// Attemp to update user's points.
-	if !c.AuthorID.EqualsTo(user) {
-		points := 1
-		if dbUp {
-			points = -1
-		}
-		incrementUserPoints(ctx, db, c.AuthorID, points)
-	}
-
 	return nil
 }
 
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestCommentsCursor(t *testing.T) {
+	id := uid.New()
+	cursors := []CommentsCursor{
+		{Sort: CommentSortTop, Score: 12, NextID: id},
+		{Sort: CommentSortNew, NextID: id},
+		{Sort: CommentSortOld, NextID: id},
+		{Sort: CommentSortControversial, Score: 3162, NextID: id},
+		{Sort: CommentSortBest, Score: 8120001, NextID: id},
+		{Sort: CommentSortQA, Score: -2, Answer: true, NextID: id},
+		{Sort: CommentSortQA, Score: 7, NextID: id},
+	}
+	for _, c := range cursors {
+		got, err := ParseCommentsCursor(c.Sort, c.String())
+		if err != nil {
+			t.Errorf("ParseCommentsCursor(%q) error: %v", c.String(), err)
+			continue
+		}
+		if *got != c {
+			t.Errorf("ParseCommentsCursor(%q) = %+v, want %+v", c.String(), *got, c)
+		}
+	}
+
+	invalid := []struct {
+		sort CommentSort
+		text string
+	}{
+		{CommentSortTop, ""},
+		{CommentSortTop, "12"},
+		{CommentSortNew, "12." + id.String()},
+		{CommentSortQA, "12." + id.String()},
+		{CommentSortQA, "2.12." + id.String()},
+	}
+	for _, c := range invalid {
+		if _, err := ParseCommentsCursor(c.sort, c.text); err == nil {
+			t.Errorf("ParseCommentsCursor(%v, %q) succeeded, want an error", c.sort, c.text)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/discuitnet/discuit/core/sitesettings"
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/images"
 	msql "github.com/discuitnet/discuit/internal/sql"
@@ -22,20 +24,29 @@ import (
 const maxCommunityAboutLength = 2000 // in runes
 
 type Community struct {
-	ID                uid.ID          `json:"id"`
-	AuthorID          uid.ID          `json:"userId"`
-	Name              string          `json:"name"`
-	NameLowerCase     string          `json:"-"` // TODO: Remove this field (only from this struct, not also from the database).
-	NSFW              bool            `json:"nsfw"`
-	About             msql.NullString `json:"about"`
-	NumMembers        int             `json:"noMembers"`
-	PostsCount        int             `json:"-"` // Including deleted posts
-	ProPic            *images.Image   `json:"proPic"`
-	BannerImage       *images.Image   `json:"bannerImage"`
-	PostingRestricted bool            `json:"postingRestricted"` // If true only mods can post.
-	CreatedAt         time.Time       `json:"createdAt"`
-	DeletedAt         msql.NullTime   `json:"deletedAt"`
-	DeletedBy         uid.NullID      `json:"-"`
+	ID                 uid.ID          `json:"id"`
+	AuthorID           uid.ID          `json:"userId"`
+	Name               string          `json:"name"`
+	NameLowerCase      string          `json:"-"` // TODO: Remove this field (only from this struct, not also from the database).
+	NSFW               bool            `json:"nsfw"`
+	About              msql.NullString `json:"about"`
+	NumMembers         int             `json:"noMembers"`
+	PostsCount         int             `json:"-"` // Including deleted posts
+	ProPic             *images.Image   `json:"proPic"`
+	BannerImage        *images.Image   `json:"bannerImage"`
+	PostingRestricted  bool            `json:"postingRestricted"` // If true only mods can post.
+	PostFlairRequired  bool            `json:"postFlairRequired"` // If true every post must have a flair.
+	DefaultCommentSort CommentSort     `json:"defaultCommentSort"`
+	CreatedAt          time.Time       `json:"createdAt"`
+	DeletedAt          msql.NullTime   `json:"deletedAt"`
+	DeletedBy          uid.NullID      `json:"-"`
+
+	// Visibility is who can view, join, and post in the community.
+	Visibility CommunityVisibility `json:"visibility"`
+
+	// HotnessParams, if not nil, override the site-wide hotness parameters
+	// for the posts of the community.
+	HotnessParams *sitesettings.HotnessParams `json:"hotnessParams,omitempty"`
 
 	// IsDefault is nil until Default is called.
 	IsDefault *bool `json:"isDefault,omitempty"`
@@ -60,8 +71,12 @@ func buildSelectCommunityQuery(where string) string {
 		"communities.no_members",
 		"communities.posts_count",
 		"communities.posting_restricted",
+		"communities.post_flair_required",
+		"communities.default_comment_sort",
+		"communities.visibility",
 		"communities.created_at",
 		"communities.deleted_at",
+		"communities.hotness_params",
 	}
 	cols = append(cols, images.ImageColumns("pro_pic")...)
 	cols = append(cols, images.ImageColumns("banner")...)
@@ -159,6 +174,7 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 	var comms []*Community
 	for rows.Next() {
 		c := &Community{}
+		var hotnessParams []byte
 		dests := []any{
 			&c.ID,
 			&c.AuthorID,
@@ -169,8 +185,12 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 			&c.NumMembers,
 			&c.PostsCount,
 			&c.PostingRestricted,
+			&c.PostFlairRequired,
+			&c.DefaultCommentSort,
+			&c.Visibility,
 			&c.CreatedAt,
 			&c.DeletedAt,
+			&hotnessParams,
 		}
 
 		proPic, bannerImage := &images.Image{}, &images.Image{}
@@ -181,6 +201,12 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 			return nil, err
 		}
 
+		if hotnessParams != nil {
+			c.HotnessParams = &sitesettings.HotnessParams{}
+			if err := json.Unmarshal(hotnessParams, c.HotnessParams); err != nil {
+				return nil, fmt.Errorf("unmarshaling community hotness_params: %w", err)
+			}
+		}
 		if proPic.ID != nil {
 			proPic.PostScan()
 			setCommunityProPicCopies(proPic)
@@ -222,6 +248,13 @@ func countUserModdingCommunities(ctx context.Context, db *sql.DB, user uid.ID) (
 	return
 }
 
+// UserModsAnyCommunity reports whether user is a moderator of at least one
+// community.
+func UserModsAnyCommunity(ctx context.Context, db *sql.DB, user uid.ID) (bool, error) {
+	n, err := countUserModdingCommunities(ctx, db, user)
+	return n > 0, err
+}
+
 // To temporary disable community creation to everyone.
 var communityCreationAdminOnly = true
 
@@ -334,8 +367,8 @@ func GetCommunities(ctx context.Context, db *sql.DB, sort CommunitiesSort, set s
 		return nil, httperr.NewBadRequest("invalid-set", "Invalid community set options.")
 	}
 
-	var args []any
-	where := "WHERE communities.deleted_at IS NULL "
+	hidden, args := hiddenCommunitiesQuery(viewer)
+	where := fmt.Sprintf("WHERE communities.deleted_at IS NULL AND communities.id NOT IN (%s) ", hidden)
 	if set == CommunitiesSetDefault {
 		where += "AND communities.id IN (SELECT community_id FROM default_communities) "
 	} else if set == CommunitiesSetSubscribed {
@@ -371,11 +404,14 @@ func GetCommunities(ctx context.Context, db *sql.DB, sort CommunitiesSort, set s
 	return scanCommunities(ctx, db, rows, viewer)
 }
 
-// GetCommunitiesPrefix returns all communities with name prefix s sorted by created at.
-func GetCommunitiesPrefix(ctx context.Context, db *sql.DB, s string) ([]*Community, error) {
+// GetCommunitiesPrefix returns all communities with name prefix s sorted by
+// created at. Private communities that viewer is not a member of are excluded.
+func GetCommunitiesPrefix(ctx context.Context, db *sql.DB, s string, viewer *uid.ID) ([]*Community, error) {
 	const limit = 10
-	query := buildSelectCommunityQuery("WHERE communities.name LIKE ? AND communities.deleted_at IS NULL LIMIT ?")
-	rows, err := db.QueryContext(ctx, query, "%"+s+"%", limit)
+	hidden, hiddenArgs := hiddenCommunitiesQuery(viewer)
+	query := buildSelectCommunityQuery(fmt.Sprintf("WHERE communities.name LIKE ? AND communities.deleted_at IS NULL AND communities.id NOT IN (%s) LIMIT ?", hidden))
+	args := append(append([]any{"%" + s + "%"}, hiddenArgs...), limit)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -384,8 +420,8 @@ func GetCommunitiesPrefix(ctx context.Context, db *sql.DB, s string) ([]*Communi
 		return nil, err
 	}
 
-	query = buildSelectCommunityQuery("WHERE communities.name = ?")
-	rows, err = db.QueryContext(ctx, query, s)
+	query = buildSelectCommunityQuery(fmt.Sprintf("WHERE communities.name = ? AND communities.id NOT IN (%s)", hidden))
+	rows, err = db.QueryContext(ctx, query, append([]any{s}, hiddenArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -419,6 +455,9 @@ func GetCommunitiesPrefix(ctx context.Context, db *sql.DB, s string) ([]*Communi
 //   - NSFW
 //   - About
 //   - PostingRestricted
+//   - PostFlairRequired
+//   - DefaultCommentSort
+//   - Visibility
 func (c *Community) Update(ctx context.Context, db *sql.DB, mod uid.ID) error {
 	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
 		return err
@@ -426,11 +465,52 @@ func (c *Community) Update(ctx context.Context, db *sql.DB, mod uid.ID) error {
 		return errNotMod
 	}
 
+	if !c.DefaultCommentSort.Valid() {
+		return ErrInvalidCommentSort
+	}
+	if !c.Visibility.Valid() {
+		return errInvalidVisibility
+	}
+
 	c.About.String = utils.TruncateUnicodeString(c.About.String, maxCommunityAboutLength)
-	_, err := db.ExecContext(ctx, "UPDATE communities SET nsfw = ?, about = ?, posting_restricted = ? WHERE id = ?", c.NSFW, c.About, c.PostingRestricted, c.ID)
+	_, err := db.ExecContext(ctx, "UPDATE communities SET nsfw = ?, about = ?, posting_restricted = ?, post_flair_required = ?, default_comment_sort = ?, visibility = ? WHERE id = ?", c.NSFW, c.About, c.PostingRestricted, c.PostFlairRequired, c.DefaultCommentSort, c.Visibility, c.ID)
 	return err
 }
 
+// GetCommunityDefaultCommentSort returns the sort in which the comments of the
+// posts of community are shown by default.
+func GetCommunityDefaultCommentSort(ctx context.Context, db *sql.DB, community uid.ID) (CommentSort, error) {
+	var sort CommentSort
+	if err := db.QueryRowContext(ctx, "SELECT default_comment_sort FROM communities WHERE id = ?", community).Scan(&sort); err != nil {
+		if err == sql.ErrNoRows {
+			return sort, errCommunityNotFound
+		}
+		return sort, err
+	}
+	return sort, nil
+}
+
+// SetHotnessParams sets the hotness parameters of the posts of the community,
+// overriding the site-wide ones, and recalculates the hotness of its posts. If
+// params is nil, the site-wide parameters apply once more.
+func (c *Community) SetHotnessParams(ctx context.Context, db *sql.DB, params *sitesettings.HotnessParams) error {
+	var data []byte
+	if params != nil {
+		if err := params.Validate(); err != nil {
+			return httperr.NewBadRequest("invalid-hotness", err.Error())
+		}
+		var err error
+		if data, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE communities SET hotness_params = ? WHERE id = ?", data, c.ID); err != nil {
+		return err
+	}
+	c.HotnessParams = params
+	return updatePostsHotness(ctx, db, &c.ID)
+}
+
 // Default reports whether c is a default community, and, if there's no error,
 // it sets c.IsDefault to a non-nil value.
 func (c *Community) Default(ctx context.Context, db *sql.DB) (bool, error) {
@@ -462,18 +542,23 @@ func (c *Community) SetDefault(ctx context.Context, db *sql.DB, set bool) error
 	return err
 }
 
+// Join makes user a member of c. Private communities can be joined only with
+// an approved join request or an invite (except by admins).
 func (c *Community) Join(ctx context.Context, db *sql.DB, user uid.ID) error {
-	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, "INSERT INTO community_members (community_id, user_id) VALUES (?, ?)", c.ID, user); err != nil {
-			if msql.IsErrDuplicateErr(err) {
-				return nil // already a member, exit
-			}
+	if c.IsPrivate() {
+		if ok, err := c.UserCanView(ctx, db, &user); err != nil {
 			return err
+		} else if !ok {
+			return errJoinRequestRequired
 		}
-		if _, err := tx.ExecContext(ctx, "UPDATE communities SET no_members = no_members + 1 WHERE id = ?", c.ID); err != nil {
-			return err
-		}
-		return nil
+	}
+	return c.join(ctx, db, user)
+}
+
+// join is like Join, but it doesn't check the visibility of c.
+func (c *Community) join(ctx context.Context, db *sql.DB, user uid.ID) error {
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		return c.joinTx(ctx, tx, user)
 	})
 	if err != nil {
 		return err
@@ -482,6 +567,19 @@ func (c *Community) Join(ctx context.Context, db *sql.DB, user uid.ID) error {
 	return nil
 }
 
+// joinTx makes user a member of c within tx. It does nothing if user is
+// already a member.
+func (c *Community) joinTx(ctx context.Context, tx *sql.Tx, user uid.ID) error {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO community_members (community_id, user_id) VALUES (?, ?)", c.ID, user); err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return nil // already a member, exit
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE communities SET no_members = no_members + 1 WHERE id = ?", c.ID)
+	return err
+}
+
 func (c *Community) Leave(ctx context.Context, db *sql.DB, user uid.ID) error {
 	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
 		if _, err := tx.ExecContext(ctx, "DELETE FROM community_members WHERE community_id = ? AND user_id = ?", c.ID, user); err != nil {
@@ -1020,8 +1118,9 @@ func makeUserMod(ctx context.Context, db *sql.DB, c *Community, user uid.ID, isM
 	// When changing the SQL queries of this function, make duplicate the
 	// changes in User.Delete function as well.
 
-	// First add user as member of c.
-	if err := c.Join(ctx, db, user); err != nil {
+	// First add user as member of c. The visibility of c is not checked, as
+	// the callers are authorized already.
+	if err := c.join(ctx, db, user); err != nil {
 		if e, ok := err.(*httperr.Error); ok {
 			if e.HTTPStatus != http.StatusConflict {
 				return err
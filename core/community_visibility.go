@@ -0,0 +1,629 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const maxJoinRequestMessageLength = 1000 // in runes
+
+var (
+	errCommunityPrivate        = httperr.NewForbidden("community_private", "This community is private.")
+	errCommunityNotPrivate     = httperr.NewBadRequest("community_not_private", "The community is not private.")
+	errPostingApprovalRequired = httperr.NewForbidden("posting_approval_required", "Only approved users can post in this community.")
+	errJoinRequestRequired     = httperr.NewForbidden("join_request_required", "Joining this community requires the approval of its moderators.")
+	errAlreadyMember           = httperr.NewBadRequest("already_member", "You are already a member of this community.")
+	errInviteInvalid           = httperr.NewNotFound("invite_invalid", "The invite link is invalid or has expired.")
+	errInvalidVisibility       = httperr.NewBadRequest("invalid_visibility", "Invalid community visibility.")
+
+	errJoinRequestExists = &httperr.Error{
+		HTTPStatus: http.StatusConflict,
+		Code:       "join_request_exists",
+		Message:    "You have already requested to join this community.",
+	}
+	errJoinRequestReviewed = &httperr.Error{
+		HTTPStatus: http.StatusConflict,
+		Code:       "join_request_reviewed",
+		Message:    "The join request has already been reviewed.",
+	}
+)
+
+// CommunityVisibility is who can view, join, and post in a community.
+type CommunityVisibility int
+
+const (
+	CommunityVisibilityPublic     = CommunityVisibility(iota) // Anyone can view, join, and post.
+	CommunityVisibilityRestricted                             // Anyone can view and join, but only approved users can post.
+	CommunityVisibilityPrivate                                // Only members can view, and joining requires the approval of the mods.
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (v CommunityVisibility) MarshalText() ([]byte, error) {
+	switch v {
+	case CommunityVisibilityPublic:
+		return []byte("public"), nil
+	case CommunityVisibilityRestricted:
+		return []byte("restricted"), nil
+	case CommunityVisibilityPrivate:
+		return []byte("private"), nil
+	}
+	return nil, fmt.Errorf("unknown community visibility: %d", v)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (v *CommunityVisibility) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "public":
+		*v = CommunityVisibilityPublic
+	case "restricted":
+		*v = CommunityVisibilityRestricted
+	case "private":
+		*v = CommunityVisibilityPrivate
+	default:
+		return errInvalidVisibility
+	}
+	return nil
+}
+
+// Valid reports whether v is one of the defined visibilities.
+func (v CommunityVisibility) Valid() bool {
+	return v >= CommunityVisibilityPublic && v <= CommunityVisibilityPrivate
+}
+
+// hiddenCommunitiesQuery returns an SQL query, and its arguments, that selects
+// the IDs of the private communities that viewer (nil for a logged out user)
+// is not a member of.
+//
+// Admins can view any private community (see Community.UserCanView), but its
+// posts are not shown to them in feeds unless they are members.
+func hiddenCommunitiesQuery(viewer *uid.ID) (string, []any) {
+	query := fmt.Sprintf("SELECT id FROM communities WHERE visibility = %d", CommunityVisibilityPrivate)
+	if viewer == nil {
+		return query, nil
+	}
+	return query + " AND id NOT IN (SELECT community_id FROM community_members WHERE user_id = ?)", []any{*viewer}
+}
+
+// IsPrivate reports whether c is a private community.
+func (c *Community) IsPrivate() bool {
+	return c.Visibility == CommunityVisibilityPrivate
+}
+
+// UserCanView reports whether user (nil for a logged out user) can view c and
+// its posts. Private communities can be viewed only by their members and by
+// admins.
+func (c *Community) UserCanView(ctx context.Context, db *sql.DB, user *uid.ID) (bool, error) {
+	if !c.IsPrivate() {
+		return true, nil
+	}
+	return userCanViewPrivateCommunity(ctx, db, c.ID, user)
+}
+
+// userCanViewCommunity is like Community.UserCanView, but it takes the ID of
+// the community.
+func userCanViewCommunity(ctx context.Context, db *sql.DB, community uid.ID, user *uid.ID) (bool, error) {
+	var v CommunityVisibility
+	if err := db.QueryRowContext(ctx, "SELECT visibility FROM communities WHERE id = ?", community).Scan(&v); err != nil {
+		if err == sql.ErrNoRows {
+			return false, errCommunityNotFound
+		}
+		return false, err
+	}
+	if v != CommunityVisibilityPrivate {
+		return true, nil
+	}
+	return userCanViewPrivateCommunity(ctx, db, community, user)
+}
+
+func userCanViewPrivateCommunity(ctx context.Context, db *sql.DB, community uid.ID, user *uid.ID) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	if member, err := userMember(ctx, db, community, *user); err != nil || member {
+		return member, err
+	}
+	return IsAdmin(db, user)
+}
+
+// userMember reports whether user is a member of community.
+func userMember(ctx context.Context, db *sql.DB, community, user uid.ID) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM community_members WHERE community_id = ? AND user_id = ?", community, user).Scan(&n)
+	return n > 0, err
+}
+
+// UserCanPost reports whether user can post in c, as far as the visibility of
+// c is concerned. In restricted communities, only approved users, mods, and
+// admins can post. In private communities, only members and admins can.
+func (c *Community) UserCanPost(ctx context.Context, db *sql.DB, user uid.ID) (bool, error) {
+	switch c.Visibility {
+	case CommunityVisibilityRestricted:
+		if approved, err := c.UserApproved(ctx, db, user); err != nil || approved {
+			return approved, err
+		}
+		return c.UserModOrAdmin(ctx, db, user)
+	case CommunityVisibilityPrivate:
+		return c.UserCanView(ctx, db, &user)
+	}
+	return true, nil
+}
+
+// UserApproved reports whether user is an approved user of c, that is, a user
+// that can post in c while c is restricted.
+func (c *Community) UserApproved(ctx context.Context, db *sql.DB, user uid.ID) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM community_approved_users WHERE community_id = ? AND user_id = ?", c.ID, user).Scan(&n)
+	return n > 0, err
+}
+
+// ApproveUser makes user, by mod, an approved user of c. It does nothing if
+// user is already approved.
+func (c *Community) ApproveUser(ctx context.Context, db *sql.DB, mod, user uid.ID) error {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	query, args := msql.BuildInsertQuery("community_approved_users", []msql.ColumnValue{
+		{Name: "community_id", Value: c.ID},
+		{Name: "user_id", Value: user},
+		{Name: "approved_by", Value: mod},
+	})
+	if _, err := db.ExecContext(ctx, query, args...); err != nil && !msql.IsErrDuplicateErr(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveApprovedUser, by mod, removes user from the approved users of c.
+func (c *Community) RemoveApprovedUser(ctx context.Context, db *sql.DB, mod, user uid.ID) error {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	_, err := db.ExecContext(ctx, "DELETE FROM community_approved_users WHERE community_id = ? AND user_id = ?", c.ID, user)
+	return err
+}
+
+// GetApprovedUsers returns the approved users of c.
+func (c *Community) GetApprovedUsers(ctx context.Context, db *sql.DB) ([]*User, error) {
+	rows, err := db.QueryContext(ctx, "SELECT user_id FROM community_approved_users WHERE community_id = ? ORDER BY created_at DESC", c.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return GetUsersByIDs(ctx, db, ids, nil)
+}
+
+// CommunityJoinRequestStatus is the state of the review of a join request.
+type CommunityJoinRequestStatus int
+
+const (
+	CommunityJoinRequestStatusPending  = CommunityJoinRequestStatus(iota)
+	CommunityJoinRequestStatusApproved // The user was made a member.
+	CommunityJoinRequestStatusDenied
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s CommunityJoinRequestStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case CommunityJoinRequestStatusPending:
+		return []byte("pending"), nil
+	case CommunityJoinRequestStatusApproved:
+		return []byte("approved"), nil
+	case CommunityJoinRequestStatusDenied:
+		return []byte("denied"), nil
+	}
+	return nil, fmt.Errorf("unknown join request status: %d", s)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *CommunityJoinRequestStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "pending":
+		*s = CommunityJoinRequestStatusPending
+	case "approved":
+		*s = CommunityJoinRequestStatusApproved
+	case "denied":
+		*s = CommunityJoinRequestStatusDenied
+	default:
+		return httperr.NewBadRequest("invalid_join_request_status", "Invalid join request status.")
+	}
+	return nil
+}
+
+// CommunityJoinRequest is a request, by a user, to join a private community.
+type CommunityJoinRequest struct {
+	ID          int                        `json:"id"`
+	CommunityID uid.ID                     `json:"communityId"`
+	UserID      uid.ID                     `json:"userId"`
+	Username    string                     `json:"username"`
+	Message     msql.NullString            `json:"message"`
+	Status      CommunityJoinRequestStatus `json:"status"`
+	ReviewedBy  uid.NullID                 `json:"reviewedBy"`
+	ReviewedAt  msql.NullTime              `json:"reviewedAt"`
+	CreatedAt   time.Time                  `json:"createdAt"`
+}
+
+const selectCommunityJoinRequestsQuery = `
+	SELECT
+		community_join_requests.id,
+		community_join_requests.community_id,
+		community_join_requests.user_id,
+		users.username,
+		community_join_requests.message,
+		community_join_requests.status,
+		community_join_requests.reviewed_by,
+		community_join_requests.reviewed_at,
+		community_join_requests.created_at
+	FROM community_join_requests
+	INNER JOIN users ON users.id = community_join_requests.user_id `
+
+func selectCommunityJoinRequests(ctx context.Context, db *sql.DB, where string, args ...any) ([]*CommunityJoinRequest, error) {
+	rows, err := db.QueryContext(ctx, selectCommunityJoinRequestsQuery+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*CommunityJoinRequest{}
+	for rows.Next() {
+		r := &CommunityJoinRequest{}
+		err := rows.Scan(
+			&r.ID,
+			&r.CommunityID,
+			&r.UserID,
+			&r.Username,
+			&r.Message,
+			&r.Status,
+			&r.ReviewedBy,
+			&r.ReviewedAt,
+			&r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// GetCommunityJoinRequest returns the join request with id.
+func GetCommunityJoinRequest(ctx context.Context, db *sql.DB, id int) (*CommunityJoinRequest, error) {
+	requests, err := selectCommunityJoinRequests(ctx, db, "WHERE community_join_requests.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, httperr.NewNotFound("join_request_not_found", "Join request not found.")
+	}
+	return requests[0], nil
+}
+
+// GetCommunityJoinRequests returns the requests to join community with status,
+// the latest first. The next returned is for fetching the next page of
+// requests.
+func GetCommunityJoinRequests(ctx context.Context, db *sql.DB, community uid.ID, status CommunityJoinRequestStatus, limit int, next *string) ([]*CommunityJoinRequest, *string, error) {
+	where := "WHERE community_join_requests.community_id = ? AND community_join_requests.status = ? "
+	args := []any{community, status}
+	if next != nil {
+		nextID, err := strconv.Atoi(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-next", "Invalid next.")
+		}
+		where += "AND community_join_requests.id <= ? "
+		args = append(args, nextID)
+	}
+	args = append(args, limit+1)
+
+	requests, err := selectCommunityJoinRequests(ctx, db, where+"ORDER BY community_join_requests.id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(requests) > limit {
+		nextNext = new(string)
+		*nextNext = strconv.Itoa(requests[limit].ID)
+		requests = requests[:limit]
+	}
+	return requests, nextNext, nil
+}
+
+// CreateCommunityJoinRequest creates a request, by user, to join the private
+// community c. A user may have only one pending request per community.
+func CreateCommunityJoinRequest(ctx context.Context, db *sql.DB, c *Community, user uid.ID, message string) (*CommunityJoinRequest, error) {
+	if !c.IsPrivate() {
+		return nil, errCommunityNotPrivate
+	}
+	if banned, err := c.UserBanned(ctx, db, user); err != nil {
+		return nil, err
+	} else if banned {
+		return nil, errUserBannedFromCommunity
+	}
+	if member, err := userMember(ctx, db, c.ID, user); err != nil {
+		return nil, err
+	} else if member {
+		return nil, errAlreadyMember
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM community_join_requests WHERE user_id = ? AND community_id = ? AND status = ?", user, c.ID, CommunityJoinRequestStatusPending).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, errJoinRequestExists
+	}
+
+	message = utils.TruncateUnicodeString(strings.TrimSpace(message), maxJoinRequestMessageLength)
+	query, args := msql.BuildInsertQuery("community_join_requests", []msql.ColumnValue{
+		{Name: "community_id", Value: c.ID},
+		{Name: "user_id", Value: user},
+		{Name: "message", Value: msql.NewNullString(message)},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetCommunityJoinRequest(ctx, db, int(id))
+}
+
+// Approve approves the join request, by mod, and makes the user who requested
+// to join a member of the community.
+func (r *CommunityJoinRequest) Approve(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	comm, err := r.checkReviewable(ctx, db, mod)
+	if err != nil {
+		return err
+	}
+	if banned, err := comm.UserBanned(ctx, db, r.UserID); err != nil {
+		return err
+	} else if banned {
+		return errUserBannedFromCommunity
+	}
+	return r.setReviewed(ctx, db, mod, CommunityJoinRequestStatusApproved, func(tx *sql.Tx) error {
+		return comm.joinTx(ctx, tx, r.UserID)
+	})
+}
+
+// Deny denies the join request, by mod.
+func (r *CommunityJoinRequest) Deny(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if _, err := r.checkReviewable(ctx, db, mod); err != nil {
+		return err
+	}
+	return r.setReviewed(ctx, db, mod, CommunityJoinRequestStatusDenied, nil)
+}
+
+// checkReviewable returns the community of r if r is pending and if mod is
+// a mod of it (or an admin).
+func (r *CommunityJoinRequest) checkReviewable(ctx context.Context, db *sql.DB, mod uid.ID) (*Community, error) {
+	if r.Status != CommunityJoinRequestStatusPending {
+		return nil, errJoinRequestReviewed
+	}
+	comm, err := GetCommunityByID(ctx, db, r.CommunityID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if is, err := comm.UserModOrAdmin(ctx, db, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+	return comm, nil
+}
+
+// setReviewed marks r as reviewed by mod, with status. If then is not nil, it's
+// run in the same transaction, so that r is marked as reviewed only if then
+// succeeds.
+func (r *CommunityJoinRequest) setReviewed(ctx context.Context, db *sql.DB, mod uid.ID, status CommunityJoinRequestStatus, then func(tx *sql.Tx) error) error {
+	now := time.Now()
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE community_join_requests SET status = ?, reviewed_by = ?, reviewed_at = ? WHERE id = ? AND status = ?", status, mod, now, r.ID, CommunityJoinRequestStatusPending)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return errJoinRequestReviewed // Reviewed concurrently.
+		}
+		if then != nil {
+			return then(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Status = status
+	r.ReviewedBy = uid.NullID{ID: mod, Valid: true}
+	r.ReviewedAt = msql.NewNullTime(now)
+	return nil
+}
+
+// CommunityInvite is an invite link to a community. Anyone with the code of
+// the invite can join the community, even if it's private, until the invite
+// expires or is used up.
+type CommunityInvite struct {
+	ID          int    `json:"id"`
+	CommunityID uid.ID `json:"communityId"`
+	Code        string `json:"code"`
+	CreatedBy   uid.ID `json:"createdBy"`
+
+	// ExpiresAt and MaxUses are null for invites that never expire and for
+	// invites that can be used any number of times, respectively.
+	ExpiresAt msql.NullTime  `json:"expiresAt"`
+	MaxUses   msql.NullInt32 `json:"maxUses"`
+	Uses      int            `json:"uses"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func selectCommunityInvites(ctx context.Context, db *sql.DB, where string, args ...any) ([]*CommunityInvite, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, community_id, code, created_by, expires_at, max_uses, uses, created_at FROM community_invites "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*CommunityInvite{}
+	for rows.Next() {
+		i := &CommunityInvite{}
+		if err := rows.Scan(&i.ID, &i.CommunityID, &i.Code, &i.CreatedBy, &i.ExpiresAt, &i.MaxUses, &i.Uses, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+// newInviteCode returns a random invite code. It's generated with crypto/rand,
+// since anyone who guesses a code can join a private community.
+func newInviteCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateInvite creates an invite link to c, by mod. If expires is nil, the
+// invite never expires, and if maxUses is 0, it can be used any number of
+// times.
+func (c *Community) CreateInvite(ctx context.Context, db *sql.DB, mod uid.ID, expires *time.Time, maxUses int) (*CommunityInvite, error) {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+	if expires != nil && !expires.After(time.Now()) {
+		return nil, httperr.NewBadRequest("invalid_expires", "Invite expiry must be in the future.")
+	}
+	if maxUses < 0 {
+		return nil, httperr.NewBadRequest("invalid_max_uses", "Invalid max uses.")
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	cols := []msql.ColumnValue{
+		{Name: "community_id", Value: c.ID},
+		{Name: "code", Value: code},
+		{Name: "created_by", Value: mod},
+	}
+	if expires != nil {
+		cols = append(cols, msql.ColumnValue{Name: "expires_at", Value: *expires})
+	}
+	if maxUses > 0 {
+		cols = append(cols, msql.ColumnValue{Name: "max_uses", Value: maxUses})
+	}
+	query, args := msql.BuildInsertQuery("community_invites", cols)
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	invites, err := selectCommunityInvites(ctx, db, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	return invites[0], nil
+}
+
+// GetInvites returns all the invite links to c, the latest first.
+func (c *Community) GetInvites(ctx context.Context, db *sql.DB) ([]*CommunityInvite, error) {
+	return selectCommunityInvites(ctx, db, "WHERE community_id = ? ORDER BY id DESC", c.ID)
+}
+
+// DeleteInvite, by mod, deletes the invite link to c with id, after which it
+// can no longer be used.
+func (c *Community) DeleteInvite(ctx context.Context, db *sql.DB, mod uid.ID, id int) error {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	res, err := db.ExecContext(ctx, "DELETE FROM community_invites WHERE id = ? AND community_id = ?", id, c.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return httperr.NewNotFound("invite_not_found", "Invite not found.")
+	}
+	return nil
+}
+
+// AcceptCommunityInvite makes user a member of the community of the invite
+// with code, and returns the community. The invite is used up only if user
+// was not already a member.
+func AcceptCommunityInvite(ctx context.Context, db *sql.DB, code string, user uid.ID) (*Community, error) {
+	var community uid.ID
+	if err := db.QueryRowContext(ctx, "SELECT community_id FROM community_invites WHERE code = ?", code).Scan(&community); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInviteInvalid
+		}
+		return nil, err
+	}
+	comm, err := GetCommunityByID(ctx, db, community, nil)
+	if err != nil {
+		return nil, err
+	}
+	if comm.DeletedAt.Valid {
+		return nil, errInviteInvalid
+	}
+	if banned, err := comm.UserBanned(ctx, db, user); err != nil {
+		return nil, err
+	} else if banned {
+		return nil, errUserBannedFromCommunity
+	}
+	if member, err := userMember(ctx, db, comm.ID, user); err != nil {
+		return nil, err
+	} else if member {
+		return comm, nil
+	}
+
+	// Checked and used in one statement so that concurrent uses cannot take
+	// an invite over its limit.
+	res, err := db.ExecContext(ctx, `
+		UPDATE community_invites SET uses = uses + 1
+		WHERE code = ? AND (max_uses IS NULL OR uses < max_uses) AND (expires_at IS NULL OR expires_at > ?)`, code, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, errInviteInvalid
+	}
+	if err := comm.join(ctx, db, user); err != nil {
+		return nil, err
+	}
+	return comm, nil
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestCommunityVisibilityText(t *testing.T) {
+	for _, v := range []CommunityVisibility{CommunityVisibilityPublic, CommunityVisibilityRestricted, CommunityVisibilityPrivate} {
+		text, err := v.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CommunityVisibility
+		if err := got.UnmarshalText(text); err != nil || got != v {
+			t.Errorf("visibility %d round-tripped (via %q) to %d (error: %v)", v, text, got, err)
+		}
+	}
+
+	// Community updates are decoded from JSON.
+	var c Community
+	if err := json.Unmarshal([]byte(`{"visibility":"secret"}`), &c); err == nil {
+		t.Error("invalid visibility unmarshaled without error")
+	}
+	if CommunityVisibility(3).Valid() {
+		t.Error("out-of-range visibility reported valid")
+	}
+}
+
+func TestHiddenCommunitiesQuery(t *testing.T) {
+	query, args := hiddenCommunitiesQuery(nil)
+	if want := "SELECT id FROM communities WHERE visibility = 2"; query != want || len(args) != 0 {
+		t.Errorf("got %q %v, want %q with no args", query, args, want)
+	}
+
+	viewer := uid.New()
+	query, args = hiddenCommunitiesQuery(&viewer)
+	if want := "SELECT id FROM communities WHERE visibility = 2 AND id NOT IN (SELECT community_id FROM community_members WHERE user_id = ?)"; query != want {
+		t.Errorf("got %q, want %q", query, want)
+	}
+	if len(args) != 1 || args[0] != viewer {
+		t.Errorf("got args %v, want [%v]", args, viewer)
+	}
+}
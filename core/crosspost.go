@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+var (
+	errCrosspostOriginalDeleted = httperr.NewForbidden("crosspost/original-deleted", "Cannot crosspost a deleted post.")
+	errCrosspostOriginalLocked  = httperr.NewForbidden("crosspost/original-locked", "Cannot crosspost a locked post.")
+	errCrosspostSameCommunity   = httperr.NewBadRequest("crosspost/same-community", "Cannot crosspost a post to its own community.")
+	errCrosspostOriginalPrivate = httperr.NewForbidden("crosspost/original-private", "Cannot crosspost a post from a private community.")
+
+	errCrosspostExists = &httperr.Error{
+		HTTPStatus: http.StatusConflict,
+		Code:       "crosspost/already-exists",
+		Message:    "Post is already crossposted to the community.",
+	}
+)
+
+// IsCrosspost reports whether p is a crosspost of another post.
+func (p *Post) IsCrosspost() bool {
+	return p.crosspostOf.Valid
+}
+
+// CreateCrosspost creates a post in community, by author, that's a crosspost
+// of original. If original is itself a crosspost, the post that it's a
+// crosspost of is crossposted instead. If title is empty, the title of the
+// original post is used.
+func CreateCrosspost(ctx context.Context, db *sql.DB, author, community uid.ID, original *Post, title string, flair *int) (*Post, error) {
+	if original.IsCrosspost() {
+		var err error
+		if original, err = getPost(ctx, db, &original.crosspostOf.ID, "", nil, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if original.Deleted {
+		return nil, errCrosspostOriginalDeleted
+	}
+	if original.Locked {
+		return nil, errCrosspostOriginalLocked
+	}
+	if original.CommunityID == community {
+		return nil, errCrosspostSameCommunity
+	}
+	// Only private communities cannot be viewed by logged out users.
+	if public, err := userCanViewCommunity(ctx, db, original.CommunityID, nil); err != nil {
+		return nil, err
+	} else if !public {
+		return nil, errCrosspostOriginalPrivate
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE crosspost_of = ? AND community_id = ? AND deleted = FALSE", original.ID, community).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, errCrosspostExists
+	}
+
+	if title == "" {
+		title = original.Title
+	}
+	opts := &createPostOpts{
+		author:      author,
+		community:   community,
+		postType:    original.Type,
+		title:       title,
+		flair:       flair,
+		crosspostOf: original,
+	}
+	if original.link != nil {
+		// Copied so that the crosspost shows up in the domain filters and the
+		// like. The link image, however, belongs to the original post.
+		opts.link = *original.link
+	}
+	return createPost(ctx, db, opts)
+}
+
+// populatePostsCrosspostOf sets the CrosspostOf field of the crossposts in
+// posts.
+func populatePostsCrosspostOf(ctx context.Context, db *sql.DB, posts []*Post, viewer *uid.ID) error {
+	var ids []uid.ID
+	seen := make(map[uid.ID]bool)
+	for _, post := range posts {
+		if post.IsCrosspost() && !seen[post.crosspostOf.ID] {
+			seen[post.crosspostOf.ID] = true
+			ids = append(ids, post.crosspostOf.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// The originals of crossposts are never crossposts themselves, so this
+	// doesn't recurse any further.
+	originals, err := GetPostsByIDs(ctx, db, viewer, true, ids...)
+	if err != nil && err != errPostNotFound {
+		return err
+	}
+
+	m := make(map[uid.ID]*Post, len(originals))
+	for _, original := range originals {
+		m[original.ID] = original
+	}
+	for _, post := range posts {
+		if post.IsCrosspost() {
+			post.CrosspostOf = m[post.crosspostOf.ID]
+		}
+	}
+	return nil
+}
+
+// GetCrossposts returns the undeleted crossposts of p, latest first. The
+// crossposts in private communities that viewer is not a member of are left
+// out.
+func (p *Post) GetCrossposts(ctx context.Context, db *sql.DB, viewer *uid.ID) ([]*Post, error) {
+	hidden, hiddenArgs := hiddenCommunitiesQuery(viewer)
+	query := fmt.Sprintf("SELECT id FROM posts WHERE crosspost_of = ? AND deleted = FALSE AND community_id NOT IN (%s) ORDER BY created_at DESC", hidden)
+	rows, err := db.QueryContext(ctx, query, append([]any{p.ID}, hiddenArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*Post{}, nil
+	}
+	posts, err := GetPostsByIDs(ctx, db, viewer, false, ids...)
+	if err != nil && err != errPostNotFound {
+		return nil, err
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+	return posts, nil
+}
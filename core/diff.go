@@ -0,0 +1,110 @@
+package core
+
+import "regexp"
+
+// maxDiffCells limits the size of the table used by diffText. Larger inputs
+// (after the common prefix and suffix are removed) are diffed as a whole
+// deletion followed by a whole insertion.
+const maxDiffCells = 1 << 20
+
+// DiffOp is the operation of a DiffChunk.
+type DiffOp string
+
+const (
+	DiffOpEqual  = DiffOp("equal")
+	DiffOpInsert = DiffOp("insert")
+	DiffOpDelete = DiffOp("delete")
+)
+
+// DiffChunk is a piece of text that's unchanged, inserted, or deleted between
+// two versions of a text.
+type DiffChunk struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words and runs of whitespace.
+var diffTokenRegexp = regexp.MustCompile(`\s+|\S+`)
+
+// diffText returns a word-level diff of the texts a and b. Concatenating the
+// equal and delete chunks gives a, and concatenating the equal and insert
+// chunks gives b.
+func diffText(a, b string) []DiffChunk {
+	x, y := diffTokenRegexp.FindAllString(a, -1), diffTokenRegexp.FindAllString(b, -1)
+
+	chunks := []DiffChunk{}
+	add := func(op DiffOp, text string) {
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Text += text
+			return
+		}
+		chunks = append(chunks, DiffChunk{Op: op, Text: text})
+	}
+
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		add(DiffOpEqual, x[prefix])
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	diffTokens(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix], add)
+
+	for _, token := range x[len(x)-suffix:] {
+		add(DiffOpEqual, token)
+	}
+	return chunks
+}
+
+// diffTokens diffs x and y using their longest common subsequence.
+func diffTokens(x, y []string, add func(DiffOp, string)) {
+	n, m := len(x), len(y)
+	if n == 0 || m == 0 || n*m > maxDiffCells {
+		for _, token := range x {
+			add(DiffOpDelete, token)
+		}
+		for _, token := range y {
+			add(DiffOpInsert, token)
+		}
+		return
+	}
+
+	// lcs[i*(m+1)+j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) int32 { return lcs[i*(m+1)+j] }
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i*(m+1)+j] = at(i+1, j+1) + 1
+			} else {
+				lcs[i*(m+1)+j] = max(at(i+1, j), at(i, j+1))
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			add(DiffOpEqual, x[i])
+			i++
+			j++
+		case at(i+1, j) >= at(i, j+1):
+			add(DiffOpDelete, x[i])
+			i++
+		default:
+			add(DiffOpInsert, y[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		add(DiffOpDelete, x[i])
+	}
+	for ; j < m; j++ {
+		add(DiffOpInsert, y[j])
+	}
+}
@@ -0,0 +1,38 @@
+package core
+
+import "testing"
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []DiffChunk
+	}{
+		{"", "", []DiffChunk{}},
+		{"same text", "same text", []DiffChunk{{DiffOpEqual, "same text"}}},
+		{"", "new", []DiffChunk{{DiffOpInsert, "new"}}},
+		{"old", "", []DiffChunk{{DiffOpDelete, "old"}}},
+		{
+			"you are right about this",
+			"you are wrong about this",
+			[]DiffChunk{{DiffOpEqual, "you are "}, {DiffOpDelete, "right"}, {DiffOpInsert, "wrong"}, {DiffOpEqual, " about this"}},
+		},
+		{
+			"a b c d",
+			"a c d e",
+			[]DiffChunk{{DiffOpEqual, "a "}, {DiffOpDelete, "b "}, {DiffOpEqual, "c d"}, {DiffOpInsert, " e"}},
+		},
+	}
+	for _, test := range tests {
+		got := diffText(test.a, test.b)
+		if len(got) != len(test.want) {
+			t.Errorf("diffText(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("diffText(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,545 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxPostDraftsPerUser    = 100
+	maxDraftScheduleAhead   = time.Hour * 24 * 365
+	scheduledPostsBatchSize = 100
+)
+
+var (
+	errPostDraftNotFound    = httperr.NewNotFound("draft-not-found", "Draft not found.")
+	errDraftCommunityNeeded = httperr.NewBadRequest("draft/no-community", "Draft has no community.")
+)
+
+// DraftRecurrence is how often a scheduled draft is published.
+type DraftRecurrence int
+
+const (
+	// The draft is published once, after which it's deleted.
+	DraftRecurrenceNone = DraftRecurrence(iota)
+
+	DraftRecurrenceDaily
+	DraftRecurrenceWeekly
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (r DraftRecurrence) MarshalText() ([]byte, error) {
+	switch r {
+	case DraftRecurrenceNone:
+		return []byte("none"), nil
+	case DraftRecurrenceDaily:
+		return []byte("daily"), nil
+	case DraftRecurrenceWeekly:
+		return []byte("weekly"), nil
+	}
+	return nil, fmt.Errorf("unknown draft recurrence: %d", r)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (r *DraftRecurrence) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "none", "":
+		*r = DraftRecurrenceNone
+	case "daily":
+		*r = DraftRecurrenceDaily
+	case "weekly":
+		*r = DraftRecurrenceWeekly
+	default:
+		return httperr.NewBadRequest("draft/invalid-recurrence", "Invalid draft recurrence.")
+	}
+	return nil
+}
+
+// next returns the first publish time of the recurrence, starting from t,
+// that's after now. For DraftRecurrenceNone, it returns t.
+func (r DraftRecurrence) next(t, now time.Time) time.Time {
+	days := 0
+	switch r {
+	case DraftRecurrenceDaily:
+		days = 1
+	case DraftRecurrenceWeekly:
+		days = 7
+	default:
+		return t
+	}
+	for !t.After(now) {
+		t = t.AddDate(0, 0, days)
+	}
+	return t
+}
+
+// PostDraft is a post saved on the server that's yet to be published. If
+// ScheduledAt is set, the draft is published at that time by
+// PublishScheduledPosts.
+type PostDraft struct {
+	ID          int             `json:"id"`
+	UserID      uid.ID          `json:"userId"`
+	CommunityID uid.NullID      `json:"communityId"` // Optional, unless the draft is scheduled.
+	Type        PostType        `json:"type"`
+	Title       string          `json:"title"`
+	Body        msql.NullString `json:"body"`
+	URL         msql.NullString `json:"url"`  // For link posts.
+	Poll        *NewPoll        `json:"poll"` // For poll posts.
+	FlairID     *int            `json:"flairId"`
+	PostAs      UserGroup       `json:"userGroup"`
+	ScheduledAt msql.NullTime   `json:"scheduledAt"`
+
+	// Recurring drafts are rescheduled, instead of deleted, after being
+	// published. Only mods can create them.
+	Recurrence DraftRecurrence `json:"recurrence"`
+
+	// If true, the published post is pinned to the community (and the post
+	// last published from the draft, if any, is unpinned). Only mods can set
+	// it.
+	Pin bool `json:"pin"`
+
+	LastPostID   uid.NullID      `json:"lastPostId"`
+	NumPublished int             `json:"noPublished"`
+	LastError    msql.NullString `json:"lastError"` // The error of the last failed scheduled publish.
+	CreatedAt    time.Time       `json:"createdAt"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+}
+
+var selectPostDraftCols = []string{
+	"id",
+	"user_id",
+	"community_id",
+	"type",
+	"title",
+	"body",
+	"url",
+	"poll",
+	"flair_id",
+	"user_group",
+	"scheduled_at",
+	"recurrence",
+	"pin",
+	"last_post_id",
+	"no_published",
+	"last_error",
+	"created_at",
+	"updated_at",
+}
+
+func getPostDrafts(ctx context.Context, db *sql.DB, where string, args ...any) ([]*PostDraft, error) {
+	rows, err := db.QueryContext(ctx, msql.BuildSelectQuery("post_drafts", selectPostDraftCols, nil, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []*PostDraft{}
+	for rows.Next() {
+		d := &PostDraft{}
+		var pollBytes []byte
+		if err := rows.Scan(
+			&d.ID,
+			&d.UserID,
+			&d.CommunityID,
+			&d.Type,
+			&d.Title,
+			&d.Body,
+			&d.URL,
+			&pollBytes,
+			&d.FlairID,
+			&d.PostAs,
+			&d.ScheduledAt,
+			&d.Recurrence,
+			&d.Pin,
+			&d.LastPostID,
+			&d.NumPublished,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if pollBytes != nil {
+			d.Poll = &NewPoll{}
+			if err := json.Unmarshal(pollBytes, d.Poll); err != nil {
+				return nil, fmt.Errorf("unmarshaling poll of draft %d: %w", d.ID, err)
+			}
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// GetPostDraft returns the draft with the id.
+func GetPostDraft(ctx context.Context, db *sql.DB, id int) (*PostDraft, error) {
+	drafts, err := getPostDrafts(ctx, db, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, errPostDraftNotFound
+	}
+	return drafts[0], nil
+}
+
+// GetPostDrafts returns all the drafts of user, most recent first.
+func GetPostDrafts(ctx context.Context, db *sql.DB, user uid.ID) ([]*PostDraft, error) {
+	return getPostDrafts(ctx, db, "WHERE user_id = ? ORDER BY id DESC", user)
+}
+
+// validate normalizes and validates the draft. A draft that's not scheduled
+// may be incomplete, but a scheduled one must be publishable.
+func (d *PostDraft) validate(ctx context.Context, db *sql.DB) error {
+	switch d.Type {
+	case PostTypeText, PostTypeLink, PostTypePoll:
+	case PostTypeImage:
+		// Uploaded images are temporary until they're used in a post, and
+		// would be deleted before the draft is published.
+		return httperr.NewBadRequest("draft/image-posts-unsupported", "Image posts cannot be saved as drafts.")
+	default:
+		return errPostTypeUnsupported
+	}
+	if d.Type != PostTypeLink {
+		d.URL = msql.NullString{}
+	}
+	if d.Type != PostTypePoll {
+		d.Poll = nil
+	}
+	if d.PostAs == UserGroupNaN {
+		d.PostAs = UserGroupNormal
+	}
+	if !d.PostAs.Valid() {
+		return errInvalidUserGroup
+	}
+	if _, err := d.Recurrence.MarshalText(); err != nil {
+		return httperr.NewBadRequest("draft/invalid-recurrence", "Invalid draft recurrence.")
+	}
+
+	if utf8.RuneCountInString(d.Title) > maxPostTitleLength {
+		return httperr.NewBadRequest("post/title-too-long", "Title too long.")
+	}
+	if utf8.RuneCountInString(d.Body.String) > maxPostBodyLength {
+		return httperr.NewBadRequest("post/body-too-long", "Body too long.")
+	}
+	if len(d.URL.String) > maxPostLinkLength {
+		return httperr.NewBadRequest("invalid-url", "Invalid URL.")
+	}
+
+	if d.Recurrence != DraftRecurrenceNone && !d.ScheduledAt.Valid {
+		return httperr.NewBadRequest("draft/not-scheduled", "Recurring drafts must be scheduled.")
+	}
+	if d.Recurrence != DraftRecurrenceNone || d.Pin || d.PostAs == UserGroupMods {
+		if !d.CommunityID.Valid {
+			return errDraftCommunityNeeded
+		}
+		if is, err := UserModOrAdmin(ctx, db, d.CommunityID.ID, d.UserID); err != nil {
+			return err
+		} else if !is {
+			return errNotMod
+		}
+	}
+
+	if d.ScheduledAt.Valid {
+		now := time.Now()
+		if !d.ScheduledAt.Time.After(now) {
+			return httperr.NewBadRequest("draft/invalid-schedule", "Scheduled time must be in the future.")
+		}
+		if d.ScheduledAt.Time.Sub(now) > maxDraftScheduleAhead {
+			return httperr.NewBadRequest("draft/invalid-schedule", "Scheduled time is too far in the future.")
+		}
+		return d.validatePublishable(d.ScheduledAt.Time)
+	}
+	return nil
+}
+
+// validatePublishable returns an error if the draft cannot be published at t.
+func (d *PostDraft) validatePublishable(t time.Time) error {
+	if !d.CommunityID.Valid {
+		return errDraftCommunityNeeded
+	}
+	if err := validatePost(d.Title, d.Body.String); err != nil {
+		return err
+	}
+	switch d.Type {
+	case PostTypeLink:
+		if d.URL.String == "" {
+			return httperr.NewBadRequest("invalid-url", "Invalid URL.")
+		}
+	case PostTypePoll:
+		if d.Poll == nil {
+			return httperr.NewBadRequest("poll/empty", "Poll cannot be empty.")
+		}
+		if err := d.Poll.validate(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *PostDraft) pollJSON() ([]byte, error) {
+	if d.Poll == nil {
+		return nil, nil
+	}
+	return json.Marshal(d.Poll)
+}
+
+// CreatePostDraft saves d as a new draft of user.
+func CreatePostDraft(ctx context.Context, db *sql.DB, user uid.ID, d *PostDraft) (*PostDraft, error) {
+	d.UserID = user
+	if err := d.validate(ctx, db); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM post_drafts WHERE user_id = ?", user).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxPostDraftsPerUser {
+		return nil, httperr.NewForbidden("max-drafts-limit", fmt.Sprintf("You cannot have more than %d drafts.", maxPostDraftsPerUser))
+	}
+
+	poll, err := d.pollJSON()
+	if err != nil {
+		return nil, err
+	}
+	query, args := msql.BuildInsertQuery("post_drafts", []msql.ColumnValue{
+		{Name: "user_id", Value: d.UserID},
+		{Name: "community_id", Value: d.CommunityID},
+		{Name: "type", Value: d.Type},
+		{Name: "title", Value: d.Title},
+		{Name: "body", Value: d.Body},
+		{Name: "url", Value: d.URL},
+		{Name: "poll", Value: poll},
+		{Name: "flair_id", Value: d.FlairID},
+		{Name: "user_group", Value: d.PostAs},
+		{Name: "scheduled_at", Value: d.ScheduledAt},
+		{Name: "recurrence", Value: d.Recurrence},
+		{Name: "pin", Value: d.Pin},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetPostDraft(ctx, db, int(id))
+}
+
+// UnmarshalUpdatableFieldsJSON extracts the updatable values of the draft from
+// the encoded JSON string.
+func (d *PostDraft) UnmarshalUpdatableFieldsJSON(data []byte) error {
+	temp := *d // shallow copy
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	d.CommunityID = temp.CommunityID
+	d.Type = temp.Type
+	d.Title = temp.Title
+	d.Body = temp.Body
+	d.URL = temp.URL
+	d.Poll = temp.Poll
+	d.FlairID = temp.FlairID
+	d.PostAs = temp.PostAs
+	d.ScheduledAt = temp.ScheduledAt
+	d.Recurrence = temp.Recurrence
+	d.Pin = temp.Pin
+	return nil
+}
+
+// Update saves the updatable fields of the draft.
+func (d *PostDraft) Update(ctx context.Context, db *sql.DB) error {
+	if err := d.validate(ctx, db); err != nil {
+		return err
+	}
+	poll, err := d.pollJSON()
+	if err != nil {
+		return err
+	}
+	d.UpdatedAt = time.Now()
+	d.LastError = msql.NullString{}
+	_, err = db.ExecContext(ctx, `
+		UPDATE post_drafts SET
+			community_id = ?,
+			type = ?,
+			title = ?,
+			body = ?,
+			url = ?,
+			poll = ?,
+			flair_id = ?,
+			user_group = ?,
+			scheduled_at = ?,
+			recurrence = ?,
+			pin = ?,
+			last_error = NULL,
+			updated_at = ?
+		WHERE id = ?`,
+		d.CommunityID, d.Type, d.Title, d.Body, d.URL, poll, d.FlairID, d.PostAs, d.ScheduledAt, d.Recurrence, d.Pin, d.UpdatedAt, d.ID)
+	return err
+}
+
+// Delete deletes the draft.
+func (d *PostDraft) Delete(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM post_drafts WHERE id = ?", d.ID)
+	return err
+}
+
+// Publish creates a post out of the draft. A non-recurring draft is deleted
+// after it's published.
+func (d *PostDraft) Publish(ctx context.Context, db *sql.DB) (*Post, error) {
+	return d.publish(ctx, db, time.Now())
+}
+
+func (d *PostDraft) publish(ctx context.Context, db *sql.DB, now time.Time) (*Post, error) {
+	if err := d.validatePublishable(now); err != nil {
+		return nil, err
+	}
+
+	user, err := GetUser(ctx, db, d.UserID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if user.Deleted {
+		return nil, ErrUserDeleted
+	}
+	if user.Banned {
+		return nil, httperr.NewForbidden("user-banned", "User is banned.")
+	}
+
+	var post *Post
+	community := d.CommunityID.ID
+	switch d.Type {
+	case PostTypeText:
+		post, err = CreateTextPost(ctx, db, d.UserID, community, d.Title, d.Body.String, d.FlairID)
+	case PostTypeLink:
+		post, err = CreateLinkPost(ctx, db, d.UserID, community, d.Title, d.URL.String, d.FlairID)
+	case PostTypePoll:
+		poll := *d.Poll // CreatePollPost modifies the poll.
+		poll.Options = append([]string(nil), d.Poll.Options...)
+		post, err = CreatePollPost(ctx, db, d.UserID, community, d.Title, d.Body.String, &poll, d.FlairID)
+	default:
+		return nil, errPostTypeUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// From here on the post is published, so the errors are only logged.
+	if d.PostAs != UserGroupNormal {
+		if err := post.ChangeUserGroup(ctx, db, d.UserID, d.PostAs); err != nil {
+			log.Printf("Error changing user group of post %v (draft %d): %v\n", post.ID, d.ID, err)
+		}
+	}
+	if err := post.Vote(ctx, db, d.UserID, true); err != nil {
+		log.Printf("Error upvoting post %v (draft %d): %v\n", post.ID, d.ID, err)
+	}
+	if d.Pin {
+		if d.LastPostID.Valid {
+			if last, err := getPost(ctx, db, &d.LastPostID.ID, "", nil, true); err == nil && last.Pinned {
+				if err := last.Pin(ctx, db, d.UserID, false, true, false); err != nil {
+					log.Printf("Error unpinning post %v (draft %d): %v\n", last.ID, d.ID, err)
+				}
+			}
+		}
+		if err := post.Pin(ctx, db, d.UserID, false, false, false); err != nil {
+			log.Printf("Error pinning post %v (draft %d): %v\n", post.ID, d.ID, err)
+		}
+	}
+
+	if d.Recurrence == DraftRecurrenceNone {
+		if err := d.Delete(ctx, db); err != nil {
+			return nil, err
+		}
+		return post, nil
+	}
+
+	d.reschedule(now)
+	d.LastPostID = uid.NullID{ID: post.ID, Valid: true}
+	d.NumPublished++
+	d.LastError = msql.NullString{}
+	poll, err := d.pollJSON()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE post_drafts SET scheduled_at = ?, poll = ?, last_post_id = ?, no_published = no_published + 1, last_error = NULL WHERE id = ?",
+		d.ScheduledAt, poll, d.LastPostID, d.ID); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// reschedule moves the scheduled time of a recurring draft to its next
+// occurrence after now. The close time of the poll, if any, is moved along.
+func (d *PostDraft) reschedule(now time.Time) {
+	if !d.ScheduledAt.Valid {
+		return
+	}
+	next := d.Recurrence.next(d.ScheduledAt.Time, now)
+	if d.Poll != nil && d.Poll.ClosesAt.Valid {
+		d.Poll.ClosesAt.Time = d.Poll.ClosesAt.Time.Add(next.Sub(d.ScheduledAt.Time))
+	}
+	d.ScheduledAt.Time = next
+}
+
+// recordPublishError saves the error of a failed scheduled publish of the
+// draft, for its author to see. A non-recurring draft is unscheduled, so that
+// it's not retried, and a recurring draft is moved to its next occurrence.
+func (d *PostDraft) recordPublishError(ctx context.Context, db *sql.DB, pubErr error, now time.Time) error {
+	if d.Recurrence == DraftRecurrenceNone {
+		d.ScheduledAt = msql.NullTime{}
+	} else {
+		d.reschedule(now)
+	}
+	d.LastError = msql.NewNullString(publishErrorMessage(pubErr))
+	poll, err := d.pollJSON()
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "UPDATE post_drafts SET scheduled_at = ?, poll = ?, last_error = ? WHERE id = ?",
+		d.ScheduledAt, poll, d.LastError, d.ID)
+	return err
+}
+
+// publishErrorMessage returns the message of err, an error of publishing a
+// draft, that's shown to the author of the draft. Internal errors are not
+// shown, only logged.
+func publishErrorMessage(err error) string {
+	if httperr.IsInternalServerError(err) {
+		return "The post could not be published due to an internal error."
+	}
+	return utils.TruncateUnicodeString(err.(*httperr.Error).Message, 1024)
+}
+
+// PublishScheduledPosts publishes the drafts whose scheduled time has come. It
+// returns the number of posts published.
+func PublishScheduledPosts(ctx context.Context, db *sql.DB) (int, error) {
+	now := time.Now()
+	drafts, err := getPostDrafts(ctx, db, "WHERE scheduled_at <= ? ORDER BY scheduled_at LIMIT ?", now, scheduledPostsBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, d := range drafts {
+		if _, err := d.publish(ctx, db, now); err != nil {
+			log.Printf("Error publishing scheduled draft %d: %v\n", d.ID, err)
+			if err := d.recordPublishError(ctx, db, err, now); err != nil {
+				return n, err
+			}
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
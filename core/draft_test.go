@@ -0,0 +1,39 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+func TestDraftRecurrenceNext(t *testing.T) {
+	start := time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC) // A Monday.
+	tests := []struct {
+		recurrence DraftRecurrence
+		now        time.Time
+		want       time.Time
+	}{
+		{DraftRecurrenceNone, start.Add(time.Hour), start},
+		{DraftRecurrenceDaily, start, start.AddDate(0, 0, 1)},
+		{DraftRecurrenceDaily, start.Add(-time.Hour), start},
+		{DraftRecurrenceWeekly, start, start.AddDate(0, 0, 7)},
+		{DraftRecurrenceWeekly, start.AddDate(0, 0, 15), start.AddDate(0, 0, 21)}, // Missed runs are skipped.
+	}
+	for i, test := range tests {
+		if got := test.recurrence.next(start, test.now); !got.Equal(test.want) {
+			t.Errorf("test %d: got %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestPublishErrorMessage(t *testing.T) {
+	if got := publishErrorMessage(errFlairRequired); got != errFlairRequired.(*httperr.Error).Message {
+		t.Errorf("publishErrorMessage(errFlairRequired) = %q", got)
+	}
+	internal := errors.New("Error 1213: Deadlock found when trying to get lock")
+	if got := publishErrorMessage(internal); got == internal.Error() {
+		t.Errorf("publishErrorMessage shows the internal error %q", got)
+	}
+}
@@ -12,6 +12,8 @@ var (
 	ErrWrongPassword = &httperr.Error{HTTPStatus: http.StatusUnauthorized, Code: "wrong-password", Message: "Username and password do not match."}
 
 	ErrUserDeleted = httperr.NewForbidden("user-deleted", "Cannot continue because the user is deleted.")
+
+	ErrInvalidCommentSort = httperr.NewBadRequest("invalid-comment-sort", "Invalid comment sort.")
 )
 
 var (
@@ -26,6 +26,9 @@ const (
 	FeedSortTopMonth
 	FeedSortTopYear
 	FeedSortTopAll
+	FeedSortRising
+	FeedSortControversial
+	FeedSortBest
 )
 
 // Valid reports whether f is a valid FeedSort.
@@ -53,6 +56,12 @@ func (s FeedSort) MarshalText() ([]byte, error) {
 		return []byte("hot"), nil
 	case FeedSortActivity:
 		return []byte("activity"), nil
+	case FeedSortRising:
+		return []byte("rising"), nil
+	case FeedSortControversial:
+		return []byte("controversial"), nil
+	case FeedSortBest:
+		return []byte("best"), nil
 	}
 	return nil, fmt.Errorf("cannot marshal unsupported FeedSort (%v)", int(s))
 }
@@ -81,18 +90,27 @@ func (s *FeedSort) UnmarshalText(text []byte) error {
 		*s = FeedSortHot
 	case "activity":
 		*s = FeedSortActivity
+	case "rising":
+		*s = FeedSortRising
+	case "controversial":
+		*s = FeedSortControversial
+	case "best":
+		*s = FeedSortBest
 	default:
 		return fmt.Errorf("cannot unmarshal unsupported FeedSort: %v", t)
 	}
 	return nil
 }
 
-// FeedType distinguishes between the two main content feeds.
+// FeedType distinguishes between the two main content feeds (and a multi and
+// the feed of followed users, which a user may set as their home feed).
 type FeedType int
 
 const (
 	FeedTypeAll = FeedType(iota)
 	FeedTypeSubscriptions
+	FeedTypeMulti
+	FeedTypeFollowing
 )
 
 func (ft FeedType) Valid() bool {
@@ -107,6 +125,10 @@ func (ft FeedType) MarshalText() ([]byte, error) {
 		return []byte("all"), nil
 	case FeedTypeSubscriptions:
 		return []byte("subscriptions"), nil
+	case FeedTypeMulti:
+		return []byte("multi"), nil
+	case FeedTypeFollowing:
+		return []byte("following"), nil
 	}
 	return nil, fmt.Errorf("cannot marshal unsupported FeedType (%v)", int(ft))
 }
@@ -122,6 +144,10 @@ func (ft *FeedType) UnmarshalText(text []byte) error {
 		*ft = FeedTypeAll
 	case "subscriptions":
 		*ft = FeedTypeSubscriptions
+	case "multi":
+		*ft = FeedTypeMulti
+	case "following":
+		*ft = FeedTypeFollowing
 	default:
 		return fmt.Errorf("cannot unmarshal text unsupported text: %v", string(text))
 	}
@@ -149,6 +175,12 @@ func newFeedResultSet(posts []*Post, limit int, sort FeedSort) *FeedResultSet {
 			nextnext = strconv.Itoa(posts[limit].Hotness) + "." + posts[limit].ID.String()
 		case FeedSortActivity:
 			nextnext = posts[limit].LastActivityAt.UnixNano()
+		case FeedSortRising:
+			nextnext = strconv.Itoa(posts[limit].Rising) + "." + posts[limit].ID.String()
+		case FeedSortControversial:
+			nextnext = strconv.Itoa(posts[limit].Controversy) + "." + posts[limit].ID.String()
+		case FeedSortBest:
+			nextnext = strconv.Itoa(posts[limit].Best) + "." + posts[limit].ID.String()
 		default:
 			// Shouldn't happen, ever.
 			panic("invalid feed sort")
@@ -177,14 +209,28 @@ func NextPointsIDCursor(text string) (p int, id *uid.ID, err error) {
 	return
 }
 
+// homeFeedWhereClause appends to where a condition that limits posts to those
+// in the home feed of user: the communities of the user's home multi, if the
+// user has set one, or else the communities the user has joined.
 func homeFeedWhereClause(ctx context.Context, db *sql.DB, user uid.ID, where string, args []any) (string, []any, error) {
+	if multi, err := getHomeMulti(ctx, db, user); err != nil {
+		return where, args, err
+	} else if multi != nil {
+		communityIDs, err := multi.CommunityIDs(ctx, db)
+		if err != nil {
+			return where, args, err
+		}
+		where, args = communitiesWhereClause(where, args, communityIDs)
+		return where, args, nil
+	}
+
 	rows, err := db.QueryContext(ctx, "SELECT community_members.community_id FROM community_members WHERE community_members.user_id = ?", user)
 	if err != nil {
 		return where, args, err
 	}
 	defer rows.Close()
 
-	var communityIDs []any
+	var communityIDs []uid.ID
 	for rows.Next() {
 		var cid uid.ID
 		if err := rows.Scan(&cid); err != nil {
@@ -197,32 +243,70 @@ func homeFeedWhereClause(ctx context.Context, db *sql.DB, user uid.ID, where str
 		return where, args, err
 	}
 
+	where, args = communitiesWhereClause(where, args, communityIDs)
+	return where, args, nil
+}
+
+// followingWhereClause appends to where a condition that limits posts to those
+// by users that viewer follows.
+func followingWhereClause(where, postsTable string, args []any, viewer uid.ID) (string, []any) {
+	joiner := ""
+	if where != "" {
+		joiner = "AND"
+	}
+	where = fmt.Sprintf("%s %s %s.user_id IN (SELECT followed_user_id FROM user_follows WHERE user_id = ?) ", where, joiner, postsTable)
+	args = append(args, viewer)
+	return where, args
+}
+
+// flairWhereClause appends to where a condition that limits posts to those
+// with flair.
+func flairWhereClause(where, postsTable string, args []any, flair int) (string, []any) {
+	joiner := ""
+	if where != "" {
+		joiner = "AND"
+	}
+	if postsTable == "posts" {
+		where = fmt.Sprintf("%s %s posts.flair_id = ? ", where, joiner)
+	} else {
+		where = fmt.Sprintf("%s %s %s.post_id IN (SELECT id FROM posts WHERE flair_id = ?) ", where, joiner, postsTable)
+	}
+	args = append(args, flair)
+	return where, args
+}
+
+// communitiesWhereClause appends to where a condition that limits posts to
+// those in communities.
+func communitiesWhereClause(where string, args []any, communities []uid.ID) (string, []any) {
 	joiner := ""
 	if where != "" {
 		joiner = "AND"
 	}
 
-	if len(communityIDs) == 0 {
-		// User is not subscribed to any communities. Use the sentinel value of
-		// zero-bytes community ID, which no community would have, to return an
-		// empty result set.
+	if len(communities) == 0 {
+		// No communities. Use the sentinel value of zero-bytes community ID,
+		// which no community would have, to return an empty result set.
 		where = fmt.Sprintf("%s %s community_id = ? ", where, joiner)
 		args = append(args, uid.ID{})
-		return where, args, nil
+		return where, args
 	}
 
-	where = fmt.Sprintf("%s %s community_id IN %s ", where, joiner, msql.InClauseQuestionMarks(len(communityIDs)))
-	args = append(args, communityIDs...)
-
-	return where, args, nil
+	where = fmt.Sprintf("%s %s community_id IN %s ", where, joiner, msql.InClauseQuestionMarks(len(communities)))
+	for _, id := range communities {
+		args = append(args, id)
+	}
+	return where, args
 }
 
 type FeedOptions struct {
 	Sort        FeedSort
 	DefaultSort bool
 	Viewer      *uid.ID
-	Community   *uid.ID // Community should be nil if Homefeed is true.
-	Homefeed    bool    // If true, the requested feed is the feed with only posts from communities where the user is a member
+	Community   *uid.ID  // Community should be nil if Homefeed is true.
+	Homefeed    bool     // If true, the requested feed is the feed with only posts from communities where the user is a member
+	Communities []uid.ID // If non-nil (and Community is nil and Homefeed is false), only posts from these communities are returned (as in multis).
+	Following   bool     // If true (and Community is nil and Homefeed is false), only posts by users the viewer follows are returned.
+	Flair       *int     // If non-nil, only posts with this flair are returned.
 	Limit       int
 	Next        string // The pagination cursor, taken from previous API response.
 }
@@ -232,6 +316,12 @@ var (
 	ErrInvalidFeedSort   = httperr.NewBadRequest("invalid-sort", "Invalid feed sort.")
 )
 
+// muteCommunities reports whether posts from the communities muted by the
+// viewer are to be excluded from the feed.
+func (o *FeedOptions) muteCommunities() bool {
+	return o.Community == nil && !o.Homefeed && o.Communities == nil
+}
+
 // nextID parses o.Next assuming it contains an uid.ID.
 func (o *FeedOptions) nextID() (_ uid.ID, err error) {
 	var id uid.ID
@@ -267,11 +357,21 @@ func GetFeed(ctx context.Context, db *sql.DB, opts *FeedOptions) (_ *FeedResultS
 	if !opts.Sort.Valid() {
 		return nil, ErrInvalidFeedSort
 	}
+	if opts.Following && opts.Viewer == nil {
+		return nil, errors.New("following feed requested without a viewer")
+	}
+	if opts.Community != nil {
+		if ok, err := userCanViewCommunity(ctx, db, *opts.Community, opts.Viewer); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, errCommunityPrivate
+		}
+	}
 	var set *FeedResultSet
 	if opts.Sort == FeedSortLatest {
 		set, err = getPostsLatest(ctx, db, opts)
-	} else if opts.Sort == FeedSortHot {
-		set, err = getPostsHot(ctx, db, opts)
+	} else if opts.Sort == FeedSortHot || opts.Sort == FeedSortRising || opts.Sort == FeedSortControversial || opts.Sort == FeedSortBest {
+		set, err = getPostsByScore(ctx, db, opts)
 	} else if opts.Sort == FeedSortActivity {
 		set, err = getPostsActivity(ctx, db, opts)
 	} else {
@@ -280,11 +380,19 @@ func GetFeed(ctx context.Context, db *sql.DB, opts *FeedOptions) (_ *FeedResultS
 	if err != nil {
 		return nil, err
 	}
-	if opts.DefaultSort {
+	if opts.DefaultSort && opts.Flair == nil {
 		// Merge pinned posts.
-		return mergePinnedPosts(ctx, db, opts.Viewer, opts.Community, opts.Next, set)
+		if set, err = mergePinnedPosts(ctx, db, opts.Viewer, opts.Community, opts.Next, set); err != nil {
+			return nil, err
+		}
+	}
+	// The posts are filtered after the pagination cursor is set, so that
+	// filtered posts don't affect pagination. A page may therefore have fewer
+	// posts than the limit.
+	if set.Posts, err = filterPosts(ctx, db, opts.Viewer, set.Posts); err != nil {
+		return nil, err
 	}
-	return set, err
+	return set, nil
 }
 
 // getPostsLatest returns site wide latest posts, if opts.Community is nil, or
@@ -303,6 +411,10 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		if err != nil {
 			return nil, err
 		}
+	} else if opts.Following {
+		where, args = followingWhereClause(where, "posts", args, *opts.Viewer)
+	} else if opts.Communities != nil {
+		where, args = communitiesWhereClause(where, args, opts.Communities)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -310,7 +422,13 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		}
 	}
 	if loggedIn {
-		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.muteCommunities())
+		where, args = whereFlairsNotFiltered(where, "posts", args, *opts.Viewer)
+	}
+	where, args = whereNotShadowBanned(where, "posts", args, opts.Viewer)
+	where, args = whereCommunityVisible(where, "posts", args, opts.Viewer)
+	if opts.Flair != nil {
+		where, args = flairWhereClause(where, "posts", args, *opts.Flair)
 	}
 	if opts.Next != "" {
 		next, err := opts.nextID()
@@ -422,9 +540,48 @@ func whereMutedAndHidden(where, postsTable string, args []any, viewer uid.ID, mu
 	return where, args
 }
 
-// getPostsHot returns site wide hot posts, if opts.Community is nil, or hot
-// posts in opts.Community, if not.
-func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
+// whereNotShadowBanned appends to where a condition that excludes the posts by
+// shadow-banned users, except for those of viewer.
+func whereNotShadowBanned(where, postsTable string, args []any, viewer *uid.ID) (string, []any) {
+	if !(where == "" || strings.TrimSpace(strings.ToUpper(where)) == "WHERE") {
+		where += "AND "
+	}
+	cond, condArgs := shadowBannedCondition(postsTable+".user_id", viewer)
+	return where + cond + " ", append(args, condArgs...)
+}
+
+// whereCommunityVisible appends to where a condition that excludes the posts
+// in private communities that viewer is not a member of.
+func whereCommunityVisible(where, postsTable string, args []any, viewer *uid.ID) (string, []any) {
+	if !(where == "" || strings.TrimSpace(strings.ToUpper(where)) == "WHERE") {
+		where += "AND "
+	}
+	hidden, hiddenArgs := hiddenCommunitiesQuery(viewer)
+	return where + fmt.Sprintf("%s.community_id NOT IN (%s) ", postsTable, hidden), append(args, hiddenArgs...)
+}
+
+// sortScoreColumn returns the column of the posts table holding the score by
+// which posts are ordered in feeds of sort s, for the sorts that have one.
+func sortScoreColumn(s FeedSort) string {
+	switch s {
+	case FeedSortHot:
+		return "hotness"
+	case FeedSortRising:
+		return "rising"
+	case FeedSortControversial:
+		return "controversy"
+	case FeedSortBest:
+		return "best"
+	default:
+		panic(fmt.Sprintf("FeedSort (%v) has no score column", s))
+	}
+}
+
+// getPostsByScore returns site wide posts, if opts.Community is nil, or posts
+// in opts.Community, if not, ordered by the score of opts.Sort (which is one of
+// hot, rising, controversial, and best).
+func getPostsByScore(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
+	col := "posts." + sortScoreColumn(opts.Sort)
 	var args []any
 	loggedIn := opts.Viewer != nil
 
@@ -438,6 +595,10 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		if err != nil {
 			return nil, err
 		}
+	} else if opts.Following {
+		where, args = followingWhereClause(where, "posts", args, *opts.Viewer)
+	} else if opts.Communities != nil {
+		where, args = communitiesWhereClause(where, args, opts.Communities)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -445,18 +606,27 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		}
 	}
 	if loggedIn {
-		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.muteCommunities())
+		where, args = whereFlairsNotFiltered(where, "posts", args, *opts.Viewer)
+	}
+	where, args = whereNotShadowBanned(where, "posts", args, opts.Viewer)
+	where, args = whereCommunityVisible(where, "posts", args, opts.Viewer)
+	if opts.Flair != nil {
+		where, args = flairWhereClause(where, "posts", args, *opts.Flair)
+	}
+	if opts.Sort == FeedSortRising {
+		where += "AND posts.rising > 0 "
 	}
 	if opts.Next != "" {
-		nextHotness, nextID, err := opts.nextPointsID()
+		nextScore, nextID, err := opts.nextPointsID()
 		if err != nil {
 			return nil, err
 		}
-		where += "AND (posts.hotness, posts.id) <= (?, ?) "
-		args = append(args, nextHotness)
+		where += fmt.Sprintf("AND (%s, posts.id) <= (?, ?) ", col)
+		args = append(args, nextScore)
 		args = append(args, nextID)
 	}
-	where += "ORDER BY posts.hotness DESC, posts.id DESC LIMIT ?"
+	where += fmt.Sprintf("ORDER BY %s DESC, posts.id DESC LIMIT ?", col)
 	query := buildSelectPostQuery(loggedIn, where)
 
 	var rows *sql.Rows
@@ -474,7 +644,7 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		}
 		return nil, err
 	}
-	return newFeedResultSet(posts, opts.Limit, FeedSortHot), nil
+	return newFeedResultSet(posts, opts.Limit, opts.Sort), nil
 }
 
 // getPostsTopAll returns site wide all time top posts, if opts.Community is
@@ -493,6 +663,10 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		if err != nil {
 			return nil, err
 		}
+	} else if opts.Following {
+		where, args = followingWhereClause(where, "posts", args, *opts.Viewer)
+	} else if opts.Communities != nil {
+		where, args = communitiesWhereClause(where, args, opts.Communities)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -500,7 +674,13 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		}
 	}
 	if loggedIn {
-		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.muteCommunities())
+		where, args = whereFlairsNotFiltered(where, "posts", args, *opts.Viewer)
+	}
+	where, args = whereNotShadowBanned(where, "posts", args, opts.Viewer)
+	where, args = whereCommunityVisible(where, "posts", args, opts.Viewer)
+	if opts.Flair != nil {
+		where, args = flairWhereClause(where, "posts", args, *opts.Flair)
 	}
 	if opts.Next != "" {
 		nextPoints, nextID, err := opts.nextPointsID()
@@ -548,6 +728,10 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		if err != nil {
 			return nil, err
 		}
+	} else if opts.Following {
+		where, args = followingWhereClause(where, table, args, *opts.Viewer)
+	} else if opts.Communities != nil {
+		where, args = communitiesWhereClause(where, args, opts.Communities)
 	} else {
 		if opts.Community != nil {
 			where += "community_id = ? "
@@ -555,7 +739,13 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		}
 	}
 	if opts.Viewer != nil {
-		where, args = whereMutedAndHidden(where, table, args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereMutedAndHidden(where, table, args, *opts.Viewer, opts.muteCommunities())
+		where, args = whereFlairsNotFiltered(where, table, args, *opts.Viewer)
+	}
+	where, args = whereNotShadowBanned(where, table, args, opts.Viewer)
+	where, args = whereCommunityVisible(where, table, args, opts.Viewer)
+	if opts.Flair != nil {
+		where, args = flairWhereClause(where, table, args, *opts.Flair)
 	}
 	if opts.Next != "" {
 		nextPoints, nextID, err := opts.nextPointsID()
@@ -612,6 +802,10 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 		if err != nil {
 			return nil, err
 		}
+	} else if opts.Following {
+		where, args = followingWhereClause(where, "posts", args, *opts.Viewer)
+	} else if opts.Communities != nil {
+		where, args = communitiesWhereClause(where, args, opts.Communities)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -619,7 +813,13 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 		}
 	}
 	if loggedIn {
-		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.muteCommunities())
+		where, args = whereFlairsNotFiltered(where, "posts", args, *opts.Viewer)
+	}
+	where, args = whereNotShadowBanned(where, "posts", args, opts.Viewer)
+	where, args = whereCommunityVisible(where, "posts", args, opts.Viewer)
+	if opts.Flair != nil {
+		where, args = flairWhereClause(where, "posts", args, *opts.Flair)
 	}
 	if opts.Next != "" {
 		next, err := opts.nextInt64()
@@ -736,6 +936,18 @@ func GetUserFeed(ctx context.Context, db *sql.DB, viewer *uid.ID, userID uid.ID,
 		return nil, httperr.NewBadRequest("invalid-filter", "filter must be one of 'posts' or 'comments' or it must be empty")
 	}
 
+	// The content of shadow-banned users is visible only to themselves.
+	if viewer == nil || *viewer != userID {
+		if shadowBanned, err := userShadowBanned(ctx, db, userID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errUserNotFound
+			}
+			return nil, err
+		} else if shadowBanned {
+			return &UserFeedResultSet{Items: []UserFeedItem{}}, nil
+		}
+	}
+
 	query := "SELECT target_id, target_type FROM posts_comments WHERE user_id = ? "
 	args := []any{userID}
 
@@ -757,6 +969,12 @@ func GetUserFeed(ctx context.Context, db *sql.DB, viewer *uid.ID, userID uid.ID,
 		query += "AND deleted = false "
 	}
 
+	// Hide the posts and comments in the private communities that the viewer
+	// is not a member of.
+	hidden, hiddenArgs := hiddenCommunitiesQuery(viewer)
+	query += fmt.Sprintf("AND target_id NOT IN (SELECT id FROM posts WHERE community_id IN (%s) UNION SELECT id FROM comments WHERE community_id IN (%s)) ", hidden, hidden)
+	args = append(append(args, hiddenArgs...), hiddenArgs...)
+
 	if next != nil {
 		query += "AND target_id <= ? "
 		args = append(args, *next)
@@ -818,6 +1036,19 @@ func GetUserFeed(ctx context.Context, db *sql.DB, viewer *uid.ID, userID uid.ID,
 		for _, post := range posts {
 			postItemsMap[post.ID].Item = post
 		}
+		if viewer != nil && *viewer != userID {
+			// Apply the viewer's content filters.
+			kept, err := filterPosts(ctx, db, viewer, posts)
+			if err != nil {
+				return nil, err
+			}
+			for _, post := range posts {
+				postItemsMap[post.ID].Item = nil
+			}
+			for _, post := range kept {
+				postItemsMap[post.ID].Item = post
+			}
+		}
 	}
 
 	if len(commentIDs) > 0 {
@@ -836,6 +1067,16 @@ func GetUserFeed(ctx context.Context, db *sql.DB, viewer *uid.ID, userID uid.ID,
 	if len(ids) == limit+1 {
 		set.Next = &ids[limit]
 	}
+
+	// Remove the posts hidden by content filters (and any items that could
+	// not be found).
+	items := set.Items[:0]
+	for _, item := range set.Items {
+		if item.Item != nil {
+			items = append(items, item)
+		}
+	}
+	set.Items = items
 	return set, nil
 }
 
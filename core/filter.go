@@ -0,0 +1,408 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	maxContentFiltersPerUser   = 100
+	maxContentFilterPatternLen = 255
+)
+
+// ContentFilterType is the type of a content filter: what part of a post it
+// matches against.
+type ContentFilterType int
+
+const (
+	// A keyword filter matches a whole word (or a regular expression) in the
+	// title, and optionally the body, of posts.
+	ContentFilterTypeKeyword = ContentFilterType(iota)
+
+	// A domain filter matches link posts to a domain or any of its
+	// subdomains.
+	ContentFilterTypeDomain
+
+	// An NSFW filter matches all posts in NSFW communities.
+	ContentFilterTypeNSFW
+
+	// A flair filter matches the posts with a post flair, whose ID is the
+	// pattern of the filter.
+	ContentFilterTypeFlair
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (t ContentFilterType) MarshalText() ([]byte, error) {
+	switch t {
+	case ContentFilterTypeKeyword:
+		return []byte("keyword"), nil
+	case ContentFilterTypeDomain:
+		return []byte("domain"), nil
+	case ContentFilterTypeNSFW:
+		return []byte("nsfw"), nil
+	case ContentFilterTypeFlair:
+		return []byte("flair"), nil
+	}
+	return nil, fmt.Errorf("unknown content filter type: %d", t)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (t *ContentFilterType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "keyword":
+		*t = ContentFilterTypeKeyword
+	case "domain":
+		*t = ContentFilterTypeDomain
+	case "nsfw":
+		*t = ContentFilterTypeNSFW
+	case "flair":
+		*t = ContentFilterTypeFlair
+	default:
+		return httperr.NewBadRequest("invalid-filter-type", "Invalid content filter type.")
+	}
+	return nil
+}
+
+// ContentFilterAction is what happens to posts that match a content filter.
+type ContentFilterAction int
+
+const (
+	// The matching posts are removed from feeds.
+	ContentFilterActionHide = ContentFilterAction(iota)
+
+	// The matching posts are shown collapsed, with a notice of the filter
+	// (see Post.Filtered).
+	ContentFilterActionCollapse
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (a ContentFilterAction) MarshalText() ([]byte, error) {
+	switch a {
+	case ContentFilterActionHide:
+		return []byte("hide"), nil
+	case ContentFilterActionCollapse:
+		return []byte("collapse"), nil
+	}
+	return nil, fmt.Errorf("unknown content filter action: %d", a)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (a *ContentFilterAction) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "hide":
+		*a = ContentFilterActionHide
+	case "collapse":
+		*a = ContentFilterActionCollapse
+	default:
+		return httperr.NewBadRequest("invalid-filter-action", "Invalid content filter action.")
+	}
+	return nil
+}
+
+// ContentFilter is a user's filter of posts in feeds.
+type ContentFilter struct {
+	ID        int                 `json:"id"`
+	UserID    uid.ID              `json:"-"`
+	Type      ContentFilterType   `json:"type"`
+	Pattern   string              `json:"pattern"`
+	Regex     bool                `json:"regex"`     // Only for keyword filters; if false, Pattern is matched as a whole word.
+	MatchBody bool                `json:"matchBody"` // Only for keyword filters.
+	Action    ContentFilterAction `json:"action"`
+	CreatedAt time.Time           `json:"createdAt"`
+
+	re      *regexp.Regexp // For keyword filters.
+	flairID int            // For flair filters.
+}
+
+// compile validates and normalizes the filter, and compiles the regular
+// expression of keyword filters.
+func (f *ContentFilter) compile() error {
+	f.Pattern = strings.TrimSpace(f.Pattern)
+	if len(f.Pattern) > maxContentFilterPatternLen {
+		return httperr.NewBadRequest("filter-pattern-too-long", "Filter pattern is too long.")
+	}
+	switch f.Type {
+	case ContentFilterTypeKeyword:
+		if f.Pattern == "" {
+			return httperr.NewBadRequest("filter-pattern-empty", "Filter pattern cannot be empty.")
+		}
+		expr := f.Pattern
+		if !f.Regex {
+			expr = `\b` + regexp.QuoteMeta(expr) + `\b`
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return httperr.NewBadRequest("invalid-filter-regex", fmt.Sprintf("Invalid regular expression: %v.", err))
+		}
+		f.re = re
+	case ContentFilterTypeDomain:
+		f.Pattern = strings.TrimPrefix(strings.ToLower(f.Pattern), "www.")
+		if f.Pattern == "" || strings.ContainsAny(f.Pattern, "/: ") {
+			return httperr.NewBadRequest("invalid-filter-domain", "Invalid domain.")
+		}
+		f.Regex, f.MatchBody = false, false
+	case ContentFilterTypeNSFW:
+		f.Pattern, f.Regex, f.MatchBody = "", false, false
+	case ContentFilterTypeFlair:
+		id, err := strconv.Atoi(f.Pattern)
+		if err != nil || id <= 0 {
+			return httperr.NewBadRequest("invalid-filter-flair", "Invalid flair id.")
+		}
+		f.Pattern, f.Regex, f.MatchBody = strconv.Itoa(id), false, false
+		f.flairID = id
+	default:
+		return httperr.NewBadRequest("invalid-filter-type", "Invalid content filter type.")
+	}
+	return nil
+}
+
+// matches reports whether post matches the filter. nsfw is whether the
+// post's community is NSFW.
+func (f *ContentFilter) matches(post *Post, nsfw bool) bool {
+	switch f.Type {
+	case ContentFilterTypeKeyword:
+		if f.re.MatchString(post.Title) {
+			return true
+		}
+		return f.MatchBody && post.Body.Valid && f.re.MatchString(post.Body.String)
+	case ContentFilterTypeDomain:
+		if post.Link == nil {
+			return false
+		}
+		host := strings.TrimPrefix(strings.ToLower(post.Link.Hostname), "www.")
+		return host == f.Pattern || strings.HasSuffix(host, "."+f.Pattern)
+	case ContentFilterTypeNSFW:
+		return nsfw
+	case ContentFilterTypeFlair:
+		return post.Flair != nil && post.Flair.ID == f.flairID
+	}
+	return false
+}
+
+// PostFilterNotice is set on posts that are collapsed by a content filter of
+// the viewer.
+type PostFilterNotice struct {
+	FilterID int               `json:"filterId"`
+	Type     ContentFilterType `json:"type"`
+	Pattern  string            `json:"pattern"`
+	Notice   string            `json:"notice"`
+}
+
+func newPostFilterNotice(f *ContentFilter, post *Post) *PostFilterNotice {
+	var notice string
+	switch f.Type {
+	case ContentFilterTypeKeyword:
+		notice = fmt.Sprintf("This post matches your filter %q.", f.Pattern)
+	case ContentFilterTypeDomain:
+		notice = fmt.Sprintf("This post links to %s, which you have filtered.", f.Pattern)
+	case ContentFilterTypeNSFW:
+		notice = "This post is NSFW."
+	case ContentFilterTypeFlair:
+		notice = fmt.Sprintf("This post has the flair %q, which you have filtered.", post.Flair.Text)
+	}
+	return &PostFilterNotice{
+		FilterID: f.ID,
+		Type:     f.Type,
+		Pattern:  f.Pattern,
+		Notice:   notice,
+	}
+}
+
+// GetContentFilters returns all the content filters of user.
+func GetContentFilters(ctx context.Context, db *sql.DB, user uid.ID) ([]*ContentFilter, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, user_id, type, pattern, is_regex, match_body, action, created_at FROM content_filters WHERE user_id = ? ORDER BY id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filters := []*ContentFilter{}
+	for rows.Next() {
+		f := &ContentFilter{}
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Type, &f.Pattern, &f.Regex, &f.MatchBody, &f.Action, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := f.compile(); err != nil {
+			// A filter that was valid when it was saved should not fail to
+			// compile, but don't break the feeds of the user over it.
+			continue
+		}
+		filters = append(filters, f)
+	}
+	return filters, rows.Err()
+}
+
+// CreateContentFilter validates and saves a new content filter of user.
+func CreateContentFilter(ctx context.Context, db *sql.DB, user uid.ID, f *ContentFilter) (*ContentFilter, error) {
+	if err := f.compile(); err != nil {
+		return nil, err
+	}
+	if _, err := f.Action.MarshalText(); err != nil {
+		return nil, httperr.NewBadRequest("invalid-filter-action", "Invalid content filter action.")
+	}
+	if f.Type == ContentFilterTypeFlair {
+		flair, err := GetFlair(ctx, db, f.flairID)
+		if err != nil {
+			return nil, err
+		}
+		if flair.Type != FlairTypePost {
+			return nil, httperr.NewBadRequest("invalid-filter-flair", "Only post flairs can be filtered.")
+		}
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM content_filters WHERE user_id = ?", user).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxContentFiltersPerUser {
+		return nil, httperr.NewForbidden("max-filters-limit", fmt.Sprintf("You cannot have more than %d filters.", maxContentFiltersPerUser))
+	}
+
+	query, args := msql.BuildInsertQuery("content_filters", []msql.ColumnValue{
+		{Name: "user_id", Value: user},
+		{Name: "type", Value: f.Type},
+		{Name: "pattern", Value: f.Pattern},
+		{Name: "is_regex", Value: f.Regex},
+		{Name: "match_body", Value: f.MatchBody},
+		{Name: "action", Value: f.Action},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	f.ID = int(id)
+	f.UserID = user
+	f.CreatedAt = time.Now()
+	return f, nil
+}
+
+// DeleteContentFilter deletes the content filter of user with the id.
+func DeleteContentFilter(ctx context.Context, db *sql.DB, user uid.ID, id int) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM content_filters WHERE id = ? AND user_id = ?", id, user)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return httperr.NewNotFound("filter-not-found", "Filter not found.")
+	}
+	return nil
+}
+
+// filterPosts applies the content filters of viewer on posts. The posts that
+// match a hide filter are removed from the returned slice, and the posts that
+// match only collapse filters have their Filtered field set.
+func filterPosts(ctx context.Context, db *sql.DB, viewer *uid.ID, posts []*Post) ([]*Post, error) {
+	if viewer == nil || len(posts) == 0 {
+		return posts, nil
+	}
+	filters, err := GetContentFilters(ctx, db, *viewer)
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return posts, nil
+	}
+
+	nsfw, err := nsfwCommunities(ctx, db, filters, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := posts[:0:0]
+	for _, post := range posts {
+		if post.AuthorID == *viewer {
+			kept = append(kept, post)
+			continue
+		}
+		hide := false
+		var collapse *ContentFilter
+		for _, f := range filters {
+			if !f.matches(post, nsfw[post.CommunityID]) {
+				continue
+			}
+			if f.Action == ContentFilterActionHide {
+				hide = true
+				break
+			}
+			if collapse == nil {
+				collapse = f
+			}
+		}
+		if hide {
+			continue
+		}
+		if collapse != nil {
+			post.Filtered = newPostFilterNotice(collapse, post)
+		}
+		kept = append(kept, post)
+	}
+	return kept, nil
+}
+
+// whereFlairsNotFiltered appends to where a condition that excludes the posts
+// with a flair that viewer has a hide filter of, except for those of viewer.
+// (The posts that match collapse filters are left to filterPosts.)
+func whereFlairsNotFiltered(where, postsTable string, args []any, viewer uid.ID) (string, []any) {
+	if !(where == "" || strings.TrimSpace(strings.ToUpper(where)) == "WHERE") {
+		where += "AND "
+	}
+	filtered := fmt.Sprintf("SELECT CAST(pattern AS UNSIGNED) FROM content_filters WHERE user_id = ? AND type = %d AND action = %d", ContentFilterTypeFlair, ContentFilterActionHide)
+	if postsTable == "posts" {
+		where += fmt.Sprintf("(posts.user_id = ? OR posts.flair_id IS NULL OR posts.flair_id NOT IN (%s)) ", filtered)
+	} else {
+		where += fmt.Sprintf("(%s.user_id = ? OR %s.post_id NOT IN (SELECT id FROM posts WHERE flair_id IN (%s))) ", postsTable, postsTable, filtered)
+	}
+	return where, append(args, viewer, viewer)
+}
+
+// nsfwCommunities returns the set of the NSFW communities of posts, if any of
+// filters is an NSFW filter.
+func nsfwCommunities(ctx context.Context, db *sql.DB, filters []*ContentFilter, posts []*Post) (map[uid.ID]bool, error) {
+	needed := false
+	for _, f := range filters {
+		if f.Type == ContentFilterTypeNSFW {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	var args []any
+	seen := make(map[uid.ID]bool)
+	for _, post := range posts {
+		if !seen[post.CommunityID] {
+			seen[post.CommunityID] = true
+			args = append(args, post.CommunityID)
+		}
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT id FROM communities WHERE nsfw = TRUE AND id IN %s", msql.InClauseQuestionMarks(len(args))), args...)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	nsfw := make(map[uid.ID]bool, len(ids))
+	for _, id := range ids {
+		nsfw[id] = true
+	}
+	return nsfw, nil
+}
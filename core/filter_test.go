@@ -0,0 +1,50 @@
+package core
+
+import (
+	"testing"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+func TestContentFilterMatches(t *testing.T) {
+	post := &Post{
+		Title: "Episode 5 discussion: no Spoilers please",
+		Body:  msql.NewNullString("The ending was a twist."),
+		Link:  &PostLink{Hostname: "news.example.com"},
+		Flair: &Flair{ID: 7, Text: "Spoiler"},
+	}
+	cases := []struct {
+		filter ContentFilter
+		want   bool
+	}{
+		{ContentFilter{Type: ContentFilterTypeKeyword, Pattern: "spoilers"}, true},
+		{ContentFilter{Type: ContentFilterTypeKeyword, Pattern: "spoil"}, false}, // whole words only
+		{ContentFilter{Type: ContentFilterTypeKeyword, Pattern: "twist"}, false}, // not in the title
+		{ContentFilter{Type: ContentFilterTypeKeyword, Pattern: "twist", MatchBody: true}, true},
+		{ContentFilter{Type: ContentFilterTypeKeyword, Pattern: `episode \d+`, Regex: true}, true},
+		{ContentFilter{Type: ContentFilterTypeKeyword, Pattern: "a.c", Regex: false}, false},
+		{ContentFilter{Type: ContentFilterTypeDomain, Pattern: "example.com"}, true},
+		{ContentFilter{Type: ContentFilterTypeDomain, Pattern: "www.news.example.com"}, true},
+		{ContentFilter{Type: ContentFilterTypeDomain, Pattern: "ample.com"}, false},
+		{ContentFilter{Type: ContentFilterTypeNSFW}, false},
+		{ContentFilter{Type: ContentFilterTypeFlair, Pattern: "7"}, true},
+		{ContentFilter{Type: ContentFilterTypeFlair, Pattern: "8"}, false},
+	}
+	for _, c := range cases {
+		if err := c.filter.compile(); err != nil {
+			t.Fatalf("compiling filter %+v: %v", c.filter, err)
+		}
+		if got := c.filter.matches(post, false); got != c.want {
+			t.Errorf("filter (type: %d, pattern: %q) matches = %v, want %v", c.filter.Type, c.filter.Pattern, got, c.want)
+		}
+	}
+
+	invalid := ContentFilter{Type: ContentFilterTypeKeyword, Pattern: "(", Regex: true}
+	if err := invalid.compile(); err == nil {
+		t.Error("invalid regular expression compiled")
+	}
+	invalid = ContentFilter{Type: ContentFilterTypeFlair, Pattern: "spoiler"}
+	if err := invalid.compile(); err == nil {
+		t.Error("flair filter with an invalid flair id compiled")
+	}
+}
@@ -0,0 +1,442 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	maxFlairTextLength    = 64 // in bytes.
+	maxFlairsPerCommunity = 100
+	defaultFlairColor     = "#888888"
+)
+
+const selectFlairCols = "community_flairs.id, community_flairs.community_id, community_flairs.type, community_flairs.text, community_flairs.color, community_flairs.mods_only, community_flairs.z_index, community_flairs.created_at"
+
+var (
+	errFlairNotFound = httperr.NewNotFound("flair-not-found", "Flair not found.")
+	errFlairRequired = httperr.NewBadRequest("flair-required", "A flair is required for posts in this community.")
+	errFlairModsOnly = httperr.NewForbidden("flair-mods-only", "Only moderators can use this flair.")
+
+	flairColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// FlairType is the type of a flair: whether it's for posts or for users.
+type FlairType int
+
+const (
+	FlairTypePost = FlairType(iota)
+	FlairTypeUser
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (t FlairType) MarshalText() ([]byte, error) {
+	switch t {
+	case FlairTypePost:
+		return []byte("post"), nil
+	case FlairTypeUser:
+		return []byte("user"), nil
+	}
+	return nil, fmt.Errorf("unknown flair type: %d", t)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (t *FlairType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "post":
+		*t = FlairTypePost
+	case "user":
+		*t = FlairTypeUser
+	default:
+		return httperr.NewBadRequest("invalid-flair-type", "Invalid flair type.")
+	}
+	return nil
+}
+
+// Flair is a flair template of a community, which mods define and which can be
+// given to posts or to users (depending on its type) in the community.
+type Flair struct {
+	ID          int       `json:"id"`
+	CommunityID uid.ID    `json:"communityId"`
+	Type        FlairType `json:"type"`
+	Text        string    `json:"text"`
+	Color       string    `json:"color"`    // In #rrggbb format.
+	ModsOnly    bool      `json:"modsOnly"` // If true, only mods can give the flair to a post or a user.
+	ZIndex      int       `json:"zIndex"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// validate normalizes and validates the user-settable fields of the flair.
+func (f *Flair) validate() error {
+	if _, err := f.Type.MarshalText(); err != nil {
+		return httperr.NewBadRequest("invalid-flair-type", "Invalid flair type.")
+	}
+	f.Text = strings.TrimSpace(f.Text)
+	if f.Text == "" {
+		return httperr.NewBadRequest("flair-text-empty", "Flair text cannot be empty.")
+	}
+	if len(f.Text) > maxFlairTextLength {
+		return httperr.NewBadRequest("flair-text-too-long", fmt.Sprintf("Flair text cannot be longer than %d characters.", maxFlairTextLength))
+	}
+	if f.Color == "" {
+		f.Color = defaultFlairColor
+	}
+	if !flairColorRegexp.MatchString(f.Color) {
+		return httperr.NewBadRequest("invalid-flair-color", "Flair color must be in #rrggbb format.")
+	}
+	f.Color = strings.ToLower(f.Color)
+	return nil
+}
+
+func scanFlairs(rows *sql.Rows) ([]*Flair, error) {
+	defer rows.Close()
+
+	flairs := []*Flair{}
+	for rows.Next() {
+		f := &Flair{}
+		if err := rows.Scan(&f.ID, &f.CommunityID, &f.Type, &f.Text, &f.Color, &f.ModsOnly, &f.ZIndex, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		flairs = append(flairs, f)
+	}
+	return flairs, rows.Err()
+}
+
+// GetFlair returns the flair with the id.
+func GetFlair(ctx context.Context, db *sql.DB, id int) (*Flair, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+selectFlairCols+" FROM community_flairs WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	flairs, err := scanFlairs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(flairs) == 0 {
+		return nil, errFlairNotFound
+	}
+	return flairs[0], nil
+}
+
+// GetCommunityFlairs returns the flairs of community of type t, or of both
+// types if t is nil.
+func GetCommunityFlairs(ctx context.Context, db *sql.DB, community uid.ID, t *FlairType) ([]*Flair, error) {
+	query := "SELECT " + selectFlairCols + " FROM community_flairs WHERE community_id = ? "
+	args := []any{community}
+	if t != nil {
+		query += "AND type = ? "
+		args = append(args, *t)
+	}
+	query += "ORDER BY z_index, id"
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanFlairs(rows)
+}
+
+// AddFlair adds a flair to the community. The fields ID, CommunityID, ZIndex,
+// and CreatedAt of flair are set by the function.
+func (c *Community) AddFlair(ctx context.Context, db *sql.DB, flair *Flair, mod uid.ID) error {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	if err := flair.validate(); err != nil {
+		return err
+	}
+
+	var count, zIndex int
+	row := db.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(MAX(z_index), 0) FROM community_flairs WHERE community_id = ?", c.ID)
+	if err := row.Scan(&count, &zIndex); err != nil {
+		return err
+	}
+	if count >= maxFlairsPerCommunity {
+		return httperr.NewForbidden("max-flairs-limit", fmt.Sprintf("A community cannot have more than %d flairs.", maxFlairsPerCommunity))
+	}
+
+	flair.CommunityID = c.ID
+	flair.ZIndex = zIndex + 1
+	flair.CreatedAt = time.Now()
+	query, args := msql.BuildInsertQuery("community_flairs", []msql.ColumnValue{
+		{Name: "community_id", Value: flair.CommunityID},
+		{Name: "type", Value: flair.Type},
+		{Name: "text", Value: flair.Text},
+		{Name: "color", Value: flair.Color},
+		{Name: "mods_only", Value: flair.ModsOnly},
+		{Name: "z_index", Value: flair.ZIndex},
+		{Name: "created_by", Value: mod},
+		{Name: "created_at", Value: flair.CreatedAt},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	flair.ID = int(id)
+	return nil
+}
+
+// Update updates the flair's text, color, ModsOnly, and ZIndex. The type of a
+// flair cannot be changed.
+func (f *Flair) Update(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if is, err := UserModOrAdmin(ctx, db, f.CommunityID, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	if err := f.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "UPDATE community_flairs SET text = ?, color = ?, mods_only = ?, z_index = ? WHERE id = ?", f.Text, f.Color, f.ModsOnly, f.ZIndex, f.ID)
+	return err
+}
+
+// Delete deletes the flair. Posts with the flair are left without a flair, and
+// users with the flair lose it.
+func (f *Flair) Delete(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if is, err := UserModOrAdmin(ctx, db, f.CommunityID, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	_, err := db.ExecContext(ctx, "DELETE FROM community_flairs WHERE id = ?", f.ID)
+	return err
+}
+
+// checkFlairUsable returns an error if user cannot give flair id, of type t,
+// in community.
+func checkFlairUsable(ctx context.Context, db *sql.DB, id int, t FlairType, community, user uid.ID) (*Flair, error) {
+	flair, err := GetFlair(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	if flair.CommunityID != community || flair.Type != t {
+		return nil, errFlairNotFound
+	}
+	if flair.ModsOnly {
+		if is, err := UserModOrAdmin(ctx, db, community, user); err != nil {
+			return nil, err
+		} else if !is {
+			return nil, errFlairModsOnly
+		}
+	}
+	return flair, nil
+}
+
+// SetFlair sets the flair of the post, or removes it if flair is nil. Only
+// the author of the post and the mods (and admins) can change the flair of a
+// post.
+func (p *Post) SetFlair(ctx context.Context, db *sql.DB, user uid.ID, flair *int) error {
+	isMod, err := UserModOrAdmin(ctx, db, p.CommunityID, user)
+	if err != nil {
+		return err
+	}
+	if !(isMod || p.AuthorID == user) {
+		return errNotMod
+	}
+
+	var f *Flair
+	if flair == nil {
+		if !isMod {
+			required, err := communityPostFlairRequired(ctx, db, p.CommunityID)
+			if err != nil {
+				return err
+			}
+			if required {
+				return errFlairRequired
+			}
+		}
+	} else {
+		if f, err = checkFlairUsable(ctx, db, *flair, FlairTypePost, p.CommunityID, user); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE posts SET flair_id = ? WHERE id = ?", flair, p.ID); err != nil {
+		return err
+	}
+	p.Flair = f
+	return nil
+}
+
+func communityPostFlairRequired(ctx context.Context, db *sql.DB, community uid.ID) (bool, error) {
+	var required bool
+	err := db.QueryRowContext(ctx, "SELECT post_flair_required FROM communities WHERE id = ?", community).Scan(&required)
+	return required, err
+}
+
+// GetUserFlair returns the flair of user in community, which is nil if the
+// user has no flair.
+func GetUserFlair(ctx context.Context, db *sql.DB, community, user uid.ID) (*Flair, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+selectFlairCols+` FROM community_user_flairs
+		INNER JOIN community_flairs ON community_flairs.id = community_user_flairs.flair_id
+		WHERE community_user_flairs.community_id = ? AND community_user_flairs.user_id = ?`, community, user)
+	if err != nil {
+		return nil, err
+	}
+	flairs, err := scanFlairs(rows)
+	if err != nil || len(flairs) == 0 {
+		return nil, err
+	}
+	return flairs[0], nil
+}
+
+// SetUserFlair sets the flair of user in community, or removes it if flair is
+// nil. Users can set their own flair (except to flairs for mods only), and
+// mods can set the flair of anyone in the community.
+func SetUserFlair(ctx context.Context, db *sql.DB, community, user uid.ID, flair *int, setBy uid.ID) error {
+	if setBy != user {
+		if is, err := UserModOrAdmin(ctx, db, community, setBy); err != nil {
+			return err
+		} else if !is {
+			return errNotMod
+		}
+	}
+
+	if flair == nil {
+		_, err := db.ExecContext(ctx, "DELETE FROM community_user_flairs WHERE community_id = ? AND user_id = ?", community, user)
+		return err
+	}
+
+	if _, err := checkFlairUsable(ctx, db, *flair, FlairTypeUser, community, setBy); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO community_user_flairs (community_id, user_id, flair_id, assigned_by) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE flair_id = VALUES(flair_id), assigned_by = VALUES(assigned_by), created_at = CURRENT_TIMESTAMP()`,
+		community, user, *flair, setBy)
+	return err
+}
+
+// userFlairKey is a (community, user) pair.
+type userFlairKey struct {
+	community, user uid.ID
+}
+
+// getUserFlairs returns the user flairs of the (community, user) pairs in
+// keys.
+func getUserFlairs(ctx context.Context, db *sql.DB, keys []userFlairKey) (map[userFlairKey]*Flair, error) {
+	flairs := make(map[userFlairKey]*Flair)
+	if len(keys) == 0 {
+		return flairs, nil
+	}
+
+	var (
+		conds []string
+		args  []any
+		seen  = make(map[userFlairKey]bool)
+	)
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		conds = append(conds, "(community_user_flairs.community_id = ? AND community_user_flairs.user_id = ?)")
+		args = append(args, key.community, key.user)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT community_user_flairs.user_id, "+selectFlairCols+` FROM community_user_flairs
+		INNER JOIN community_flairs ON community_flairs.id = community_user_flairs.flair_id
+		WHERE `+strings.Join(conds, " OR "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user uid.ID
+		f := &Flair{}
+		if err := rows.Scan(&user, &f.ID, &f.CommunityID, &f.Type, &f.Text, &f.Color, &f.ModsOnly, &f.ZIndex, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		flairs[userFlairKey{f.CommunityID, user}] = f
+	}
+	return flairs, rows.Err()
+}
+
+// populatePostsFlairs sets the Flair field of posts. flairIDs are the flair ids
+// of posts, in the same order.
+func populatePostsFlairs(ctx context.Context, db *sql.DB, posts []*Post, flairIDs []sql.NullInt64) error {
+	var args []any
+	for _, id := range flairIDs {
+		if id.Valid {
+			args = append(args, id.Int64)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+selectFlairCols+" FROM community_flairs WHERE id IN "+msql.InClauseQuestionMarks(len(args)), args...)
+	if err != nil {
+		return err
+	}
+	flairs, err := scanFlairs(rows)
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		if !flairIDs[i].Valid {
+			continue
+		}
+		for _, f := range flairs {
+			if int64(f.ID) == flairIDs[i].Int64 {
+				post.Flair = f
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// populatePostsAuthorFlairs sets the AuthorFlair field of posts.
+func populatePostsAuthorFlairs(ctx context.Context, db *sql.DB, posts []*Post) error {
+	keys := make([]userFlairKey, 0, len(posts))
+	for _, post := range posts {
+		if !post.AuthorDeleted {
+			keys = append(keys, userFlairKey{post.CommunityID, post.AuthorID})
+		}
+	}
+	flairs, err := getUserFlairs(ctx, db, keys)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if !post.AuthorDeleted {
+			post.AuthorFlair = flairs[userFlairKey{post.CommunityID, post.AuthorID}]
+		}
+	}
+	return nil
+}
+
+// populateCommentsAuthorFlairs sets the AuthorFlair field of comments.
+func populateCommentsAuthorFlairs(ctx context.Context, db *sql.DB, comments []*Comment) error {
+	keys := make([]userFlairKey, 0, len(comments))
+	for _, c := range comments {
+		if !(c.AuthorDeleted || c.Deleted) {
+			keys = append(keys, userFlairKey{c.CommunityID, c.AuthorID})
+		}
+	}
+	flairs, err := getUserFlairs(ctx, db, keys)
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		if !(c.AuthorDeleted || c.Deleted) {
+			c.AuthorFlair = flairs[userFlairKey{c.CommunityID, c.AuthorID}]
+		}
+	}
+	return nil
+}
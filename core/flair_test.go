@@ -0,0 +1,30 @@
+package core
+
+import "testing"
+
+func TestFlairValidate(t *testing.T) {
+	tests := []struct {
+		text, color string
+		wantColor   string
+		valid       bool
+	}{
+		{"Discussion", "#FF00aa", "#ff00aa", true},
+		{"  News ", "", defaultFlairColor, true},
+		{"", "#ffffff", "", false},
+		{"   ", "#ffffff", "", false},
+		{"Question", "red", "", false},
+		{"Question", "#fff", "", false},
+		{"Question", "#gggggg", "", false},
+	}
+	for _, test := range tests {
+		f := &Flair{Text: test.text, Color: test.color}
+		err := f.validate()
+		if (err == nil) != test.valid {
+			t.Errorf("validate of (%q, %q): got error %v, want valid %v", test.text, test.color, err, test.valid)
+			continue
+		}
+		if test.valid && f.Color != test.wantColor {
+			t.Errorf("validate of (%q, %q): got color %q, want %q", test.text, test.color, f.Color, test.wantColor)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+var errCannotFollowSelf = httperr.NewBadRequest("cannot-follow-self", "You cannot follow yourself.")
+
+// FollowUser makes user a follower of followed. It's not an error if user
+// already follows followed.
+func FollowUser(ctx context.Context, db *sql.DB, user, followed uid.ID) error {
+	if user == followed {
+		return errCannotFollowSelf
+	}
+	if is, err := UserDeleted(db, followed); err != nil {
+		return err
+	} else if is {
+		return ErrUserDeleted
+	}
+
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_follows (user_id, followed_user_id) VALUES (?, ?)", user, followed)
+		if err != nil {
+			if msql.IsErrDuplicateErr(err) {
+				return nil
+			}
+			return err
+		}
+		return updateFollowCounts(ctx, tx, user, followed, 1)
+	})
+}
+
+// UnfollowUser removes user from the followers of followed. It's not an error
+// if user does not follow followed.
+func UnfollowUser(ctx context.Context, db *sql.DB, user, followed uid.ID) error {
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM user_follows WHERE user_id = ? AND followed_user_id = ?", user, followed)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return nil
+		}
+		return updateFollowCounts(ctx, tx, user, followed, -1)
+	})
+}
+
+func updateFollowCounts(ctx context.Context, tx *sql.Tx, user, followed uid.ID, delta int) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET no_following = no_following + ? WHERE id = ?", delta, user); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE users SET no_followers = no_followers + ? WHERE id = ?", delta, followed)
+	return err
+}
+
+// deleteUserFollowsTx removes all the follows by and of user and adjusts the
+// follow counts of the other users involved.
+func deleteUserFollowsTx(ctx context.Context, tx *sql.Tx, user uid.ID) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET no_followers = no_followers - 1
+		WHERE id IN (SELECT followed_user_id FROM user_follows WHERE user_id = ?)`, user); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET no_following = no_following - 1
+		WHERE id IN (SELECT user_id FROM user_follows WHERE followed_user_id = ?)`, user); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_follows WHERE user_id = ? OR followed_user_id = ?", user, user); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE users SET no_followers = 0, no_following = 0 WHERE id = ?", user)
+	return err
+}
+
+// UserFollows reports whether user follows followed.
+func UserFollows(ctx context.Context, db *sql.DB, user, followed uid.ID) (bool, error) {
+	var x int
+	err := db.QueryRowContext(ctx, "SELECT 1 FROM user_follows WHERE user_id = ? AND followed_user_id = ?", user, followed).Scan(&x)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// setFollowedByViewer sets the FollowedByViewer field of users.
+func setFollowedByViewer(ctx context.Context, db *sql.DB, viewer uid.ID, users []*User) error {
+	args := []any{viewer}
+	for _, u := range users {
+		if u.ID != viewer {
+			args = append(args, u.ID)
+		}
+	}
+	if len(args) == 1 {
+		// One cannot follow oneself. This saves a query in the common case of
+		// a user fetching their own account.
+		return nil
+	}
+	rows, err := db.QueryContext(ctx, "SELECT followed_user_id FROM user_follows WHERE user_id = ? AND followed_user_id IN "+msql.InClauseQuestionMarks(len(args)-1), args...)
+	if err != nil {
+		return err
+	}
+	followed, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		for _, id := range followed {
+			if u.ID == id {
+				u.FollowedByViewer = true
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// FollowsResultSet is a page of the followers or the followed users of a user.
+type FollowsResultSet struct {
+	Users []*User `json:"users"`
+	Next  *string `json:"next"`
+}
+
+// GetFollowers returns the followers of user, most recent first. The cursor
+// next, if not empty, is the Next value of the previous page.
+func GetFollowers(ctx context.Context, db *sql.DB, user uid.ID, viewer *uid.ID, limit int, next string) (*FollowsResultSet, error) {
+	return getFollows(ctx, db, "user_id", "followed_user_id", user, viewer, limit, next)
+}
+
+// GetFollowing returns the users user follows, most recently followed first.
+// The cursor next, if not empty, is the Next value of the previous page.
+func GetFollowing(ctx context.Context, db *sql.DB, user uid.ID, viewer *uid.ID, limit int, next string) (*FollowsResultSet, error) {
+	return getFollows(ctx, db, "followed_user_id", "user_id", user, viewer, limit, next)
+}
+
+// getFollows returns a page of the follows of user. The cursor next is of the
+// form "<created_at in Unix nanoseconds>.<user ID>", the user ID breaking the
+// ties of follows created at the same time.
+func getFollows(ctx context.Context, db *sql.DB, selectCol, whereCol string, user uid.ID, viewer *uid.ID, limit int, next string) (*FollowsResultSet, error) {
+	args := []any{user}
+	query := "SELECT " + selectCol + ", created_at FROM user_follows WHERE " + whereCol + " = ? "
+	if next != "" {
+		nextTime, nextID, err := parseFollowsCursor(next)
+		if err != nil {
+			return nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		query += "AND (created_at < ? OR (created_at = ? AND " + selectCol + " <= ?)) "
+		args = append(args, nextTime, nextTime, nextID)
+	}
+	query += "ORDER BY created_at DESC, " + selectCol + " DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		ids   []uid.ID
+		times []time.Time
+	)
+	for rows.Next() {
+		var id uid.ID
+		var t time.Time
+		if err := rows.Scan(&id, &t); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		times = append(times, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	set := &FollowsResultSet{Users: []*User{}}
+	if len(ids) > limit {
+		s := strconv.FormatInt(times[limit].UnixNano(), 10) + "." + ids[limit].String()
+		set.Next = &s
+		ids = ids[:limit]
+	}
+	if len(ids) == 0 {
+		return set, nil
+	}
+
+	users, err := GetUsersByIDs(ctx, db, ids, viewer)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the order of ids.
+	byID := make(map[uid.ID]*User, len(users))
+	for _, u := range users {
+		byID[u.preGhostID] = u
+	}
+	for _, id := range ids {
+		if u, ok := byID[id]; ok {
+			set.Users = append(set.Users, u)
+		}
+	}
+	return set, nil
+}
+
+// parseFollowsCursor parses the pagination cursor of getFollows.
+func parseFollowsCursor(s string) (time.Time, uid.ID, error) {
+	var id uid.ID
+	nanos, idText, ok := strings.Cut(s, ".")
+	if !ok {
+		return time.Time{}, id, errors.New("invalid follows cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, id, err
+	}
+	if err := id.UnmarshalText([]byte(idText)); err != nil {
+		return time.Time{}, id, err
+	}
+	return time.Unix(0, n), id, nil
+}
+
+// notifyFollowers sends a notification of post to every follower of the
+// post's author who hasn't turned off such notifications (and hasn't muted the
+// author). No notifications are sent if the author is shadow-banned, and, for
+// posts in private communities, only followers who are members are notified.
+func notifyFollowers(ctx context.Context, db *sql.DB, post *Post) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_follows.user_id
+		FROM user_follows
+		INNER JOIN users ON users.id = user_follows.user_id
+		WHERE user_follows.followed_user_id = ?
+			AND users.follow_notifications_off = FALSE
+			AND users.deleted_at IS NULL
+			AND user_follows.user_id NOT IN (SELECT user_id FROM muted_users WHERE muted_user_id = ?)
+			AND user_follows.followed_user_id NOT IN (`+shadowBannedUsersQuery+`)
+			AND (
+				? NOT IN (SELECT id FROM communities WHERE visibility = ?)
+				OR user_follows.user_id IN (SELECT user_id FROM community_members WHERE community_id = ?)
+			)`, post.AuthorID, post.AuthorID, post.CommunityID, CommunityVisibilityPrivate, post.CommunityID)
+	if err != nil {
+		return err
+	}
+	followers, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, follower := range followers {
+		if err := CreateNotification(ctx, db, follower, NotificationTypeFollowedUserPost, &NotificationFollowedUserPost{
+			PostID: post.ID,
+		}); err != nil {
+			log.Printf("Error sending followed user post notification (user: %v): %v\n", follower, err)
+		}
+	}
+	return nil
+}
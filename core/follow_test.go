@@ -0,0 +1,27 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestParseFollowsCursor(t *testing.T) {
+	id := uid.New()
+	at := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	gotTime, gotID, err := parseFollowsCursor(strconv.FormatInt(at.UnixNano(), 10) + "." + id.String())
+	if err != nil {
+		t.Fatalf("parseFollowsCursor error: %v", err)
+	}
+	if !gotTime.Equal(at) || gotID != id {
+		t.Errorf("parseFollowsCursor = (%v, %v), want (%v, %v)", gotTime, gotID, at, id)
+	}
+
+	for _, s := range []string{"", "1714559400000000000", "x." + id.String(), "1714559400000000000.x"} {
+		if _, _, err := parseFollowsCursor(s); err == nil {
+			t.Errorf("parseFollowsCursor(%q) returned no error", s)
+		}
+	}
+}
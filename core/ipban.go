@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+var errIPBanned = httperr.NewForbidden("ip_banned", "Your IP address is banned.")
+
+// IPBan is a ban, by an admin, of an IP address or of a range of them.
+type IPBan struct {
+	ID        int             `json:"id"`
+	Prefix    string          `json:"prefix"` // In CIDR notation; single addresses are /32 (or /128).
+	Reason    msql.NullString `json:"reason"`
+	CreatedBy uid.ID          `json:"createdBy"`
+	CreatedAt time.Time       `json:"createdAt"`
+	ExpiresAt msql.NullTime   `json:"expiresAt"` // If null, the ban is permanent.
+
+	prefix netip.Prefix
+}
+
+// parseIPBanPrefix parses s, an IP address or a CIDR range, into a prefix with
+// the host bits zeroed. IPv4-mapped IPv6 addresses are treated as IPv4.
+func parseIPBanPrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// matches reports whether the ban covers addr.
+func (b *IPBan) matches(addr netip.Addr) bool {
+	return b.prefix.Contains(addr.Unmap())
+}
+
+// expired reports whether the ban is no longer in effect at time t.
+func (b *IPBan) expired(t time.Time) bool {
+	return b.ExpiresAt.Valid && !b.ExpiresAt.Time.After(t)
+}
+
+// GetIPBans returns the IP bans, the latest first. Expired bans are included
+// only if expired is true.
+func GetIPBans(ctx context.Context, db *sql.DB, expired bool) ([]*IPBan, error) {
+	query := "SELECT id, prefix, reason, created_by, created_at, expires_at FROM ip_bans"
+	var args []any
+	if !expired {
+		query += " WHERE expires_at IS NULL OR expires_at > ?"
+		args = append(args, time.Now())
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []*IPBan{}
+	for rows.Next() {
+		b := &IPBan{}
+		if err := rows.Scan(&b.ID, &b.Prefix, &b.Reason, &b.CreatedBy, &b.CreatedAt, &b.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if b.prefix, err = netip.ParsePrefix(b.Prefix); err != nil {
+			continue // Should not happen; prefixes are validated on creation.
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// CreateIPBan validates and saves ban, which is created by admin. The prefix of
+// ban may be either a single IP address or a CIDR range.
+func CreateIPBan(ctx context.Context, db *sql.DB, admin uid.ID, ban *IPBan) (*IPBan, error) {
+	prefix, err := parseIPBanPrefix(ban.Prefix)
+	if err != nil {
+		return nil, httperr.NewBadRequest("invalid-ip-prefix", "Invalid IP address or CIDR range.")
+	}
+	if ban.ExpiresAt.Valid && ban.ExpiresAt.Time.Before(time.Now()) {
+		return nil, httperr.NewBadRequest("invalid-expiry", "Ban expiry cannot be in the past.")
+	}
+	ban.prefix = prefix
+	ban.Prefix = prefix.String()
+
+	query, args := msql.BuildInsertQuery("ip_bans", []msql.ColumnValue{
+		{Name: "prefix", Value: ban.Prefix},
+		{Name: "reason", Value: ban.Reason},
+		{Name: "created_by", Value: admin},
+		{Name: "expires_at", Value: ban.ExpiresAt},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	ban.ID = int(id)
+	ban.CreatedBy = admin
+	ban.CreatedAt = time.Now()
+	return ban, nil
+}
+
+// DeleteIPBan deletes the IP ban with the id.
+func DeleteIPBan(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM ip_bans WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return httperr.NewNotFound("ip-ban-not-found", "IP ban not found.")
+	}
+	return nil
+}
+
+// CheckIPBan returns an error if the IP address ip is covered by an unexpired
+// ban. Invalid (or empty) addresses are never banned.
+func CheckIPBan(ctx context.Context, db *sql.DB, ip string) error {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	bans, err := GetIPBans(ctx, db, false)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, ban := range bans {
+		if !ban.expired(now) && ban.matches(addr) {
+			return errIPBanned
+		}
+	}
+	return nil
+}
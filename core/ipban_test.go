@@ -0,0 +1,44 @@
+package core
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPBanMatches(t *testing.T) {
+	cases := []struct {
+		prefix     string
+		wantPrefix string
+		ip         string
+		want       bool
+	}{
+		{"203.0.113.7", "203.0.113.7/32", "203.0.113.7", true},
+		{"203.0.113.7", "203.0.113.7/32", "203.0.113.8", false},
+		{"203.0.113.7/24", "203.0.113.0/24", "203.0.113.200", true},
+		{"203.0.113.0/24", "203.0.113.0/24", "203.0.114.1", false},
+		{"203.0.113.0/24", "203.0.113.0/24", "::ffff:203.0.113.9", true},
+		{"::ffff:203.0.113.0/120", "203.0.113.0/24", "203.0.113.9", true},
+		{"2001:db8::/32", "2001:db8::/32", "2001:db8:1::1", true},
+		{"2001:db8::/32", "2001:db8::/32", "2001:db9::1", false},
+	}
+	for _, c := range cases {
+		prefix, err := parseIPBanPrefix(c.prefix)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.prefix, err)
+			continue
+		}
+		if prefix.String() != c.wantPrefix {
+			t.Errorf("%s: prefix is %s, want %s", c.prefix, prefix, c.wantPrefix)
+		}
+		ban := &IPBan{prefix: prefix}
+		if got := ban.matches(netip.MustParseAddr(c.ip)); got != c.want {
+			t.Errorf("%s matches %s: got %v, want %v", c.prefix, c.ip, got, c.want)
+		}
+	}
+
+	for _, s := range []string{"", "203.0.113", "203.0.113.0/33", "example.com"} {
+		if _, err := parseIPBanPrefix(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
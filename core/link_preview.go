@@ -0,0 +1,323 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core/sitesettings"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/httputil"
+	"github.com/discuitnet/discuit/internal/utils"
+	"golang.org/x/net/html"
+)
+
+const (
+	maxLinkPreviewTitleLength       = 512  // in runes.
+	maxLinkPreviewDescriptionLength = 1024 // in runes.
+
+	// Previews that haven't been used for this many TTLs are deleted.
+	linkPreviewUnusedTTLs = 7
+)
+
+// linkImageTypes are the content types of the images of link posts.
+var linkImageTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// linkEmbedHosts are the hosts of the iframes that the oEmbed data of a link
+// may embed.
+var linkEmbedHosts = []string{
+	"www.youtube.com",
+	"www.youtube-nocookie.com",
+	"player.vimeo.com",
+	"open.spotify.com",
+	"w.soundcloud.com",
+	"streamable.com",
+	"clips.twitch.tv",
+	"player.twitch.tv",
+}
+
+// LinkPreview is the preview of the web page at a link.
+type LinkPreview struct {
+	Title        string     `json:"title"`
+	Description  string     `json:"description,omitempty"`
+	SiteName     string     `json:"siteName,omitempty"`
+	FaviconURL   string     `json:"faviconUrl,omitempty"`
+	CanonicalURL string     `json:"canonicalUrl,omitempty"` // As declared by the page.
+	ImageURL     string     `json:"imageUrl,omitempty"`     // The og:image, or the link itself if it's an image.
+	Embed        *LinkEmbed `json:"embed,omitempty"`        // For video and other embed providers.
+	FetchedAt    time.Time  `json:"fetchedAt"`
+}
+
+// LinkEmbed is the oEmbed data of a link. The HTML of the oEmbed data is not
+// kept, since it's provided by a third party. Only the source of the iframe in
+// it, if it's one of linkEmbedHosts, is.
+type LinkEmbed struct {
+	Type         string `json:"type"` // One of photo, video, link, or rich.
+	Title        string `json:"title,omitempty"`
+	AuthorName   string `json:"authorName,omitempty"`
+	ProviderName string `json:"providerName,omitempty"`
+	URL          string `json:"url,omitempty"` // For photos.
+	IframeURL    string `json:"iframeUrl,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+}
+
+func newLinkEmbed(o *httputil.OEmbed) *LinkEmbed {
+	atoi := func(n json.Number) int {
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return &LinkEmbed{
+		Type:         o.Type,
+		Title:        o.Title,
+		AuthorName:   o.AuthorName,
+		ProviderName: o.ProviderName,
+		URL:          o.URL,
+		IframeURL:    embedIframeURL(o.HTML),
+		Width:        atoi(o.Width),
+		Height:       atoi(o.Height),
+		ThumbnailURL: o.ThumbnailURL,
+	}
+}
+
+// embedIframeURL returns the source of the iframe in the oEmbed HTML s, if
+// it's an HTTPS URL of one of linkEmbedHosts. Otherwise it returns an empty
+// string.
+func embedIframeURL(s string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), nil)
+	if err != nil {
+		return ""
+	}
+	var src string
+	var f func(*html.Node) bool
+	f = func(n *html.Node) bool {
+		if n.Type == html.ElementNode && n.Data == "iframe" {
+			for _, attr := range n.Attr {
+				if strings.ToLower(attr.Key) == "src" {
+					src = strings.TrimSpace(attr.Val)
+				}
+			}
+			return true
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if f(c) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, n := range nodes {
+		if f(n) {
+			break
+		}
+	}
+
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "https" || u.User != nil || !slices.Contains(linkEmbedHosts, strings.ToLower(u.Host)) {
+		return ""
+	}
+	return u.String()
+}
+
+// fetchLinkPreview fetches the web page at u and returns its preview.
+func fetchLinkPreview(ctx context.Context, u *url.URL) (*LinkPreview, error) {
+	res, err := httputil.Fetch(ctx, u.String(), append([]string{"text/html", "application/xhtml+xml"}, linkImageTypes...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, httperr.NewBadRequest("link-bad-status", fmt.Sprintf("The link responded with status %s.", res.Status))
+	}
+
+	preview := &LinkPreview{FetchedAt: time.Now()}
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); slices.Contains(linkImageTypes, mediaType) {
+		preview.ImageURL = u.String()
+		return preview, nil
+	}
+
+	meta, err := httputil.ExtractLinkMeta(res.Body, res.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	preview.Title = utils.TruncateUnicodeString(meta.Title, maxLinkPreviewTitleLength)
+	preview.Description = utils.TruncateUnicodeString(meta.Description, maxLinkPreviewDescriptionLength)
+	preview.SiteName = utils.TruncateUnicodeString(meta.SiteName, maxLinkPreviewTitleLength)
+	preview.FaviconURL = meta.FaviconURL
+	preview.CanonicalURL = meta.CanonicalURL
+	preview.ImageURL = meta.ImageURL
+
+	if meta.OEmbedURL != "" {
+		if oembed, err := httputil.FetchOEmbed(ctx, meta.OEmbedURL); err != nil {
+			log.Printf("Error fetching the oEmbed data of %s: %v\n", u, err)
+		} else {
+			preview.Embed = newLinkEmbed(oembed)
+		}
+	}
+	return preview, nil
+}
+
+// getLinkPreview returns the preview of the link u, which must be a canonical
+// URL (see canonicalURL), from the cache if possible.
+func getLinkPreview(ctx context.Context, db *sql.DB, u *url.URL) (*LinkPreview, error) {
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	ttl := settings.LinkPreviewDuration()
+	if ttl == 0 {
+		return fetchLinkPreview(ctx, u)
+	}
+
+	hash := linkHash(u)
+	var (
+		data      []byte
+		fetchedAt time.Time
+		cached    *LinkPreview
+	)
+	err = db.QueryRowContext(ctx, "SELECT preview, fetched_at FROM link_previews WHERE link_hash = ?", hash).Scan(&data, &fetchedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		cached = &LinkPreview{}
+		if err := json.Unmarshal(data, cached); err != nil {
+			return nil, err
+		}
+		if time.Since(fetchedAt) < ttl {
+			if _, err := db.ExecContext(ctx, "UPDATE link_previews SET last_used_at = ? WHERE link_hash = ?", time.Now(), hash); err != nil {
+				return nil, err
+			}
+			return cached, nil
+		}
+	}
+
+	preview, err := fetchLinkPreview(ctx, u)
+	if err != nil {
+		if cached != nil {
+			return cached, nil // Better stale than nothing.
+		}
+		return nil, err
+	}
+	if data, err = json.Marshal(preview); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO link_previews (link_hash, url, preview, fetched_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE url = ?, preview = ?, fetched_at = ?, last_used_at = ?`,
+		hash, u.String(), data, preview.FetchedAt, now, u.String(), data, preview.FetchedAt, now)
+	return preview, err
+}
+
+// GetLinkPreview returns the preview of link.
+func GetLinkPreview(ctx context.Context, db *sql.DB, link string) (*LinkPreview, error) {
+	u, err := url.Parse(link)
+	if err != nil || u.Hostname() == "" {
+		return nil, httperr.NewBadRequest("invalid-url", "Invalid URL.")
+	}
+	return getLinkPreview(ctx, db, canonicalURL(u))
+}
+
+// RefreshLinkPreviews refetches at most limit of the cached link previews
+// that are expired and that were used within their TTL, and deletes the
+// previews that haven't been used for a long while. It returns the number of
+// previews refreshed.
+func RefreshLinkPreviews(ctx context.Context, db *sql.DB, limit int) (int, error) {
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	ttl := settings.LinkPreviewDuration()
+	if ttl == 0 {
+		_, err := db.ExecContext(ctx, "DELETE FROM link_previews")
+		return 0, err
+	}
+
+	now := time.Now()
+	if _, err := db.ExecContext(ctx, "DELETE FROM link_previews WHERE last_used_at < ?", now.Add(-ttl*linkPreviewUnusedTTLs)); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT link_hash, url
+		FROM link_previews
+		WHERE fetched_at < ? AND last_used_at > ?
+		ORDER BY last_used_at DESC
+		LIMIT ?`, now.Add(-ttl), now.Add(-ttl), limit)
+	if err != nil {
+		return 0, err
+	}
+	type entry struct {
+		hash []byte
+		url  string
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.hash, &e.url); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, e := range entries {
+		u, err := url.Parse(e.url)
+		if err != nil {
+			continue
+		}
+		preview, err := fetchLinkPreview(ctx, u)
+		if err != nil {
+			// Keep the stale preview, and try again after another TTL.
+			if _, err := db.ExecContext(ctx, "UPDATE link_previews SET fetched_at = ? WHERE link_hash = ?", time.Now(), e.hash); err != nil {
+				return n, err
+			}
+			continue
+		}
+		data, err := json.Marshal(preview)
+		if err != nil {
+			return n, err
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE link_previews SET preview = ?, fetched_at = ? WHERE link_hash = ?", data, preview.FetchedAt, e.hash); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// getLinkPostImage returns the image of preview (if any) for use as the
+// thumbnail of a link post. preview may be nil.
+func getLinkPostImage(ctx context.Context, preview *LinkPreview) []byte {
+	if preview == nil || preview.ImageURL == "" {
+		return nil
+	}
+	res, err := httputil.Fetch(ctx, preview.ImageURL, linkImageTypes...)
+	if err != nil {
+		return nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil
+	}
+	image, err := io.ReadAll(res.Body)
+	if err != nil || len(image) == 0 {
+		return nil
+	}
+	return image
+}
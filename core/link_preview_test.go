@@ -0,0 +1,24 @@
+package core
+
+import "testing"
+
+func TestEmbedIframeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`<iframe width="200" height="113" src="https://www.youtube.com/embed/abc?feature=oembed" frameborder="0"></iframe>`, "https://www.youtube.com/embed/abc?feature=oembed"},
+		{`<div><iframe src="https://player.vimeo.com/video/1"></iframe></div>`, "https://player.vimeo.com/video/1"},
+		{`<iframe src="http://www.youtube.com/embed/abc"></iframe>`, ""},
+		{`<iframe src="https://evil.example.com/embed"></iframe>`, ""},
+		{`<iframe src="javascript:alert(1)"></iframe>`, ""},
+		{`<iframe src="https://user@www.youtube.com/embed/abc"></iframe>`, ""},
+		{`<script>alert(1)</script>`, ""},
+		{`<blockquote>Quote</blockquote><script src="https://www.youtube.com/x.js"></script>`, ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := embedIframeURL(test.in); got != test.want {
+			t.Errorf("embedIframeURL(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -379,6 +379,12 @@ func GetListItems(ctx context.Context, db *sql.DB, listID, limit int, sort ListI
 	query := buildSelectListItemsQuery("WHERE list_id = ?")
 	args := []any{listID}
 
+	// Hide the posts and comments in the private communities that the viewer
+	// is not a member of.
+	hidden, hiddenArgs := hiddenCommunitiesQuery(viewer)
+	query += fmt.Sprintf(" AND target_id NOT IN (SELECT id FROM posts WHERE community_id IN (%s) UNION SELECT id FROM comments WHERE community_id IN (%s))", hidden, hidden)
+	args = append(append(args, hiddenArgs...), hiddenArgs...)
+
 	// Parse the pagination cursor, if present.
 	if next != nil {
 		if sort == ListItemsSortByAddedAsc || sort == ListItemsSortByAddedDsc {
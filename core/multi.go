@@ -0,0 +1,360 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxMultisPerUser      = 50
+	maxCommunitiesInMulti = 150
+)
+
+var errMultiNotFound = httperr.NewNotFound("multi-not-found", "Multi not found.")
+
+// Multi is a custom feed of a user that combines the posts of a chosen set of
+// communities.
+type Multi struct {
+	ID             int             `json:"id"`
+	UserID         uid.ID          `json:"userId"`
+	Username       string          `json:"username"`
+	Name           string          `json:"name"` // Unique per user.
+	DisplayName    string          `json:"displayName"`
+	Description    msql.NullString `json:"description"`
+	Public         bool            `json:"public"`
+	Sort           FeedSort        `json:"sort"` // The default sort of the feed.
+	NumCommunities int             `json:"numCommunities"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	LastUpdatedAt  time.Time       `json:"lastUpdatedAt"`
+
+	// Communities is nil until FetchCommunities is called.
+	Communities []*Community `json:"communities,omitempty"`
+}
+
+func getMultis(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Multi, error) {
+	query := msql.BuildSelectQuery("multis", []string{
+		"multis.id",
+		"multis.user_id",
+		"users.username",
+		"multis.name",
+		"multis.display_name",
+		"multis.description",
+		"multis.public",
+		"multis.sort",
+		"multis.num_communities",
+		"multis.created_at",
+		"multis.last_updated_at",
+	}, []string{
+		"INNER JOIN users on multis.user_id = users.id",
+	}, where)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	multis := []*Multi{}
+	for rows.Next() {
+		m := &Multi{}
+		err = rows.Scan(
+			&m.ID,
+			&m.UserID,
+			&m.Username,
+			&m.Name,
+			&m.DisplayName,
+			&m.Description,
+			&m.Public,
+			&m.Sort,
+			&m.NumCommunities,
+			&m.CreatedAt,
+			&m.LastUpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		multis = append(multis, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return multis, nil
+}
+
+func GetMulti(ctx context.Context, db *sql.DB, id int) (*Multi, error) {
+	multis, err := getMultis(ctx, db, "WHERE multis.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(multis) == 0 {
+		return nil, errMultiNotFound
+	}
+	return multis[0], nil
+}
+
+func GetMultiByName(ctx context.Context, db *sql.DB, user uid.ID, name string) (*Multi, error) {
+	multis, err := getMultis(ctx, db, "WHERE multis.user_id = ? AND multis.name = ?", user, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(multis) == 0 {
+		return nil, errMultiNotFound
+	}
+	return multis[0], nil
+}
+
+// GetUsersMultis returns all the multis of user, ordered by name. If
+// publicOnly is true, only the public ones are returned.
+func GetUsersMultis(ctx context.Context, db *sql.DB, user uid.ID, publicOnly bool) ([]*Multi, error) {
+	where := "WHERE multis.user_id = ? "
+	if publicOnly {
+		where += "AND multis.public = TRUE "
+	}
+	return getMultis(ctx, db, where+"ORDER BY multis.name", user)
+}
+
+// multinameValid always returns an httperr.Error.
+func multinameValid(name string) error {
+	if err := IsUsernameValid(name); err != nil {
+		return httperr.NewBadRequest("invalid-multi-name", fmt.Sprintf("multi name %v", err))
+	}
+	return nil
+}
+
+func truncateMultiDisplayName(s string) string {
+	return utils.TruncateUnicodeString(s, 50)
+}
+
+// CreateMulti creates a multi, without any communities, and returns it.
+func CreateMulti(ctx context.Context, db *sql.DB, user uid.ID, name, displayName string, description msql.NullString, public bool, sort FeedSort) (*Multi, error) {
+	if err := multinameValid(name); err != nil {
+		return nil, err
+	}
+	if !sort.Valid() {
+		return nil, ErrInvalidFeedSort
+	}
+	if description.String == "" {
+		description.Valid = false
+	}
+	description.String = utils.TruncateUnicodeString(description.String, maxUserProfileAboutLength)
+	displayName = truncateMultiDisplayName(displayName)
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM multis WHERE user_id = ?", user).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxMultisPerUser {
+		return nil, httperr.NewForbidden("max-multis-limit", fmt.Sprintf("You cannot have more than %d multis.", maxMultisPerUser))
+	}
+
+	query, args := msql.BuildInsertQuery("multis", []msql.ColumnValue{
+		{Name: "user_id", Value: user},
+		{Name: "name", Value: name},
+		{Name: "display_name", Value: displayName},
+		{Name: "description", Value: description},
+		{Name: "public", Value: public},
+		{Name: "sort", Value: sort},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return nil, &httperr.Error{
+				HTTPStatus: http.StatusConflict,
+				Code:       "duplicate-multi",
+				Message:    "A multi with that name already exists.",
+			}
+		}
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetMulti(ctx, db, int(id))
+}
+
+// Viewable reports whether viewer (which may be nil) can see the multi and its
+// feed.
+func (m *Multi) Viewable(viewer *uid.ID) bool {
+	return m.Public || (viewer != nil && *viewer == m.UserID)
+}
+
+// Update updates the multi's updatable fields.
+func (m *Multi) Update(ctx context.Context, db *sql.DB) error {
+	if err := multinameValid(m.Name); err != nil {
+		return err
+	}
+	if !m.Sort.Valid() {
+		return ErrInvalidFeedSort
+	}
+
+	m.Description.String = utils.TruncateUnicodeString(m.Description.String, maxUserProfileAboutLength)
+	m.DisplayName = truncateMultiDisplayName(m.DisplayName)
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE multis SET
+			name = ?,
+			display_name = ?,
+			description = ?,
+			public = ?,
+			sort = ?,
+			last_updated_at = ?
+		WHERE multis.id = ?`,
+		m.Name,
+		m.DisplayName,
+		m.Description,
+		m.Public,
+		m.Sort,
+		time.Now(),
+		m.ID)
+	if err != nil && msql.IsErrDuplicateErr(err) {
+		return &httperr.Error{
+			HTTPStatus: http.StatusConflict,
+			Code:       "duplicate-multi",
+			Message:    "A multi with that name already exists.",
+		}
+	}
+	return err
+}
+
+// UnmarshalUpdatableFieldsJSON extracts the updatable values of the multi
+// from the encoded JSON string.
+func (m *Multi) UnmarshalUpdatableFieldsJSON(data []byte) error {
+	temp := *m // shallow copy
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	m.Name = temp.Name
+	m.DisplayName = temp.DisplayName
+	m.Description = temp.Description
+	if m.Description.String == "" {
+		m.Description.Valid = false
+	}
+	m.Public = temp.Public
+	m.Sort = temp.Sort
+	return nil
+}
+
+func (m *Multi) Delete(ctx context.Context, db *sql.DB) error {
+	// The rows of the multi_communities table are deleted by the ON DELETE
+	// CASCADE foreign key, and users.home_multi_id is set to null.
+	_, err := db.ExecContext(ctx, "DELETE FROM multis WHERE id = ?", m.ID)
+	return err
+}
+
+// getHomeMulti returns the multi that user has set as the home feed, or nil if
+// there's none (or if it's no longer viewable by user).
+func getHomeMulti(ctx context.Context, db *sql.DB, user uid.ID) (*Multi, error) {
+	var (
+		homeFeed FeedType
+		multiID  sql.NullInt64
+	)
+	if err := db.QueryRowContext(ctx, "SELECT home_feed, home_multi_id FROM users WHERE id = ?", user).Scan(&homeFeed, &multiID); err != nil {
+		return nil, err
+	}
+	if homeFeed != FeedTypeMulti || !multiID.Valid {
+		return nil, nil
+	}
+	multi, err := GetMulti(ctx, db, int(multiID.Int64))
+	if err != nil {
+		if err == errMultiNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !multi.Viewable(&user) {
+		return nil, nil
+	}
+	return multi, nil
+}
+
+// CommunityIDs returns the IDs of the communities of the multi.
+func (m *Multi) CommunityIDs(ctx context.Context, db *sql.DB) ([]uid.ID, error) {
+	rows, err := db.QueryContext(ctx, "SELECT community_id FROM multi_communities WHERE multi_id = ?", m.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []uid.ID{}
+	}
+	return ids, nil
+}
+
+// FetchCommunities populates m.Communities.
+func (m *Multi) FetchCommunities(ctx context.Context, db *sql.DB, viewer *uid.ID) error {
+	ids, err := m.CommunityIDs(ctx, db)
+	if err != nil {
+		return err
+	}
+	comms, err := GetCommunitiesByIDs(ctx, db, ids, viewer)
+	if err != nil {
+		return err
+	}
+	if comms == nil {
+		comms = []*Community{}
+	}
+	m.Communities = comms
+	return nil
+}
+
+// SetCommunities replaces the communities of the multi with communities.
+func (m *Multi) SetCommunities(ctx context.Context, db *sql.DB, communities []uid.ID) error {
+	seen := make(map[uid.ID]bool, len(communities))
+	var ids []uid.ID
+	for _, id := range communities {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxCommunitiesInMulti {
+		return httperr.NewBadRequest("max-multi-communities", fmt.Sprintf("A multi cannot have more than %d communities.", maxCommunitiesInMulti))
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if len(ids) > 0 {
+			args := make([]any, len(ids))
+			for i := range ids {
+				args[i] = ids[i]
+			}
+			var count int
+			query := fmt.Sprintf("SELECT COUNT(*) FROM communities WHERE id IN %s AND deleted_at IS NULL", msql.InClauseQuestionMarks(len(ids)))
+			if err := tx.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+				return err
+			}
+			if count != len(ids) {
+				return errCommunityNotFound
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM multi_communities WHERE multi_id = ?", m.ID); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO multi_communities (multi_id, community_id) VALUES (?, ?)", m.ID, id); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE multis SET num_communities = ?, last_updated_at = ? WHERE id = ?", len(ids), time.Now(), m.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	m.NumCommunities = len(ids)
+	return nil
+}
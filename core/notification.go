@@ -201,6 +201,9 @@ const (
 	NotificationTypeNewBadge     = NotificationType("new_badge")
 	NotificationTypeWelcome      = NotificationType("welcome")
 	NotificationTypeAnnouncement = NotificationType("announcement")
+
+	NotificationTypeFollowedUserPost = NotificationType("followed_user_post")
+	NotificationTypeBanAppeal        = NotificationType("ban_appeal")
 )
 
 func (t NotificationType) Valid() bool {
@@ -213,6 +216,8 @@ func (t NotificationType) Valid() bool {
 		NotificationTypeNewBadge,
 		NotificationTypeWelcome,
 		NotificationTypeAnnouncement,
+		NotificationTypeFollowedUserPost,
+		NotificationTypeBanAppeal,
 	}, t)
 }
 
@@ -428,6 +433,10 @@ func scanNotifications(ctx context.Context, db *sql.DB, rows *sql.Rows, render b
 			nc = &NotificationWelcome{}
 		case NotificationTypeAnnouncement:
 			nc = &NotificationAnnouncement{}
+		case NotificationTypeFollowedUserPost:
+			nc = &NotificationFollowedUserPost{}
+		case NotificationTypeBanAppeal:
+			nc = &NotificationBanAppeal{}
 		default:
 			return nil, fmt.Errorf("unknown notification type: %s", string(notif.Type))
 		}
@@ -707,7 +716,7 @@ func (n NotificationNewComment) marshalJSONForAPI(ctx context.Context, db *sql.D
 		T: (T)(n),
 	}
 
-	post, err := GetPost(ctx, db, &n.PostID, "", nil, true)
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -726,7 +735,7 @@ func encloseInBold(format TextFormat, text string) string {
 }
 
 func (n NotificationNewComment) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
-	post, err := GetPost(ctx, db, &n.PostID, "", nil, true)
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -764,6 +773,14 @@ func CreateNewCommentNotification(ctx context.Context, db *sql.DB, post *Post, c
 		return nil
 	}
 
+	// Members who left a private community are not notified of the comments
+	// in it.
+	if ok, err := userCanViewCommunity(ctx, db, post.CommunityID, &user.ID); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
 	// Select last 10 notifications to see if an identical notification exists.
 	notifs, _, err := GetNotifications(ctx, db, post.AuthorID, 10, "", false, "")
 	if err != nil {
@@ -818,7 +835,7 @@ func (n NotificationCommentReply) marshalJSONForAPI(ctx context.Context, db *sql
 		T: (T)(n),
 	}
 
-	post, err := GetPost(ctx, db, &n.PostID, "", nil, true)
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -827,7 +844,7 @@ func (n NotificationCommentReply) marshalJSONForAPI(ctx context.Context, db *sql
 }
 
 func (n NotificationCommentReply) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
-	post, err := GetPost(ctx, db, &n.PostID, "", nil, true)
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -865,6 +882,14 @@ func CreateCommentReplyNotification(ctx context.Context, db *sql.DB, receiver ui
 		return nil
 	}
 
+	// Members who left a private community are not notified of the comments
+	// in it.
+	if ok, err := userCanViewCommunity(ctx, db, post.CommunityID, &user.ID); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
 	// Select last 10 notifications to see if an identical notification exists.
 	notifs, _, err := GetNotifications(ctx, db, receiver, 10, "", false, "")
 	if err != nil {
@@ -939,19 +964,19 @@ func (n NotificationNewVotes) marshalJSONForAPI(ctx context.Context, db *sql.DB)
 	}
 
 	if n.TargetType == "post" {
-		post, err := GetPost(ctx, db, &n.TargetID, "", nil, true)
+		post, err := getPost(ctx, db, &n.TargetID, "", nil, true)
 		if err != nil {
 			return nil, err
 		}
 		out.Post = post
 	} else {
-		comment, err := GetComment(ctx, db, n.TargetID, nil)
+		comment, err := getComment(ctx, db, n.TargetID, nil)
 		if err != nil {
 			return nil, err
 		}
 		out.Comment = comment
 
-		post, err := GetPost(ctx, db, &comment.PostID, "", nil, true)
+		post, err := getPost(ctx, db, &comment.PostID, "", nil, true)
 		if err != nil {
 			return nil, err
 		}
@@ -963,7 +988,7 @@ func (n NotificationNewVotes) marshalJSONForAPI(ctx context.Context, db *sql.DB)
 func (n NotificationNewVotes) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
 	view := &NotificationView{}
 	if n.TargetType == "post" {
-		post, err := GetPost(ctx, db, &n.TargetID, "", nil, true)
+		post, err := getPost(ctx, db, &n.TargetID, "", nil, true)
 		if err != nil {
 			return nil, err
 		}
@@ -971,11 +996,11 @@ func (n NotificationNewVotes) view(ctx context.Context, db *sql.DB, format TextF
 		view.ToURL = fmt.Sprintf("/%s/post/%s", post.CommunityName, post.PublicID)
 		view.setIcon(post)
 	} else {
-		comment, err := GetComment(ctx, db, n.TargetID, nil)
+		comment, err := getComment(ctx, db, n.TargetID, nil)
 		if err != nil {
 			return nil, err
 		}
-		post, err := GetPost(ctx, db, &comment.PostID, "", nil, true)
+		post, err := getPost(ctx, db, &comment.PostID, "", nil, true)
 		if err != nil {
 			return nil, err
 		}
@@ -1040,13 +1065,13 @@ func (n NotificationPostDeleted) marshalJSONForAPI(ctx context.Context, db *sql.
 	}
 
 	if n.TargetType == "post" {
-		post, err := GetPost(ctx, db, &n.TargetID, "", nil, true)
+		post, err := getPost(ctx, db, &n.TargetID, "", nil, true)
 		if err != nil {
 			return nil, err
 		}
 		out.Post = post
 	} else {
-		comment, err := GetComment(ctx, db, n.TargetID, nil)
+		comment, err := getComment(ctx, db, n.TargetID, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -1056,7 +1081,7 @@ func (n NotificationPostDeleted) marshalJSONForAPI(ctx context.Context, db *sql.
 }
 
 func (n NotificationPostDeleted) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
-	post, err := GetPost(ctx, db, &n.TargetID, "", nil, true)
+	post, err := getPost(ctx, db, &n.TargetID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -1272,7 +1297,7 @@ func (n *NotificationAnnouncement) marshalJSONForAPI(ctx context.Context, db *sq
 		Community *Community `json:"community"`
 	}{T: (T)(*n)}
 
-	post, err := GetPost(ctx, db, &n.PostID, "", nil, true)
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -1287,7 +1312,7 @@ func (n *NotificationAnnouncement) marshalJSONForAPI(ctx context.Context, db *sq
 }
 
 func (n NotificationAnnouncement) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
-	post, err := GetPost(ctx, db, &n.PostID, "", nil, true)
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -1417,3 +1442,93 @@ func SendAnnouncementNotifications(ctx context.Context, db *sql.DB, post uid.ID)
 	}
 	return nil
 }
+
+// NotificationFollowedUserPost is sent to the followers of a user when the user
+// makes a post.
+type NotificationFollowedUserPost struct {
+	PostID uid.ID `json:"postId"`
+}
+
+func (n *NotificationFollowedUserPost) marshalJSONForAPI(ctx context.Context, db *sql.DB) ([]byte, error) {
+	type T NotificationFollowedUserPost
+	out := struct {
+		T
+		Post *Post `json:"post"`
+	}{T: (T)(*n)}
+
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
+	if err != nil {
+		return nil, err
+	}
+	out.Post = post
+	return json.Marshal(out)
+}
+
+func (n *NotificationFollowedUserPost) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
+	post, err := getPost(ctx, db, &n.PostID, "", nil, true)
+	if err != nil {
+		return nil, err
+	}
+	view := &NotificationView{
+		ToURL: fmt.Sprintf("/%s/post/%s", post.CommunityName, post.PublicID),
+		Title: fmt.Sprintf("%s posted %s in %s", encloseInBold(format, "@"+post.AuthorUsername), encloseInBold(format, post.Title), encloseInBold(format, post.CommunityName)),
+	}
+	view.setIcon(post)
+	return view, nil
+}
+
+// NotificationBanAppeal is sent to a banned user when their appeal of the ban
+// is accepted or denied.
+type NotificationBanAppeal struct {
+	AppealID      int             `json:"appealId"`
+	Type          BanAppealType   `json:"type"`
+	CommunityName string          `json:"communityName,omitempty"` // Only for community bans.
+	Accepted      bool            `json:"accepted"`
+	Response      msql.NullString `json:"response"`
+}
+
+func (n *NotificationBanAppeal) marshalJSONForAPI(ctx context.Context, db *sql.DB) ([]byte, error) {
+	type T NotificationBanAppeal
+	out := struct {
+		T
+		Community *Community `json:"community"`
+	}{T: (T)(*n)}
+
+	if n.Type == BanAppealTypeCommunity {
+		community, err := GetCommunityByName(ctx, db, n.CommunityName, nil)
+		if err != nil {
+			return nil, err
+		}
+		out.Community = community
+	}
+	return json.Marshal(out)
+}
+
+func (n *NotificationBanAppeal) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
+	outcome := "denied"
+	if n.Accepted {
+		outcome = "accepted"
+	}
+	view := &NotificationView{ToURL: "/"}
+	if n.Type == BanAppealTypeCommunity {
+		view.ToURL = "/" + n.CommunityName
+		view.Title = fmt.Sprintf("Your appeal of your ban from %s was %s", encloseInBold(format, n.CommunityName), encloseInBold(format, outcome))
+	} else {
+		view.Title = fmt.Sprintf("Your appeal of your site ban was %s", encloseInBold(format, outcome))
+	}
+	if n.Response.Valid {
+		view.Body = n.Response.String
+	}
+	view.setIcon(nil)
+	return view, nil
+}
+
+func createBanAppealNotification(ctx context.Context, db *sql.DB, appeal *BanAppeal) error {
+	return CreateNotification(ctx, db, appeal.UserID, NotificationTypeBanAppeal, &NotificationBanAppeal{
+		AppealID:      appeal.ID,
+		Type:          appeal.Type,
+		CommunityName: appeal.CommunityName.String,
+		Accepted:      appeal.Status == BanAppealStatusAccepted,
+		Response:      appeal.Response,
+	})
+}
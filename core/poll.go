@@ -0,0 +1,335 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	minPollOptions       = 2
+	maxPollOptions       = 8
+	maxPollOptionLength  = 255 // in runes.
+	maxPollCloseDuration = time.Hour * 24 * 365
+)
+
+var (
+	errNotPoll    = httperr.NewBadRequest("not-poll", "Post is not a poll.")
+	errPollClosed = httperr.NewForbidden("poll-closed", "Poll is closed.")
+
+	errAlreadyVotedPoll = &httperr.Error{
+		HTTPStatus: http.StatusConflict,
+		Code:       "poll/already-voted",
+		Message:    "User has already voted on the poll.",
+	}
+)
+
+// NewPoll is the poll of a poll post that's to be created.
+type NewPoll struct {
+	Options        []string      `json:"options"`
+	MultipleChoice bool          `json:"multipleChoice"`
+	ClosesAt       msql.NullTime `json:"closesAt"` // If not set, the poll never closes.
+}
+
+// validate normalizes and validates the poll. now is the creation time of the
+// poll.
+func (p *NewPoll) validate(now time.Time) error {
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		return httperr.NewBadRequest("poll/invalid-options-count", fmt.Sprintf("A poll must have between %d and %d options.", minPollOptions, maxPollOptions))
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for i, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return httperr.NewBadRequest("poll/option-empty", "Poll options cannot be empty.")
+		}
+		if utf8.RuneCountInString(option) > maxPollOptionLength {
+			return httperr.NewBadRequest("poll/option-too-long", fmt.Sprintf("Poll options cannot be longer than %d characters.", maxPollOptionLength))
+		}
+		if seen[strings.ToLower(option)] {
+			return httperr.NewBadRequest("poll/duplicate-options", "Poll options must be different from each other.")
+		}
+		seen[strings.ToLower(option)] = true
+		p.Options[i] = option
+	}
+	if p.ClosesAt.Valid {
+		if !p.ClosesAt.Time.After(now) {
+			return httperr.NewBadRequest("poll/invalid-close-time", "Poll close time must be in the future.")
+		}
+		if p.ClosesAt.Time.Sub(now) > maxPollCloseDuration {
+			return httperr.NewBadRequest("poll/invalid-close-time", "Poll close time is too far in the future.")
+		}
+	}
+	return nil
+}
+
+// Poll is the poll of a poll post.
+type Poll struct {
+	MultipleChoice bool          `json:"multipleChoice"`
+	ClosesAt       msql.NullTime `json:"closesAt"`
+	Closed         bool          `json:"closed"`
+
+	// If true, the vote counts are not included (because the viewer hasn't
+	// voted yet and the poll is still open).
+	ResultsHidden bool `json:"resultsHidden"`
+
+	NumVoters *int          `json:"noVoters"` // Nil if ResultsHidden is true.
+	Options   []*PollOption `json:"options"`
+
+	// The ids of the options the viewer has voted for. It's empty if the
+	// viewer hasn't voted.
+	ViewerVotes []int `json:"viewerVotes"`
+}
+
+// PollOption is an option of a poll.
+type PollOption struct {
+	ID       int    `json:"id"`
+	Text     string `json:"text"`
+	NumVotes *int   `json:"noVotes"` // Nil if the results of the poll are hidden.
+}
+
+// closed reports whether the poll is closed at t.
+func (p *Poll) closed(t time.Time) bool {
+	return p.ClosesAt.Valid && !t.Before(p.ClosesAt.Time)
+}
+
+// option returns the option with the id, or nil if there's no such option.
+func (p *Poll) option(id int) *PollOption {
+	for _, option := range p.Options {
+		if option.ID == id {
+			return option
+		}
+	}
+	return nil
+}
+
+// hideResults hides the vote counts of the poll, if the poll is open and the
+// viewer hasn't voted.
+func (p *Poll) hideResults() {
+	p.ResultsHidden = !p.Closed && len(p.ViewerVotes) == 0
+	if p.ResultsHidden {
+		p.NumVoters = nil
+		for _, option := range p.Options {
+			option.NumVotes = nil
+		}
+	}
+}
+
+// CreatePollPost creates a poll post. The body of the post, which is optional,
+// is a description of the poll.
+func CreatePollPost(ctx context.Context, db *sql.DB, author, community uid.ID, title, body string, poll *NewPoll, flair *int) (*Post, error) {
+	if poll == nil {
+		return nil, httperr.NewBadRequest("poll/empty", "Poll cannot be empty.")
+	}
+	if err := poll.validate(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return createPost(ctx, db, &createPostOpts{
+		flair:     flair,
+		postType:  PostTypePoll,
+		author:    author,
+		community: community,
+		title:     title,
+		body:      body,
+		poll:      poll,
+	})
+}
+
+// createPollTx saves the poll of the newly created post.
+func createPollTx(ctx context.Context, tx *sql.Tx, post uid.ID, poll *NewPoll) error {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO post_polls (post_id, multiple_choice, closes_at) VALUES (?, ?, ?)",
+		post, poll.MultipleChoice, poll.ClosesAt); err != nil {
+		return err
+	}
+
+	var rows [][]msql.ColumnValue
+	for i, option := range poll.Options {
+		rows = append(rows, []msql.ColumnValue{
+			{Name: "post_id", Value: post},
+			{Name: "position", Value: i},
+			{Name: "text", Value: option},
+		})
+	}
+	query, args := msql.BuildInsertQuery("poll_options", rows...)
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// populatePostsPolls sets the Poll field of the poll posts in posts (except
+// for those whose content is deleted). Vote counts are hidden as per
+// Poll.hideResults.
+func populatePostsPolls(ctx context.Context, db *sql.DB, posts []*Post, viewer *uid.ID) error {
+	polls := make(map[uid.ID]*Poll)
+	var args []any
+	for _, post := range posts {
+		if post.Type == PostTypePoll && !post.DeletedContent {
+			polls[post.ID] = nil
+			args = append(args, post.ID)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	inClause := msql.InClauseQuestionMarks(len(args))
+
+	now := time.Now()
+	rows, err := db.QueryContext(ctx, "SELECT post_id, multiple_choice, closes_at, no_voters FROM post_polls WHERE post_id IN "+inClause, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			postID    uid.ID
+			poll      = &Poll{Options: []*PollOption{}, ViewerVotes: []int{}}
+			numVoters int
+		)
+		if err := rows.Scan(&postID, &poll.MultipleChoice, &poll.ClosesAt, &numVoters); err != nil {
+			return err
+		}
+		poll.NumVoters = &numVoters
+		poll.Closed = poll.closed(now)
+		polls[postID] = poll
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT id, post_id, text, no_votes FROM poll_options WHERE post_id IN "+inClause+" ORDER BY position", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			postID   uid.ID
+			option   = &PollOption{}
+			numVotes int
+		)
+		if err := rows.Scan(&option.ID, &postID, &option.Text, &numVotes); err != nil {
+			return err
+		}
+		option.NumVotes = &numVotes
+		if poll := polls[postID]; poll != nil {
+			poll.Options = append(poll.Options, option)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if viewer != nil {
+		rows, err = db.QueryContext(ctx, "SELECT post_id, option_id FROM poll_votes WHERE user_id = ? AND post_id IN "+inClause, append([]any{*viewer}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				postID uid.ID
+				option int
+			)
+			if err := rows.Scan(&postID, &option); err != nil {
+				return err
+			}
+			if poll := polls[postID]; poll != nil {
+				poll.ViewerVotes = append(poll.ViewerVotes, option)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, post := range posts {
+		if poll := polls[post.ID]; poll != nil {
+			poll.hideResults()
+			post.Poll = poll
+		}
+	}
+	return nil
+}
+
+// VotePoll casts the vote of user, for the options with the ids in options, on
+// the poll of the post. Votes on polls cannot be changed.
+func (p *Post) VotePoll(ctx context.Context, db *sql.DB, user uid.ID, options []int) error {
+	if p.Type != PostTypePoll || p.Poll == nil {
+		return errNotPoll
+	}
+	if p.Deleted {
+		return httperr.NewForbidden("post-deleted", "Post is deleted.")
+	}
+	if p.Locked {
+		return errPostLocked
+	}
+	if p.Poll.closed(time.Now()) {
+		return errPollClosed
+	}
+	if is, err := IsUserBannedFromCommunity(ctx, db, p.CommunityID, user); err != nil {
+		return err
+	} else if is {
+		return errUserBannedFromCommunity
+	}
+
+	var ids []int
+	seen := make(map[int]bool)
+	for _, id := range options {
+		if seen[id] {
+			continue
+		}
+		if p.Poll.option(id) == nil {
+			return httperr.NewBadRequest("poll/invalid-option", "Invalid poll option.")
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return httperr.NewBadRequest("poll/no-options", "No poll options selected.")
+	}
+	if !p.Poll.MultipleChoice && len(ids) > 1 {
+		return httperr.NewBadRequest("poll/single-choice", "Only one option can be selected in this poll.")
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO poll_votes (option_id, post_id, user_id) VALUES (?, ?, ?)", id, p.ID, user); err != nil {
+				return err
+			}
+		}
+		// The primary key of poll_votes only prevents voting twice for the same
+		// option; check that the user hasn't voted for other options before.
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM poll_votes WHERE post_id = ? AND user_id = ?", p.ID, user).Scan(&count); err != nil {
+			return err
+		}
+		if count != len(ids) {
+			return errAlreadyVotedPoll
+		}
+		args := []any{}
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE poll_options SET no_votes = no_votes + 1 WHERE id IN "+msql.InClauseQuestionMarks(len(ids)), args...); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE post_polls SET no_voters = no_voters + 1 WHERE post_id = ?", p.ID)
+		return err
+	})
+	if err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return errAlreadyVotedPoll
+		}
+		return err
+	}
+
+	return populatePostsPolls(ctx, db, []*Post{p}, &user)
+}
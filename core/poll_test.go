@@ -0,0 +1,63 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+func TestNewPollValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		options  []string
+		closesAt msql.NullTime
+		valid    bool
+	}{
+		{"two options", []string{"Yes", "No"}, msql.NullTime{}, true},
+		{"eight options", []string{"1", "2", "3", "4", "5", "6", "7", "8"}, msql.NullTime{}, true},
+		{"one option", []string{"Yes"}, msql.NullTime{}, false},
+		{"nine options", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}, msql.NullTime{}, false},
+		{"empty option", []string{"Yes", "  "}, msql.NullTime{}, false},
+		{"duplicate options", []string{"Yes", " yes"}, msql.NullTime{}, false},
+		{"closes in future", []string{"Yes", "No"}, msql.NewNullTime(now.Add(time.Hour)), true},
+		{"closes in past", []string{"Yes", "No"}, msql.NewNullTime(now.Add(-time.Hour)), false},
+		{"closes too late", []string{"Yes", "No"}, msql.NewNullTime(now.Add(maxPollCloseDuration + time.Hour)), false},
+	}
+	for _, test := range tests {
+		p := &NewPoll{Options: test.options, ClosesAt: test.closesAt}
+		if err := p.validate(now); (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestPollHideResults(t *testing.T) {
+	n := 3
+	newPoll := func(closed bool, votes []int) *Poll {
+		return &Poll{
+			Closed:      closed,
+			NumVoters:   &n,
+			Options:     []*PollOption{{ID: 1, NumVotes: &n}, {ID: 2, NumVotes: &n}},
+			ViewerVotes: votes,
+		}
+	}
+	tests := []struct {
+		poll   *Poll
+		hidden bool
+	}{
+		{newPoll(false, []int{}), true},
+		{newPoll(false, []int{1}), false},
+		{newPoll(true, []int{}), false},
+	}
+	for i, test := range tests {
+		test.poll.hideResults()
+		if test.poll.ResultsHidden != test.hidden {
+			t.Errorf("test %d: got ResultsHidden %v, want %v", i, test.poll.ResultsHidden, test.hidden)
+		}
+		if hidden := test.poll.NumVoters == nil && test.poll.Options[0].NumVotes == nil; hidden != test.hidden {
+			t.Errorf("test %d: vote counts hidden %v, want %v", i, hidden, test.hidden)
+		}
+	}
+}
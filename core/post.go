@@ -5,9 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -15,12 +13,10 @@ import (
 	"time"
 
 	"github.com/discuitnet/discuit/internal/httperr"
-	"github.com/discuitnet/discuit/internal/httputil"
 	"github.com/discuitnet/discuit/internal/images"
 	msql "github.com/discuitnet/discuit/internal/sql"
 	"github.com/discuitnet/discuit/internal/uid"
 	"github.com/discuitnet/discuit/internal/utils"
-	"golang.org/x/exp/slices"
 )
 
 const (
@@ -41,6 +37,7 @@ const (
 	PostTypeText = PostType(iota)
 	PostTypeImage
 	PostTypeLink
+	PostTypePoll
 )
 
 // Valid reports whether t is a valid PostType.
@@ -59,6 +56,8 @@ func (t PostType) MarshalText() ([]byte, error) {
 		s = "image"
 	case PostTypeLink:
 		s = "link"
+	case PostTypePoll:
+		s = "poll"
 	default:
 		return nil, errPostTypeUnsupported
 	}
@@ -74,6 +73,8 @@ func (p *PostType) UnmarshalText(text []byte) error {
 		*p = PostTypeImage
 	case "link":
 		*p = PostTypeLink
+	case "poll":
+		*p = PostTypePoll
 	default:
 		return errPostTypeUnsupported
 	}
@@ -118,6 +119,17 @@ type Post struct {
 
 	Link *PostLink `json:"link,omitempty"` // what's sent to the client
 
+	Poll *Poll `json:"poll,omitempty"` // only for poll posts
+
+	crosspostOf uid.NullID // the original post, if the post is a crosspost
+
+	// If the post is a crosspost, CrosspostOf is the original post. The
+	// content of a crosspost is that of the original post.
+	CrosspostOf *Post `json:"crosspostOf,omitempty"`
+
+	// The number of (undeleted) crossposts of the post.
+	NumCrossposts int `json:"noCrossposts"`
+
 	Locked   bool       `json:"locked"`
 	LockedBy uid.NullID `json:"lockedBy"`
 
@@ -131,6 +143,9 @@ type Post struct {
 	Points    int `json:"-"` // Upvotes - Downvotes
 
 	Hotness        int           `json:"hotness"`
+	Rising         int           `json:"-"`
+	Controversy    int           `json:"-"`
+	Best           int           `json:"-"`
 	CreatedAt      time.Time     `json:"createdAt"`
 	EditedAt       msql.NullTime `json:"editedAt"`
 	LastActivityAt time.Time     `json:"lastActivityAt"`
@@ -151,6 +166,7 @@ type Post struct {
 	NumComments  int             `json:"noComments"`
 	Comments     []*Comment      `json:"comments"`
 	CommentsNext msql.NullString `json:"commentsNext"` // pagination cursor
+	CommentsSort *CommentSort    `json:"commentsSort,omitempty"`
 
 	// Whether the logged in user have voted on this post.
 	ViewerVoted msql.NullBool `json:"userVoted"`
@@ -161,6 +177,13 @@ type Post struct {
 	AuthorMutedByViewer    bool `json:"isAuthorMuted"`
 	CommunityMutedByViewer bool `json:"isCommunityMuted"`
 
+	Flair       *Flair `json:"flair"`
+	AuthorFlair *Flair `json:"authorFlair"` // The author's user flair in the community.
+
+	// Filtered is set if the post is collapsed by a content filter of the
+	// viewer.
+	Filtered *PostFilterNotice `json:"filtered,omitempty"`
+
 	Community *Community `json:"community,omitempty"`
 	Author    *User      `json:"author,omitempty"`
 }
@@ -188,6 +211,9 @@ var selectPostCols = []string{
 	"posts.downvotes",
 	"posts.points",
 	"posts.hotness",
+	"posts.rising",
+	"posts.controversy",
+	"posts.best",
 	"posts.created_at",
 	"posts.edited_at",
 	"posts.last_activity_at",
@@ -200,6 +226,9 @@ var selectPostCols = []string{
 	"posts.deleted_content_at",
 	"posts.deleted_content_by",
 	"posts.deleted_content_as",
+	"posts.flair_id",
+	"posts.crosspost_of",
+	"posts.no_crossposts",
 }
 
 var selectPostJoins = []string{
@@ -226,8 +255,25 @@ func buildSelectPostQuery(loggedIn bool, where string) string {
 }
 
 // GetPosts returns a post using publicID, if publicID is not an empty string,
-// or using postID.
+// or using postID. If the post is in a private community that viewer (nil for
+// a logged out user) cannot view, an error is returned.
 func GetPost(ctx context.Context, db *sql.DB, postID *uid.ID, publicID string, viewer *uid.ID, getDeleted bool) (*Post, error) {
+	post, err := getPost(ctx, db, postID, publicID, viewer, getDeleted)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := userCanViewCommunity(ctx, db, post.CommunityID, viewer); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errCommunityPrivate
+	}
+	return post, nil
+}
+
+// getPost is like GetPost, but it doesn't check whether viewer can view the
+// post. It's for fetching posts on behalf of the system (to render
+// notifications, for example).
+func getPost(ctx context.Context, db *sql.DB, postID *uid.ID, publicID string, viewer *uid.ID, getDeleted bool) (*Post, error) {
 	loggedIn := viewer != nil
 
 	where := "WHERE "
@@ -298,14 +344,20 @@ func GetPostsByIDs(ctx context.Context, db *sql.DB, viewer *uid.ID, includeDelet
 func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID) ([]*Post, error) {
 	defer rows.Close()
 
-	var posts []*Post
+	var (
+		posts    []*Post
+		flairIDs []sql.NullInt64 // flair ids of posts
+	)
 	loggedIn := viewer != nil
 
 	for rows.Next() {
 		post := &Post{
 			Images: make([]*images.Image, 0),
 		}
-		var linkBytes []byte
+		var (
+			linkBytes []byte
+			flairID   sql.NullInt64
+		)
 		dest := []interface{}{
 			&post.ID,
 			&post.Type,
@@ -329,6 +381,9 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.Downvotes,
 			&post.Points,
 			&post.Hotness,
+			&post.Rising,
+			&post.Controversy,
+			&post.Best,
 			&post.CreatedAt,
 			&post.EditedAt,
 			&post.LastActivityAt,
@@ -341,6 +396,9 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.DeletedContentAt,
 			&post.DeletedContentBy,
 			&post.DeletedContentAs,
+			&flairID,
+			&post.crosspostOf,
+			&post.NumCrossposts,
 		}
 
 		linkImage := &images.Image{}
@@ -382,6 +440,7 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 		}
 
 		posts = append(posts, post)
+		flairIDs = append(flairIDs, flairID)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -418,6 +477,18 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 	if err := populatePostsImages(ctx, db, posts); err != nil {
 		return nil, err
 	}
+	if err := populatePostsPolls(ctx, db, posts, viewer); err != nil {
+		return nil, err
+	}
+	if err := populatePostsFlairs(ctx, db, posts, flairIDs); err != nil {
+		return nil, err
+	}
+	if err := populatePostsAuthorFlairs(ctx, db, posts); err != nil {
+		return nil, err
+	}
+	if err := populatePostsCrosspostOf(ctx, db, posts, viewer); err != nil {
+		return nil, err
+	}
 
 	viewerAdmin, err := IsAdmin(db, viewer)
 	if err != nil {
@@ -574,11 +645,17 @@ type createPostOpts struct {
 	title     string
 
 	// Optional, depending on post type:
-	body      string // for text posts
+	body      string // for text and poll posts
 	link      postLink
 	linkImage []byte // for link posts (thumbnail image)
 	// image     uid.ID // for image posts
 	images []*ImageUpload // for image posts
+
+	poll *NewPoll // for poll posts
+
+	flair *int // Required if the community requires post flairs.
+
+	crosspostOf *Post // for crossposts
 }
 
 func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, error) {
@@ -606,6 +683,24 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 			return nil, httperr.NewForbidden("posting-restricted", "Posting in this community is restricted.")
 		}
 	}
+	if ok, err := community.UserCanPost(ctx, db, opts.author); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errPostingApprovalRequired
+	}
+
+	if opts.flair != nil {
+		if _, err := checkFlairUsable(ctx, db, *opts.flair, FlairTypePost, community.ID, opts.author); err != nil {
+			return nil, err
+		}
+	} else if community.PostFlairRequired {
+		return nil, errFlairRequired
+	}
+
+	hotness, err := community.postHotnessParams(ctx, db)
+	if err != nil {
+		return nil, err
+	}
 
 	// Truncate title and body if max lengths are exceeded.
 	var post Post
@@ -625,7 +720,11 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		{Name: "title", Value: post.Title},
 		{Name: "body", Value: post.Body},
 		{Name: "created_at", Value: post.CreatedAt},
-		{Name: "hotness", Value: PostHotness(0, 0, post.CreatedAt)},
+		{Name: "hotness", Value: postHotness(hotness, 0, 0, post.CreatedAt)},
+		{Name: "flair_id", Value: opts.flair},
+	}
+	if opts.crosspostOf != nil {
+		cols = append(cols, msql.ColumnValue{Name: "crosspost_of", Value: opts.crosspostOf.ID})
 	}
 
 	if opts.postType == PostTypeLink {
@@ -634,6 +733,9 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 			return nil, err
 		}
 		cols = append(cols, msql.ColumnValue{Name: "link_info", Value: data})
+		if u, err := url.Parse(opts.link.URL); err == nil {
+			cols = append(cols, msql.ColumnValue{Name: "link_hash", Value: linkHash(canonicalURL(u))})
+		}
 	}
 
 	tx, err := db.BeginTx(ctx, nil)
@@ -663,7 +765,14 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		return nil, err
 	}
 
-	if opts.postType == PostTypeImage {
+	if opts.postType == PostTypePoll && opts.crosspostOf == nil {
+		if err = createPollTx(ctx, tx, post.ID, opts.poll); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if opts.postType == PostTypeImage && opts.crosspostOf == nil {
 		// Insert the rows into post_images table.
 		var rows [][]msql.ColumnValue
 		for _, image := range opts.images {
@@ -716,15 +825,34 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		return nil, err
 	}
 
+	if opts.crosspostOf != nil {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET no_crossposts = no_crossposts + 1 WHERE id = ?", opts.crosspostOf.ID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return GetPost(ctx, db, &post.ID, "", nil, false)
+	created, err := getPost(ctx, db, &post.ID, "", nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := notifyFollowers(context.Background(), db, created); err != nil {
+			log.Printf("Error notifying the followers of %v: %v\n", created.AuthorID, err)
+		}
+	}()
+
+	return created, nil
 }
 
-func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, body string) (*Post, error) {
+func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, body string, flair *int) (*Post, error) {
 	return createPost(ctx, db, &createPostOpts{
+		flair:     flair,
 		postType:  PostTypeText,
 		author:    author,
 		community: community,
@@ -733,7 +861,7 @@ func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, t
 	})
 }
 
-func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, imgs []*ImageUpload) (*Post, error) {
+func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, imgs []*ImageUpload, flair *int) (*Post, error) {
 	// We don't check whether the image belongs to the person who uploaded it.
 	// This is not a big deal as image ids are hard to guess.
 
@@ -750,6 +878,7 @@ func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID,
 	}
 
 	return createPost(ctx, db, &createPostOpts{
+		flair:     flair,
 		postType:  PostTypeImage,
 		author:    author,
 		community: community,
@@ -758,61 +887,7 @@ func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID,
 	})
 }
 
-// getLinkPostImage returns the og:image of the url or, if no og:image can be
-// found and the url is itself is an image, then that image. If no image is
-// found in either case, it returns nil.
-func getLinkPostImage(u *url.URL) []byte {
-	fullURL := u.String()
-	res, err := httputil.Get(fullURL)
-	if err != nil {
-		return nil
-	}
-	defer res.Body.Close()
-
-	imageURL, err := httputil.ExtractOpenGraphImage(res.Body)
-	if err != nil {
-		log.Printf("error extracting the og:image tag of url: %v\n", u)
-		return nil
-	}
-	if imageURL == "" {
-		// Since og:image is not found, see if the link itself is an image.
-		probablyAnImage := slices.Contains([]string{"image/jpeg", "image/png", "image/webp"}, res.Header.Get("Content-Type"))
-		if !probablyAnImage {
-			exts := []string{".jpg", ".jpeg", ".png", ".webp"}
-			for _, v := range exts {
-				if strings.HasSuffix(u.Path, v) {
-					probablyAnImage = true
-					break
-				}
-			}
-		}
-		if probablyAnImage {
-			imageURL = fullURL
-		}
-	}
-	if imageURL != "" {
-		res, err := httputil.Get(imageURL)
-		if err != nil {
-			return nil
-		}
-		defer res.Body.Close()
-		if res.StatusCode < 200 || res.StatusCode > 299 {
-			return nil
-		}
-		image, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil
-		}
-		if len(image) == 0 {
-			return nil
-		}
-		return image
-	}
-
-	return nil
-}
-
-func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, link string) (*Post, error) {
+func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, link string, flair *int) (*Post, error) {
 	errInvalidURL := httperr.NewBadRequest("invalid-url", "Invalid URL.")
 	if len(link) > maxPostLinkLength {
 		link = link[:maxPostLinkLength]
@@ -828,17 +903,26 @@ func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, t
 	if u.Hostname() == "" {
 		return nil, errInvalidURL
 	}
+	u = canonicalURL(u)
+
+	preview, err := getLinkPreview(ctx, db, u)
+	if err != nil {
+		log.Printf("Error getting the link preview of %s: %v\n", u, err)
+		// Continue on error...
+	}
 
 	return createPost(ctx, db, &createPostOpts{
+		flair:     flair,
 		postType:  PostTypeLink,
 		author:    author,
 		community: community,
 		title:     title,
-		linkImage: getLinkPostImage(u),
+		linkImage: getLinkPostImage(ctx, preview),
 		link: postLink{
 			Version:  1,
 			URL:      u.String(),
 			Hostname: u.Hostname(),
+			Preview:  preview,
 		},
 	})
 }
@@ -868,14 +952,26 @@ func (p *Post) Save(ctx context.Context, db *sql.DB, user uid.ID) error {
 	var args []any
 	query := "UPDATE posts SET title = ?"
 	args = append(args, p.Title)
-	if p.Type == PostTypeText && !p.DeletedContent {
+	if (p.Type == PostTypeText || p.Type == PostTypePoll) && !p.DeletedContent {
 		query += ", body = ?"
 		args = append(args, p.Body)
 	}
 	query += ", edited_at = ? WHERE id = ?"
 	args = append(args, now, p.ID)
 
-	_, err := db.ExecContext(ctx, query, args...)
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var oldTitle, oldBody msql.NullString
+		if err := tx.QueryRowContext(ctx, "SELECT title, body FROM posts WHERE id = ? FOR UPDATE", p.ID).Scan(&oldTitle, &oldBody); err != nil {
+			return err
+		}
+		if oldTitle.String != p.Title || oldBody.String != p.Body.String {
+			if err := saveRevisionTx(ctx, tx, db, ContentTypePost, p.ID, p.CreatedAt, oldTitle, oldBody, user); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
 	if err == nil {
 		p.EditedAt.Valid = true
 		p.EditedAt.Time = now
@@ -956,6 +1052,11 @@ func (p *Post) Delete(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup,
 			if _, err := tx.ExecContext(ctx, q, true, now, user, g, p.ID); err != nil {
 				return err
 			}
+			if p.crosspostOf.Valid && !p.Deleted {
+				if _, err := tx.ExecContext(ctx, "UPDATE posts SET no_crossposts = no_crossposts - 1 WHERE id = ?", p.crosspostOf.ID); err != nil {
+					return err
+				}
+			}
 		}
 
 		if deleteContent {
@@ -1182,15 +1283,6 @@ func (p *Post) Pin(ctx context.Context, db *sql.DB, user uid.ID, siteWide, unpin
 	})
 }
 
-func (p *Post) updatePostsTablesPoints(ctx context.Context, db *sql.DB) error {
-	for _, table := range postsTables {
-		if _, err := db.ExecContext(ctx, "UPDATE "+table+" SET points = ? WHERE post_id = ?", p.Points, p.ID); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool) error {
 	if p.Locked {
 		return errPostLocked
@@ -1214,24 +1306,19 @@ func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool) error
 		return err
 	}
 
-	point := 1
+	point, authorPoints := 1, 0
 	if !up {
 		point = -1
 	}
-
-	query := "UPDATE posts SET points = points + ?, hotness = ?"
-	newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
-	if up {
-		query += ", upvotes = upvotes + 1"
-		newUpvotes++
-	} else {
-		query += ", downvotes = downvotes + 1"
-		newDownvotes++
+	if up && !p.AuthorID.EqualsTo(user) {
+		authorPoints = 1
+	}
+	if authorPoints, err = voterAuthorPoints(ctx, db, user, authorPoints); err != nil {
+		tx.Rollback()
+		return err
 	}
-	query += " WHERE id = ?"
 
-	_, err = tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID)
-	if err != nil {
+	if err = enqueueVote(ctx, tx, voteTargetPost, p.ID, p.AuthorID, authorPoints); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -1240,19 +1327,18 @@ func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool) error
 		return err
 	}
 
-	p.Upvotes = newUpvotes
-	p.Downvotes = newDownvotes
+	if up {
+		p.Upvotes++
+	} else {
+		p.Downvotes++
+	}
 	p.Points += point
 	p.ViewerVoted = msql.NewNullBool(true)
 	p.ViewerVotedUp = msql.NewNullBool(up)
 
-	// Attempt to update user's points.
-	if up && !p.AuthorID.EqualsTo(user) {
-		incrementUserPoints(ctx, db, p.AuthorID, 1)
-	}
-
-	// Attempt to create a notification (only for upvotes).
-	if !p.AuthorID.EqualsTo(user) && up {
+	// Attempt to create a notification (only for upvotes, and not for those of
+	// shadow-banned users).
+	if authorPoints > 0 {
 		go func() {
 			if err := CreateNewVotesNotification(context.Background(), db, p.AuthorID, p.CommunityName, true, p.ID); err != nil {
 				log.Printf("Failed creating new_votes notification: %v\n", err)
@@ -1260,7 +1346,7 @@ func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool) error
 		}()
 	}
 
-	return p.updatePostsTablesPoints(ctx, db)
+	return nil
 }
 
 // DeleteVote undos users's vote on post.
@@ -1286,21 +1372,19 @@ func (p *Post) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error {
 		return err
 	}
 
-	query := "UPDATE posts SET points = points + ?, hotness = ?"
-	point := 1
-	newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
+	point, authorPoints := 1, 0
 	if up {
 		point = -1
-		query += ", upvotes = upvotes - 1"
-		newUpvotes--
-	} else {
-		query += ", downvotes = downvotes -1"
-		newDownvotes--
+		if !p.AuthorID.EqualsTo(user) {
+			authorPoints = -1
+		}
+	}
+	if authorPoints, err = voterAuthorPoints(ctx, db, user, authorPoints); err != nil {
+		tx.Rollback()
+		return err
 	}
-	query += " WHERE id = ?"
 
-	_, err = tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID)
-	if err != nil {
+	if err = enqueueVote(ctx, tx, voteTargetPost, p.ID, p.AuthorID, authorPoints); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -1309,18 +1393,16 @@ func (p *Post) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error {
 		return err
 	}
 
-	p.Upvotes = newUpvotes
-	p.Downvotes = newDownvotes
+	if up {
+		p.Upvotes--
+	} else {
+		p.Downvotes--
+	}
 	p.Points += point
 	p.ViewerVoted.Valid = false
 	p.ViewerVotedUp.Valid = false
 
-	// Attempt to update user's points.
-	if up && !p.AuthorID.EqualsTo(user) {
-		incrementUserPoints(ctx, db, p.AuthorID, -1)
-	}
-
-	return p.updatePostsTablesPoints(ctx, db)
+	return nil
 }
 
 // ChangeVote changes user's vote on post.
@@ -1350,23 +1432,19 @@ func (p *Post) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bool)
 		return err
 	}
 
-	query := "UPDATE posts SET points = points + ?, hotness = ?"
-	points := 2
-	newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
+	points, authorPoints := 2, 0
 	if dbUp {
 		points = -2
-		query += ", upvotes = upvotes - 1, downvotes = downvotes + 1"
-		newUpvotes--
-		newDownvotes++
-	} else {
-		query += ", upvotes = upvotes + 1, downvotes = downvotes - 1"
-		newUpvotes++
-		newDownvotes--
 	}
-	query += " WHERE id = ?"
+	if !p.AuthorID.EqualsTo(user) {
+		authorPoints = points / 2
+	}
+	if authorPoints, err = voterAuthorPoints(ctx, db, user, authorPoints); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	_, err = tx.ExecContext(ctx, query, points, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID)
-	if err != nil {
+	if err = enqueueVote(ctx, tx, voteTargetPost, p.ID, p.AuthorID, authorPoints); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -1375,21 +1453,17 @@ func (p *Post) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bool)
 		return err
 	}
 
-	p.Upvotes = newUpvotes
-	p.Downvotes = newDownvotes
+	if dbUp {
+		p.Upvotes--
+		p.Downvotes++
+	} else {
+		p.Upvotes++
+		p.Downvotes--
+	}
 	p.Points += points
 	p.ViewerVotedUp = msql.NewNullBool(up)
 
-	// Attempt to update user's points.
-	if !p.AuthorID.EqualsTo(user) {
-		point := 1
-		if dbUp {
-			point = -1
-		}
-		incrementUserPoints(ctx, db, p.AuthorID, point)
-	}
-
-	return p.updatePostsTablesPoints(ctx, db)
+	return nil
 }
 
 func getComments(ctx context.Context, db *sql.DB, viewer *uid.ID, where string, args ...interface{}) ([]*Comment, error) {
@@ -1431,22 +1505,121 @@ func getComments(ctx context.Context, db *sql.DB, viewer *uid.ID, where string,
 	return ret(c, nil)
 }
 
-// CommentsCursor is an API pagination cursor.
+// CommentsCursor is an API pagination cursor of the comments of a post. Which
+// of its fields are used depends on the sort of the comments.
 type CommentsCursor struct {
-	Upvotes int
-	NextID  uid.ID
+	Sort CommentSort
+
+	// Score is the number of upvotes (of the top and the Q&A sorts), the
+	// controversy, or the best score of the next comment. It's not used by the
+	// new and the old sorts.
+	Score int
+
+	// Answer reports whether the next comment is an answer (see CommentSortQA).
+	Answer bool
+
+	NextID uid.ID
 }
 
-// GetComments populates c.Comments and returns the next comment's cursor.
-func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, cursor *CommentsCursor) (*CommentsCursor, error) {
+// String returns c in the form in which it's sent to API clients.
+func (c *CommentsCursor) String() string {
+	switch c.Sort {
+	case CommentSortNew, CommentSortOld:
+		return c.NextID.String()
+	case CommentSortQA:
+		answer := "0"
+		if c.Answer {
+			answer = "1"
+		}
+		return answer + "." + strconv.Itoa(c.Score) + "." + c.NextID.String()
+	}
+	return strconv.Itoa(c.Score) + "." + c.NextID.String()
+}
+
+// ParseCommentsCursor parses a cursor, in the form returned by
+// CommentsCursor.String, of comments sorted by sort.
+func ParseCommentsCursor(sort CommentSort, text string) (*CommentsCursor, error) {
+	c := &CommentsCursor{Sort: sort}
+	if sort == CommentSortNew || sort == CommentSortOld {
+		if err := c.NextID.UnmarshalText([]byte(text)); err != nil {
+			return nil, ErrInvalidFeedCursor
+		}
+		return c, nil
+	}
+	if sort == CommentSortQA {
+		answer, rest, _ := strings.Cut(text, ".")
+		if answer != "0" && answer != "1" {
+			return nil, ErrInvalidFeedCursor
+		}
+		c.Answer, text = answer == "1", rest
+	}
+	score, id, err := NextPointsIDCursor(text)
+	if err != nil || id == nil {
+		return nil, ErrInvalidFeedCursor
+	}
+	c.Score, c.NextID = score, *id
+	return c, nil
+}
+
+// commentsAnswerExpr returns an SQL expression, and its arguments, that is
+// true for the comments of the post that are answers (see CommentSortQA).
+func (p *Post) commentsAnswerExpr() (string, []any) {
+	expr := "(comments.user_id = ? OR comments.user_group IN (?, ?) OR comments.user_id IN (SELECT user_id FROM community_mods WHERE community_id = ?))"
+	return expr, []any{p.AuthorID, UserGroupMods, UserGroupAdmins, p.CommunityID}
+}
+
+// GetComments populates c.Comments, with the comments sorted by sort, and
+// returns the next comment's cursor.
+func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, sort CommentSort, cursor *CommentsCursor) (*CommentsCursor, error) {
+	if !sort.Valid() {
+		return nil, ErrInvalidCommentSort
+	}
+
 	var args []any
 	where := "WHERE comments.post_id = ? "
 	args = append(args, p.ID)
+	// Excluded in the query, rather than after, so that pages stay full.
+	where, args = whereCommentsNotShadowBanned(where, args, viewer)
+
+	var scoreCol string
+	switch sort {
+	case CommentSortTop, CommentSortQA:
+		scoreCol = "comments.upvotes"
+	case CommentSortControversial:
+		scoreCol = "comments.controversy"
+	case CommentSortBest:
+		scoreCol = "comments.best"
+	}
+	answerExpr, answerArgs := p.commentsAnswerExpr()
+
 	if cursor != nil {
-		where += "AND (comments.upvotes, comments.id) <= (?, ?) "
-		args = append(args, cursor.Upvotes, cursor.NextID)
+		switch sort {
+		case CommentSortNew:
+			where += "AND comments.id <= ? "
+			args = append(args, cursor.NextID)
+		case CommentSortOld:
+			where += "AND comments.id >= ? "
+			args = append(args, cursor.NextID)
+		case CommentSortQA:
+			where += fmt.Sprintf("AND (%s, %s, comments.id) <= (?, ?, ?) ", answerExpr, scoreCol)
+			args = append(args, answerArgs...)
+			args = append(args, cursor.Answer, cursor.Score, cursor.NextID)
+		default:
+			where += fmt.Sprintf("AND (%s, comments.id) <= (?, ?) ", scoreCol)
+			args = append(args, cursor.Score, cursor.NextID)
+		}
+	}
+	switch sort {
+	case CommentSortNew:
+		where += "ORDER BY comments.id DESC LIMIT ?"
+	case CommentSortOld:
+		where += "ORDER BY comments.id LIMIT ?"
+	case CommentSortQA:
+		where += fmt.Sprintf("ORDER BY %s DESC, %s DESC, comments.id DESC LIMIT ?", answerExpr, scoreCol)
+		args = append(args, answerArgs...)
+	default:
+		where += fmt.Sprintf("ORDER BY %s DESC, comments.id DESC LIMIT ?", scoreCol)
 	}
-	where += "ORDER BY upvotes DESC, comments.id DESC LIMIT ?"
 	args = append(args, commentsFetchLimit+1)
 
 	all, err := getComments(ctx, db, viewer, where, args...)
@@ -1458,12 +1631,27 @@ func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, curs
 
 	var nextCursor *CommentsCursor
 	if len(all) >= commentsFetchLimit+1 {
-		nextCursor = new(CommentsCursor)
-		nextCursor.Upvotes = all[commentsFetchLimit].Upvotes
-		nextCursor.NextID = all[commentsFetchLimit].ID
+		next := all[commentsFetchLimit]
+		nextCursor = &CommentsCursor{Sort: sort, NextID: next.ID}
+		switch sort {
+		case CommentSortTop:
+			nextCursor.Score = next.Upvotes
+		case CommentSortControversial:
+			nextCursor.Score = next.Controversy
+		case CommentSortBest:
+			nextCursor.Score = next.Best
+		case CommentSortQA:
+			nextCursor.Score = next.Upvotes
+			// The author of the comment may have been stripped from it.
+			row := db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM comments WHERE comments.id = ?", answerExpr), append(answerArgs, next.ID)...)
+			if err := row.Scan(&nextCursor.Answer); err != nil {
+				return nil, err
+			}
+		}
 		comments = all[:commentsFetchLimit]
 	}
 	p.Comments = comments
+	p.CommentsSort = &sort
 
 	ids := make(map[uid.ID]bool)
 	for _, c := range p.Comments {
@@ -1498,7 +1686,7 @@ func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, curs
 	}
 
 	if nextCursor != nil {
-		p.CommentsNext.String = strconv.Itoa(nextCursor.Upvotes) + "." + nextCursor.NextID.String()
+		p.CommentsNext.String = nextCursor.String()
 		p.CommentsNext.Valid = true
 	}
 
@@ -1507,21 +1695,21 @@ func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, curs
 
 // GetCommentReplies returns all the replies of comment.
 func (p *Post) GetCommentReplies(ctx context.Context, db *sql.DB, viewer *uid.ID, comment uid.ID) ([]*Comment, error) {
-	rows, err := db.QueryContext(ctx, "SELECT reply_id FROM comment_replies WHERE parent_id = ?", comment)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	ids, err := scanIDs(rows)
-	if err != nil {
+	where, args := commentRepliesWhere(p.ID, comment, viewer)
+	comments, err := getComments(ctx, db, viewer, where, args...)
+	if err != nil || len(comments) == 0 {
 		return nil, err
 	}
-	if len(ids) == 0 {
-		return nil, nil
-	}
+	return comments, nil
+}
 
-	return GetCommentsByIDs(ctx, db, viewer, ids...)
+// commentRepliesWhere returns the WHERE clause, and its arguments, of the
+// query of GetCommentReplies. The replies are limited to those of post, since
+// the caller checks only whether the viewer can view post (and comment could
+// be in a private community).
+func commentRepliesWhere(post, comment uid.ID, viewer *uid.ID) (string, []any) {
+	where := "WHERE comments.post_id = ? AND comments.id IN (SELECT reply_id FROM comment_replies WHERE parent_id = ?) "
+	return whereCommentsNotShadowBanned(where, []any{post, comment}, viewer)
 }
 
 // AddComment adds a new comment to post.
@@ -1666,103 +1854,6 @@ func IsPostLocked(ctx context.Context, db *sql.DB, post uid.ID) (bool, error) {
 	return is, err
 }
 
-// PostHotness calculates the hotness score of a post.
-func PostHotness(upvotes, downvotes int, date time.Time) int {
-	s := 0
-	for i := 1; i < upvotes+1; i++ {
-		if i <= 3 {
-			s += 1
-		} else if i <= 6 {
-			s += 3
-		} else if i <= 10 {
-			s += 3
-		} else if i <= 20 {
-			s += 4
-		} else if i <= 40 {
-			s += 5
-		} else {
-			s += 6
-		}
-	}
-
-	order := math.Log10(math.Max(math.Abs(float64(s)), 1))
-	var sign float64
-	if s > 0 {
-		sign = 1
-	} else if s < 0 {
-		sign = -1
-	}
-
-	interval := float64(45000) // float64(69000)
-	seconds := float64(date.Unix())
-	hotness := order + float64(sign*seconds)/interval
-	return int(math.Round(hotness * 10000000))
-}
-
-// UpdateAllPostsHotness applies the PostHotness function to every row in the
-// posts table.
-func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
-	var (
-		limit      = 1000
-		lastID     uid.ID
-		goOn       = true
-		totalCount = 0
-	)
-
-	for goOn {
-		rows, err := db.QueryContext(ctx, "SELECT id, upvotes, downvotes, created_at FROM posts WHERE id > ? ORDER BY id LIMIT ?", lastID, limit)
-		if err != nil {
-			return err
-		}
-
-		count := 0
-		tx, err := db.BeginTx(ctx, nil)
-		if err != nil {
-			return err
-		}
-
-		for rows.Next() {
-			upvotes, downvotes := 0, 0
-			var createdAt time.Time
-			var postID uid.ID
-			if err := rows.Scan(&postID, &upvotes, &downvotes, &createdAt); err != nil {
-				tx.Rollback()
-				rows.Close()
-				return err
-			}
-			if _, err := tx.ExecContext(ctx, "UPDATE posts SET hotness = ? WHERE id = ?", PostHotness(upvotes, downvotes, createdAt), postID); err != nil {
-				log.Println(err)
-				goOn = false
-				break
-			}
-			lastID = postID
-			count++
-		}
-
-		if err := rows.Err(); err != nil {
-			tx.Rollback()
-			rows.Close()
-			return err
-		}
-
-		if err = tx.Commit(); err != nil {
-			return err
-		}
-
-		totalCount += count
-		if count < limit {
-			goOn = false
-		}
-
-		if err := rows.Close(); err != nil {
-			return err
-		}
-	}
-
-	log.Printf("Fixed %v posts", totalCount)
-	return nil
-}
-
 func SavePostImage(ctx context.Context, db *sql.DB, authorID uid.ID, image []byte) (*images.ImageRecord, error) {
 	var imageID uid.ID
 	err := msql.Transact(ctx, db, func(tx *sql.Tx) (err error) {
@@ -1837,9 +1928,10 @@ func RemoveTempImages(ctx context.Context, db *sql.DB) (int, error) {
 
 // postLink is the link metadata of a link post as stored in the database.
 type postLink struct {
-	Version  int    `json:"v"`
-	URL      string `json:"u"`
-	Hostname string `json:"h"`
+	Version  int          `json:"v"`
+	URL      string       `json:"u"`
+	Hostname string       `json:"h"`
+	Preview  *LinkPreview `json:"p,omitempty"`
 }
 
 func (pl *postLink) PostLink() *PostLink {
@@ -1847,6 +1939,7 @@ func (pl *postLink) PostLink() *PostLink {
 		Version:  pl.Version,
 		URL:      pl.URL,
 		Hostname: pl.Hostname,
+		Preview:  pl.Preview,
 	}
 }
 
@@ -1856,6 +1949,7 @@ type PostLink struct {
 	URL      string        `json:"url"`
 	Hostname string        `json:"hostname"`
 	Image    *images.Image `json:"image"`
+	Preview  *LinkPreview  `json:"preview,omitempty"` // nil for older posts
 }
 
 func (pl *PostLink) SetImageCopies() {
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"time"
+
+	"github.com/discuitnet/discuit/core/sitesettings"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// The scores of posts by which feeds are sorted (hotness, rising,
+// controversy, and best) are stored in the posts table, so that feeds can be
+// paginated with a cursor of a score and a post ID. Likewise for the scores of
+// comments in the comments table. The scores are kept up to
+// date by FlushVoteQueue, UpdateRisingPosts, and UpdateAllPostsHotness.
+
+const (
+	// Only the votes of this last period count towards the rising score of a
+	// post.
+	risingWindow = time.Hour * 3
+
+	// Posts older than this are not rising.
+	risingMaxAge = time.Hour * 24
+)
+
+// PostHotness calculates the hotness score of a post, with the default
+// hotness parameters.
+func PostHotness(upvotes, downvotes int, date time.Time) int {
+	return postHotness(sitesettings.HotnessParams{}, upvotes, downvotes, date)
+}
+
+func postHotness(params sitesettings.HotnessParams, upvotes, downvotes int, date time.Time) int {
+	s := 0
+	for i := 1; i < upvotes+1; i++ {
+		if i <= 3 {
+			s += 1
+		} else if i <= 6 {
+			s += 3
+		} else if i <= 10 {
+			s += 3
+		} else if i <= 20 {
+			s += 4
+		} else if i <= 40 {
+			s += 5
+		} else {
+			s += 6
+		}
+	}
+	score := float64(s) - params.DownvoteWeight*float64(downvotes)
+
+	order := math.Log10(math.Max(math.Abs(score), 1))
+	var sign float64
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+
+	interval := float64(sitesettings.DefaultHotnessInterval)
+	if params.Interval > 0 {
+		interval = float64(params.Interval)
+	}
+	seconds := float64(date.Unix())
+	hotness := order + float64(sign*seconds)/interval
+	return int(math.Round(hotness * 10000000))
+}
+
+// controversyScore returns the controversy score of a post or a comment, which
+// is higher the more votes it has and the more evenly they are split between
+// upvotes and downvotes.
+func controversyScore(upvotes, downvotes int) int {
+	if upvotes <= 0 || downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(upvotes + downvotes)
+	balance := float64(min(upvotes, downvotes)) / float64(max(upvotes, downvotes))
+	return int(math.Round(math.Pow(magnitude, balance) * 1000))
+}
+
+// bestScore returns the lower bound of the Wilson score confidence interval (at
+// 95% confidence) of the ratio of upvotes to all votes.
+func bestScore(upvotes, downvotes int) int {
+	n := float64(upvotes + downvotes)
+	if n <= 0 {
+		return 0
+	}
+	const z = 1.96
+	phat := float64(upvotes) / n
+	lower := (phat + z*z/(2*n) - z*math.Sqrt((phat*(1-phat)+z*z/(4*n))/n)) / (1 + z*z/n)
+	return int(math.Round(lower * 10000000))
+}
+
+// postRising returns the rising score of a post: the net votes it got in the
+// last risingWindow, per hour.
+func postRising(netVotes int, createdAt, now time.Time) int {
+	age := now.Sub(createdAt)
+	if age > risingMaxAge || netVotes <= 0 {
+		return 0
+	}
+	// The velocity of the votes of the very newest posts is not measured
+	// over less than 15 minutes, so that a couple of votes don't put them on
+	// top.
+	period := min(max(age, time.Minute*15), risingWindow)
+	return int(math.Round(float64(netVotes) / period.Hours() * 1000))
+}
+
+// hotnessParams returns the hotness parameters of posts of a community, given
+// the community's overrides (the hotness_params column of the communities
+// table).
+func hotnessParams(ctx context.Context, db *sql.DB, communityParams []byte) (sitesettings.HotnessParams, error) {
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return sitesettings.HotnessParams{}, err
+	}
+	params := settings.Hotness
+	if communityParams != nil {
+		var o sitesettings.HotnessParams
+		if err := json.Unmarshal(communityParams, &o); err != nil {
+			return params, err
+		}
+		params = params.Override(o)
+	}
+	return params, nil
+}
+
+// postHotnessParams returns the hotness parameters of the posts of c: the
+// site-wide parameters, overridden by those of c, if any.
+func (c *Community) postHotnessParams(ctx context.Context, db *sql.DB) (sitesettings.HotnessParams, error) {
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return sitesettings.HotnessParams{}, err
+	}
+	params := settings.Hotness
+	if c.HotnessParams != nil {
+		params = params.Override(*c.HotnessParams)
+	}
+	return params, nil
+}
+
+// postRisingVotes returns the net votes post got in the last risingWindow.
+func postRisingVotes(ctx context.Context, tx *sql.Tx, post uid.ID, now time.Time) (int, error) {
+	var n sql.NullInt64
+	row := tx.QueryRowContext(ctx, "SELECT SUM(IF(up, 1, -1)) FROM post_votes WHERE post_id = ? AND created_at > ? AND user_id NOT IN ("+shadowBannedUsersQuery+")", post, now.Add(-risingWindow))
+	if err := row.Scan(&n); err != nil {
+		return 0, err
+	}
+	return int(n.Int64), nil
+}
+
+// UpdateRisingPosts recalculates the rising scores of all the posts that are
+// currently rising, so that the scores decay as votes stop coming.
+func UpdateRisingPosts(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM posts WHERE rising > 0")
+	if err != nil {
+		return err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+			var createdAt time.Time
+			if err := tx.QueryRowContext(ctx, "SELECT created_at FROM posts WHERE id = ?", id).Scan(&createdAt); err != nil {
+				return err
+			}
+			votes, err := postRisingVotes(ctx, tx, id, now)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE posts SET rising = ? WHERE id = ?", postRising(votes, createdAt, now), id)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateAllPostsHotness recalculates the hotness, the controversy, and the
+// best scores of every row in the posts table.
+func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
+	return updatePostsHotness(ctx, db, nil)
+}
+
+// updatePostsHotness recalculates the hotness, the controversy, and the best
+// scores of all the posts in community, or of all the posts if community is
+// nil.
+func updatePostsHotness(ctx context.Context, db *sql.DB, community *uid.ID) error {
+	var (
+		limit      = 1000
+		lastID     uid.ID
+		goOn       = true
+		totalCount = 0
+	)
+
+	query := "SELECT posts.id, posts.upvotes, posts.downvotes, posts.created_at, communities.hotness_params FROM posts INNER JOIN communities ON communities.id = posts.community_id WHERE posts.id > ? "
+	args := []any{nil}
+	if community != nil {
+		query += "AND posts.community_id = ? "
+		args = append(args, *community)
+	}
+	query += "ORDER BY posts.id LIMIT ?"
+	args = append(args, limit)
+
+	for goOn {
+		args[0] = lastID
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			upvotes, downvotes := 0, 0
+			var createdAt time.Time
+			var postID uid.ID
+			var communityParams []byte
+			if err := rows.Scan(&postID, &upvotes, &downvotes, &createdAt, &communityParams); err != nil {
+				tx.Rollback()
+				rows.Close()
+				return err
+			}
+			params, err := hotnessParams(ctx, db, communityParams)
+			if err != nil {
+				tx.Rollback()
+				rows.Close()
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE posts SET hotness = ?, controversy = ?, best = ? WHERE id = ?",
+				postHotness(params, upvotes, downvotes, createdAt), controversyScore(upvotes, downvotes), bestScore(upvotes, downvotes), postID); err != nil {
+				log.Println(err)
+				goOn = false
+				break
+			}
+			lastID = postID
+			count++
+		}
+
+		if err := rows.Err(); err != nil {
+			tx.Rollback()
+			rows.Close()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+
+		totalCount += count
+		if count < limit {
+			goOn = false
+		}
+
+		if err := rows.Close(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Fixed %v posts", totalCount)
+	return nil
+}
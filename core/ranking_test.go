@@ -0,0 +1,65 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/core/sitesettings"
+)
+
+func TestVoteScores(t *testing.T) {
+	// Each case is a pair of vote counts (upvotes, downvotes) of which the
+	// first should score higher.
+	cases := []struct {
+		name          string
+		score         func(up, down int) int
+		higher, lower [2]int
+	}{
+		{"best", bestScore, [2]int{100, 5}, [2]int{10, 0}},
+		{"best", bestScore, [2]int{10, 0}, [2]int{1, 0}},
+		{"best", bestScore, [2]int{1, 0}, [2]int{0, 0}},
+		{"controversy", controversyScore, [2]int{50, 50}, [2]int{90, 10}},
+		{"controversy", controversyScore, [2]int{50, 50}, [2]int{5, 5}},
+		{"controversy", controversyScore, [2]int{2, 1}, [2]int{100, 0}},
+	}
+	for _, c := range cases {
+		h, l := c.score(c.higher[0], c.higher[1]), c.score(c.lower[0], c.lower[1])
+		if h <= l {
+			t.Errorf("%s: %v scored %d, not higher than %v (%d)", c.name, c.higher, h, c.lower, l)
+		}
+	}
+}
+
+func TestPostRising(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		votes int
+		age   time.Duration
+		want  int
+	}{
+		{0, time.Hour, 0},
+		{-5, time.Hour, 0},
+		{10, time.Hour * 25, 0},
+		{10, time.Hour, 10000},
+		{10, time.Hour * 6, 3333},
+		{1, time.Minute, 4000},
+	}
+	for _, c := range cases {
+		if got := postRising(c.votes, now.Add(-c.age), now); got != c.want {
+			t.Errorf("postRising(%d, %v old) = %d, want %d", c.votes, c.age, got, c.want)
+		}
+	}
+}
+
+func TestPostHotnessParams(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got, want := postHotness(sitesettings.HotnessParams{}, 10, 5, date), PostHotness(10, 5, date); got != want {
+		t.Errorf("hotness with zero params is %d, want the default %d", got, want)
+	}
+	if postHotness(sitesettings.HotnessParams{DownvoteWeight: 1}, 10, 5, date) >= PostHotness(10, 5, date) {
+		t.Error("downvotes didn't lower hotness with a non-zero downvote weight")
+	}
+	if postHotness(sitesettings.HotnessParams{Interval: 90000}, 10, 0, date) >= PostHotness(10, 0, date) {
+		t.Error("a longer interval didn't lower the hotness of a recent post")
+	}
+}
@@ -135,7 +135,7 @@ func NewReport(ctx context.Context, db *sql.DB, community uid.ID, post uid.NullI
 
 // NewPostReport creates a report on post.
 func NewPostReport(ctx context.Context, db *sql.DB, post uid.ID, reason int, createdBy uid.ID) (*Report, error) {
-	p, err := GetPost(ctx, db, &post, "", nil, true)
+	p, err := getPost(ctx, db, &post, "", nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -145,7 +145,7 @@ func NewPostReport(ctx context.Context, db *sql.DB, post uid.ID, reason int, cre
 
 // NewCommentReport creates a report on comment.
 func NewCommentReport(ctx context.Context, db *sql.DB, comment uid.ID, reason int, createdBy uid.ID) (*Report, error) {
-	c, err := GetComment(ctx, db, comment, nil)
+	c, err := getComment(ctx, db, comment, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -221,13 +221,13 @@ func GetReport(ctx context.Context, db *sql.DB, reportID int) (*Report, error) {
 // made.
 func (r *Report) FetchTarget(ctx context.Context, db *sql.DB) error {
 	if r.Type == ReportTypePost {
-		post, err := GetPost(ctx, db, &r.TargetID, "", nil, true)
+		post, err := getPost(ctx, db, &r.TargetID, "", nil, true)
 		if err != nil {
 			return err
 		}
 		r.Target = post
 	} else if r.Type == ReportTypeComment {
-		comment, err := GetComment(ctx, db, r.TargetID, nil)
+		comment, err := getComment(ctx, db, r.TargetID, nil)
 		if err != nil {
 			return err
 		}
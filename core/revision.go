@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/discuitnet/discuit/core/sitesettings"
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+var errRevisionsForbidden = httperr.NewForbidden("revisions-forbidden", "You cannot see the revisions of this content.")
+
+// Revision is an edit of a post or a comment. It holds the content as it was
+// before the edit, and the diff of the edit.
+type Revision struct {
+	ID        int             `json:"id"`
+	Title     msql.NullString `json:"title"` // Only for posts.
+	Body      msql.NullString `json:"body"`
+	EditorID  uid.ID          `json:"editorId"`
+	EditedAt  time.Time       `json:"editedAt"`
+	TitleDiff []DiffChunk     `json:"titleDiff,omitempty"` // Only for posts.
+	BodyDiff  []DiffChunk     `json:"bodyDiff"`
+}
+
+// saveRevisionTx records an edit, by editor, of the post or comment id, whose
+// content before the edit is title and body. Edits made within the edit grace
+// period (see sitesettings.SiteSettings.EditGracePeriod) of createdAt, the
+// creation time of the content, are not recorded.
+func saveRevisionTx(ctx context.Context, tx *sql.Tx, db *sql.DB, t ContentType, id uid.ID, createdAt time.Time, title, body msql.NullString, editor uid.ID) error {
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return err
+	}
+	if time.Since(createdAt) < settings.EditGrace() {
+		return nil
+	}
+	query, args := msql.BuildInsertQuery("content_revisions", []msql.ColumnValue{
+		{Name: "target_type", Value: t},
+		{Name: "target_id", Value: id},
+		{Name: "title", Value: title},
+		{Name: "body", Value: body},
+		{Name: "editor_id", Value: editor},
+	})
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// canViewRevisions reports whether viewer can see the revisions of content,
+// by author, in community. deleted is whether the content is deleted. The
+// revisions of deleted content are kept, as a record for mods, but only mods
+// and admins can see them.
+func canViewRevisions(ctx context.Context, db *sql.DB, community, author uid.ID, deleted bool, viewer *uid.ID) (bool, error) {
+	if viewer != nil {
+		if is, err := UserModOrAdmin(ctx, db, community, *viewer); err != nil || is {
+			return is, err
+		}
+		if !deleted && *viewer == author {
+			return true, nil
+		}
+	}
+	if deleted {
+		return false, nil
+	}
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	return settings.PublicRevisions, nil
+}
+
+// getRevisions returns the revisions of the post or comment id, oldest first.
+// title and body are the current content, against which the latest revision
+// is diffed.
+func getRevisions(ctx context.Context, db *sql.DB, t ContentType, id uid.ID, title, body msql.NullString) ([]*Revision, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, title, body, editor_id, created_at
+		FROM content_revisions
+		WHERE target_type = ? AND target_id = ?
+		ORDER BY id`, t, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revs := []*Revision{}
+	for rows.Next() {
+		rev := &Revision{}
+		if err := rows.Scan(&rev.ID, &rev.Title, &rev.Body, &rev.EditorID, &rev.EditedAt); err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, rev := range revs {
+		nextTitle, nextBody := title, body
+		if i+1 < len(revs) {
+			nextTitle, nextBody = revs[i+1].Title, revs[i+1].Body
+		}
+		if t == ContentTypePost {
+			rev.TitleDiff = diffText(rev.Title.String, nextTitle.String)
+		}
+		rev.BodyDiff = diffText(rev.Body.String, nextBody.String)
+	}
+	return revs, nil
+}
+
+// GetRevisions returns the edit history of the post, oldest edit first.
+func (p *Post) GetRevisions(ctx context.Context, db *sql.DB, viewer *uid.ID) ([]*Revision, error) {
+	if ok, err := canViewRevisions(ctx, db, p.CommunityID, p.AuthorID, p.Deleted || p.DeletedContent, viewer); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errRevisionsForbidden
+	}
+	return getRevisions(ctx, db, ContentTypePost, p.ID, msql.NewNullString(p.Title), p.Body)
+}
+
+// GetRevisions returns the edit history of the comment, oldest edit first.
+func (c *Comment) GetRevisions(ctx context.Context, db *sql.DB, viewer *uid.ID) ([]*Revision, error) {
+	if ok, err := canViewRevisions(ctx, db, c.CommunityID, c.AuthorID, c.Deleted, viewer); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errRevisionsForbidden
+	}
+	return getRevisions(ctx, db, ContentTypeComment, c.ID, msql.NullString{}, msql.NewNullString(c.Body))
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// A shadow-banned user can post, comment, and vote as usual, and sees their
+// own content as usual, but their posts and comments are hidden from everyone
+// else, and their votes are not counted. Unlike a site ban, which spammers
+// notice right away, it keeps them on an account that's harmless.
+//
+// Nothing is deleted on a shadow ban, so it can be undone: the votes of the
+// user are excluded from the vote counts on recount (see FlushVoteQueue), and
+// on a shadow ban (or its undoing), all the posts and comments the user voted
+// on are queued for a recount.
+
+// shadowBannedUsersQuery selects the IDs of all the shadow-banned users.
+const shadowBannedUsersQuery = "SELECT id FROM users WHERE shadow_banned_at IS NOT NULL"
+
+// shadowBannedCondition returns an SQL condition, and its arguments, that's
+// false for the rows of column (a user ID column) that belong to shadow-banned
+// users other than viewer.
+func shadowBannedCondition(column string, viewer *uid.ID) (string, []any) {
+	if viewer == nil {
+		return fmt.Sprintf("%s NOT IN (%s)", column, shadowBannedUsersQuery), nil
+	}
+	return fmt.Sprintf("%s NOT IN (%s AND id <> ?)", column, shadowBannedUsersQuery), []any{*viewer}
+}
+
+// IsShadowBanned reports whether u is shadow-banned.
+func (u *User) IsShadowBanned() bool {
+	return u.ShadowBannedAt.Valid
+}
+
+// userShadowBanned reports whether user is shadow-banned.
+func userShadowBanned(ctx context.Context, db *sql.DB, user uid.ID) (bool, error) {
+	var t msql.NullTime
+	if err := db.QueryRowContext(ctx, "SELECT shadow_banned_at FROM users WHERE id = ?", user).Scan(&t); err != nil {
+		return false, err
+	}
+	return t.Valid, nil
+}
+
+// ShadowBan shadow-bans u. It does nothing if u is already shadow-banned.
+func (u *User) ShadowBan(ctx context.Context, db *sql.DB) error {
+	if u.Deleted {
+		return ErrUserDeleted
+	}
+	if u.IsShadowBanned() {
+		return nil
+	}
+	now := time.Now()
+	if err := u.setShadowBan(ctx, db, msql.NewNullTime(now)); err != nil {
+		return err
+	}
+	u.ShadowBannedAt = msql.NewNullTime(now)
+	return nil
+}
+
+// UndoShadowBan undoes the shadow ban of u, after which the content of u is
+// visible, and the votes of u count, as if u had never been shadow-banned.
+func (u *User) UndoShadowBan(ctx context.Context, db *sql.DB) error {
+	if !u.IsShadowBanned() {
+		return nil
+	}
+	if err := u.setShadowBan(ctx, db, msql.NullTime{}); err != nil {
+		return err
+	}
+	u.ShadowBannedAt = msql.NullTime{}
+	return nil
+}
+
+// setShadowBan sets the shadow_banned_at column of u to t, and queues a
+// recount of all the posts and comments u voted on. The upvotes of u are
+// taken from (or given back to) the points of their authors.
+func (u *User) setShadowBan(ctx context.Context, db *sql.DB, t msql.NullTime) error {
+	authorPoints := 1
+	if t.Valid {
+		authorPoints = -1
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET shadow_banned_at = ? WHERE id = ?", t, u.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO vote_queue (target_type, target_id, author_id, author_points)
+			SELECT ?, post_votes.post_id, posts.user_id, IF(post_votes.up AND posts.user_id <> post_votes.user_id, ?, 0)
+			FROM post_votes
+			INNER JOIN posts ON posts.id = post_votes.post_id
+			WHERE post_votes.user_id = ?`, voteTargetPost, authorPoints, u.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO vote_queue (target_type, target_id, author_id, author_points)
+			SELECT ?, comment_votes.comment_id, comments.user_id, IF(comment_votes.up AND comments.user_id <> comment_votes.user_id, ?, 0)
+			FROM comment_votes
+			INNER JOIN comments ON comments.id = comment_votes.comment_id
+			WHERE comment_votes.user_id = ?`, voteTargetComment, authorPoints, u.ID)
+		return err
+	})
+}
+
+// whereCommentsNotShadowBanned appends to where (a non-empty WHERE clause of
+// a comments query) a condition that excludes the comments by shadow-banned
+// users other than viewer, along with all the replies to them.
+func whereCommentsNotShadowBanned(where string, args []any, viewer *uid.ID) (string, []any) {
+	cond, condArgs := shadowBannedCondition("comments.user_id", viewer)
+	banned := "SELECT comments.id FROM comments INNER JOIN users ON users.id = comments.user_id WHERE users.shadow_banned_at IS NOT NULL"
+	if viewer != nil {
+		banned += " AND users.id <> ?"
+		condArgs = append(condArgs, *viewer)
+	}
+	where += fmt.Sprintf("AND %s AND comments.id NOT IN (SELECT reply_id FROM comment_replies WHERE parent_id IN (%s)) ", cond, banned)
+	return where, append(args, condArgs...)
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestWhereNotShadowBanned(t *testing.T) {
+	viewer := uid.New()
+	cases := []struct {
+		where, table string
+		viewer       *uid.ID
+		want         string
+		nargs        int
+	}{
+		{"WHERE posts.deleted = FALSE ", "posts", nil, "WHERE posts.deleted = FALSE AND posts.user_id NOT IN (SELECT id FROM users WHERE shadow_banned_at IS NOT NULL) ", 1},
+		{"", "posts_today", &viewer, "posts_today.user_id NOT IN (SELECT id FROM users WHERE shadow_banned_at IS NOT NULL AND id <> ?) ", 2},
+	}
+	for _, c := range cases {
+		where, args := whereNotShadowBanned(c.where, c.table, []any{"x"}, c.viewer)
+		if where != c.want || len(args) != c.nargs {
+			t.Errorf("got %q (%d args), want %q (%d args)", where, len(args), c.want, c.nargs)
+		}
+	}
+}
+
+func TestCommentRepliesWhere(t *testing.T) {
+	post, comment, viewer := uid.New(), uid.New(), uid.New()
+	cases := []struct {
+		viewer *uid.ID
+		want   string
+		nargs  int
+	}{
+		{nil, "WHERE comments.post_id = ? AND comments.id IN (SELECT reply_id FROM comment_replies WHERE parent_id = ?) AND comments.user_id NOT IN (SELECT id FROM users WHERE shadow_banned_at IS NOT NULL) AND comments.id NOT IN (SELECT reply_id FROM comment_replies WHERE parent_id IN (SELECT comments.id FROM comments INNER JOIN users ON users.id = comments.user_id WHERE users.shadow_banned_at IS NOT NULL)) ", 2},
+		{&viewer, "WHERE comments.post_id = ? AND comments.id IN (SELECT reply_id FROM comment_replies WHERE parent_id = ?) AND comments.user_id NOT IN (SELECT id FROM users WHERE shadow_banned_at IS NOT NULL AND id <> ?) AND comments.id NOT IN (SELECT reply_id FROM comment_replies WHERE parent_id IN (SELECT comments.id FROM comments INNER JOIN users ON users.id = comments.user_id WHERE users.shadow_banned_at IS NOT NULL AND users.id <> ?)) ", 4},
+	}
+	for _, c := range cases {
+		where, args := commentRepliesWhere(post, comment, c.viewer)
+		if where != c.want || len(args) != c.nargs {
+			t.Errorf("got %q (%d args), want %q (%d args)", where, len(args), c.want, c.nargs)
+		}
+		// The replies must be scoped to post, whose visibility is what the
+		// caller checks.
+		if len(args) < 2 || args[0] != post || args[1] != comment {
+			t.Errorf("got args %v, want post and comment first", args)
+		}
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 var cache = &ssCache{}
@@ -16,8 +20,48 @@ var cache = &ssCache{}
 type SiteSettings struct {
 	SignupsDisabled bool `json:"signupsDisabled"`
 
-	// note: ssCache.store() and ssCache.get() uses shallow-copy on this struct.
-	// So those lines of code need updating if pointer fields are added to this
+	// Hotness are the parameters of the hot sort of feeds. Communities may
+	// override them.
+	Hotness HotnessParams `json:"hotness"`
+
+	// EditGracePeriod is the number of seconds, after a post or a comment is
+	// created, during which its edits are not recorded as revisions. Zero means
+	// the default (DefaultEditGracePeriod), and a negative value means no
+	// grace period.
+	EditGracePeriod int `json:"editGracePeriod"`
+
+	// If true, everyone can see the revisions of edited posts and comments.
+	// Otherwise only the mods of the community, the admins, and the author
+	// can.
+	PublicRevisions bool `json:"publicRevisions"`
+
+	// DuplicateLinkWindow is the number of hours, after a link is posted in a
+	// community, during which posting the same link in the community again
+	// requires confirmation. Zero means the default
+	// (DefaultDuplicateLinkWindow), and a negative value means never.
+	DuplicateLinkWindow int `json:"duplicateLinkWindow"`
+
+	// LinkPreviewTTL is the number of hours for which the previews of links
+	// are cached. Zero means the default (DefaultLinkPreviewTTL), and a
+	// negative value means previews aren't cached.
+	LinkPreviewTTL int `json:"linkPreviewTTL"`
+
+	// MaxSignupsPerIP is the number of accounts that can be created from an IP
+	// address within SignupIPWindow. Zero means no limit.
+	MaxSignupsPerIP int `json:"maxSignupsPerIP"`
+
+	// SignupIPWindow is the number of hours of MaxSignupsPerIP. Zero means the
+	// default (DefaultSignupIPWindow).
+	SignupIPWindow int `json:"signupIPWindow"`
+
+	// If EmailDomainAllowlist is not empty, new accounts require an email
+	// address of one of these domains (or of their subdomains). Email
+	// addresses of the domains in EmailDomainBlocklist are never accepted.
+	EmailDomainAllowlist []string `json:"emailDomainAllowlist"`
+	EmailDomainBlocklist []string `json:"emailDomainBlocklist"`
+
+	// note: ssCache.store() and ssCache.get() copy this struct with clone(). So
+	// clone() needs updating if pointer or slice fields are added to this
 	// struct.
 }
 
@@ -34,6 +78,132 @@ func (s *SiteSettings) Save(ctx context.Context, db *sql.DB) error {
 	return err
 }
 
+// HotnessParams are the parameters of the hotness function of posts. Zero
+// values mean the defaults. Changes apply to a post the next time its votes
+// change, and to all posts on the next run of the hotness background task.
+type HotnessParams struct {
+	// Interval is the number of seconds after which a post needs ten times as
+	// many votes to be as hot as a newer post. Defaults to 45000.
+	Interval int `json:"interval"`
+
+	// DownvoteWeight is how many upvotes a downvote cancels out. Defaults to
+	// zero: downvotes are ignored.
+	DownvoteWeight float64 `json:"downvoteWeight"`
+}
+
+// DefaultHotnessInterval is the default value of HotnessParams.Interval.
+const DefaultHotnessInterval = 45000
+
+// Override returns p with the non-zero fields of o taking the place of those
+// of p.
+func (p HotnessParams) Override(o HotnessParams) HotnessParams {
+	if o.Interval != 0 {
+		p.Interval = o.Interval
+	}
+	if o.DownvoteWeight != 0 {
+		p.DownvoteWeight = o.DownvoteWeight
+	}
+	return p
+}
+
+// Validate returns an error if any of the fields of p are out of range.
+func (p HotnessParams) Validate() error {
+	if p.Interval < 0 {
+		return errors.New("hotness interval cannot be negative")
+	}
+	if p.DownvoteWeight < 0 || p.DownvoteWeight > 10 {
+		return errors.New("hotness downvote weight must be between 0 and 10")
+	}
+	return nil
+}
+
+// DefaultEditGracePeriod is the default value of SiteSettings.EditGracePeriod.
+const DefaultEditGracePeriod = 180
+
+// EditGrace returns the edit grace period of s.
+func (s *SiteSettings) EditGrace() time.Duration {
+	switch {
+	case s.EditGracePeriod == 0:
+		return DefaultEditGracePeriod * time.Second
+	case s.EditGracePeriod < 0:
+		return 0
+	}
+	return time.Duration(s.EditGracePeriod) * time.Second
+}
+
+// DefaultDuplicateLinkWindow is the default value of
+// SiteSettings.DuplicateLinkWindow.
+const DefaultDuplicateLinkWindow = 24 * 30
+
+// DuplicateLinkPeriod returns the duplicate link window of s.
+func (s *SiteSettings) DuplicateLinkPeriod() time.Duration {
+	switch {
+	case s.DuplicateLinkWindow == 0:
+		return DefaultDuplicateLinkWindow * time.Hour
+	case s.DuplicateLinkWindow < 0:
+		return 0
+	}
+	return time.Duration(s.DuplicateLinkWindow) * time.Hour
+}
+
+// DefaultLinkPreviewTTL is the default value of SiteSettings.LinkPreviewTTL.
+const DefaultLinkPreviewTTL = 24
+
+// LinkPreviewDuration returns the link preview TTL of s.
+func (s *SiteSettings) LinkPreviewDuration() time.Duration {
+	switch {
+	case s.LinkPreviewTTL == 0:
+		return DefaultLinkPreviewTTL * time.Hour
+	case s.LinkPreviewTTL < 0:
+		return 0
+	}
+	return time.Duration(s.LinkPreviewTTL) * time.Hour
+}
+
+// DefaultSignupIPWindow is the default value of SiteSettings.SignupIPWindow.
+const DefaultSignupIPWindow = 24
+
+// SignupIPPeriod returns the signup IP window of s.
+func (s *SiteSettings) SignupIPPeriod() time.Duration {
+	if s.SignupIPWindow <= 0 {
+		return DefaultSignupIPWindow * time.Hour
+	}
+	return time.Duration(s.SignupIPWindow) * time.Hour
+}
+
+// EmailAllowed reports whether new accounts may be created with email, per
+// the email domain allowlist and blocklist of s. An empty email is allowed
+// only if there's no allowlist.
+func (s *SiteSettings) EmailAllowed(email string) bool {
+	_, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	domain = strings.TrimSuffix(domain, ".")
+	matches := func(list []string) bool {
+		for _, d := range list {
+			d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "@")
+			if d != "" && (domain == d || strings.HasSuffix(domain, "."+d)) {
+				return true
+			}
+		}
+		return false
+	}
+	if domain != "" && matches(s.EmailDomainBlocklist) {
+		return false
+	}
+	if len(s.EmailDomainAllowlist) > 0 {
+		return domain != "" && matches(s.EmailDomainAllowlist)
+	}
+	return true
+}
+
+// clone returns a copy of s that shares no memory with it.
+func (s *SiteSettings) clone() *SiteSettings {
+	cp := &SiteSettings{}
+	*cp = *s // shallow copy
+	cp.EmailDomainAllowlist = slices.Clone(s.EmailDomainAllowlist)
+	cp.EmailDomainBlocklist = slices.Clone(s.EmailDomainBlocklist)
+	return cp
+}
+
 type ssCache struct {
 	mu       sync.RWMutex
 	settings *SiteSettings
@@ -43,18 +213,14 @@ func (c *ssCache) get() *SiteSettings {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	if c.settings != nil {
-		cp := &SiteSettings{}
-		*cp = *c.settings // shallow copy
-		return cp
+		return c.settings.clone()
 	}
 	return nil
 }
 
 func (c *ssCache) store(s *SiteSettings) {
 	c.mu.Lock()
-	cp := &SiteSettings{}
-	*cp = *s // shallow copy
-	c.settings = cp
+	c.settings = s.clone()
 	c.mu.Unlock()
 }
 
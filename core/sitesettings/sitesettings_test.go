@@ -0,0 +1,28 @@
+package sitesettings
+
+import "testing"
+
+func TestEmailAllowed(t *testing.T) {
+	cases := []struct {
+		allow, block []string
+		email        string
+		want         bool
+	}{
+		{nil, nil, "", true},
+		{nil, nil, "a@example.com", true},
+		{nil, []string{"spam.test"}, "a@spam.test", false},
+		{nil, []string{"spam.test"}, "a@mail.SPAM.test", false},
+		{nil, []string{"spam.test"}, "a@notspam.test", true},
+		{[]string{"example.com"}, nil, "a@example.com", true},
+		{[]string{"example.com"}, nil, "a@uni.example.com", true},
+		{[]string{"example.com"}, nil, "a@example.org", false},
+		{[]string{"example.com"}, nil, "", false},
+		{[]string{"example.com"}, []string{"bad.example.com"}, "a@bad.example.com", false},
+	}
+	for _, c := range cases {
+		s := &SiteSettings{EmailDomainAllowlist: c.allow, EmailDomainBlocklist: c.block}
+		if got := s.EmailAllowed(c.email); got != c.want {
+			t.Errorf("EmailAllowed(%q) with allowlist %v and blocklist %v: got %v, want %v", c.email, c.allow, c.block, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxSuspensionReasonLength    = 1024  // in runes
+	maxSuspensionAdminNoteLength = 10000 // in runes
+)
+
+// UserSuspension is a site-wide ban of a user, either until an expiry time
+// or indefinitely. A user is banned (User.Banned) for as long as they have a
+// suspension that's not lifted.
+type UserSuspension struct {
+	ID     int    `json:"id"`
+	UserID uid.ID `json:"userId"`
+
+	// Reason is shown to the user when they try to log in. It may be empty.
+	Reason string `json:"reason"`
+
+	// AdminNote is for the admins only.
+	AdminNote msql.NullString `json:"adminNote"`
+
+	CreatedBy uid.ID        `json:"createdBy"`
+	CreatedAt time.Time     `json:"createdAt"`
+	ExpiresAt msql.NullTime `json:"expiresAt"` // If null, the suspension is indefinite.
+
+	// LiftedAt is set once the suspension expires or is lifted by an admin
+	// (LiftedBy, which is null if the suspension expired).
+	LiftedAt msql.NullTime `json:"liftedAt"`
+	LiftedBy uid.NullID    `json:"liftedBy"`
+}
+
+// expired reports whether the suspension is over at time t, though it may
+// not have been lifted yet.
+func (s *UserSuspension) expired(t time.Time) bool {
+	return s.ExpiresAt.Valid && !s.ExpiresAt.Time.After(t)
+}
+
+// loginError returns the error shown to the user of s when they try to log
+// in.
+func (s *UserSuspension) loginError() error {
+	var b strings.Builder
+	b.WriteString("Your account is suspended")
+	if s.ExpiresAt.Valid {
+		fmt.Fprintf(&b, " until %s", s.ExpiresAt.Time.UTC().Format("January 2, 2006 15:04 MST"))
+	}
+	b.WriteString(".")
+	if s.Reason != "" {
+		fmt.Fprintf(&b, " Reason: %s", s.Reason)
+	}
+	return httperr.NewForbidden("account_suspended", b.String())
+}
+
+func scanUserSuspensions(rows *sql.Rows) ([]*UserSuspension, error) {
+	defer rows.Close()
+
+	suspensions := []*UserSuspension{}
+	for rows.Next() {
+		s := &UserSuspension{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Reason, &s.AdminNote, &s.CreatedBy, &s.CreatedAt, &s.ExpiresAt, &s.LiftedAt, &s.LiftedBy); err != nil {
+			return nil, err
+		}
+		suspensions = append(suspensions, s)
+	}
+	return suspensions, rows.Err()
+}
+
+const selectUserSuspensionsQuery = "SELECT id, user_id, reason, admin_note, created_by, created_at, expires_at, lifted_at, lifted_by FROM user_suspensions "
+
+// GetActiveSuspension returns the suspension of user that's not lifted, if
+// any, or nil.
+func GetActiveSuspension(ctx context.Context, db *sql.DB, user uid.ID) (*UserSuspension, error) {
+	rows, err := db.QueryContext(ctx, selectUserSuspensionsQuery+"WHERE user_id = ? AND lifted_at IS NULL ORDER BY id DESC LIMIT 1", user)
+	if err != nil {
+		return nil, err
+	}
+	suspensions, err := scanUserSuspensions(rows)
+	if err != nil || len(suspensions) == 0 {
+		return nil, err
+	}
+	return suspensions[0], nil
+}
+
+// GetSuspensions returns the suspension history of u, the latest first.
+func (u *User) GetSuspensions(ctx context.Context, db *sql.DB) ([]*UserSuspension, error) {
+	rows, err := db.QueryContext(ctx, selectUserSuspensionsQuery+"WHERE user_id = ? ORDER BY id DESC", u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserSuspensions(rows)
+}
+
+// Suspend bans u from the site until expires (or indefinitely, if expires is
+// nil), replacing any suspension u already has. reason is shown to the user,
+// and note only to the admins. Like with Ban, make sure to log out all
+// sessions of u before calling this function.
+func (u *User) Suspend(ctx context.Context, db *sql.DB, admin uid.ID, reason, note string, expires *time.Time) (*UserSuspension, error) {
+	if u.Deleted {
+		return nil, ErrUserDeleted
+	}
+
+	now := time.Now()
+	s := &UserSuspension{
+		UserID:    u.ID,
+		Reason:    utils.TruncateUnicodeString(strings.TrimSpace(reason), maxSuspensionReasonLength),
+		CreatedBy: admin,
+		CreatedAt: now,
+	}
+	if note = strings.TrimSpace(note); note != "" {
+		s.AdminNote = msql.NewNullString(utils.TruncateUnicodeString(note, maxSuspensionAdminNoteLength))
+	}
+	if expires != nil {
+		if !expires.After(now) {
+			return nil, httperr.NewBadRequest("invalid_expires", "Suspension expiry must be in the future.")
+		}
+		s.ExpiresAt = msql.NewNullTime(*expires)
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := liftUserSuspensionsTx(ctx, tx, u.ID, uid.NullID{ID: admin, Valid: true}, now); err != nil {
+			return err
+		}
+		query, args := msql.BuildInsertQuery("user_suspensions", []msql.ColumnValue{
+			{Name: "user_id", Value: s.UserID},
+			{Name: "reason", Value: s.Reason},
+			{Name: "admin_note", Value: s.AdminNote},
+			{Name: "created_by", Value: s.CreatedBy},
+			{Name: "created_at", Value: s.CreatedAt},
+			{Name: "expires_at", Value: s.ExpiresAt},
+		})
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		s.ID = int(id)
+		_, err = tx.ExecContext(ctx, "UPDATE users SET banned_at = ? WHERE id = ?", now, u.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u.BannedAt = msql.NewNullTime(now)
+	u.Banned = true
+	return s, nil
+}
+
+// LiftSuspension unbans u, recording admin as the one who lifted the
+// suspension of u.
+func (u *User) LiftSuspension(ctx context.Context, db *sql.DB, admin uid.ID) error {
+	return u.unban(ctx, db, uid.NullID{ID: admin, Valid: true})
+}
+
+func (u *User) unban(ctx context.Context, db *sql.DB, admin uid.NullID) error {
+	if u.Deleted {
+		return ErrUserDeleted
+	}
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := liftUserSuspensionsTx(ctx, tx, u.ID, admin, time.Now()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE users SET banned_at = NULL WHERE id = ?", u.ID)
+		return err
+	})
+	if err == nil {
+		u.BannedAt = msql.NullTime{}
+		u.Banned = false
+	}
+	return err
+}
+
+// liftUserSuspensionsTx marks all the suspensions of user as lifted at t, by
+// admin.
+func liftUserSuspensionsTx(ctx context.Context, tx *sql.Tx, user uid.ID, admin uid.NullID, t time.Time) error {
+	_, err := tx.ExecContext(ctx, "UPDATE user_suspensions SET lifted_at = ?, lifted_by = ? WHERE user_id = ? AND lifted_at IS NULL", t, admin, user)
+	return err
+}
+
+// liftExpiredSuspension lifts the suspension with id, if it's not lifted
+// already, and unbans its user.
+func liftExpiredSuspension(ctx context.Context, db *sql.DB, id int, user uid.ID) error {
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE user_suspensions SET lifted_at = ? WHERE id = ? AND lifted_at IS NULL", time.Now(), id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET banned_at = NULL WHERE id = ?", user)
+		return err
+	})
+}
+
+// LiftExpiredSuspensions lifts all the expired suspensions, returning the
+// number of users unbanned.
+func LiftExpiredSuspensions(ctx context.Context, db *sql.DB) (int, error) {
+	rows, err := db.QueryContext(ctx, selectUserSuspensionsQuery+"WHERE lifted_at IS NULL AND expires_at <= ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	suspensions, err := scanUserSuspensions(rows)
+	if err != nil {
+		return 0, err
+	}
+	for i, s := range suspensions {
+		if err := liftExpiredSuspension(ctx, db, s.ID, s.UserID); err != nil {
+			return i, err
+		}
+	}
+	return len(suspensions), nil
+}
+
+// CheckSuspension returns an error, with the reason of the suspension, if u
+// is banned. If the suspension of u has expired, but was not yet lifted (see
+// LiftExpiredSuspensions), it's lifted.
+func (u *User) CheckSuspension(ctx context.Context, db *sql.DB) error {
+	if !u.Banned {
+		return nil
+	}
+	s, err := GetActiveSuspension(ctx, db, u.ID)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		// Banned with Ban, without a suspension.
+		return httperr.NewForbidden("account_suspended", "User account suspended.")
+	}
+	if !s.expired(time.Now()) {
+		return s.loginError()
+	}
+	if err := liftExpiredSuspension(ctx, db, s.ID, u.ID); err != nil {
+		return err
+	}
+	u.BannedAt = msql.NullTime{}
+	u.Banned = false
+	return nil
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+func TestUserSuspensionLoginError(t *testing.T) {
+	until := time.Date(2025, time.March, 4, 15, 30, 0, 0, time.UTC)
+	cases := []struct {
+		s    *UserSuspension
+		want string
+	}{
+		{&UserSuspension{}, "Your account is suspended."},
+		{&UserSuspension{Reason: "Spam."}, "Your account is suspended. Reason: Spam."},
+		{&UserSuspension{Reason: "Spam.", ExpiresAt: msql.NewNullTime(until)}, "Your account is suspended until March 4, 2025 15:30 UTC. Reason: Spam."},
+	}
+	for _, c := range cases {
+		err, ok := c.s.loginError().(*httperr.Error)
+		if !ok {
+			t.Fatalf("loginError returned a %T, want an *httperr.Error", err)
+		}
+		if err.Code != "account_suspended" || err.Message != c.want {
+			t.Errorf("got %s %q, want account_suspended %q", err.Code, err.Message, c.want)
+		}
+	}
+
+	s := &UserSuspension{ExpiresAt: msql.NewNullTime(until)}
+	if s.expired(until.Add(-time.Second)) || !s.expired(until) {
+		t.Error("suspension expired at the wrong time")
+	}
+	if (&UserSuspension{}).expired(until) {
+		t.Error("indefinite suspension expired")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/discuitnet/discuit/core/sitesettings"
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/images"
 	msql "github.com/discuitnet/discuit/internal/sql"
@@ -114,6 +115,8 @@ type User struct {
 	Badges           Badges          `json:"badges"`
 	NumPosts         int             `json:"noPosts"`
 	NumComments      int             `json:"noComments"`
+	NumFollowers     int             `json:"noFollowers"`
+	NumFollowing     int             `json:"noFollowing"`
 	LastSeen         time.Time       `json:"-"`             // accurate to within 5 minutes
 	LastSeenMonth    string          `json:"lastSeenMonth"` // of the form: November 2024
 	LastSeenIP       *string         `json:"-"`
@@ -125,7 +128,9 @@ type User struct {
 	// User preferences.
 	UpvoteNotificationsOff  bool     `json:"upvoteNotificationsOff"`
 	ReplyNotificationsOff   bool     `json:"replyNotificationsOff"`
+	FollowNotificationsOff  bool     `json:"followNotificationsOff"` // Notifications of posts by followed users.
 	HomeFeed                FeedType `json:"homeFeed"`
+	HomeMultiID             *int     `json:"homeMultiId"` // The multi of the home feed, if HomeFeed is FeedTypeMulti.
 	RememberFeedSort        bool     `json:"rememberFeedSort"`
 	EmbedsOff               bool     `json:"embedsOff"`
 	HideUserProfilePictures bool     `json:"hideUserProfilePictures"`
@@ -137,7 +142,12 @@ type User struct {
 	BannedAt msql.NullTime `json:"bannedAt"`
 	Banned   bool          `json:"isBanned"`
 
-	MutedByViewer bool `json:"-"`
+	// ShadowBannedAt is never sent to clients, so that a shadow-banned user
+	// can't tell. See ShadowBan.
+	ShadowBannedAt msql.NullTime `json:"-"`
+
+	MutedByViewer    bool `json:"-"`
+	FollowedByViewer bool `json:"isFollowed"`
 
 	NumNewNotifications int `json:"notificationsNewCount"`
 
@@ -232,6 +242,8 @@ func buildSelectUserQuery(where string) string {
 		"users.is_admin",
 		"users.no_posts",
 		"users.no_comments",
+		"users.no_followers",
+		"users.no_following",
 		"users.notifications_new_count",
 		"users.last_seen",
 		"users.last_seen_ip",
@@ -239,9 +251,12 @@ func buildSelectUserQuery(where string) string {
 		"users.created_ip",
 		"users.deleted_at",
 		"users.banned_at",
+		"users.shadow_banned_at",
 		"users.upvote_notifications_off",
 		"users.reply_notifications_off",
+		"users.follow_notifications_off",
 		"users.home_feed",
+		"users.home_multi_id",
 		"users.remember_feed_sort",
 		"users.embeds_off",
 		"users.hide_user_profile_pictures",
@@ -334,6 +349,8 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&u.Admin,
 			&u.NumPosts,
 			&u.NumComments,
+			&u.NumFollowers,
+			&u.NumFollowing,
 			&u.NumNewNotifications,
 			&u.LastSeen,
 			&u.LastSeenIP,
@@ -341,9 +358,12 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&u.CreatedIP,
 			&u.DeletedAt,
 			&u.BannedAt,
+			&u.ShadowBannedAt,
 			&u.UpvoteNotificationsOff,
 			&u.ReplyNotificationsOff,
+			&u.FollowNotificationsOff,
 			&u.HomeFeed,
+			&u.HomeMultiID,
 			&u.RememberFeedSort,
 			&u.EmbedsOff,
 			&u.HideUserProfilePictures,
@@ -397,6 +417,10 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 				}
 			}
 		}
+
+		if err := setFollowedByViewer(ctx, db, *viewer, users); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := fetchBadges(db, users...); err != nil {
@@ -447,6 +471,30 @@ func RegisterUser(ctx context.Context, db *sql.DB, username, email, password, ip
 		return nil, httperr.NewBadRequest("invalid-username", fmt.Sprintf("Username %v.", err))
 	}
 
+	settings, err := sitesettings.GetSiteSettings(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.EmailAllowed(email) {
+		if email == "" {
+			return nil, httperr.NewBadRequest("email-required", "An email address is required to sign up.")
+		}
+		return nil, httperr.NewForbidden("email-domain-not-allowed", "Signing up with an email address of this domain is not allowed.")
+	}
+	if settings.MaxSignupsPerIP > 0 && ip != "" {
+		var count int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE created_ip = ? AND created_at > ?", ip, time.Now().Add(-settings.SignupIPPeriod())).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count >= settings.MaxSignupsPerIP {
+			return nil, &httperr.Error{
+				HTTPStatus: http.StatusTooManyRequests,
+				Code:       "too_many_signups",
+				Message:    "Too many accounts were created from your IP address recently.",
+			}
+		}
+	}
+
 	hash, err := HashPassword([]byte(password))
 	if err != nil {
 		return nil, err
@@ -588,13 +636,30 @@ func (u *User) Update(ctx context.Context, db *sql.DB) error {
 	}
 
 	u.About.String = utils.TruncateUnicodeString(u.About.String, maxUserProfileAboutLength)
+	if u.HomeFeed == FeedTypeMulti {
+		if u.HomeMultiID == nil {
+			return httperr.NewBadRequest("no-home-multi", "No multi selected for the home feed.")
+		}
+		multi, err := GetMulti(ctx, db, *u.HomeMultiID)
+		if err != nil {
+			return err
+		}
+		if !multi.Viewable(&u.ID) {
+			return errMultiNotFound
+		}
+	} else {
+		u.HomeMultiID = nil
+	}
+
 	_, err := db.ExecContext(ctx, `
 	UPDATE users SET
 		email = ?, 
 		about_me = ?,
 		upvote_notifications_off = ?,
 		reply_notifications_off = ?,
+		follow_notifications_off = ?,
 		home_feed = ?,
+		home_multi_id = ?,
 		remember_feed_sort = ?,
 		embeds_off = ?,
 		hide_user_profile_pictures = ?
@@ -603,7 +668,9 @@ func (u *User) Update(ctx context.Context, db *sql.DB) error {
 		u.About,
 		u.UpvoteNotificationsOff,
 		u.ReplyNotificationsOff,
+		u.FollowNotificationsOff,
 		u.HomeFeed,
+		u.HomeMultiID,
 		u.RememberFeedSort,
 		u.EmbedsOff,
 		u.HideUserProfilePictures,
@@ -727,6 +794,31 @@ func (u *User) Delete(ctx context.Context, db *sql.DB) error {
 			return err
 		}
 
+		// Delete the user's flairs.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM community_user_flairs WHERE user_id = ?", u.ID); err != nil {
+			return err
+		}
+
+		// Delete the user's drafts.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM post_drafts WHERE user_id = ?", u.ID); err != nil {
+			return err
+		}
+
+		// Delete the user's content filters.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM content_filters WHERE user_id = ?", u.ID); err != nil {
+			return err
+		}
+
+		// Delete the user's multis.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM multis WHERE user_id = ?", u.ID); err != nil {
+			return err
+		}
+
+		// Remove the user's follows, both ways.
+		if err := deleteUserFollowsTx(ctx, tx, u.ID); err != nil {
+			return err
+		}
+
 		// Delete the user's profile picture
 		if err := u.DeleteProPicTx(ctx, db, tx); err != nil {
 			return err
@@ -834,7 +926,15 @@ func (u *User) Ban(ctx context.Context, db *sql.DB) error {
 	}
 
 	t := time.Now()
-	_, err := db.ExecContext(ctx, "UPDATE users SET banned_at = ? WHERE id = ?", t, u.ID)
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		// The ban replaces any temporary suspension, so that the user is not
+		// unbanned once it expires.
+		if err := liftUserSuspensionsTx(ctx, tx, u.ID, uid.NullID{}, t); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE users SET banned_at = ? WHERE id = ?", t, u.ID)
+		return err
+	})
 	if err == nil {
 		u.BannedAt = msql.NewNullTime(t)
 		u.Banned = true
@@ -842,13 +942,9 @@ func (u *User) Ban(ctx context.Context, db *sql.DB) error {
 	return err
 }
 
+// Unban unbans the user from site, lifting any suspension of the user.
 func (u *User) Unban(ctx context.Context, db *sql.DB) error {
-	if u.Deleted {
-		return ErrUserDeleted
-	}
-
-	_, err := db.ExecContext(ctx, "UPDATE users SET banned_at = NULL WHERE id = ?", u.ID)
-	return err
+	return u.unban(ctx, db, uid.NullID{})
 }
 
 // MakeAdmin makes the user an admin of the site. If isAdmin is false
@@ -943,9 +1039,18 @@ func (u *User) Saw(ctx context.Context, db *sql.DB, userIP string) error {
 }
 
 // UserSeen updates user's LastSeen to current time. It also updates the IP
-// address of the user.
+// address of the user, and records it in the IP history of the user (see
+// GetAltAccountsReport).
 func UserSeen(ctx context.Context, db *sql.DB, user uid.ID, userIP string) error {
-	_, err := db.ExecContext(ctx, "UPDATE users SET last_seen = ?, last_seen_ip = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), userIP, user)
+	now := time.Now()
+	res, err := db.ExecContext(ctx, "UPDATE users SET last_seen = ?, last_seen_ip = ? WHERE id = ? AND deleted_at IS NULL", now, userIP, user)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 || userIP == "" {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO user_ips (user_id, ip, first_seen, last_seen) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE last_seen = ?", user, userIP, now, now, now)
 	return err
 }
 
@@ -0,0 +1,485 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+// Vote manipulation detection: AnalyzeVotes looks for suspicious patterns in
+// the recent votes and flags the votes (in the vote_flags table) for the
+// admins to review. Flagged votes count as usual until an admin invalidates
+// them (see InvalidateVoteFlags).
+
+const (
+	// The votes of this long ago are analyzed on each run of AnalyzeVotes.
+	voteAnalysisWindow = time.Hour * 24
+
+	// A vote within fastVoteDelay of the creation of its post or comment is a
+	// fast vote. The votes of accounts with at least minFastVotes of them are
+	// flagged.
+	fastVoteDelay = time.Second * 10
+	minFastVotes  = 3
+
+	// The upvotes of an account on an author are flagged if there are at least
+	// minAuthorClusterVotes of them, and if they are at least
+	// authorClusterShare of all the upvotes of the account.
+	minAuthorClusterVotes = 5
+	authorClusterShare    = 0.8
+
+	// The votes on a post or comment, of the same direction, by at least
+	// minSharedIPVoters accounts created from the same IP address are flagged.
+	minSharedIPVoters = 2
+
+	maxVoteFlagDetailLength = 255
+)
+
+// VoteFlagReason is the pattern for which a vote was flagged.
+type VoteFlagReason int
+
+const (
+	// The voter votes within seconds of the creation of posts and comments.
+	VoteFlagReasonFastVote = VoteFlagReason(iota)
+
+	// The voter upvotes the same author almost exclusively.
+	VoteFlagReasonAuthorCluster
+
+	// The voter was created from the same IP address as other voters on the
+	// same post or comment.
+	VoteFlagReasonSharedIP
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (r VoteFlagReason) MarshalText() ([]byte, error) {
+	switch r {
+	case VoteFlagReasonFastVote:
+		return []byte("fast_vote"), nil
+	case VoteFlagReasonAuthorCluster:
+		return []byte("author_cluster"), nil
+	case VoteFlagReasonSharedIP:
+		return []byte("shared_ip"), nil
+	}
+	return nil, fmt.Errorf("unknown vote flag reason: %d", r)
+}
+
+// VoteFlagStatus is the state of the review of a flagged vote.
+type VoteFlagStatus int
+
+const (
+	VoteFlagStatusPending = VoteFlagStatus(iota)
+	VoteFlagStatusDismissed
+	VoteFlagStatusInvalidated // The vote was deleted.
+)
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s VoteFlagStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case VoteFlagStatusPending:
+		return []byte("pending"), nil
+	case VoteFlagStatusDismissed:
+		return []byte("dismissed"), nil
+	case VoteFlagStatusInvalidated:
+		return []byte("invalidated"), nil
+	}
+	return nil, fmt.Errorf("unknown vote flag status: %d", s)
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *VoteFlagStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "pending":
+		*s = VoteFlagStatusPending
+	case "dismissed":
+		*s = VoteFlagStatusDismissed
+	case "invalidated":
+		*s = VoteFlagStatusInvalidated
+	default:
+		return httperr.NewBadRequest("invalid-vote-flag-status", "Invalid vote flag status.")
+	}
+	return nil
+}
+
+// VoteFlag is a vote flagged as possible vote manipulation.
+type VoteFlag struct {
+	ID         int            `json:"id"`
+	Reason     VoteFlagReason `json:"reason"`
+	TargetType string         `json:"targetType"` // Either post or comment.
+	TargetID   uid.ID         `json:"targetId"`
+
+	// The public ID of the post of the vote (or of the post of the comment of
+	// the vote). Null if the post was deleted since.
+	PostPublicID msql.NullString `json:"postPublicId"`
+
+	VoterID    uid.ID         `json:"voterId"`
+	Voter      string         `json:"voter"` // Username.
+	AuthorID   uid.ID         `json:"authorId"`
+	Author     string         `json:"author"` // Username.
+	Up         bool           `json:"up"`
+	VotedAt    time.Time      `json:"votedAt"`
+	Detail     string         `json:"detail"`
+	Status     VoteFlagStatus `json:"status"`
+	ReviewedBy uid.NullID     `json:"reviewedBy"`
+	ReviewedAt msql.NullTime  `json:"reviewedAt"`
+	CreatedAt  time.Time      `json:"createdAt"`
+
+	targetType int // One of voteTargetPost and voteTargetComment.
+}
+
+// recentVote is a vote in the window of AnalyzeVotes.
+type recentVote struct {
+	targetType      int
+	target          uid.ID
+	targetCreatedAt time.Time
+	voter, author   uid.ID
+	up              bool
+	votedAt         time.Time
+	voterIP         string // The IP address the voter was created from.
+}
+
+func (v *recentVote) flag(reason VoteFlagReason, detail string) *VoteFlag {
+	return &VoteFlag{
+		Reason:     reason,
+		targetType: v.targetType,
+		TargetID:   v.target,
+		VoterID:    v.voter,
+		AuthorID:   v.author,
+		Up:         v.up,
+		VotedAt:    v.votedAt,
+		Detail:     detail,
+	}
+}
+
+// detectFastVotes flags the fast votes of the voters with many of them.
+func detectFastVotes(votes []*recentVote) []*VoteFlag {
+	fast := make(map[uid.ID][]*recentVote)
+	for _, v := range votes {
+		if v.votedAt.Sub(v.targetCreatedAt) < fastVoteDelay {
+			fast[v.voter] = append(fast[v.voter], v)
+		}
+	}
+	var flags []*VoteFlag
+	for _, vs := range fast {
+		if len(vs) < minFastVotes {
+			continue
+		}
+		for _, v := range vs {
+			detail := fmt.Sprintf("Voted %v after creation; %d such votes in %v.", v.votedAt.Sub(v.targetCreatedAt).Round(time.Second), len(vs), voteAnalysisWindow)
+			flags = append(flags, v.flag(VoteFlagReasonFastVote, detail))
+		}
+	}
+	return flags
+}
+
+// detectAuthorClusters flags the upvotes of the voters who upvote one author
+// almost exclusively.
+func detectAuthorClusters(votes []*recentVote) []*VoteFlag {
+	type voterAuthor struct{ voter, author uid.ID }
+	var (
+		totals   = make(map[uid.ID]int)
+		byAuthor = make(map[voterAuthor][]*recentVote)
+	)
+	for _, v := range votes {
+		if !v.up {
+			continue
+		}
+		totals[v.voter]++
+		k := voterAuthor{v.voter, v.author}
+		byAuthor[k] = append(byAuthor[k], v)
+	}
+
+	clustered := make(map[voterAuthor]bool)
+	clusterSizes := make(map[uid.ID]int) // By author.
+	for k, vs := range byAuthor {
+		if len(vs) >= minAuthorClusterVotes && float64(len(vs)) >= authorClusterShare*float64(totals[k.voter]) {
+			clustered[k] = true
+			clusterSizes[k.author]++
+		}
+	}
+
+	var flags []*VoteFlag
+	for k := range clustered {
+		vs := byAuthor[k]
+		detail := fmt.Sprintf("%d of %d upvotes on the author; %d accounts upvote the author so.", len(vs), totals[k.voter], clusterSizes[k.author])
+		for _, v := range vs {
+			flags = append(flags, v.flag(VoteFlagReasonAuthorCluster, detail))
+		}
+	}
+	return flags
+}
+
+// detectSharedIPVotes flags the votes, in the same direction on the same post
+// or comment, of voters created from the same IP address.
+func detectSharedIPVotes(votes []*recentVote) []*VoteFlag {
+	type group struct {
+		targetType int
+		target     uid.ID
+		ip         string
+		up         bool
+	}
+	groups := make(map[group][]*recentVote)
+	for _, v := range votes {
+		if v.voterIP == "" {
+			continue
+		}
+		k := group{v.targetType, v.target, v.voterIP, v.up}
+		groups[k] = append(groups[k], v)
+	}
+	var flags []*VoteFlag
+	for k, vs := range groups {
+		if len(vs) < minSharedIPVoters {
+			continue
+		}
+		for _, v := range vs {
+			detail := fmt.Sprintf("One of %d voters created from %s.", len(vs), k.ip)
+			flags = append(flags, v.flag(VoteFlagReasonSharedIP, detail))
+		}
+	}
+	return flags
+}
+
+// getRecentVotes returns the votes, other than those of authors on their own
+// posts and comments, cast since t.
+func getRecentVotes(ctx context.Context, db *sql.DB, t time.Time) ([]*recentVote, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT ?, post_votes.post_id, posts.created_at, post_votes.user_id, posts.user_id, post_votes.up, post_votes.created_at, COALESCE(users.created_ip, '')
+		FROM post_votes
+		INNER JOIN posts ON posts.id = post_votes.post_id
+		INNER JOIN users ON users.id = post_votes.user_id
+		WHERE post_votes.created_at > ? AND post_votes.user_id <> posts.user_id
+		UNION ALL
+		SELECT ?, comment_votes.comment_id, comments.created_at, comment_votes.user_id, comments.user_id, comment_votes.up, comment_votes.created_at, COALESCE(users.created_ip, '')
+		FROM comment_votes
+		INNER JOIN comments ON comments.id = comment_votes.comment_id
+		INNER JOIN users ON users.id = comment_votes.user_id
+		WHERE comment_votes.created_at > ? AND comment_votes.user_id <> comments.user_id`,
+		voteTargetPost, t, voteTargetComment, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []*recentVote
+	for rows.Next() {
+		v := &recentVote{}
+		if err := rows.Scan(&v.targetType, &v.target, &v.targetCreatedAt, &v.voter, &v.author, &v.up, &v.votedAt, &v.voterIP); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+// AnalyzeVotes flags the recent votes that match a pattern of vote
+// manipulation. It returns the number of new flags.
+func AnalyzeVotes(ctx context.Context, db *sql.DB) (int, error) {
+	votes, err := getRecentVotes(ctx, db, time.Now().Add(-voteAnalysisWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	var flags []*VoteFlag
+	flags = append(flags, detectFastVotes(votes)...)
+	flags = append(flags, detectAuthorClusters(votes)...)
+	flags = append(flags, detectSharedIPVotes(votes)...)
+
+	n := 0
+	for _, f := range flags {
+		// Votes already flagged for the same reason (in an earlier run) are
+		// skipped, as are the votes of reviewed flags.
+		res, err := db.ExecContext(ctx, `
+			INSERT IGNORE INTO vote_flags (reason, target_type, target_id, voter_id, author_id, up, voted_at, detail)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.Reason, f.targetType, f.TargetID, f.VoterID, f.AuthorID, f.Up, f.VotedAt, utils.TruncateUnicodeString(f.Detail, maxVoteFlagDetailLength))
+		if err != nil {
+			return n, err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += int(rows)
+	}
+	return n, nil
+}
+
+// GetVoteFlags returns the vote flags with status, the latest first. The next
+// returned is for fetching the next page of flags.
+func GetVoteFlags(ctx context.Context, db *sql.DB, status VoteFlagStatus, limit int, next *string) ([]*VoteFlag, *string, error) {
+	where, args := "WHERE vote_flags.status = ? ", []any{status}
+	if next != nil {
+		nextID, err := strconv.Atoi(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-next", "Invalid next.")
+		}
+		where += "AND vote_flags.id <= ? "
+		args = append(args, nextID)
+	}
+	args = append(args, limit+1)
+
+	flags, err := selectVoteFlags(ctx, db, where+"ORDER BY vote_flags.id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(flags) > limit {
+		nextNext = new(string)
+		*nextNext = strconv.Itoa(flags[limit].ID)
+		flags = flags[:limit]
+	}
+	return flags, nextNext, nil
+}
+
+func selectVoteFlags(ctx context.Context, db *sql.DB, where string, args ...any) ([]*VoteFlag, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			vote_flags.id,
+			vote_flags.reason,
+			vote_flags.target_type,
+			vote_flags.target_id,
+			COALESCE(posts.public_id, comments.post_public_id),
+			vote_flags.voter_id,
+			voters.username,
+			vote_flags.author_id,
+			authors.username,
+			vote_flags.up,
+			vote_flags.voted_at,
+			vote_flags.detail,
+			vote_flags.status,
+			vote_flags.reviewed_by,
+			vote_flags.reviewed_at,
+			vote_flags.created_at
+		FROM vote_flags
+		INNER JOIN users AS voters ON voters.id = vote_flags.voter_id
+		INNER JOIN users AS authors ON authors.id = vote_flags.author_id
+		LEFT JOIN posts ON vote_flags.target_type = `+strconv.Itoa(voteTargetPost)+` AND posts.id = vote_flags.target_id
+		LEFT JOIN comments ON vote_flags.target_type = `+strconv.Itoa(voteTargetComment)+` AND comments.id = vote_flags.target_id
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []*VoteFlag{}
+	for rows.Next() {
+		f := &VoteFlag{}
+		err := rows.Scan(
+			&f.ID,
+			&f.Reason,
+			&f.targetType,
+			&f.TargetID,
+			&f.PostPublicID,
+			&f.VoterID,
+			&f.Voter,
+			&f.AuthorID,
+			&f.Author,
+			&f.Up,
+			&f.VotedAt,
+			&f.Detail,
+			&f.Status,
+			&f.ReviewedBy,
+			&f.ReviewedAt,
+			&f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		f.TargetType = "post"
+		if f.targetType == voteTargetComment {
+			f.TargetType = "comment"
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// DismissVoteFlags marks the pending vote flags with ids as reviewed, by
+// admin, and found to be fine.
+func DismissVoteFlags(ctx context.Context, db *sql.DB, admin uid.ID, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{VoteFlagStatusDismissed, admin, time.Now()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, VoteFlagStatusPending)
+	_, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE vote_flags SET status = ?, reviewed_by = ?, reviewed_at = ? WHERE id IN %s AND status = ?", msql.InClauseQuestionMarks(len(ids))), args...)
+	return err
+}
+
+// InvalidateVoteFlags deletes the votes of the pending vote flags with ids,
+// and marks all the pending flags of those votes as reviewed by admin. The
+// points and the ranking scores of the posts and comments, and the points of
+// their authors, are recomputed. It returns the number of votes deleted.
+func InvalidateVoteFlags(ctx context.Context, db *sql.DB, admin uid.ID, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []any{VoteFlagStatusPending}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	flags, err := selectVoteFlags(ctx, db, fmt.Sprintf("WHERE vote_flags.status = ? AND vote_flags.id IN %s", msql.InClauseQuestionMarks(len(ids))), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, f := range flags {
+		deleted := false
+		err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+			table, column := "post_votes", "post_id"
+			if f.targetType == voteTargetComment {
+				table, column = "comment_votes", "comment_id"
+			}
+			var up bool
+			err := tx.QueryRowContext(ctx, "SELECT up FROM "+table+" WHERE "+column+" = ? AND user_id = ? FOR UPDATE", f.TargetID, f.VoterID).Scan(&up)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err == nil { // Otherwise the vote was undone (or invalidated) already.
+				if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE "+column+" = ? AND user_id = ?", f.TargetID, f.VoterID); err != nil {
+					return err
+				}
+				authorPoints := 0
+				if up && !f.VoterID.EqualsTo(f.AuthorID) {
+					authorPoints = -1
+				}
+				// The votes of shadow-banned users never gave the author a point.
+				if authorPoints, err = voterAuthorPoints(ctx, db, f.VoterID, authorPoints); err != nil {
+					return err
+				}
+				if err := enqueueVote(ctx, tx, f.targetType, f.TargetID, f.AuthorID, authorPoints); err != nil {
+					return err
+				}
+				deleted = true
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE vote_flags SET status = ?, reviewed_by = ?, reviewed_at = ?
+				WHERE target_type = ? AND target_id = ? AND voter_id = ? AND status = ?`,
+				VoteFlagStatusInvalidated, admin, time.Now(), f.targetType, f.TargetID, f.VoterID, VoteFlagStatusPending)
+			return err
+		})
+		if err != nil {
+			return n, err
+		}
+		if deleted { // Counted only once committed.
+			n++
+		}
+	}
+
+	if n > 0 {
+		// Apply the changes now rather than on the next flush.
+		if _, _, err := FlushVoteQueue(ctx, db); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
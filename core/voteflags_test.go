@@ -0,0 +1,65 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestVoteManipulationDetectors(t *testing.T) {
+	var (
+		now                       = time.Now()
+		alice, bob, carol, author = uid.New(), uid.New(), uid.New(), uid.New()
+		votes                     []*recentVote
+	)
+	vote := func(voter, author uid.ID, delay time.Duration, ip string) *recentVote {
+		v := &recentVote{
+			target:          uid.New(),
+			targetCreatedAt: now,
+			voter:           voter,
+			author:          author,
+			up:              true,
+			votedAt:         now.Add(delay),
+			voterIP:         ip,
+		}
+		votes = append(votes, v)
+		return v
+	}
+
+	// Alice upvotes author alone, within seconds, five times.
+	for i := 0; i < 5; i++ {
+		vote(alice, author, time.Second*2, "192.0.2.1")
+	}
+	// Bob votes fast only twice, on many authors.
+	vote(bob, uid.New(), time.Second, "198.51.100.1")
+	vote(bob, uid.New(), time.Second, "198.51.100.1")
+	vote(bob, uid.New(), time.Hour, "198.51.100.1")
+	// Carol, created from the same IP as Alice, votes with Alice once.
+	shared := vote(carol, author, time.Hour, "192.0.2.1")
+	shared.target = votes[0].target
+
+	count := func(flags []*VoteFlag) map[uid.ID]int {
+		m := make(map[uid.ID]int)
+		for _, f := range flags {
+			m[f.VoterID]++
+		}
+		return m
+	}
+
+	if got := count(detectFastVotes(votes)); got[alice] != 5 || got[bob] != 0 || got[carol] != 0 {
+		t.Errorf("fast votes: got %v flags of alice, %v of bob, %v of carol; want 5, 0, 0", got[alice], got[bob], got[carol])
+	}
+	if got := count(detectAuthorClusters(votes)); got[alice] != 5 || got[bob] != 0 || got[carol] != 0 {
+		t.Errorf("author clusters: got %v flags of alice, %v of bob, %v of carol; want 5, 0, 0", got[alice], got[bob], got[carol])
+	}
+	flags := detectSharedIPVotes(votes)
+	if got := count(flags); got[alice] != 1 || got[bob] != 0 || got[carol] != 1 {
+		t.Errorf("shared IP votes: got %v flags of alice, %v of bob, %v of carol; want 1, 0, 1", got[alice], got[bob], got[carol])
+	}
+	for _, f := range flags {
+		if f.TargetID != votes[0].target {
+			t.Errorf("shared IP vote flagged on the wrong target")
+		}
+	}
+}
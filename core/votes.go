@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// Votes are recorded right away in the post_votes and comment_votes tables,
+// but the counters derived from them (upvotes, downvotes, points and ranking
+// scores of posts and comments, and the points of their authors) are updated in
+// batches, by FlushVoteQueue. Every vote adds a row to the vote_queue table in
+// the same transaction as the vote itself, so no vote is left unaccounted for.
+
+// Types of targets in the vote_queue table.
+const (
+	voteTargetPost    = 0
+	voteTargetComment = 1
+)
+
+// enqueueVote adds an entry to the vote queue for a changed vote on target. The
+// points of the target's author are to be incremented by authorPoints.
+func enqueueVote(ctx context.Context, tx *sql.Tx, targetType int, target, author uid.ID, authorPoints int) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO vote_queue (target_type, target_id, author_id, author_points) VALUES (?, ?, ?, ?)", targetType, target, author, authorPoints)
+	return err
+}
+
+// voterAuthorPoints returns authorPoints, the change to the points of an
+// author from a vote by voter, or 0 if voter is shadow-banned.
+func voterAuthorPoints(ctx context.Context, db *sql.DB, voter uid.ID, authorPoints int) (int, error) {
+	if authorPoints == 0 {
+		return 0, nil
+	}
+	if shadowBanned, err := userShadowBanned(ctx, db, voter); err != nil || shadowBanned {
+		return 0, err
+	}
+	return authorPoints, nil
+}
+
+// FlushVoteQueue applies all the queued votes, returning the number of queue
+// entries processed and the posts whose vote counts were updated.
+//
+// The vote counts of each affected post and comment are recounted from the
+// votes tables, rather than incremented, so they end up matching the votes
+// tables even if they had drifted.
+func FlushVoteQueue(ctx context.Context, db *sql.DB) (int, []uid.ID, error) {
+	var (
+		total int
+		posts []uid.ID
+	)
+	for {
+		n, batchPosts, err := flushVoteQueueBatch(ctx, db, 5000)
+		total += n
+		posts = append(posts, batchPosts...)
+		if err != nil || n == 0 {
+			return total, posts, err
+		}
+	}
+}
+
+// voteQueueEntry is a row of the vote_queue table.
+type voteQueueEntry struct {
+	id           uint64
+	targetType   int
+	target       uid.ID
+	author       uid.ID
+	authorPoints int
+}
+
+// voteQueueBatch is the aggregate of a batch of vote queue entries.
+type voteQueueBatch struct {
+	ids          []uint64       // Of the entries, in order.
+	posts        []uid.ID       // To recount the votes of.
+	comments     []uid.ID       // To recount the votes of.
+	authorPoints map[uid.ID]int // The changes to the points of authors, excluding zeros.
+}
+
+// aggregateVoteQueue returns the aggregate of entries.
+func aggregateVoteQueue(entries []voteQueueEntry) *voteQueueBatch {
+	b := &voteQueueBatch{authorPoints: make(map[uid.ID]int)}
+	seenPosts, seenComments := make(map[uid.ID]bool), make(map[uid.ID]bool)
+	for _, e := range entries {
+		b.ids = append(b.ids, e.id)
+		switch e.targetType {
+		case voteTargetPost:
+			if !seenPosts[e.target] {
+				seenPosts[e.target] = true
+				b.posts = append(b.posts, e.target)
+			}
+		case voteTargetComment:
+			if !seenComments[e.target] {
+				seenComments[e.target] = true
+				b.comments = append(b.comments, e.target)
+			}
+		}
+		b.authorPoints[e.author] += e.authorPoints
+	}
+	for author, points := range b.authorPoints {
+		if points == 0 {
+			delete(b.authorPoints, author)
+		}
+	}
+	return b
+}
+
+// deleteQuery returns the query, and its arguments, that deletes exactly the
+// entries of the batch from the queue. (Entries with lower ids may be committed
+// after the batch was selected, so a range of ids won't do.)
+func (b *voteQueueBatch) deleteQuery() (string, []any) {
+	args := make([]any, len(b.ids))
+	for i, id := range b.ids {
+		args[i] = id
+	}
+	return "DELETE FROM vote_queue WHERE id IN " + msql.InClauseQuestionMarks(len(b.ids)), args
+}
+
+func flushVoteQueueBatch(ctx context.Context, db *sql.DB, limit int) (int, []uid.ID, error) {
+	var batch *voteQueueBatch
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		// Locking the rows keeps concurrent flushes (of other processes) from
+		// applying the same entries twice.
+		rows, err := tx.QueryContext(ctx, "SELECT id, target_type, target_id, author_id, author_points FROM vote_queue ORDER BY id LIMIT ? FOR UPDATE", limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var entries []voteQueueEntry
+		for rows.Next() {
+			var e voteQueueEntry
+			if err := rows.Scan(&e.id, &e.targetType, &e.target, &e.author, &e.authorPoints); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if len(entries) == 0 {
+			return nil
+		}
+
+		b := aggregateVoteQueue(entries)
+		for _, post := range b.posts {
+			if err := recountPostVotes(ctx, db, tx, post); err != nil {
+				return err
+			}
+		}
+		for _, comment := range b.comments {
+			if err := recountCommentVotes(ctx, tx, comment); err != nil {
+				return err
+			}
+		}
+		for user, points := range b.authorPoints {
+			if _, err := tx.ExecContext(ctx, "UPDATE users SET points = points + ? WHERE id = ?", points, user); err != nil {
+				return err
+			}
+		}
+
+		query, args := b.deleteQuery()
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		batch = b
+		return nil
+	})
+	if err != nil || batch == nil {
+		return 0, nil, err
+	}
+	return len(batch.ids), batch.posts, nil
+}
+
+// recountPostVotes sets the vote counts and the points of post from the
+// post_votes table, and recalculates its ranking scores. The votes of
+// shadow-banned users are not counted.
+func recountPostVotes(ctx context.Context, db *sql.DB, tx *sql.Tx, post uid.ID) error {
+	var (
+		upvotes, downvotes int
+		createdAt          time.Time
+		communityParams    []byte
+	)
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			posts.created_at,
+			communities.hotness_params,
+			(SELECT COUNT(*) FROM post_votes WHERE post_id = posts.id AND up = TRUE AND user_id NOT IN (`+shadowBannedUsersQuery+`)),
+			(SELECT COUNT(*) FROM post_votes WHERE post_id = posts.id AND up = FALSE AND user_id NOT IN (`+shadowBannedUsersQuery+`))
+		FROM posts
+		INNER JOIN communities ON communities.id = posts.community_id
+		WHERE posts.id = ?`, post)
+	if err := row.Scan(&createdAt, &communityParams, &upvotes, &downvotes); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	params, err := hotnessParams(ctx, db, communityParams)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	risingVotes, err := postRisingVotes(ctx, tx, post, now)
+	if err != nil {
+		return err
+	}
+
+	points := upvotes - downvotes
+	if _, err := tx.ExecContext(ctx, "UPDATE posts SET upvotes = ?, downvotes = ?, points = ?, hotness = ?, rising = ?, controversy = ?, best = ? WHERE id = ?",
+		upvotes, downvotes, points,
+		postHotness(params, upvotes, downvotes, createdAt),
+		postRising(risingVotes, createdAt, now),
+		controversyScore(upvotes, downvotes),
+		bestScore(upvotes, downvotes),
+		post); err != nil {
+		return err
+	}
+	for _, table := range postsTables {
+		if _, err := tx.ExecContext(ctx, "UPDATE "+table+" SET points = ? WHERE post_id = ?", points, post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recountCommentVotes sets the vote counts and the points of comment from the
+// comment_votes table, and recalculates its ranking scores. The votes of
+// shadow-banned users are not counted.
+func recountCommentVotes(ctx context.Context, tx *sql.Tx, comment uid.ID) error {
+	var upvotes, downvotes int
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM comment_votes WHERE comment_id = ? AND up = TRUE AND user_id NOT IN (`+shadowBannedUsersQuery+`)),
+			(SELECT COUNT(*) FROM comment_votes WHERE comment_id = ? AND up = FALSE AND user_id NOT IN (`+shadowBannedUsersQuery+`))`, comment, comment)
+	if err := row.Scan(&upvotes, &downvotes); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE comments SET upvotes = ?, downvotes = ?, points = ?, controversy = ?, best = ? WHERE id = ?",
+		upvotes, downvotes, upvotes-downvotes, controversyScore(upvotes, downvotes), bestScore(upvotes, downvotes), comment)
+	return err
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestAggregateVoteQueue(t *testing.T) {
+	var (
+		post1, post2 = uid.New(), uid.New()
+		comment      = uid.New()
+		alice, bob   = uid.New(), uid.New()
+	)
+	entries := []voteQueueEntry{
+		{id: 3, targetType: voteTargetPost, target: post1, author: alice, authorPoints: 1},
+		{id: 4, targetType: voteTargetPost, target: post1, author: alice, authorPoints: 1},
+		{id: 7, targetType: voteTargetComment, target: comment, author: bob, authorPoints: 1},
+		{id: 9, targetType: voteTargetPost, target: post2, author: bob, authorPoints: -1},
+		{id: 12, targetType: voteTargetPost, target: post1, author: alice, authorPoints: 0},
+	}
+	b := aggregateVoteQueue(entries)
+
+	if want := []uint64{3, 4, 7, 9, 12}; !reflect.DeepEqual(b.ids, want) {
+		t.Errorf("ids = %v, want %v", b.ids, want)
+	}
+	if want := []uid.ID{post1, post2}; !reflect.DeepEqual(b.posts, want) {
+		t.Errorf("posts = %v, want %v", b.posts, want)
+	}
+	if want := []uid.ID{comment}; !reflect.DeepEqual(b.comments, want) {
+		t.Errorf("comments = %v, want %v", b.comments, want)
+	}
+	// Bob's points cancel out.
+	if want := map[uid.ID]int{alice: 2}; !reflect.DeepEqual(b.authorPoints, want) {
+		t.Errorf("authorPoints = %v, want %v", b.authorPoints, want)
+	}
+
+	// Only the entries of the batch are deleted, even if there are gaps in
+	// their ids that might be filled by entries committed later.
+	query, args := b.deleteQuery()
+	if want := "DELETE FROM vote_queue WHERE id IN (?, ?, ?, ?, ?)"; query != want {
+		t.Errorf("delete query = %q, want %q", query, want)
+	}
+	if want := []any{uint64(3), uint64(4), uint64(7), uint64(9), uint64(12)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("delete args = %v, want %v", args, want)
+	}
+}
@@ -0,0 +1,91 @@
+// Package cache implements a Redis backed cache of byte values.
+package cache
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Cache stores values under keys grouped into namespaces. A namespace can be
+// invalidated as a whole, in constant time, with Invalidate: every namespace
+// has a generation number that is part of the Redis key of each of its values,
+// and invalidating it increments the generation. Stale values are left to
+// expire on their own.
+type Cache struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// New returns a Cache. All Redis keys used by the cache begin with prefix.
+func New(pool *redis.Pool, prefix string) *Cache {
+	return &Cache{pool: pool, prefix: prefix}
+}
+
+func (c *Cache) generationKey(ns string) string {
+	return c.prefix + "gen:" + ns
+}
+
+func (c *Cache) valueKey(conn redis.Conn, ns, key string) (string, error) {
+	gen, err := redis.Int64(conn.Do("GET", c.generationKey(ns)))
+	if err != nil && err != redis.ErrNil {
+		return "", err
+	}
+	return c.prefix + ns + ":" + strconv.FormatInt(gen, 10) + ":" + key, nil
+}
+
+// Get returns the value stored under key in namespace ns. If there's no such
+// value, or if it's expired or invalidated, the returned bool is false.
+func (c *Cache) Get(ns, key string) ([]byte, bool, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	k, err := c.valueKey(conn, ns, key)
+	if err != nil {
+		return nil, false, err
+	}
+	val, err := redis.Bytes(conn.Do("GET", k))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+// Set stores val under key in namespace ns for ttl.
+func (c *Cache) Set(ns, key string, val []byte, ttl time.Duration) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	k, err := c.valueKey(conn, ns, key)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("SET", k, val, "PX", ttl.Milliseconds())
+	return err
+}
+
+// Delete removes the value stored under key in namespace ns, if any.
+func (c *Cache) Delete(ns, key string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	k, err := c.valueKey(conn, ns, key)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("DEL", k)
+	return err
+}
+
+// Invalidate invalidates all the values in namespace ns.
+func (c *Cache) Invalidate(ns string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("INCR", c.generationKey(ns))
+	return err
+}
@@ -0,0 +1,362 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Errors returned by Fetcher.Get (wrapped).
+var (
+	ErrUnsupportedScheme = errors.New("httputil: unsupported URL scheme")
+	ErrBlockedHost       = errors.New("httputil: host is not allowed")
+	ErrBlockedAddress    = errors.New("httputil: address is not allowed")
+	ErrTooManyRedirects  = errors.New("httputil: too many redirects")
+	ErrBodyTooLarge      = errors.New("httputil: response body too large")
+	ErrContentType       = errors.New("httputil: unexpected content type")
+)
+
+// IsFetchError reports whether err is one of the errors returned by
+// Fetcher.Get on account of its restrictions (as opposed to, say, a network
+// error).
+func IsFetchError(err error) bool {
+	for _, target := range []error{ErrUnsupportedScheme, ErrBlockedHost, ErrBlockedAddress, ErrTooManyRedirects, ErrBodyTooLarge, ErrContentType} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedPrefixes are the address ranges, in addition to the private,
+// loopback, link-local, multicast, and unspecified addresses, that are never
+// fetched (unless they are allowlisted).
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT (and some cloud metadata services)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved (and broadcast)
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// isPublicAddr reports whether addr is a publicly routable address.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostList is a list of hostnames and address ranges.
+type hostList struct {
+	hosts    []string // lower-cased, without a trailing dot
+	prefixes []netip.Prefix
+}
+
+func parseHostList(entries []string) (*hostList, error) {
+	l := &hostList{}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(entry), "."))
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			l.prefixes = append(l.prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			l.prefixes = append(l.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if strings.ContainsAny(entry, "/: ") {
+			return nil, fmt.Errorf("invalid host list entry %q", entry)
+		} else {
+			l.hosts = append(l.hosts, strings.TrimPrefix(entry, "*."))
+		}
+	}
+	return l, nil
+}
+
+func (l *hostList) empty() bool {
+	return len(l.hosts) == 0 && len(l.prefixes) == 0
+}
+
+// matchHost reports whether host, or a domain that it's a subdomain of, is in
+// l. host may also be an IP address.
+func (l *hostList) matchHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return l.matchAddr(addr)
+	}
+	for _, h := range l.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *hostList) matchAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetcherOptions are the options of a Fetcher. Zero values mean the defaults.
+type FetcherOptions struct {
+	// Allowlist and Denylist entries are hostnames (which match their
+	// subdomains as well), IP addresses, or CIDR ranges. If Allowlist is not
+	// empty, only the URLs whose host is in it are fetched. Addresses that
+	// aren't publicly routable are fetched only if they're allowlisted. The
+	// hosts in the Denylist, and the URLs that resolve to an address in it,
+	// are never fetched.
+	Allowlist []string
+	Denylist  []string
+
+	MaxRedirects int           // Defaults to 5. Negative means no redirects are followed.
+	MaxBodySize  int64         // In bytes. Defaults to 10 MiB.
+	Timeout      time.Duration // Of the whole request. Defaults to 6 seconds.
+}
+
+// Fetcher fetches user-supplied URLs, for which it's unsafe to make requests
+// that may reach the internal network (as in a server-side request forgery).
+// The addresses are checked at dial time (after DNS resolution) so a host
+// cannot be made to resolve to another address later on.
+type Fetcher struct {
+	client       *http.Client
+	allow, deny  *hostList
+	maxRedirects int
+	maxBodySize  int64
+}
+
+// NewFetcher returns a Fetcher. opts may be nil.
+func NewFetcher(opts *FetcherOptions) (*Fetcher, error) {
+	if opts == nil {
+		opts = &FetcherOptions{}
+	}
+	allow, err := parseHostList(opts.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseHostList(opts.Denylist)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fetcher{
+		allow:        allow,
+		deny:         deny,
+		maxRedirects: opts.MaxRedirects,
+		maxBodySize:  opts.MaxBodySize,
+	}
+	if f.maxRedirects == 0 {
+		f.maxRedirects = 5
+	}
+	if f.maxBodySize == 0 {
+		f.maxBodySize = 10 << 20
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = time.Second * 6
+	}
+
+	dialer := &net.Dialer{
+		Timeout:        time.Second * 5,
+		ControlContext: f.checkDial,
+	}
+	f.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // A proxy would do the dialing instead.
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       time.Second * 90,
+			TLSHandshakeTimeout:   time.Second * 5,
+			ResponseHeaderTimeout: time.Second * 5,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return f.checkURL(req.Context(), req.URL)
+		},
+	}
+	return f, nil
+}
+
+// fetchState is the state of a request of a Fetcher (and of the requests of
+// its redirects), kept in the request context.
+type fetchState struct {
+	// Whether the host of the URL that's being fetched is allowlisted by
+	// name. If not, and if there's an allowlist, the address that the host
+	// resolves to must be allowlisted.
+	hostAllowed bool
+}
+
+type fetchStateKey struct{}
+
+// checkURL returns an error if u is not to be fetched. The address that the
+// host of u resolves to is checked later, at dial time, by checkDial.
+func (f *Fetcher) checkURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+	host := u.Hostname()
+	if host == "" || f.deny.matchHost(host) {
+		return ErrBlockedHost
+	}
+	state, _ := ctx.Value(fetchStateKey{}).(*fetchState)
+	if state == nil {
+		return errors.New("httputil: missing fetch state")
+	}
+	state.hostAllowed = f.allow.empty() || f.allow.matchHost(host)
+	if !state.hostAllowed && len(f.allow.prefixes) == 0 {
+		return ErrBlockedHost
+	}
+	return nil
+}
+
+// checkDial is the net.Dialer.ControlContext function of f. address is the
+// resolved address that's about to be connected to.
+func (f *Fetcher) checkDial(ctx context.Context, network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if f.deny.matchAddr(addr) {
+		return ErrBlockedAddress
+	}
+	allowed := f.allow.matchAddr(addr)
+	if !isPublicAddr(addr) && !allowed {
+		return ErrBlockedAddress
+	}
+	if state, _ := ctx.Value(fetchStateKey{}).(*fetchState); state == nil || (!state.hostAllowed && !allowed) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// Get fetches url with an ordinary looking User-Agent. If contentTypes are
+// given, the media type of the response must be one of them (a type like
+// "image/*" matches all subtypes). Reading more than the max body size of f
+// from the response body returns ErrBodyTooLarge. Make sure to close the
+// http.Response.Body.
+func (f *Fetcher) Get(ctx context.Context, rawURL string, contentTypes ...string) (*http.Response, error) {
+	ctx = context.WithValue(ctx, fetchStateKey{}, &fetchState{})
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkURL(ctx, req.URL); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ContentLength > f.maxBodySize {
+		res.Body.Close()
+		return nil, ErrBodyTooLarge
+	}
+	if len(contentTypes) > 0 && !matchContentType(res.Header.Get("Content-Type"), contentTypes) {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrContentType, res.Header.Get("Content-Type"))
+	}
+	res.Body = &limitedBody{rc: res.Body, n: f.maxBodySize}
+	return res, nil
+}
+
+// matchContentType reports whether the media type of the Content-Type header
+// value header is one of types.
+func matchContentType(header string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBody is a response body from which at most n bytes can be read.
+type limitedBody struct {
+	rc io.ReadCloser
+	n  int64 // bytes remaining
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.rc.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n + int(b.n), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+var (
+	defaultFetcherMu sync.RWMutex
+	defaultFetcher   *Fetcher
+)
+
+func init() {
+	defaultFetcher, _ = NewFetcher(nil)
+}
+
+// SetDefaultFetcher sets the Fetcher used by Fetch.
+func SetDefaultFetcher(f *Fetcher) {
+	defaultFetcherMu.Lock()
+	defaultFetcher = f
+	defaultFetcherMu.Unlock()
+}
+
+// Fetch calls Get on the default Fetcher (see SetDefaultFetcher).
+func Fetch(ctx context.Context, url string, contentTypes ...string) (*http.Response, error) {
+	defaultFetcherMu.RLock()
+	f := defaultFetcher
+	defaultFetcherMu.RUnlock()
+	return f.Get(ctx, url, contentTypes...)
+}
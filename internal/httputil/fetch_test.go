@@ -0,0 +1,98 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // cloud metadata
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"64:ff9b::7f00:1", false},
+	}
+	for _, test := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(test.addr)); got != test.public {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", test.addr, got, test.public)
+		}
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/redirect", http.StatusFound)
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(strings.Repeat("a", 2048)))
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer ts.Close()
+
+	newFetcher := func(opts *FetcherOptions) *Fetcher {
+		f, err := NewFetcher(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	get := func(f *Fetcher, url string, contentTypes ...string) error {
+		res, err := f.Get(context.Background(), url, contentTypes...)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, err = io.ReadAll(res.Body)
+		return err
+	}
+
+	allowed := &FetcherOptions{Allowlist: []string{"127.0.0.0/8"}, MaxBodySize: 1024}
+	tests := []struct {
+		name         string
+		opts         *FetcherOptions
+		url          string
+		contentTypes []string
+		want         error
+	}{
+		{"loopback", nil, ts.URL, nil, ErrBlockedAddress},
+		{"resolves to loopback", nil, strings.Replace(ts.URL, "127.0.0.1", "localhost", 1), nil, ErrBlockedAddress},
+		{"allowlisted", allowed, ts.URL, nil, nil},
+		{"content type", allowed, ts.URL, []string{"text/html"}, nil},
+		{"wrong content type", allowed, ts.URL, []string{"image/*"}, ErrContentType},
+		{"redirects", allowed, ts.URL + "/redirect", nil, ErrTooManyRedirects},
+		{"body too large", allowed, ts.URL + "/large", nil, ErrBodyTooLarge},
+		{"scheme", allowed, "file:///etc/passwd", nil, ErrUnsupportedScheme},
+		{"denylisted", &FetcherOptions{Allowlist: []string{"127.0.0.0/8"}, Denylist: []string{"127.0.0.1"}}, ts.URL, nil, ErrBlockedHost},
+		{"not in allowlist", &FetcherOptions{Allowlist: []string{"example.com"}}, ts.URL, nil, ErrBlockedHost},
+	}
+	for _, test := range tests {
+		err := get(newFetcher(test.opts), test.url, test.contentTypes...)
+		if (test.want == nil && err != nil) || !errors.Is(err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// LinkMeta is the metadata of a web page, found in its HTML head.
+type LinkMeta struct {
+	Title        string // og:title, or the title element.
+	Description  string // og:description, or the description meta tag.
+	SiteName     string // og:site_name
+	ImageURL     string // og:image
+	FaviconURL   string // If the page doesn't link to one, it's /favicon.ico.
+	CanonicalURL string // The canonical link, or og:url.
+	OEmbedURL    string // The JSON oEmbed discovery link.
+}
+
+// ExtractLinkMeta returns the metadata of the HTML document in r, which was
+// fetched from base. The URLs in the returned LinkMeta are absolute.
+func ExtractLinkMeta(r io.Reader, base *url.URL) (*LinkMeta, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		meta     = &LinkMeta{}
+		title    string
+		descTag  string
+		ogURL    string
+		resolved = func(ref string) string {
+			u, err := base.Parse(strings.TrimSpace(ref))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return ""
+			}
+			return u.String()
+		}
+	)
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attrs := make(map[string]string, len(n.Attr))
+			for _, attr := range n.Attr {
+				attrs[strings.ToLower(attr.Key)] = attr.Val
+			}
+			switch n.Data {
+			case "title":
+				if title == "" && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+					title = n.FirstChild.Data
+				}
+			case "meta":
+				content := strings.TrimSpace(attrs["content"])
+				switch strings.ToLower(attrs["property"]) {
+				case "og:title":
+					meta.Title = content
+				case "og:description":
+					meta.Description = content
+				case "og:site_name":
+					meta.SiteName = content
+				case "og:image":
+					if meta.ImageURL == "" {
+						meta.ImageURL = resolved(content)
+					}
+				case "og:url":
+					ogURL = resolved(content)
+				}
+				if strings.ToLower(attrs["name"]) == "description" {
+					descTag = content
+				}
+			case "link":
+				rels := strings.Fields(strings.ToLower(attrs["rel"]))
+				for _, rel := range rels {
+					switch rel {
+					case "icon":
+						if meta.FaviconURL == "" {
+							meta.FaviconURL = resolved(attrs["href"])
+						}
+					case "canonical":
+						meta.CanonicalURL = resolved(attrs["href"])
+					case "alternate":
+						if strings.ToLower(attrs["type"]) == "application/json+oembed" {
+							meta.OEmbedURL = resolved(attrs["href"])
+						}
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	if meta.Title == "" {
+		meta.Title = strings.TrimSpace(title)
+	}
+	if meta.Description == "" {
+		meta.Description = descTag
+	}
+	if meta.CanonicalURL == "" {
+		meta.CanonicalURL = ogURL
+	}
+	if meta.FaviconURL == "" {
+		meta.FaviconURL = resolved("/favicon.ico")
+	}
+	return meta, nil
+}
+
+// OEmbed is an oEmbed response. See https://oembed.com. HTML, if any, is
+// provided by a third party and is not to be trusted. The dimensions are
+// numbers, but some providers send them as strings.
+type OEmbed struct {
+	Type            string      `json:"type"` // One of photo, video, link, or rich.
+	Version         string      `json:"version"`
+	Title           string      `json:"title,omitempty"`
+	AuthorName      string      `json:"author_name,omitempty"`
+	AuthorURL       string      `json:"author_url,omitempty"`
+	ProviderName    string      `json:"provider_name,omitempty"`
+	ProviderURL     string      `json:"provider_url,omitempty"`
+	URL             string      `json:"url,omitempty"` // For photos.
+	HTML            string      `json:"html,omitempty"`
+	Width           json.Number `json:"width,omitempty"`
+	Height          json.Number `json:"height,omitempty"`
+	ThumbnailURL    string      `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  json.Number `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight json.Number `json:"thumbnail_height,omitempty"`
+}
+
+// FetchOEmbed fetches the oEmbed data at endpoint (a JSON oEmbed URL) using
+// the default Fetcher.
+func FetchOEmbed(ctx context.Context, endpoint string) (*OEmbed, error) {
+	res, err := Fetch(ctx, endpoint, "application/json", "application/json+oembed", "text/json", "text/javascript")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("oembed endpoint responded with status %s", res.Status)
+	}
+
+	oembed := &OEmbed{}
+	if err := json.NewDecoder(res.Body).Decode(oembed); err != nil {
+		return nil, err
+	}
+	return oembed, nil
+}
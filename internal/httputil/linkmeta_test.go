@@ -0,0 +1,49 @@
+package httputil
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractLinkMeta(t *testing.T) {
+	doc := `<!DOCTYPE html>
+<html>
+<head>
+	<title> Page title </title>
+	<meta name="description" content="Plain description">
+	<meta property="og:site_name" content="Example">
+	<meta property="og:image" content="/images/cover.jpg">
+	<meta property="og:url" content="https://example.com/og">
+	<link rel="canonical" href="https://example.com/articles/1">
+	<link rel="shortcut icon" href="//cdn.example.com/icon.png">
+	<link rel="alternate" type="application/json+oembed" href="/oembed?url=x">
+</head>
+<body><p>Hello</p></body>
+</html>`
+	base, _ := url.Parse("https://example.com/articles/1?ref=home")
+	meta, err := ExtractLinkMeta(strings.NewReader(doc), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &LinkMeta{
+		Title:        "Page title",
+		Description:  "Plain description",
+		SiteName:     "Example",
+		ImageURL:     "https://example.com/images/cover.jpg",
+		FaviconURL:   "https://cdn.example.com/icon.png",
+		CanonicalURL: "https://example.com/articles/1",
+		OEmbedURL:    "https://example.com/oembed?url=x",
+	}
+	if *meta != *want {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+
+	meta, err = ExtractLinkMeta(strings.NewReader(`<meta property="og:title" content="OG title"><script src="javascript:alert(1)"></script>`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "OG title" || meta.FaviconURL != "https://example.com/favicon.ico" || meta.CanonicalURL != "" {
+		t.Errorf("got %+v", meta)
+	}
+}
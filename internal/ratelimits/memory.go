@@ -0,0 +1,83 @@
+package ratelimits
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBackend is a Backend that keeps the state in memory. It's meant for
+// tests and for running a single server without Redis.
+type MemoryBackend struct {
+	mu     sync.Mutex
+	tats   map[string]time.Time // theoretical arrival times
+	checks int
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		tats: make(map[string]time.Time),
+		Now:  time.Now,
+	}
+}
+
+func (b *MemoryBackend) Allow(ctx context.Context, keys []string, rules []Rule) (Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.Now()
+	b.checks++
+	if b.checks%1000 == 0 {
+		b.sweep(now)
+	}
+
+	var (
+		tats = make([]time.Time, len(keys))
+		res  = Result{Allowed: true, Remaining: -1}
+	)
+	for i, rule := range rules {
+		emission, burst := rule.emission(), time.Duration(rule.Limit)
+		tat := b.tats[keys[i]]
+		if tat.Before(now) {
+			tat = now
+		}
+		allowAt := tat.Add(emission - burst*emission)
+		if now.Before(allowAt) {
+			if retry := allowAt.Sub(now); !res.Allowed && retry <= res.RetryAfter {
+				continue
+			}
+			res = Result{
+				Limit:      rule.Limit,
+				Reset:      tat.Sub(now),
+				RetryAfter: allowAt.Sub(now),
+			}
+		}
+		tats[i] = tat.Add(emission)
+	}
+	if !res.Allowed {
+		return res, nil
+	}
+
+	for i, rule := range rules {
+		emission, burst := rule.emission(), time.Duration(rule.Limit)
+		b.tats[keys[i]] = tats[i]
+		left := int(now.Sub(tats[i].Add(-burst*emission)) / emission)
+		if res.Remaining == -1 || left < res.Remaining {
+			res.Limit, res.Remaining, res.Reset = rule.Limit, left, tats[i].Sub(now)
+		}
+	}
+	return res, nil
+}
+
+// sweep deletes the state of the keys that are back to their full bursts.
+func (b *MemoryBackend) sweep(now time.Time) {
+	for key, tat := range b.tats {
+		if !tat.After(now) {
+			delete(b.tats, key)
+		}
+	}
+}
@@ -1,54 +1,137 @@
-// Package ratelimits implements a token bucket rate limiter.
+// Package ratelimits implements a GCRA (generic cell rate algorithm) rate
+// limiter with named policies.
+//
+// A Rule of Limit requests per Interval allows a burst of Limit requests, after
+// which requests are allowed at an even pace of one every Interval/Limit. A
+// request is checked against all the rules of its policy at once: either all
+// of them allow it (and it's counted against all of them) or it's denied.
 package ratelimits
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
-
-	"github.com/gomodule/redigo/redis"
 )
 
-func redisKey(bucketID, suffix string) string {
-	return "rl:" + bucketID + ":" + suffix
-}
-
-func resetBucket(conn redis.Conn, bucketID string, maxTokens int) error {
-	conn.Send("MULTI")
-	// Number of tokens left.
-	conn.Send("SET", redisKey(bucketID, "count"), maxTokens)
-	// Last updated timestamp.
-	conn.Send("SET", redisKey(bucketID, "ts"), time.Now().Unix())
-	_, err := conn.Do("EXEC")
-	return err
-}
-
-// Limit implements a Token Bucket rate limiter (with the bucket filled to
-// maxTokens after interval). It returns true if more than zero tokens exist in
-// the bucket.
-func Limit(conn redis.Conn, bucketID string, interval time.Duration, maxTokens int) (bool, error) {
-	// TODO: Use redis pipelining to speed things up.
-	lastUpdated, err := redis.Int64(conn.Do("GET", redisKey(bucketID, "ts")))
-	if err != nil {
-		if err == redis.ErrNil {
-			if err := resetBucket(conn, bucketID, maxTokens); err != nil {
-				return false, err
+// Rule is a limit of Limit requests per Interval.
+type Rule struct {
+	Interval time.Duration `yaml:"interval"`
+	Limit    int           `yaml:"limit"`
+}
+
+// emission returns the time between requests at the sustained rate of r.
+func (r Rule) emission() time.Duration {
+	return max(time.Millisecond, r.Interval/time.Duration(r.Limit))
+}
+
+func (r Rule) validate() error {
+	if r.Interval <= 0 || r.Limit <= 0 {
+		return fmt.Errorf("invalid rule (interval %v, limit %d)", r.Interval, r.Limit)
+	}
+	return nil
+}
+
+// Policy is a named set of rules.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+
+	// Groups are the overrides of Rules for groups of users (like new users,
+	// or moderators).
+	Groups map[string][]Rule `yaml:"groups"`
+}
+
+// RulesFor returns the rules of p for group, which may be empty.
+func (p *Policy) RulesFor(group string) []Rule {
+	if rules, ok := p.Groups[group]; ok && group != "" {
+		return rules
+	}
+	return p.Rules
+}
+
+// Validate returns an error if any rule of p is invalid.
+func (p *Policy) Validate() error {
+	for _, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	for group, rules := range p.Groups {
+		for _, rule := range rules {
+			if err := rule.validate(); err != nil {
+				return fmt.Errorf("group %s: %w", group, err)
 			}
-		} else {
-			return false, err
 		}
 	}
+	return nil
+}
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed bool
+
+	// Limit and Remaining are those of the most restrictive rule: the number
+	// of requests allowed in a burst, and how many of them are left.
+	Limit     int
+	Remaining int
+
+	// Reset is the time after which the most restrictive rule is back to its
+	// full burst.
+	Reset time.Duration
+
+	// RetryAfter is the time after which a denied request would be allowed.
+	RetryAfter time.Duration
+}
+
+// Backend stores the state of the rate limits.
+type Backend interface {
+	// Allow checks, and if allowed counts, a request against rules, the
+	// state of which is at keys (keys[i] being that of rules[i]).
+	Allow(ctx context.Context, keys []string, rules []Rule) (Result, error)
+}
 
-	if time.Since(time.Unix(lastUpdated, 0)) >= interval {
-		if err := resetBucket(conn, bucketID, maxTokens); err != nil {
-			return false, err
+// ErrUnknownPolicy is returned by Limiter.Limit for policies that don't
+// exist.
+var ErrUnknownPolicy = errors.New("ratelimits: unknown policy")
+
+// Limiter checks requests against named policies.
+type Limiter struct {
+	backend  Backend
+	policies map[string]*Policy
+}
+
+// NewLimiter returns a Limiter. It returns an error if any of the policies
+// are invalid.
+func NewLimiter(backend Backend, policies map[string]*Policy) (*Limiter, error) {
+	for name, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("rate limit policy %s: %w", name, err)
 		}
 	}
+	return &Limiter{backend: backend, policies: policies}, nil
+}
 
-	tokensLeft, err := redis.Int(conn.Do("DECR", redisKey(bucketID, "count")))
-	if err != nil {
-		return false, err
+// Policy returns the policy name, or nil if it doesn't exist.
+func (l *Limiter) Policy(name string) *Policy {
+	return l.policies[name]
+}
+
+// Limit checks a request, by the user (or IP address, etc.) key, who belongs
+// to group, against the policy name.
+func (l *Limiter) Limit(ctx context.Context, name, group, key string) (Result, error) {
+	policy, ok := l.policies[name]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s", ErrUnknownPolicy, name)
+	}
+	rules := policy.RulesFor(group)
+	if len(rules) == 0 {
+		return Result{Allowed: true}, nil
 	}
-	if tokensLeft > -1 {
-		return true, nil
+	keys := make([]string, len(rules))
+	for i, rule := range rules {
+		// The rule is a part of the key so that changes to the policies
+		// start afresh.
+		keys[i] = fmt.Sprintf("rl2:%s:%d:%d:%s", name, rule.Interval.Milliseconds(), rule.Limit, key)
 	}
-	return false, nil
+	return l.backend.Allow(ctx, keys, rules)
 }
@@ -0,0 +1,77 @@
+package ratelimits
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	backend := NewMemoryBackend()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend.Now = func() time.Time { return now }
+
+	limiter, err := NewLimiter(backend, map[string]*Policy{
+		"post": {
+			Rules: []Rule{{Interval: time.Second * 10, Limit: 2}, {Interval: time.Hour, Limit: 3}},
+			Groups: map[string][]Rule{
+				"mods": {{Interval: time.Second, Limit: 10}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := func(group, key string) Result {
+		res, err := limiter.Limit(context.Background(), "post", group, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// A burst of two, then the 10 second rule kicks in.
+	for i, wantRemaining := range []int{1, 0} {
+		if res := limit("", "a"); !res.Allowed || res.Remaining != wantRemaining || res.Limit != 2 {
+			t.Fatalf("request %d: got %+v, want allowed with %d remaining", i, res, wantRemaining)
+		}
+	}
+	res := limit("", "a")
+	if res.Allowed || res.RetryAfter != time.Second*5 {
+		t.Fatalf("got %+v, want denied with retry after 5s", res)
+	}
+
+	// Other keys and groups have their own limits.
+	if res := limit("", "b"); !res.Allowed {
+		t.Errorf("key b: got %+v, want allowed", res)
+	}
+	if res := limit("mods", "a"); !res.Allowed || res.Limit != 10 {
+		t.Errorf("mods: got %+v, want allowed", res)
+	}
+
+	// The third request uses up the hourly rule.
+	now = now.Add(res.RetryAfter)
+	if res := limit("", "a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("got %+v, want allowed with 0 remaining", res)
+	}
+	now = now.Add(time.Second * 10)
+	if res := limit("", "a"); res.Allowed || res.Limit != 3 {
+		t.Errorf("got %+v, want denied by the hourly rule", res)
+	}
+
+	if _, err := limiter.Limit(context.Background(), "nope", "", "a"); err == nil {
+		t.Error("unknown policy: got no error")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Interval: time.Second, Limit: 0}}}
+	if err := p.Validate(); err == nil {
+		t.Error("zero limit: got no error")
+	}
+	p = &Policy{Groups: map[string][]Rule{"new": {{Interval: 0, Limit: 1}}}}
+	if err := p.Validate(); err == nil {
+		t.Error("zero interval in group: got no error")
+	}
+}
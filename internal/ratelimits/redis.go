@@ -0,0 +1,90 @@
+package ratelimits
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// gcraScript checks a request against the rules of KEYS (with ARGV holding
+// the emission interval and the burst of each rule, in that order), and
+// counts it if all of them allow it. The state of a rule is its theoretical
+// arrival time (TAT), in milliseconds. It returns {allowed, limit, remaining,
+// reset, retry after}, with times in milliseconds.
+var gcraScript = redis.NewScript(-1, `
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local tats = {}
+local denied, retry, dlimit, dreset = false, 0, 0, 0
+for i = 1, #KEYS do
+	local emission = tonumber(ARGV[2 * i - 1])
+	local burst = tonumber(ARGV[2 * i])
+	local tat = tonumber(redis.call("GET", KEYS[i]) or now)
+	if tat < now then
+		tat = now
+	end
+	local allow_at = tat + emission - burst * emission
+	if now < allow_at then
+		denied = true
+		if allow_at - now > retry then
+			retry, dlimit, dreset = allow_at - now, burst, tat - now
+		end
+	end
+	tats[i] = tat + emission
+end
+if denied then
+	return {0, dlimit, 0, dreset, retry}
+end
+local limit, remaining, reset = 0, -1, 0
+for i = 1, #KEYS do
+	local emission = tonumber(ARGV[2 * i - 1])
+	local burst = tonumber(ARGV[2 * i])
+	redis.call("SET", KEYS[i], tats[i], "PX", tats[i] - now)
+	local left = math.floor((now - (tats[i] - burst * emission)) / emission)
+	if remaining == -1 or left < remaining then
+		limit, remaining, reset = burst, left, tats[i] - now
+	end
+end
+return {1, limit, remaining, reset, 0}
+`)
+
+// RedisBackend is a Backend that keeps the state in Redis. Checks are atomic
+// (they're done in a Lua script), so it can be shared by many servers.
+type RedisBackend struct {
+	pool *redis.Pool
+}
+
+// NewRedisBackend returns a RedisBackend that uses connections from pool.
+func NewRedisBackend(pool *redis.Pool) *RedisBackend {
+	return &RedisBackend{pool: pool}
+}
+
+func (b *RedisBackend) Allow(ctx context.Context, keys []string, rules []Rule) (Result, error) {
+	conn, err := b.pool.GetContext(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	args := make([]any, 0, len(keys)+len(rules)*2+1)
+	args = append(args, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	for _, rule := range rules {
+		args = append(args, rule.emission().Milliseconds(), rule.Limit)
+	}
+
+	values, err := redis.Int64s(gcraScript.Do(conn, args...))
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      int(values[1]),
+		Remaining:  int(values[2]),
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+		RetryAfter: time.Duration(values[4]) * time.Millisecond,
+	}, nil
+}
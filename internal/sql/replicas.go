@@ -0,0 +1,217 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaSet is a primary database together with a set of read replicas of
+// it. Reads that can tolerate slightly stale data may be sent to a replica
+// with ReadDB, which falls back to the primary when no replica is keeping up.
+//
+// The replication lag of each replica is only known after CheckLag is called,
+// which should be done periodically. Until then, all reads go to the primary.
+type ReplicaSet struct {
+	primary  *sql.DB
+	replicas []*replica
+	maxLag   time.Duration
+
+	// Reads of a user that has written something in the last stickiness
+	// duration go to the primary, so that users see their own writes.
+	stickiness time.Duration
+
+	next atomic.Uint32 // for round-robin
+
+	mu         sync.Mutex
+	lastWrites map[string]time.Time
+}
+
+type replica struct {
+	db *sql.DB
+
+	mu        sync.RWMutex
+	lag       time.Duration
+	healthy   bool
+	err       error // of the last check
+	checkedAt time.Time
+}
+
+// NewReplicaSet returns a ReplicaSet. Replicas lagging behind the primary by
+// more than maxLag are not read from.
+func NewReplicaSet(primary *sql.DB, replicas []*sql.DB, maxLag time.Duration) *ReplicaSet {
+	rs := &ReplicaSet{
+		primary:    primary,
+		maxLag:     maxLag,
+		stickiness: 2*maxLag + 5*time.Second,
+		lastWrites: make(map[string]time.Time),
+	}
+	for _, db := range replicas {
+		rs.replicas = append(rs.replicas, &replica{db: db})
+	}
+	return rs
+}
+
+// Primary returns the primary database.
+func (rs *ReplicaSet) Primary() *sql.DB {
+	return rs.primary
+}
+
+// ReadDB returns a healthy replica (in round-robin order), or the primary if
+// there are none or if the user identified by key (which may be empty) has
+// written anything recently.
+func (rs *ReplicaSet) ReadDB(key string) *sql.DB {
+	if len(rs.replicas) == 0 || rs.wroteRecently(key) {
+		return rs.primary
+	}
+	n := uint32(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint32(0); i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		r.mu.RLock()
+		ok := r.healthy && r.lag <= rs.maxLag
+		r.mu.RUnlock()
+		if ok {
+			return r.db
+		}
+	}
+	return rs.primary
+}
+
+// NoteWrite records that the user identified by key has just written to the
+// primary.
+func (rs *ReplicaSet) NoteWrite(key string) {
+	if key == "" || len(rs.replicas) == 0 {
+		return
+	}
+	now := time.Now()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.lastWrites[key] = now
+	if len(rs.lastWrites) > 10000 {
+		for k, t := range rs.lastWrites {
+			if now.Sub(t) > rs.stickiness {
+				delete(rs.lastWrites, k)
+			}
+		}
+	}
+}
+
+func (rs *ReplicaSet) wroteRecently(key string) bool {
+	if key == "" {
+		return false
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	t, ok := rs.lastWrites[key]
+	if !ok {
+		return false
+	}
+	if time.Since(t) > rs.stickiness {
+		delete(rs.lastWrites, key)
+		return false
+	}
+	return true
+}
+
+// CheckLag measures the replication lag of every replica. Replicas that
+// cannot be reached, or whose replication is not running, are marked
+// unhealthy until the next check. The returned error joins the errors of all
+// the failing replicas.
+func (rs *ReplicaSet) CheckLag(ctx context.Context) error {
+	var errs []error
+	for i, r := range rs.replicas {
+		lag, err := replicationLag(ctx, r.db)
+		r.mu.Lock()
+		r.lag, r.err, r.healthy, r.checkedAt = lag, err, err == nil, time.Now()
+		r.mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplicaStatus is the last measured state of a replica.
+type ReplicaStatus struct {
+	Healthy   bool          `json:"healthy"`
+	Lag       time.Duration `json:"lag"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Status returns the status of each of the replicas, in the order they were
+// passed to NewReplicaSet.
+func (rs *ReplicaSet) Status() []ReplicaStatus {
+	s := make([]ReplicaStatus, len(rs.replicas))
+	for i, r := range rs.replicas {
+		r.mu.RLock()
+		s[i] = ReplicaStatus{Healthy: r.healthy, Lag: r.lag, CheckedAt: r.checkedAt}
+		if r.err != nil {
+			s[i].Error = r.err.Error()
+		}
+		r.mu.RUnlock()
+	}
+	return s
+}
+
+// Close closes all the replicas (but not the primary).
+func (rs *ReplicaSet) Close() error {
+	var errs []error
+	for _, r := range rs.replicas {
+		errs = append(errs, r.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// replicationLag returns the replication lag of a MySQL or MariaDB replica.
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	// SHOW REPLICA STATUS is not available on older versions, and SHOW SLAVE
+	// STATUS is not on newer ones.
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		if rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS"); err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("not a replica")
+	}
+
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, col := range cols {
+		if col == "Seconds_Behind_Master" || col == "Seconds_Behind_Source" {
+			if values[i] == nil {
+				return 0, errors.New("replication is not running")
+			}
+			secs, err := strconv.Atoi(string(values[i]))
+			if err != nil {
+				return 0, fmt.Errorf("invalid replication lag %q", values[i])
+			}
+			return time.Duration(secs) * time.Second, nil
+		}
+	}
+	return 0, errors.New("replication lag not reported")
+}
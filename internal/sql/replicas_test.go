@@ -0,0 +1,52 @@
+package sql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestReplicaSetReadDB(t *testing.T) {
+	primary, r1, r2 := &sql.DB{}, &sql.DB{}, &sql.DB{}
+	rs := NewReplicaSet(primary, []*sql.DB{r1, r2}, 2*time.Second)
+
+	if rs.ReadDB("") != primary {
+		t.Error("Replicas not yet checked, but ReadDB didn't return the primary")
+	}
+
+	setLag := func(i int, healthy bool, lag time.Duration) {
+		rs.replicas[i].healthy = healthy
+		rs.replicas[i].lag = lag
+	}
+
+	setLag(0, true, time.Second)
+	setLag(1, false, 0)
+	for i := 0; i < 4; i++ {
+		if db := rs.ReadDB("user"); db != r1 {
+			t.Errorf("ReadDB returned %p, want the only healthy replica %p", db, r1)
+		}
+	}
+
+	setLag(0, true, 5*time.Second)
+	if rs.ReadDB("") != primary {
+		t.Error("Replica lagging behind by more than maxLag was read from")
+	}
+
+	setLag(0, true, 0)
+	setLag(1, true, 0)
+	seen := map[*sql.DB]bool{}
+	for i := 0; i < 4; i++ {
+		seen[rs.ReadDB("")] = true
+	}
+	if !seen[r1] || !seen[r2] || seen[primary] {
+		t.Error("ReadDB didn't round-robin over the healthy replicas")
+	}
+
+	rs.NoteWrite("user")
+	if rs.ReadDB("user") != primary {
+		t.Error("ReadDB didn't return the primary right after a write by the same user")
+	}
+	if rs.ReadDB("other") == primary {
+		t.Error("A write by one user sent another user's reads to the primary")
+	}
+}
@@ -0,0 +1,280 @@
+package taskrunner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule determines when a task runs.
+type Schedule interface {
+	// Next returns the first time, strictly after t, at which the task should
+	// run.
+	Next(t time.Time) time.Time
+
+	// String returns the schedule in the form accepted by ParseSchedule.
+	String() string
+}
+
+// Every returns a Schedule that fires every d, measured from the last run.
+func Every(d time.Duration) Schedule {
+	return periodSchedule(d)
+}
+
+type periodSchedule time.Duration
+
+func (p periodSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(p))
+}
+
+func (p periodSchedule) String() string {
+	return "every " + time.Duration(p).String()
+}
+
+// cronSchedule is a standard five field cron schedule (minute, hour, day of
+// month, month, and day of week). Each field is a bitset of the allowed
+// values.
+type cronSchedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+var weekdays = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseSchedule parses a schedule spec. All times are in the server's local
+// time zone. The following forms are accepted:
+//
+//	every 10m          (any duration accepted by time.ParseDuration)
+//	hourly             (at minute 0 of every hour)
+//	hourly at :15
+//	03:00 daily
+//	daily at 03:00
+//	03:00 weekly mon
+//	*/5 3-5 * * 1,3    (a standard five field cron expression)
+func ParseSchedule(spec string) (Schedule, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(spec), " "))
+	if s == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	if d, ok := strings.CutPrefix(s, "every "); ok {
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		if dur <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q: duration must be positive", spec)
+		}
+		return Every(dur), nil
+	}
+
+	fields := strings.Fields(s)
+	var cron string
+	switch {
+	case s == "hourly":
+		cron = "0 * * * *"
+	case len(fields) == 3 && fields[0] == "hourly" && fields[1] == "at":
+		m, ok := strings.CutPrefix(fields[2], ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule %q: expected minute of the form :MM", spec)
+		}
+		cron = m + " * * * *"
+	case len(fields) == 2 && fields[1] == "daily":
+		h, m, err := parseClock(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		cron = fmt.Sprintf("%d %d * * *", m, h)
+	case len(fields) == 3 && fields[0] == "daily" && fields[1] == "at":
+		h, m, err := parseClock(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		cron = fmt.Sprintf("%d %d * * *", m, h)
+	case len(fields) == 3 && fields[1] == "weekly":
+		h, m, err := parseClock(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		cron = fmt.Sprintf("%d %d * * %s", m, h, fields[2])
+	case len(fields) == 5:
+		cron = s
+	default:
+		return nil, fmt.Errorf("invalid schedule %q", spec)
+	}
+
+	sched, err := parseCron(cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	sched.spec = spec
+	return sched, nil
+}
+
+// MustParseSchedule is like ParseSchedule but panics on error.
+func MustParseSchedule(spec string) Schedule {
+	s, err := ParseSchedule(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// parseClock parses a time of the form HH:MM.
+func parseClock(s string) (hour, minute int, err error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected a time of the form HH:MM, got %q", s)
+	}
+	if hour, err = strconv.Atoi(h); err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid hour %q", h)
+	}
+	if minute, err = strconv.Atoi(m); err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid minute %q", m)
+	}
+	return hour, minute, nil
+}
+
+func parseCron(s string) (*cronSchedule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d", len(fields))
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+
+	return &cronSchedule{
+		spec:    s,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepStr, field.name)
+			}
+		}
+
+		lo, hi := field.min, field.max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseCronValue(a, field); err != nil {
+				return 0, err
+			}
+			if isRange {
+				if hi, err = parseCronValue(b, field); err != nil {
+					return 0, err
+				}
+			} else if !hasStep {
+				hi = lo
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s field", rng, field.name)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, field cronField) (int, error) {
+	if field.name == "day of week" {
+		if n, ok := weekdays[s]; ok {
+			return n, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, field.name)
+	}
+	if field.name == "day of week" && n == 7 {
+		n = 0
+	}
+	if n < field.min || n > field.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d] in %s field", n, field.min, field.max, field.name)
+	}
+	return n, nil
+}
+
+func (c *cronSchedule) String() string {
+	return c.spec
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	// As with cron, if both day fields are restricted, either one matching is
+	// enough.
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Give up after five years of searching; only an impossible schedule
+	// (like the 31st of February) gets that far.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
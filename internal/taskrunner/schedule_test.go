@@ -0,0 +1,62 @@
+package taskrunner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2024, time.March, 15, 10, 30, 20, 0, time.UTC) // a Friday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"every 10m", from.Add(10 * time.Minute)},
+		{"hourly", time.Date(2024, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"hourly at :45", time.Date(2024, time.March, 15, 10, 45, 0, 0, time.UTC)},
+		{"hourly at :15", time.Date(2024, time.March, 15, 11, 15, 0, 0, time.UTC)},
+		{"03:00 daily", time.Date(2024, time.March, 16, 3, 0, 0, 0, time.UTC)},
+		{"Daily at 23:59", time.Date(2024, time.March, 15, 23, 59, 0, 0, time.UTC)},
+		{"04:30 weekly mon", time.Date(2024, time.March, 18, 4, 30, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, time.March, 15, 10, 40, 0, 0, time.UTC)},
+		{"0 3-5 * * *", time.Date(2024, time.March, 16, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC).AddDate(4, 0, 0)},
+		{"0 12 * * sat,sun", time.Date(2024, time.March, 16, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, time.March, 17, 12, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 5", time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)}, // day of month or week
+	}
+	for _, test := range tests {
+		s, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) returned error: %v", test.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(test.want) {
+			t.Errorf("ParseSchedule(%q).Next(%v) = %v, want %v", test.spec, from, got, test.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"every",
+		"every -5m",
+		"sometimes",
+		"25:00 daily",
+		"03:60 daily",
+		"hourly at 15",
+		"03:00 weekly someday",
+		"60 * * * *",
+		"* * 0 * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * *",
+	}
+	for _, spec := range tests {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) returned no error", spec)
+		}
+	}
+}
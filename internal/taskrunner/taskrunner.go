@@ -2,28 +2,70 @@ package taskrunner
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 	"time"
 )
 
+// ErrTaskNotFound is returned when no task with the given name exists.
+var ErrTaskNotFound = errors.New("taskrunner: task not found")
+
 type DoFunc func()
 
 type task struct {
 	name      string
 	fn        func(context.Context) error
-	period    time.Duration
+	schedule  Schedule
 	waitFirst bool
 	done      chan struct{}
 	noLogging bool
 	do        chan struct{} // for running task on call
+
+	mu             sync.Mutex
+	paused         bool
+	running        bool
+	lastRunAt      time.Time
+	lastRunTook    time.Duration
+	lastErr        error
+	lastErrAt      time.Time
+	nextRunAt      time.Time
+	runs, failures int
+}
+
+// TaskStatus is a snapshot of the state of a task.
+type TaskStatus struct {
+	Name        string        `json:"name"`
+	Schedule    string        `json:"schedule"`
+	Paused      bool          `json:"paused"`
+	Running     bool          `json:"running"`
+	LastRunAt   *time.Time    `json:"lastRunAt"`
+	LastRunTook time.Duration `json:"lastRunTook"`
+	LastError   string        `json:"lastError"` // The error of the last run, if any.
+	LastErrorAt *time.Time    `json:"lastErrorAt"`
+	NextRunAt   *time.Time    `json:"nextRunAt"`
+	Runs        int           `json:"runs"`
+	Failures    int           `json:"failures"`
 }
 
 func (t *task) run(ctx context.Context, done <-chan struct{}) {
+	// Periodic tasks, unless waitFirst is set, run immediately on start.
+	// Tasks with a wall-clock schedule wait for their first slot.
+	next := time.Now()
+	if _, periodic := t.schedule.(periodSchedule); t.waitFirst || !periodic {
+		next = t.schedule.Next(next)
+	}
+
 	for {
-		if !t.waitFirst {
-			t.once(ctx)
+		t.mu.Lock()
+		t.nextRunAt = next
+		t.mu.Unlock()
+
+		var timer <-chan time.Time
+		if !next.IsZero() {
+			timer = time.After(time.Until(next))
 		}
+
 		select {
 		case <-done:
 			if !t.noLogging {
@@ -31,14 +73,14 @@ func (t *task) run(ctx context.Context, done <-chan struct{}) {
 			}
 			t.done <- struct{}{}
 			return
-		case <-time.After(t.period):
-			// continue
+		case <-timer:
+			if !t.isPaused() {
+				t.once(ctx)
+			}
 		case <-t.do:
-			// continue
-		}
-		if t.waitFirst {
-			t.once(ctx)
+			t.once(ctx) // even if paused
 		}
+		next = t.schedule.Next(time.Now())
 	}
 }
 
@@ -52,11 +94,73 @@ func (t *task) doFunc() DoFunc {
 
 // once runs the task once
 func (t *task) once(ctx context.Context) {
-	if err := t.fn(ctx); err != nil {
+	t0 := time.Now()
+	t.mu.Lock()
+	t.running = true
+	t.lastRunAt = t0
+	t.mu.Unlock()
+
+	err := t.fn(ctx)
+	if err != nil {
 		if !t.noLogging {
 			log.Printf("Error running task %s: %v\n", t.name, err)
 		}
 	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = false
+	t.lastRunTook = time.Since(t0)
+	t.lastErr = err
+	t.runs++
+	if err != nil {
+		t.lastErrAt = t0
+		t.failures++
+	}
+}
+
+func (t *task) isPaused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.paused
+}
+
+func (t *task) status() TaskStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timePtr := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	s := TaskStatus{
+		Name:        t.name,
+		Schedule:    t.schedule.String(),
+		Paused:      t.paused,
+		Running:     t.running,
+		LastRunAt:   timePtr(t.lastRunAt),
+		LastRunTook: t.lastRunTook,
+		LastErrorAt: timePtr(t.lastErrAt),
+		NextRunAt:   timePtr(t.nextRunAt),
+		Runs:        t.runs,
+		Failures:    t.failures,
+	}
+	if t.lastErr != nil {
+		s.LastError = t.lastErr.Error()
+	}
+	return s
+}
+
+// A Controller lets the state of tasks be observed and changed from outside
+// the running process (by persisting it to a database, for instance).
+type Controller interface {
+	// Sync is called periodically with the status of every task. It returns
+	// the desired paused state of tasks (tasks missing from the map are left
+	// as is) and the names of the tasks that should be run immediately.
+	Sync(ctx context.Context, tasks []TaskStatus) (paused map[string]bool, run []string, err error)
 }
 
 // TaskRunner runs a set of tasks in the background (in parallel).
@@ -66,6 +170,10 @@ type TaskRunner struct {
 	ctx       context.Context
 	cancel    context.CancelFunc // for force stops
 	done      chan struct{}
+
+	controller         Controller
+	controllerInterval time.Duration
+	controllerDone     chan struct{}
 }
 
 func New(ctx context.Context) *TaskRunner {
@@ -74,11 +182,23 @@ func New(ctx context.Context) *TaskRunner {
 	return tr
 }
 
+// New adds a task that runs every period. If waitFirst is false, the task is
+// run once as soon as the runner is started.
 func (tr *TaskRunner) New(name string, fn func(context.Context) error, period time.Duration, waitFirst bool) DoFunc {
+	return tr.add(name, fn, Every(period), waitFirst)
+}
+
+// NewScheduled adds a task that runs according to schedule (see
+// ParseSchedule).
+func (tr *TaskRunner) NewScheduled(name string, fn func(context.Context) error, schedule Schedule) DoFunc {
+	return tr.add(name, fn, schedule, true)
+}
+
+func (tr *TaskRunner) add(name string, fn func(context.Context) error, schedule Schedule, waitFirst bool) DoFunc {
 	t := &task{
 		name:      name,
 		fn:        fn,
-		period:    period,
+		schedule:  schedule,
 		done:      make(chan struct{}),
 		waitFirst: waitFirst,
 		do:        make(chan struct{}),
@@ -87,9 +207,105 @@ func (tr *TaskRunner) New(name string, fn func(context.Context) error, period ti
 	return t.doFunc()
 }
 
+// SetController sets the controller that is synced with every interval. It
+// should be called before Start.
+func (tr *TaskRunner) SetController(c Controller, interval time.Duration) {
+	tr.controller = c
+	tr.controllerInterval = interval
+}
+
+func (tr *TaskRunner) getTask(name string) (*task, error) {
+	for _, t := range tr.tasks {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return nil, ErrTaskNotFound
+}
+
+// Tasks returns the status of all the tasks, in the order they were added.
+func (tr *TaskRunner) Tasks() []TaskStatus {
+	s := make([]TaskStatus, len(tr.tasks))
+	for i, t := range tr.tasks {
+		s[i] = t.status()
+	}
+	return s
+}
+
+// Task returns the status of the task named name.
+func (tr *TaskRunner) Task(name string) (TaskStatus, error) {
+	t, err := tr.getTask(name)
+	if err != nil {
+		return TaskStatus{}, err
+	}
+	return t.status(), nil
+}
+
+// Trigger runs the task named name as soon as possible, regardless of whether
+// it's paused. The task's next scheduled run is computed from this run.
+func (tr *TaskRunner) Trigger(name string) error {
+	t, err := tr.getTask(name)
+	if err != nil {
+		return err
+	}
+	t.doFunc()()
+	return nil
+}
+
+// Pause pauses (or unpauses, if pause is false) the task named name. A paused
+// task skips its scheduled runs, but it can still be triggered manually.
+func (tr *TaskRunner) Pause(name string, pause bool) error {
+	t, err := tr.getTask(name)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	if t.paused != pause && !tr.NoLogging {
+		if pause {
+			log.Printf("Pausing task job: %s\n", t.name)
+		} else {
+			log.Printf("Resuming task job: %s\n", t.name)
+		}
+	}
+	t.paused = pause
+	t.mu.Unlock()
+	return nil
+}
+
+func (tr *TaskRunner) syncController(ctx context.Context) {
+	paused, run, err := tr.controller.Sync(ctx, tr.Tasks())
+	if err != nil {
+		log.Printf("Error syncing task controller: %v\n", err)
+		return
+	}
+	for name, p := range paused {
+		tr.Pause(name, p) // ignore tasks that no longer exist
+	}
+	for _, name := range run {
+		tr.Trigger(name)
+	}
+}
+
 // Start starts all the task jobs in the background. The function doesn't block
 // and returns immediately.
 func (tr *TaskRunner) Start() {
+	if tr.controller != nil {
+		// Sync once before any of the tasks start so that paused tasks stay
+		// paused across restarts.
+		tr.syncController(tr.ctx)
+		tr.controllerDone = make(chan struct{})
+		go func() {
+			defer close(tr.controllerDone)
+			for {
+				select {
+				case <-tr.done:
+					return
+				case <-time.After(tr.controllerInterval):
+					tr.syncController(tr.ctx)
+				}
+			}
+		}()
+	}
 	for _, task := range tr.tasks {
 		log.Printf("Starting task job: %s\n", task.name)
 		go task.run(tr.ctx, tr.done)
@@ -110,6 +326,13 @@ func (tr *TaskRunner) Stop(ctx context.Context) error {
 			wg.Done()
 		}(t)
 	}
+	if tr.controllerDone != nil {
+		wg.Add(1)
+		go func() {
+			<-tr.controllerDone
+			wg.Done()
+		}()
+	}
 
 	done := make(chan struct{})
 	go func() {
@@ -0,0 +1 @@
+drop table background_tasks;
@@ -0,0 +1,15 @@
+create table if not exists background_tasks (
+	name varchar (255) not null,
+	schedule varchar (255) not null,
+	paused bool not null default false,
+	running bool not null default false,
+	last_run_at datetime,
+	last_run_took_ms int not null default 0,
+	last_error text,
+	last_error_at datetime,
+	next_run_at datetime,
+	run_requested_at datetime,
+	updated_at datetime not null default current_timestamp(),
+
+	primary key (name)
+);
@@ -0,0 +1 @@
+drop table vote_queue;
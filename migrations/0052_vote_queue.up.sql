@@ -0,0 +1,10 @@
+create table if not exists vote_queue (
+	id bigint unsigned not null auto_increment,
+	target_type tinyint not null,
+	target_id binary (12) not null,
+	author_id binary (12) not null,
+	author_points int not null default 0,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id)
+);
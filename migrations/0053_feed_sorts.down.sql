@@ -0,0 +1,5 @@
+alter table communities drop column hotness_params;
+
+alter table posts drop column best;
+alter table posts drop column controversy;
+alter table posts drop column rising;
@@ -0,0 +1,11 @@
+alter table posts add column rising bigint not null default 0 after hotness;
+alter table posts add column controversy bigint not null default 0 after rising;
+alter table posts add column best bigint not null default 0 after controversy;
+alter table posts add index (deleted, rising, id);
+alter table posts add index (deleted, community_id, rising, id);
+alter table posts add index (deleted, controversy, id);
+alter table posts add index (deleted, community_id, controversy, id);
+alter table posts add index (deleted, best, id);
+alter table posts add index (deleted, community_id, best, id);
+
+alter table communities add column hotness_params json;
@@ -0,0 +1,4 @@
+alter table communities drop column default_comment_sort;
+
+alter table comments drop column best;
+alter table comments drop column controversy;
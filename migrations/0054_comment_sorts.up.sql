@@ -0,0 +1,18 @@
+alter table comments add column controversy bigint not null default 0 after points;
+alter table comments add column best bigint not null default 0 after controversy;
+alter table comments add index (post_id, controversy, id);
+alter table comments add index (post_id, best, id);
+
+update comments set
+	controversy = round(pow(upvotes + downvotes, least(upvotes, downvotes) / greatest(upvotes, downvotes)) * 1000)
+	where upvotes > 0 and downvotes > 0;
+
+/* Lower bound of the Wilson score interval at 95% confidence (see core.bestScore). */
+update comments set
+	best = round(
+		(upvotes / (upvotes + downvotes) + 1.9208 / (upvotes + downvotes)
+			- 1.96 * sqrt(upvotes * downvotes / pow(upvotes + downvotes, 3) + 0.9604 / pow(upvotes + downvotes, 2)))
+		/ (1 + 3.8416 / (upvotes + downvotes)) * 10000000)
+	where upvotes + downvotes > 0;
+
+alter table communities add column default_comment_sort tinyint not null default 0;
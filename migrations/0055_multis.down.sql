@@ -0,0 +1,5 @@
+alter table users drop foreign key fk_home_multi;
+alter table users drop column home_multi_id;
+
+drop table if exists multi_communities;
+drop table if exists multis;
@@ -0,0 +1,29 @@
+create table if not exists multis (
+	id bigint unsigned not null auto_increment,
+	user_id binary (12) not null,
+	name varchar (128) not null, /* Unique per user, as part of the URL of the multi. */
+	display_name varchar (128) not null,
+	description text,
+	public bool not null default false,
+	sort tinyint not null default 0, /* A core.FeedSort. */
+	num_communities int not null default 0,
+	created_at datetime not null default current_timestamp(),
+	last_updated_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (user_id, name),
+	foreign key (user_id) references users (id)
+) AUTO_INCREMENT = 100000;
+
+create table if not exists multi_communities (
+	multi_id bigint unsigned not null,
+	community_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (multi_id, community_id),
+	foreign key (multi_id) references multis (id) ON DELETE CASCADE,
+	foreign key (community_id) references communities (id)
+);
+
+alter table users add column home_multi_id bigint unsigned after home_feed;
+alter table users add constraint fk_home_multi foreign key (home_multi_id) references multis (id) ON DELETE SET NULL;
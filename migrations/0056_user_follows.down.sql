@@ -0,0 +1,5 @@
+alter table users drop column follow_notifications_off;
+alter table users drop column no_following;
+alter table users drop column no_followers;
+
+drop table if exists user_follows;
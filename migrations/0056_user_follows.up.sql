@@ -0,0 +1,15 @@
+create table if not exists user_follows (
+	user_id binary (12) not null, /* The follower. */
+	followed_user_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (user_id, followed_user_id),
+	index (followed_user_id, created_at),
+	index (user_id, created_at),
+	foreign key (user_id) references users (id),
+	foreign key (followed_user_id) references users (id)
+);
+
+alter table users add column no_followers int not null default 0 after no_comments;
+alter table users add column no_following int not null default 0 after no_followers;
+alter table users add column follow_notifications_off bool not null default false after reply_notifications_off;
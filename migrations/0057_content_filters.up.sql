@@ -0,0 +1,14 @@
+create table if not exists content_filters (
+	id int not null auto_increment,
+	user_id binary (12) not null,
+	type tinyint not null, /* A core.ContentFilterType. */
+	pattern varchar (255) not null, /* A keyword, a regular expression, a domain, or a flair ID (empty for NSFW filters). */
+	is_regex bool not null default false,
+	match_body bool not null default false,
+	action tinyint not null default 0, /* A core.ContentFilterAction. */
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	index (user_id),
+	foreign key (user_id) references users (id)
+);
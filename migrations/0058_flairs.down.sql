@@ -0,0 +1,8 @@
+alter table communities drop column post_flair_required;
+
+alter table posts drop foreign key fk_post_flair;
+alter table posts drop index community_id_flair_id;
+alter table posts drop column flair_id;
+
+drop table if exists community_user_flairs;
+drop table if exists community_flairs;
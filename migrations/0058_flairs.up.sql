@@ -0,0 +1,36 @@
+create table if not exists community_flairs (
+	id int not null auto_increment,
+	community_id binary (12) not null,
+	type tinyint not null, /* A core.FlairType (post or user flair). */
+	text varchar (64) not null,
+	color char (7) not null, /* In #rrggbb format. */
+	mods_only bool not null default false,
+	z_index int not null default 0,
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	index (community_id, type, z_index),
+	foreign key (community_id) references communities (id),
+	foreign key (created_by) references users (id)
+);
+
+create table if not exists community_user_flairs (
+	community_id binary (12) not null,
+	user_id binary (12) not null,
+	flair_id int not null,
+	assigned_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (community_id, user_id),
+	foreign key (community_id) references communities (id),
+	foreign key (user_id) references users (id),
+	foreign key (flair_id) references community_flairs (id) ON DELETE CASCADE,
+	foreign key (assigned_by) references users (id)
+);
+
+alter table posts add column flair_id int after community_id;
+alter table posts add constraint fk_post_flair foreign key (flair_id) references community_flairs (id) ON DELETE SET NULL;
+alter table posts add index community_id_flair_id (community_id, flair_id, deleted, id);
+
+alter table communities add column post_flair_required bool not null default false;
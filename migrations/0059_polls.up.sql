@@ -0,0 +1,34 @@
+create table if not exists post_polls (
+	post_id binary (12) not null,
+	multiple_choice bool not null default false,
+	closes_at datetime,
+	no_voters int not null default 0,
+
+	primary key (post_id),
+	foreign key (post_id) references posts (id)
+);
+
+create table if not exists poll_options (
+	id int not null auto_increment,
+	post_id binary (12) not null,
+	position tinyint not null,
+	text varchar (255) not null,
+	no_votes int not null default 0,
+
+	primary key (id),
+	unique key post_id_position (post_id, position),
+	foreign key (post_id) references post_polls (post_id)
+);
+
+create table if not exists poll_votes (
+	option_id int not null,
+	post_id binary (12) not null,
+	user_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (option_id, user_id),
+	index post_id_user_id (post_id, user_id),
+	foreign key (option_id) references poll_options (id),
+	foreign key (post_id) references post_polls (post_id),
+	foreign key (user_id) references users (id)
+);
@@ -0,0 +1,28 @@
+create table if not exists post_drafts (
+	id int not null auto_increment,
+	user_id binary (12) not null,
+	community_id binary (12),
+	type tinyint not null,
+	title varchar (255) not null default "",
+	body text,
+	url varchar (2048),
+	poll json,
+	flair_id int,
+	user_group tinyint not null default 1,
+	scheduled_at datetime, /* If null, the draft is not scheduled. */
+	recurrence tinyint not null default 0, /* A core.DraftRecurrence. */
+	pin bool not null default false,
+	last_post_id binary (12),
+	no_published int not null default 0,
+	last_error varchar (1024),
+	created_at datetime not null default current_timestamp(),
+	updated_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	index (user_id, id),
+	index scheduled_at (scheduled_at),
+	foreign key (user_id) references users (id),
+	foreign key (community_id) references communities (id),
+	foreign key (flair_id) references community_flairs (id) ON DELETE SET NULL,
+	foreign key (last_post_id) references posts (id)
+);
@@ -0,0 +1,13 @@
+create table if not exists content_revisions (
+	id int not null auto_increment,
+	target_type tinyint not null, /* A core.ContentType (post or comment). */
+	target_id binary (12) not null,
+	title varchar (255), /* Null for comments. */
+	body text,
+	editor_id binary (12) not null,
+	created_at datetime not null default current_timestamp(), /* When the edit was made. */
+
+	primary key (id),
+	index target (target_type, target_id, id),
+	foreign key (editor_id) references users (id)
+);
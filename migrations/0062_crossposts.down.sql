@@ -0,0 +1,4 @@
+alter table posts drop foreign key fk_post_crosspost_of;
+alter table posts drop index crosspost_of;
+alter table posts drop column no_crossposts;
+alter table posts drop column crosspost_of;
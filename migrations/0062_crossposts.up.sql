@@ -0,0 +1,4 @@
+alter table posts add column crosspost_of binary (12) after flair_id;
+alter table posts add column no_crossposts int not null default 0 after no_comments;
+alter table posts add constraint fk_post_crosspost_of foreign key (crosspost_of) references posts (id);
+alter table posts add index crosspost_of (crosspost_of, community_id);
@@ -0,0 +1,2 @@
+alter table posts drop index link_hash;
+alter table posts drop column link_hash;
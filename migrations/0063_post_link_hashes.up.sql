@@ -0,0 +1,4 @@
+-- The hash of the canonical link of link posts, for finding the other posts of
+-- the same link. Posts created before this migration don't have it.
+alter table posts add column link_hash binary (32) after link_info;
+alter table posts add index link_hash (link_hash, community_id, created_at);
@@ -0,0 +1,9 @@
+create table link_previews (
+	link_hash binary (32) not null,
+	url varchar (2048) not null,
+	preview json not null,
+	fetched_at datetime not null,
+	last_used_at datetime not null default current_timestamp(),
+	primary key (link_hash),
+	index fetched_at (fetched_at)
+);
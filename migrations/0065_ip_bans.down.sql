@@ -0,0 +1,3 @@
+alter table users drop index created_ip;
+
+drop table ip_bans;
@@ -0,0 +1,13 @@
+create table ip_bans (
+	id int not null auto_increment,
+	prefix varchar (64) not null,
+	reason text,
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+	expires_at datetime,
+	primary key (id),
+	index expires_at (expires_at),
+	foreign key (created_by) references users (id)
+);
+
+alter table users add index created_ip (created_ip, created_at);
@@ -0,0 +1,13 @@
+create table user_ips (
+	user_id binary (12) not null,
+	ip varchar (45) not null,
+	first_seen datetime not null default current_timestamp(),
+	last_seen datetime not null default current_timestamp(),
+	primary key (user_id, ip),
+	index ip (ip, last_seen),
+	index last_seen (last_seen),
+	foreign key (user_id) references users (id)
+);
+
+insert into user_ips (user_id, ip, first_seen, last_seen)
+select id, last_seen_ip, last_seen, last_seen from users where last_seen_ip is not null and last_seen_ip != '';
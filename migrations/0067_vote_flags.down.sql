@@ -0,0 +1,4 @@
+alter table comment_votes drop index created_at;
+alter table post_votes drop index created_at;
+
+drop table vote_flags;
@@ -0,0 +1,25 @@
+create table vote_flags (
+	id int not null auto_increment,
+	reason tinyint not null,
+	target_type tinyint not null,
+	target_id binary (12) not null,
+	voter_id binary (12) not null,
+	author_id binary (12) not null,
+	up bool not null,
+	voted_at datetime not null,
+	detail varchar (255) not null default '',
+	status tinyint not null default 0,
+	reviewed_by binary (12),
+	reviewed_at datetime,
+	created_at datetime not null default current_timestamp(),
+	primary key (id),
+	unique key one_flag (target_type, target_id, voter_id, reason),
+	index status (status, id),
+	index voter_id (voter_id),
+	foreign key (voter_id) references users (id),
+	foreign key (author_id) references users (id),
+	foreign key (reviewed_by) references users (id)
+);
+
+alter table post_votes add index created_at (created_at);
+alter table comment_votes add index created_at (created_at);
@@ -0,0 +1,17 @@
+create table user_suspensions (
+	id int not null auto_increment,
+	user_id binary (12) not null,
+	reason text not null,
+	admin_note text,
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+	expires_at datetime,
+	lifted_at datetime,
+	lifted_by binary (12),
+	primary key (id),
+	index user_id (user_id, id),
+	index lifted_at (lifted_at, expires_at),
+	foreign key (user_id) references users (id),
+	foreign key (created_by) references users (id),
+	foreign key (lifted_by) references users (id)
+);
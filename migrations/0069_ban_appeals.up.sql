@@ -0,0 +1,20 @@
+create table ban_appeals (
+	id int not null auto_increment,
+	ban_type tinyint not null,
+	ban_id int unsigned not null,
+	user_id binary (12) not null,
+	community_id binary (12),
+	message text not null,
+	status tinyint not null default 0,
+	response text,
+	reviewed_by binary (12),
+	reviewed_at datetime,
+	created_at datetime not null default current_timestamp(),
+	primary key (id),
+	index user_ban (user_id, ban_type, ban_id),
+	index community_id (community_id, status, id),
+	index status (ban_type, status, id),
+	foreign key (user_id) references users (id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (reviewed_by) references users (id)
+);
@@ -0,0 +1,2 @@
+alter table users drop index shadow_banned_at;
+alter table users drop column shadow_banned_at;
@@ -0,0 +1,2 @@
+alter table users add column shadow_banned_at datetime;
+alter table users add index shadow_banned_at (shadow_banned_at);
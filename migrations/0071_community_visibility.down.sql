@@ -0,0 +1,4 @@
+drop table community_invites;
+drop table community_join_requests;
+drop table community_approved_users;
+alter table communities drop column visibility;
@@ -0,0 +1,46 @@
+alter table communities add column visibility tinyint not null default 0;
+
+create table community_approved_users (
+	community_id binary (12) not null,
+	user_id binary (12) not null,
+	approved_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+	primary key (community_id, user_id),
+	index user_id (user_id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (user_id) references users (id),
+	foreign key (approved_by) references users (id)
+);
+
+create table community_join_requests (
+	id int not null auto_increment,
+	community_id binary (12) not null,
+	user_id binary (12) not null,
+	message text,
+	status tinyint not null default 0,
+	reviewed_by binary (12),
+	reviewed_at datetime,
+	created_at datetime not null default current_timestamp(),
+	primary key (id),
+	index community_id (community_id, status, id),
+	index user_id (user_id, community_id, status),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (user_id) references users (id),
+	foreign key (reviewed_by) references users (id)
+);
+
+create table community_invites (
+	id int not null auto_increment,
+	community_id binary (12) not null,
+	code varchar (32) not null,
+	created_by binary (12) not null,
+	expires_at datetime,
+	max_uses int unsigned,
+	uses int unsigned not null default 0,
+	created_at datetime not null default current_timestamp(),
+	primary key (id),
+	unique key code (code),
+	index community_id (community_id, id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (created_by) references users (id)
+);
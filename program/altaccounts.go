@@ -0,0 +1,65 @@
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+)
+
+// AltAccountsReport writes the report of the possible alt accounts of the user
+// username to w, in format, which is one of table, json, or csv.
+func (pg *Program) AltAccountsReport(username, format string, w io.Writer) error {
+	user, err := core.GetUserByUsername(pg.ctx, pg.db, username, nil)
+	if err != nil {
+		return err
+	}
+	report, err := core.GetAltAccountsReport(pg.ctx, pg.db, user)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "csv":
+		return report.WriteCSV(w)
+	case "", "table":
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	if len(report.Accounts) == 0 {
+		fmt.Fprintf(w, "No accounts share an IP address with %s (out of %d IP addresses).\n", user.Username, len(report.IPs))
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tCONFIDENCE\tCREATED\tLAST SEEN\tBANNED\tSIGNALS\tSHARED COMMUNITIES\tVOTES (ON/BY USER)")
+	for _, a := range report.Accounts {
+		signals := make([]string, len(a.Signals))
+		for i, s := range a.Signals {
+			signals[i] = string(s.Type)
+			if s.IP != "" {
+				signals[i] += "=" + s.IP
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\t%s\t%v\t%s\t%d\t%d/%d\n",
+			a.User.Username,
+			a.Confidence,
+			a.User.CreatedAt.Local().Format(time.DateTime),
+			a.LastSeen.Local().Format(time.DateTime),
+			a.User.Banned,
+			strings.Join(signals, ", "),
+			len(a.SharedCommunities),
+			a.VotesOnUser,
+			a.VotesByUser,
+		)
+	}
+	return tw.Flush()
+}
@@ -16,7 +16,9 @@ import (
 
 	"github.com/discuitnet/discuit/config"
 	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httputil"
 	"github.com/discuitnet/discuit/internal/images"
+	msql "github.com/discuitnet/discuit/internal/sql"
 	"github.com/discuitnet/discuit/internal/taskrunner"
 	"github.com/discuitnet/discuit/internal/uid"
 	"github.com/discuitnet/discuit/server"
@@ -30,6 +32,8 @@ type Program struct {
 	imagesDir string
 	ctx       context.Context
 	tr        *taskrunner.TaskRunner
+
+	replicas *msql.ReplicaSet // nil if there are no read replicas
 }
 
 func NewProgram(openDatabase bool) (*Program, error) {
@@ -56,6 +60,17 @@ func NewProgram(openDatabase bool) (*Program, error) {
 	}
 	images.SetImagesRootFolder(pg.imagesDir)
 
+	fetcher, err := httputil.NewFetcher(&httputil.FetcherOptions{
+		Allowlist:    pg.conf.FetchAllowlist,
+		Denylist:     pg.conf.FetchDenylist,
+		MaxRedirects: pg.conf.FetchMaxRedirects,
+		MaxBodySize:  int64(pg.conf.FetchMaxBodySize),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the fetch allowlist or denylist: %w", err)
+	}
+	httputil.SetDefaultFetcher(fetcher)
+
 	pg.tr = taskrunner.New(pg.ctx)
 
 	if openDatabase {
@@ -67,7 +82,9 @@ func NewProgram(openDatabase bool) (*Program, error) {
 	return pg, nil
 }
 
-func (pg *Program) startBackgroundTasks(delay time.Duration) {
+// startBackgroundTasks starts the background tasks. site is the server whose
+// caches the tasks keep up to date.
+func (pg *Program) startBackgroundTasks(delay time.Duration, site *server.Server) {
 	if pg.db == nil {
 		panic("pg.db is nil")
 	}
@@ -102,9 +119,59 @@ func (pg *Program) startBackgroundTasks(delay time.Duration) {
 		}
 		return nil
 	}, time.Second*10, false)
-	pg.tr.New("Record basic site analytics", func(ctx context.Context) error {
+	pg.tr.New("Flush vote queue", func(ctx context.Context) error {
+		_, posts, err := core.FlushVoteQueue(ctx, pg.db)
+		if len(posts) > 0 {
+			site.InvalidatePostFeeds(posts...)
+		}
+		return err
+	}, time.Second*time.Duration(pg.conf.VoteFlushInterval), false)
+	pg.tr.NewScheduled("Record basic site analytics", func(ctx context.Context) error {
 		return core.RecordBasicSiteStats(ctx, pg.db)
-	}, time.Hour, false)
+	}, taskrunner.MustParseSchedule(pg.conf.AnalyticsSchedule))
+	pg.tr.NewScheduled("Update posts hotness", func(ctx context.Context) error {
+		return core.UpdateAllPostsHotness(ctx, pg.db)
+	}, taskrunner.MustParseSchedule(pg.conf.HotnessSchedule))
+	pg.tr.New("Update rising posts", func(ctx context.Context) error {
+		return core.UpdateRisingPosts(ctx, pg.db)
+	}, time.Minute*5, false)
+	pg.tr.New("Publish scheduled posts", func(ctx context.Context) error {
+		n, err := core.PublishScheduledPosts(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Published %d scheduled posts\n", n)
+			site.InvalidateFeeds()
+		}
+		return err
+	}, time.Minute, false)
+	pg.tr.New("Refresh link previews", func(ctx context.Context) error {
+		_, err := core.RefreshLinkPreviews(ctx, pg.db, 50)
+		return err
+	}, time.Minute*10, false)
+	pg.tr.New("Lift expired suspensions", func(ctx context.Context) error {
+		n, err := core.LiftExpiredSuspensions(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Lifted %d expired suspensions\n", n)
+		}
+		return err
+	}, time.Minute, false)
+	pg.tr.New("Analyze votes", func(ctx context.Context) error {
+		n, err := core.AnalyzeVotes(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Flagged %d votes as possible vote manipulation\n", n)
+		}
+		return err
+	}, time.Minute*30, false)
+	pg.tr.New("Prune user IPs", func(ctx context.Context) error {
+		return core.PruneUserIPs(ctx, pg.db)
+	}, time.Hour*24, false)
+
+	if pg.replicas != nil {
+		pg.tr.New("Check read replicas", func(ctx context.Context) error {
+			return pg.replicas.CheckLag(ctx)
+		}, time.Second*5, false)
+	}
+
+	pg.tr.SetController(&taskController{db: pg.db}, time.Second*5)
 
 	go func() {
 		time.Sleep(delay)
@@ -138,6 +205,29 @@ func (pg *Program) OpenDatabase() (*sql.DB, error) {
 	return pg.db, nil
 }
 
+// openReadReplicas opens the read replicas in the config, if any.
+func (pg *Program) openReadReplicas() error {
+	if len(pg.conf.DBReplicas) == 0 || pg.replicas != nil {
+		return nil
+	}
+
+	var dbs []*sql.DB
+	for i, dsn := range pg.conf.DBReplicas {
+		db, err := openReplica(dsn)
+		if err != nil {
+			for _, db := range dbs {
+				db.Close()
+			}
+			return fmt.Errorf("error opening read replica %d: %w", i, err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	pg.replicas = msql.NewReplicaSet(pg.db, dbs, time.Duration(pg.conf.DBReplicaMaxLag)*time.Second)
+	log.Printf("Opened %d read replica(s)\n", len(dbs))
+	return nil
+}
+
 func (pg *Program) Serve() error {
 	if err := pg.createSentinelUsers(); err != nil {
 		return fmt.Errorf("error creating sentinel users: %w", err)
@@ -152,11 +242,19 @@ func (pg *Program) Serve() error {
 		return errors.New("address needs to be a valid address of the form 'host:port' (host can be empty)")
 	}
 
+	if err := pg.openReadReplicas(); err != nil {
+		return err
+	}
+
 	site, err := server.New(pg.db, pg.conf)
 	if err != nil {
 		return fmt.Errorf("error creating server: %w", err)
 	}
 	defer site.Close()
+	site.SetTaskRunner(pg.tr)
+	if pg.replicas != nil {
+		site.SetReadReplicas(pg.replicas)
+	}
 
 	var https bool = pg.conf.CertFile != ""
 
@@ -224,7 +322,7 @@ func (pg *Program) Serve() error {
 		}
 	}()
 
-	pg.startBackgroundTasks(time.Second)
+	pg.startBackgroundTasks(time.Second, site)
 
 	// Wait for interrupt signal.
 	<-stopCtx.Done()
@@ -263,6 +361,11 @@ func (pg *Program) Config() *config.Config {
 }
 
 func (pg *Program) Close() error {
+	if pg.replicas != nil {
+		if err := pg.replicas.Close(); err != nil {
+			log.Printf("Error closing read replicas: %v\n", err)
+		}
+	}
 	if pg.db != nil {
 		return pg.db.Close()
 	}
@@ -287,6 +390,27 @@ func openDatabase(addr, user, password, dbName string) (*sql.DB, error) {
 	return db, nil
 }
 
+// openReplica opens a connection to the mysql read replica at dsn.
+func openReplica(dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping the database: %w", err)
+	}
+
+	return db, nil
+}
+
 // createSentinelUsers creates the ghost user only if migrations have been run. If
 // migrations have not yet been run, the function exists silently without
 // returning an error
@@ -0,0 +1,134 @@
+package program
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/taskrunner"
+)
+
+// taskController syncs the state of the background tasks with the
+// background_tasks table, so that they can be inspected and controlled from
+// the CLI (or from another server instance).
+type taskController struct {
+	db *sql.DB
+}
+
+func (c *taskController) Sync(ctx context.Context, tasks []taskrunner.TaskStatus) (map[string]bool, []string, error) {
+	for _, t := range tasks {
+		if err := core.SaveBackgroundTaskStatus(ctx, c.db, backgroundTaskFromStatus(t)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rows, err := core.GetBackgroundTasks(ctx, c.db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paused := make(map[string]bool)
+	var run []string
+	for _, row := range rows {
+		paused[row.Name] = row.Paused
+		if row.RunRequestedAt.Valid {
+			if err := core.ClearBackgroundTaskRunRequest(ctx, c.db, row.Name, row.RunRequestedAt.Time); err != nil {
+				return nil, nil, err
+			}
+			run = append(run, row.Name)
+		}
+	}
+	return paused, run, nil
+}
+
+func backgroundTaskFromStatus(s taskrunner.TaskStatus) *core.BackgroundTask {
+	nullTime := func(t *time.Time) msql.NullTime {
+		if t == nil {
+			return msql.NullTime{}
+		}
+		return msql.NewNullTime(*t)
+	}
+	t := &core.BackgroundTask{
+		Name:          s.Name,
+		Schedule:      s.Schedule,
+		Paused:        s.Paused,
+		Running:       s.Running,
+		LastRunAt:     nullTime(s.LastRunAt),
+		LastRunTookMs: int(s.LastRunTook.Milliseconds()),
+		LastErrorAt:   nullTime(s.LastErrorAt),
+		NextRunAt:     nullTime(s.NextRunAt),
+	}
+	if s.LastError != "" {
+		t.LastError = msql.NewNullString(s.LastError)
+	}
+	return t
+}
+
+// ListBackgroundTasks prints the last recorded state of all the background
+// tasks to stdout.
+func (pg *Program) ListBackgroundTasks() error {
+	tasks, err := core.GetBackgroundTasks(pg.ctx, pg.db)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		fmt.Println("No background tasks recorded yet (tasks are recorded once the server is started).")
+		return nil
+	}
+
+	formatTime := func(t msql.NullTime) string {
+		if !t.Valid {
+			return "-"
+		}
+		return t.Time.Local().Format(time.DateTime)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCHEDULE\tSTATE\tLAST RUN\tTOOK\tNEXT RUN\tLAST ERROR")
+	for _, t := range tasks {
+		state := "active"
+		if t.Paused {
+			state = "paused"
+		}
+		if t.Running {
+			state += " (running)"
+		}
+		lastErr := "-"
+		if t.LastError.Valid {
+			lastErr = fmt.Sprintf("%s (at %s)", t.LastError.String, formatTime(t.LastErrorAt))
+		}
+		took := time.Duration(t.LastRunTookMs) * time.Millisecond
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%s\t%s\n", t.Name, t.Schedule, state, formatTime(t.LastRunAt), took, formatTime(t.NextRunAt), lastErr)
+	}
+	return w.Flush()
+}
+
+// RunBackgroundTask asks the running server to run the background task named
+// name immediately.
+func (pg *Program) RunBackgroundTask(name string) error {
+	if err := core.RequestBackgroundTaskRun(pg.ctx, pg.db, name); err != nil {
+		return fmt.Errorf("failed to request a run of task '%s': %w", name, err)
+	}
+	log.Printf("Task '%s' will be run by the server shortly\n", name)
+	return nil
+}
+
+// PauseBackgroundTask pauses (or resumes, if pause is false) the background
+// task named name.
+func (pg *Program) PauseBackgroundTask(name string, pause bool) error {
+	if err := core.SetBackgroundTaskPaused(pg.ctx, pg.db, name, pause); err != nil {
+		return fmt.Errorf("failed to update task '%s': %w", name, err)
+	}
+	if pause {
+		log.Printf("Task '%s' paused\n", name)
+	} else {
+		log.Printf("Task '%s' resumed\n", name)
+	}
+	return nil
+}
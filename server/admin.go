@@ -1,12 +1,17 @@
 package server
 
 import (
+	"bytes"
 	"database/sql"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/discuitnet/discuit/core"
 	"github.com/discuitnet/discuit/core/sitesettings"
 	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/taskrunner"
 )
 
 // getLoggedInAdmin returns the logged in admin, if the
@@ -75,9 +80,25 @@ func (s *Server) adminActions(w *responseWriter, r *request) error {
 				return err
 			}
 		}
-		if err := user.Ban(r.ctx, s.db); err != nil {
+		// Without an expiry, the suspension is indefinite.
+		var expires *time.Time
+		if v, ok := reqBody["expires"]; ok && v != nil {
+			text, ok := v.(string)
+			if !ok {
+				return invalidJSONErr
+			}
+			expires = new(time.Time)
+			if err := expires.UnmarshalText([]byte(text)); err != nil {
+				return httperr.NewBadRequest("invalid_expires", "Invalid expires.")
+			}
+		}
+		reason, _ := reqBody["reason"].(string)
+		note, _ := reqBody["note"].(string)
+		if _, err := user.Suspend(r.ctx, s.db, *r.viewer, reason, note, expires); err != nil {
 			return err
 		}
+		s.invalidateUserCache(user.ID)
+		s.invalidateCache(cacheFeeds)
 	case "unban_user":
 		username, ok := reqBody["username"].(string)
 		if !ok {
@@ -87,9 +108,32 @@ func (s *Server) adminActions(w *responseWriter, r *request) error {
 		if err != nil {
 			return err
 		}
-		if err := user.Unban(r.ctx, s.db); err != nil {
+		if err := user.LiftSuspension(r.ctx, s.db, *r.viewer); err != nil {
 			return err
 		}
+		s.invalidateUserCache(user.ID)
+	case "shadow_ban_user", "undo_shadow_ban_user":
+		username, ok := reqBody["username"].(string)
+		if !ok {
+			return invalidJSONErr
+		}
+		user, err := core.GetUserByUsername(r.ctx, s.db, username, nil)
+		if err != nil {
+			return err
+		}
+		if action == "shadow_ban_user" {
+			if user.Admin {
+				return httperr.NewForbidden("no_ban_admin", "Admin can't ban another admin, yo!")
+			}
+			err = user.ShadowBan(r.ctx, s.db)
+		} else {
+			err = user.UndoShadowBan(r.ctx, s.db)
+		}
+		if err != nil {
+			return err
+		}
+		s.invalidateUserCache(user.ID)
+		s.invalidateCache(cacheFeeds)
 	case "add_default_forum", "remove_default_forum":
 		name, ok := reqBody["name"].(string)
 		if !ok {
@@ -102,6 +146,67 @@ func (s *Server) adminActions(w *responseWriter, r *request) error {
 		if err = comm.SetDefault(r.ctx, s.db, action == "add_default_forum"); err != nil {
 			return err
 		}
+		s.invalidateCache(cacheCommunities, cacheFeeds)
+	case "set_community_hotness":
+		name, ok := reqBody["name"].(string)
+		if !ok {
+			return invalidJSONErr
+		}
+		comm, err := core.GetCommunityByName(r.ctx, s.db, name, r.viewer)
+		if err != nil {
+			return err
+		}
+		// Without any parameters, the community's overrides are removed.
+		var params *sitesettings.HotnessParams
+		if v, ok := reqBody["interval"]; ok && v != nil {
+			interval, ok := v.(float64)
+			if !ok {
+				return invalidJSONErr
+			}
+			params = &sitesettings.HotnessParams{Interval: int(interval)}
+		}
+		if v, ok := reqBody["downvoteWeight"]; ok && v != nil {
+			weight, ok := v.(float64)
+			if !ok {
+				return invalidJSONErr
+			}
+			if params == nil {
+				params = &sitesettings.HotnessParams{}
+			}
+			params.DownvoteWeight = weight
+		}
+		if err = comm.SetHotnessParams(r.ctx, s.db, params); err != nil {
+			return err
+		}
+		s.invalidateCache(cacheCommunities, cacheFeeds)
+	case "run_task":
+		name, ok := reqBody["task"].(string)
+		if !ok {
+			return invalidJSONErr
+		}
+		if s.taskRunner != nil {
+			if err := s.taskRunner.Trigger(name); err != nil {
+				if err == taskrunner.ErrTaskNotFound {
+					return httperr.NewNotFound("task/not-found", "Background task not found.")
+				}
+				return err
+			}
+		} else if err := core.RequestBackgroundTaskRun(r.ctx, s.db, name); err != nil {
+			return err
+		}
+	case "pause_task", "resume_task":
+		name, ok := reqBody["task"].(string)
+		if !ok {
+			return invalidJSONErr
+		}
+		pause := action == "pause_task"
+		if err := core.SetBackgroundTaskPaused(r.ctx, s.db, name, pause); err != nil {
+			return err
+		}
+		if s.taskRunner != nil {
+			// Apply immediately rather than wait for the next sync.
+			s.taskRunner.Pause(name, pause)
+		}
 	default:
 		return httperr.NewBadRequest("invalid_action", "Unsupported admin action.")
 	}
@@ -172,6 +277,9 @@ func (s *Server) handleSiteSettings(w *responseWriter, r *request) error {
 		if err = r.unmarshalJSONBody(settings); err != nil {
 			return err
 		}
+		if err = settings.Hotness.Validate(); err != nil {
+			return httperr.NewBadRequest("invalid-hotness", err.Error())
+		}
 		if err = settings.Save(r.ctx, s.db); err != nil {
 			return err
 		}
@@ -194,6 +302,24 @@ func (s *Server) getBasicSiteStats(w *responseWriter, r *request) error {
 	return w.writeJSON(events)
 }
 
+// /api/_admin/tasks [GET]
+func (s *Server) getBackgroundTasks(w *responseWriter, r *request) error {
+	_, err := getLoggedInAdmin(s.db, r)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := core.GetBackgroundTasks(r.ctx, s.db)
+	if err != nil {
+		return err
+	}
+	if tasks == nil {
+		tasks = []*core.BackgroundTask{}
+	}
+
+	return w.writeJSON(tasks)
+}
+
 func (s *Server) getCommunityRequests(w *responseWriter, r *request) error {
 	_, err := getLoggedInAdmin(s.db, r)
 	if err != nil {
@@ -207,3 +333,149 @@ func (s *Server) getCommunityRequests(w *responseWriter, r *request) error {
 
 	return w.writeJSON(request)
 }
+
+// /api/_admin/ip_bans [GET, POST]
+func (s *Server) handleIPBans(w *responseWriter, r *request) error {
+	admin, err := getLoggedInAdmin(s.db, r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		ban := &core.IPBan{}
+		if err := r.unmarshalJSONBody(ban); err != nil {
+			return err
+		}
+		ban, err := core.CreateIPBan(r.ctx, s.db, admin.ID, ban)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(ban)
+	}
+
+	bans, err := core.GetIPBans(r.ctx, s.db, r.urlQueryParamsValue("expired") == "true")
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(bans)
+}
+
+// /api/_admin/ip_bans/{banId} [DELETE]
+func (s *Server) deleteIPBan(w *responseWriter, r *request) error {
+	if _, err := getLoggedInAdmin(s.db, r); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(r.muxVar("banId"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid-ban-id", "Invalid IP ban id.")
+	}
+	if err := core.DeleteIPBan(r.ctx, s.db, id); err != nil {
+		return err
+	}
+	return w.writeString(`{"success":true}`)
+}
+
+// /api/_admin/users/{username}/alts [GET]
+func (s *Server) getAltAccounts(w *responseWriter, r *request) error {
+	if _, err := getLoggedInAdmin(s.db, r); err != nil {
+		return err
+	}
+
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), nil)
+	if err != nil {
+		return err
+	}
+	report, err := core.GetAltAccountsReport(r.ctx, s.db, user)
+	if err != nil {
+		return err
+	}
+
+	switch r.urlQueryParamsValue("format") {
+	case "", "json":
+		return w.writeJSON(report)
+	case "csv":
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="alts-%s-%s.csv"`, user.Username, report.CreatedAt.Format("20060102"))) // usernames are safe
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return httperr.NewBadRequest("invalid_format", "Unsupported format.")
+}
+
+// /api/_admin/vote_flags [GET, POST]
+func (s *Server) handleVoteFlags(w *responseWriter, r *request) error {
+	admin, err := getLoggedInAdmin(s.db, r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		body := struct {
+			Action string `json:"action"` // Either dismiss or invalidate.
+			IDs    []int  `json:"ids"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		n := 0
+		switch body.Action {
+		case "dismiss":
+			err = core.DismissVoteFlags(r.ctx, s.db, admin.ID, body.IDs)
+		case "invalidate":
+			if n, err = core.InvalidateVoteFlags(r.ctx, s.db, admin.ID, body.IDs); n > 0 {
+				s.invalidateCache(cacheFeeds)
+			}
+		default:
+			return httperr.NewBadRequest("invalid_action", "Unsupported action.")
+		}
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(map[string]int{"votesInvalidated": n})
+	}
+
+	var status core.VoteFlagStatus
+	if text := r.urlQueryParamsValue("status"); text != "" {
+		if err := status.UnmarshalText([]byte(text)); err != nil {
+			return err
+		}
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	flags, nextNext, err := core.GetVoteFlags(r.ctx, s.db, status, 100, nextPtr)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		Flags []*core.VoteFlag `json:"flags"`
+		Next  *string          `json:"next"`
+	}{flags, nextNext}
+
+	return w.writeJSON(res)
+}
+
+// /api/_admin/users/{username}/suspensions [GET]
+func (s *Server) getUserSuspensions(w *responseWriter, r *request) error {
+	if _, err := getLoggedInAdmin(s.db, r); err != nil {
+		return err
+	}
+
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), nil)
+	if err != nil {
+		return err
+	}
+	suspensions, err := user.GetSuspensions(r.ctx, s.db)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(suspensions)
+}
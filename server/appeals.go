@@ -0,0 +1,165 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/httputil"
+)
+
+// writeBanAppeals writes a page of ban appeals, as returned by getAppeals,
+// with the status and the next of the url query params of r.
+func (s *Server) writeBanAppeals(w *responseWriter, r *request, getAppeals func(core.BanAppealStatus, *string) ([]*core.BanAppeal, *string, error)) error {
+	var status core.BanAppealStatus
+	if text := r.urlQueryParamsValue("status"); text != "" {
+		if err := status.UnmarshalText([]byte(text)); err != nil {
+			return err
+		}
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	appeals, nextNext, err := getAppeals(status, nextPtr)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		Appeals []*core.BanAppeal `json:"appeals"`
+		Next    *string           `json:"next"`
+	}{appeals, nextNext}
+
+	return w.writeJSON(res)
+}
+
+// /api/communities/{communityID}/appeals [GET, POST]
+func (s *Server) handleCommunityBanAppeals(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		// Appeal the ban of the viewer.
+		if err := s.rateLimit(r, "appeal_ban", r.viewer.String()); err != nil {
+			return err
+		}
+		values, err := r.unmarshalJSONBodyToStringsMap(false)
+		if err != nil {
+			return err
+		}
+		appeal, err := core.CreateCommunityBanAppeal(r.ctx, s.db, comm, *r.viewer, values["message"])
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(appeal)
+	}
+
+	// Only mods and admins have access.
+	if ok, err := userModOrAdmin(r.ctx, s.db, *r.viewer, comm); err != nil {
+		return err
+	} else if !ok {
+		return errNotAdminNorMod
+	}
+
+	return s.writeBanAppeals(w, r, func(status core.BanAppealStatus, next *string) ([]*core.BanAppeal, *string, error) {
+		return core.GetCommunityBanAppeals(r.ctx, s.db, comm.ID, status, 50, next)
+	})
+}
+
+// /api/_appeal [POST]
+//
+// Site-banned users cannot log in, so they appeal with their username and
+// password instead.
+func (s *Server) appealSiteBan(w *responseWriter, r *request) error {
+	values, err := r.unmarshalJSONBodyToStringsMap(false)
+	if err != nil {
+		return err
+	}
+	username, password := values["username"], values["password"]
+	if username == "" || password == "" {
+		return httperr.NewBadRequest("invalid_credentials", "Username and password required.")
+	}
+
+	ip := httputil.GetIP(r.req)
+	if err := s.rateLimit(r, "login", ip); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "login_user", ip+username); err != nil {
+		return err
+	}
+
+	user, err := core.MatchLoginCredentials(r.ctx, s.db, username, password)
+	if err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "appeal_ban", user.ID.String()); err != nil {
+		return err
+	}
+
+	appeal, err := core.CreateSiteBanAppeal(r.ctx, s.db, user, values["message"])
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(appeal)
+}
+
+// /api/_admin/appeals [GET]
+func (s *Server) getSiteBanAppeals(w *responseWriter, r *request) error {
+	if _, err := getLoggedInAdmin(s.db, r); err != nil {
+		return err
+	}
+
+	return s.writeBanAppeals(w, r, func(status core.BanAppealStatus, next *string) ([]*core.BanAppeal, *string, error) {
+		return core.GetSiteBanAppeals(r.ctx, s.db, status, 50, next)
+	})
+}
+
+// /api/appeals/{appealId} [PUT]
+func (s *Server) reviewBanAppeal(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	id, err := strconv.Atoi(r.muxVar("appealId"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_appeal_id", "Invalid appeal ID.")
+	}
+	appeal, err := core.GetBanAppeal(r.ctx, s.db, id)
+	if err != nil {
+		return err
+	}
+
+	values, err := r.unmarshalJSONBodyToStringsMap(false)
+	if err != nil {
+		return err
+	}
+	switch values["action"] {
+	case "accept":
+		if err := appeal.Accept(r.ctx, s.db, *r.viewer, values["message"]); err != nil {
+			return err
+		}
+		if appeal.Type == core.BanAppealTypeSite {
+			s.invalidateUserCache(appeal.UserID)
+		}
+	case "deny":
+		if err := appeal.Deny(r.ctx, s.db, *r.viewer, values["message"]); err != nil {
+			return err
+		}
+	default:
+		return httperr.NewBadRequest("invalid_action", "Unsupported action.")
+	}
+
+	return w.writeJSON(appeal)
+}
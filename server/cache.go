@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// Namespaces of the response cache (see internal/cache). Only responses to
+// logged out users are cached.
+//
+// The feeds are invalidated on changes to which posts are in them, and in
+// which order (new and deleted posts, pins, locks, and community changes), and
+// on votes on and edits of the posts in them (see invalidatePostFeeds).
+// Comment counts show up once the cached feeds expire.
+const (
+	cacheFeeds       = "feeds"       // first pages of the feeds
+	cacheFeedPosts   = "feed_posts"  // IDs of the posts in the cached feeds
+	cacheCommunities = "communities" // community listings, and communities by ID or name
+	cacheUsers       = "users"       // user profiles, by user ID
+	cacheUsernames   = "usernames"   // lowercase username to user ID
+)
+
+// cacheTTL returns how long responses in namespace ns are cached. A zero
+// duration means they're not.
+func (s *Server) cacheTTL(ns string) time.Duration {
+	if s.cache == nil {
+		return 0
+	}
+	var secs int
+	switch ns {
+	case cacheFeeds, cacheFeedPosts:
+		secs = s.config.CacheFeedsTTL
+	case cacheCommunities:
+		secs = s.config.CacheCommunitiesTTL
+	case cacheUsers, cacheUsernames:
+		secs = s.config.CacheUsersTTL
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// cacheBypassed reports whether the response cache should be skipped for r.
+// For debugging, a request can skip the cache with the noCache=true query
+// parameter, but only in development mode or along with the admin API key.
+func (s *Server) cacheBypassed(r *request) bool {
+	if r.urlQueryParamsValue("noCache") != "true" {
+		return false
+	}
+	if s.config.IsDevelopment {
+		return true
+	}
+	return s.config.AdminAPIKey != "" && r.urlQueryParamsValue("adminKey") == s.config.AdminAPIKey
+}
+
+// cacheGet returns the cached response stored under key in ns. Cache errors
+// are logged and treated as misses.
+func (s *Server) cacheGet(r *request, ns, key string) ([]byte, bool) {
+	if s.cacheTTL(ns) == 0 || s.cacheBypassed(r) {
+		return nil, false
+	}
+	data, ok, err := s.cache.Get(ns, key)
+	if err != nil {
+		log.Printf("Error reading from cache (%s:%s): %v\n", ns, key, err)
+		return nil, false
+	}
+	return data, ok
+}
+
+func (s *Server) cacheSet(ns, key string, data []byte) {
+	ttl := s.cacheTTL(ns)
+	if ttl == 0 {
+		return
+	}
+	if err := s.cache.Set(ns, key, data, ttl); err != nil {
+		log.Printf("Error writing to cache (%s:%s): %v\n", ns, key, err)
+	}
+}
+
+// writeFromCache writes the response cached under key in ns, if there's one,
+// and reports whether it did.
+func (s *Server) writeFromCache(w *responseWriter, r *request, ns, key string) (bool, error) {
+	data, ok := s.cacheGet(r, ns, key)
+	if !ok {
+		return false, nil
+	}
+	w.Header().Set("X-Cache", "HIT")
+	_, err := w.Write(data)
+	return true, err
+}
+
+// writeJSONAndCache writes v as JSON and caches the response under key in ns.
+func (s *Server) writeJSONAndCache(w *responseWriter, r *request, ns, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !s.cacheBypassed(r) {
+		s.cacheSet(ns, key, data)
+	}
+	w.Header().Set("X-Cache", "MISS")
+	_, err = w.Write(data)
+	return err
+}
+
+// invalidateCache drops all the cached responses in the namespaces nss.
+func (s *Server) invalidateCache(nss ...string) {
+	if s.cache == nil {
+		return
+	}
+	for _, ns := range nss {
+		if err := s.cache.Invalidate(ns); err != nil {
+			log.Printf("Error invalidating cache namespace %s: %v\n", ns, err)
+		}
+	}
+}
+
+// cacheFeedPostIDs records the posts of set, a cached feed page, so that votes
+// on and edits of them invalidate the feeds (see invalidatePostFeeds).
+func (s *Server) cacheFeedPostIDs(set *core.FeedResultSet) {
+	for _, post := range set.Posts {
+		s.cacheSet(cacheFeedPosts, post.ID.String(), []byte{1})
+	}
+}
+
+// invalidatePostFeeds drops the cached feeds if any of posts is in them. It's
+// for changes to posts that don't change which posts are in the feeds, like
+// votes and edits, so that they don't empty the feeds cache when they're on
+// posts that no cached feed shows.
+func (s *Server) invalidatePostFeeds(posts ...uid.ID) {
+	if s.cache == nil {
+		return
+	}
+	for _, post := range posts {
+		_, ok, err := s.cache.Get(cacheFeedPosts, post.String())
+		if err != nil {
+			log.Printf("Error reading from cache (%s:%v): %v\n", cacheFeedPosts, post, err)
+		}
+		if ok || err != nil {
+			s.invalidateCache(cacheFeeds, cacheFeedPosts)
+			return
+		}
+	}
+}
+
+// InvalidateFeeds drops all the cached feeds. It's for changes to the feeds
+// made outside of request handlers, like the posts published on schedule.
+func (s *Server) InvalidateFeeds() {
+	s.invalidateCache(cacheFeeds)
+}
+
+// InvalidatePostFeeds drops the cached feeds if any of posts is in them. It's
+// for changes to posts made outside of request handlers, like the vote counts
+// updated by the vote queue flushes.
+func (s *Server) InvalidatePostFeeds(posts ...uid.ID) {
+	s.invalidatePostFeeds(posts...)
+}
+
+// invalidateUserCache drops the cached profiles of users.
+func (s *Server) invalidateUserCache(users ...uid.ID) {
+	if s.cache == nil {
+		return
+	}
+	for _, user := range users {
+		if err := s.cache.Delete(cacheUsers, user.String()); err != nil {
+			log.Printf("Error invalidating cached user %v: %v\n", user, err)
+		}
+	}
+}
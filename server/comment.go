@@ -1,7 +1,7 @@
 package server
 
 import (
-	"time"
+	"database/sql"
 
 	"github.com/discuitnet/discuit/core"
 	"github.com/discuitnet/discuit/internal/httperr"
@@ -11,7 +11,8 @@ import (
 
 // /api/posts/:postID/comments [GET]
 func (s *Server) getPostComments(w *responseWriter, r *request) error {
-	post, err := core.GetPost(r.ctx, s.db, nil, r.muxVar("postID"), r.viewer, true)
+	db := s.readDB(r)
+	post, err := core.GetPost(r.ctx, db, nil, r.muxVar("postID"), r.viewer, true)
 	if err != nil {
 		return err
 	}
@@ -25,45 +26,56 @@ func (s *Server) getPostComments(w *responseWriter, r *request) error {
 		if err != nil {
 			return err
 		}
-		comments, err := post.GetCommentReplies(r.ctx, s.db, r.viewer, parentID)
+		comments, err := post.GetCommentReplies(r.ctx, db, r.viewer, parentID)
 		if err != nil {
 			return err
 		}
 		return w.writeJSON(comments)
 	}
 
-	var (
-		nextText   = query.Get("next")
-		nextPoints int
-		nextID     *uid.ID
-	)
-	if nextText != "" {
-		if nextPoints, nextID, err = core.NextPointsIDCursor(nextText); err != nil {
-			return core.ErrInvalidFeedCursor
-		}
+	sort, err := commentSort(r, db, post)
+	if err != nil {
+		return err
 	}
+
 	var cursor *core.CommentsCursor
-	if nextID != nil {
-		cursor = new(core.CommentsCursor)
-		cursor.Upvotes = nextPoints
-		cursor.NextID = *nextID
+	if nextText := query.Get("next"); nextText != "" {
+		if cursor, err = core.ParseCommentsCursor(sort, nextText); err != nil {
+			return err
+		}
 	}
 
-	if _, err = post.GetComments(r.ctx, s.db, r.viewer, cursor); err != nil {
+	if _, err = post.GetComments(r.ctx, db, r.viewer, sort, cursor); err != nil {
 		return err
 	}
 
 	res := struct {
-		Comments []*core.Comment `json:"comments"`
-		Next     msql.NullString `json:"next"`
+		Comments []*core.Comment  `json:"comments"`
+		Next     msql.NullString  `json:"next"`
+		Sort     core.CommentSort `json:"sort"`
 	}{
 		Comments: post.Comments,
 		Next:     post.CommentsNext,
+		Sort:     sort,
 	}
 
 	return w.writeJSON(res)
 }
 
+// commentSort returns the sort of comments requested with the sort query
+// parameter, or, if there's none, the default comment sort of the community of
+// post.
+func commentSort(r *request, db *sql.DB, post *core.Post) (core.CommentSort, error) {
+	var sort core.CommentSort
+	if text := r.urlQueryParamsValue("sort"); text != "" {
+		if err := sort.UnmarshalText([]byte(text)); err != nil {
+			return sort, core.ErrInvalidCommentSort
+		}
+		return sort, nil
+	}
+	return core.GetCommunityDefaultCommentSort(r.ctx, db, post.CommunityID)
+}
+
 // /api/:commentID [GET]
 func (s *Server) getComment(w *responseWriter, r *request) error {
 	commentID, err := strToID(r.muxVar("commentID"))
@@ -79,16 +91,32 @@ func (s *Server) getComment(w *responseWriter, r *request) error {
 	return w.writeJSON(comment)
 }
 
+// /api/comments/{commentID}/revisions [GET]
+func (s *Server) getCommentRevisions(w *responseWriter, r *request) error {
+	commentID, err := strToID(r.muxVar("commentID"))
+	if err != nil {
+		return err
+	}
+
+	comment, err := core.GetComment(r.ctx, s.db, commentID, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	revs, err := comment.GetRevisions(r.ctx, s.db, r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(revs)
+}
+
 // /api/posts/:postID/comments [POST]
 func (s *Server) addComment(w *responseWriter, r *request) error {
 	if !r.loggedIn {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "add_comment_1_"+r.viewer.String(), time.Second*5, 2); err != nil {
-		return err
-	}
-	if err := s.rateLimit(r, "add_comment_2_"+r.viewer.String(), time.Hour*24, 300); err != nil {
+	if err := s.rateLimit(r, "add_comment", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -101,7 +129,7 @@ func (s *Server) addComment(w *responseWriter, r *request) error {
 	}
 
 	postID := r.muxVar("postID")
-	post, err := core.GetPost(r.ctx, s.db, nil, postID, nil, true)
+	post, err := core.GetPost(r.ctx, s.db, nil, postID, r.viewer, true)
 	if err != nil {
 		return err
 	}
@@ -126,6 +154,7 @@ func (s *Server) addComment(w *responseWriter, r *request) error {
 	// +1 your own comment.
 	comment.Vote(r.ctx, s.db, *r.viewer, true)
 
+	s.invalidateUserCache(*r.viewer)
 	return w.writeJSON(comment)
 }
 
@@ -135,7 +164,7 @@ func (s *Server) updateComment(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+	if err := s.rateLimit(r, "update_content", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -184,7 +213,7 @@ func (s *Server) deleteComment(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+	if err := s.rateLimit(r, "update_content", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -209,6 +238,7 @@ func (s *Server) deleteComment(w *responseWriter, r *request) error {
 		return err
 	}
 
+	s.invalidateUserCache(comment.AuthorID)
 	return w.writeJSON(comment)
 }
 
@@ -218,7 +248,7 @@ func (s *Server) commentVote(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimitVoting(r, *r.viewer); err != nil {
+	if err := s.rateLimit(r, "vote", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -248,5 +278,6 @@ func (s *Server) commentVote(w *responseWriter, r *request) error {
 		return err
 	}
 
+	s.invalidateUserCache(comment.AuthorID) // for the points
 	return w.writeJSON(comment)
 }
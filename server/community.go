@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -51,6 +52,7 @@ func (s *Server) createCommunity(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
 
 	return w.writeJSON(comm)
 }
@@ -81,20 +83,28 @@ func (s *Server) getCommunities(w *responseWriter, r *request) error {
 		}
 	}
 
+	var cacheKey string
+	if !r.loggedIn && search == "" {
+		cacheKey = fmt.Sprintf("%s:%s:%d", set, sort, limit)
+		if ok, err := s.writeFromCache(w, r, cacheCommunities, cacheKey); ok || err != nil {
+			return err
+		}
+	}
+
 	var comms []*core.Community
 	var err error
 
 	if search != "" { // Search communities.
-		comms, err = core.GetCommunitiesPrefix(r.ctx, s.db, search)
+		comms, err = core.GetCommunitiesPrefix(r.ctx, s.db, search, r.viewer)
 	} else {
 		switch set {
 		case core.CommunitiesSetAll, core.CommunitiesSetDefault:
-			comms, err = core.GetCommunities(r.ctx, s.db, sort, set, limit, nil)
+			comms, err = core.GetCommunities(r.ctx, s.readDB(r), sort, set, limit, nil)
 		case core.CommunitiesSetSubscribed:
 			if !r.loggedIn {
 				return errNotLoggedIn
 			}
-			comms, err = core.GetCommunities(r.ctx, s.db, sort, set, limit, r.viewer)
+			comms, err = core.GetCommunities(r.ctx, s.readDB(r), sort, set, limit, r.viewer)
 		}
 	}
 	if err != nil {
@@ -113,9 +123,12 @@ func (s *Server) getCommunities(w *responseWriter, r *request) error {
 	}
 
 	if len(comms) == 0 {
-		return w.writeString("[]")
+		comms = []*core.Community{}
 	}
 
+	if cacheKey != "" {
+		return s.writeJSONAndCache(w, r, cacheCommunities, cacheKey, comms)
+	}
 	return w.writeJSON(comms)
 }
 
@@ -129,6 +142,18 @@ func (s *Server) getCommunity(w *responseWriter, r *request) error {
 		err         error
 	)
 
+	var cacheKey string
+	if !r.loggedIn {
+		if byName {
+			cacheKey = "name:" + strings.ToLower(communityID)
+		} else {
+			cacheKey = "id:" + communityID
+		}
+		if ok, err := s.writeFromCache(w, r, cacheCommunities, cacheKey); ok || err != nil {
+			return err
+		}
+	}
+
 	if byName {
 		comm, err = core.GetCommunityByName(r.ctx, s.db, communityID, r.viewer)
 	} else {
@@ -153,6 +178,9 @@ func (s *Server) getCommunity(w *responseWriter, r *request) error {
 		return err
 	}
 
+	if cacheKey != "" {
+		return s.writeJSONAndCache(w, r, cacheCommunities, cacheKey, comm)
+	}
 	return w.writeJSON(comm)
 }
 
@@ -191,17 +219,25 @@ func (s *Server) updateCommunity(w *responseWriter, r *request) error {
 		return err
 	}
 
-	rcomm := core.Community{}
+	rcomm := core.Community{DefaultCommentSort: comm.DefaultCommentSort, PostFlairRequired: comm.PostFlairRequired, Visibility: comm.Visibility}
 	if err = r.unmarshalJSONBody(&rcomm); err != nil {
 		return err
 	}
 	comm.NSFW = rcomm.NSFW
 	comm.About = rcomm.About
 	comm.PostingRestricted = rcomm.PostingRestricted
+	comm.PostFlairRequired = rcomm.PostFlairRequired
+	comm.DefaultCommentSort = rcomm.DefaultCommentSort
+	visibilityChanged := comm.Visibility != rcomm.Visibility
+	comm.Visibility = rcomm.Visibility
 
 	if err = comm.Update(r.ctx, s.db, *r.viewer); err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
+	if visibilityChanged {
+		s.invalidateCache(cacheFeeds)
+	}
 
 	return w.writeJSON(comm)
 }
@@ -212,10 +248,7 @@ func (s *Server) joinCommunity(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "join_community_1_"+r.viewer.String(), time.Second*1, 1); err != nil {
-		return err
-	}
-	if err := s.rateLimit(r, "join_community_2_"+r.viewer.String(), time.Hour, 500); err != nil {
+	if err := s.rateLimit(r, "join_community", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -309,6 +342,7 @@ func (s *Server) addCommunityMod(w *responseWriter, r *request) error {
 	if err = core.MakeUserMod(r.ctx, s.db, comm, *r.viewer, user.ID, true); err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
 
 	mods, err := core.GetCommunityMods(r.ctx, s.db, comm.ID)
 	if err != nil {
@@ -351,6 +385,7 @@ func (s *Server) removeCommunityMod(w *responseWriter, r *request) error {
 	if err = core.MakeUserMod(r.ctx, s.db, comm, *r.viewer, user.ID, false); err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
 
 	return w.writeJSON(user)
 }
@@ -400,6 +435,7 @@ func (s *Server) addCommunityRule(w *responseWriter, r *request) error {
 	if err = comm.AddRule(r.ctx, s.db, rule.Rule, rule.Description.String, *r.viewer); err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
 
 	if err = comm.FetchRules(r.ctx, s.db); err != nil {
 		return err
@@ -454,6 +490,7 @@ func (s *Server) updateCommunityRule(w *responseWriter, r *request) error {
 	if err = rule.Update(r.ctx, s.db, *r.viewer); err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
 
 	return w.writeJSON(rule)
 }
@@ -477,6 +514,7 @@ func (s *Server) deleteCommunityRule(w *responseWriter, r *request) error {
 	if err = rule.Delete(r.ctx, s.db, *r.viewer); err != nil {
 		return err
 	}
+	s.invalidateCache(cacheCommunities)
 
 	return w.writeJSON(rule)
 }
@@ -487,10 +525,7 @@ func (s *Server) report(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "reporting_1_"+r.viewer.String(), time.Second*5, 1); err != nil {
-		return err
-	}
-	if err := s.rateLimit(r, "reporting_2_"+r.viewer.String(), time.Hour*24, 50); err != nil {
+	if err := s.rateLimit(r, "report", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -765,6 +800,7 @@ func (s *Server) handleCommunityProPic(w *responseWriter, r *request) error {
 		}
 	}
 
+	s.invalidateCache(cacheCommunities, cacheFeeds)
 	return w.writeJSON(comm)
 }
 
@@ -816,6 +852,7 @@ func (s *Server) handleCommunityBannerImage(w *responseWriter, r *request) error
 		}
 	}
 
+	s.invalidateCache(cacheCommunities, cacheFeeds)
 	return w.writeJSON(comm)
 }
 
@@ -845,7 +882,7 @@ func (s *Server) createCommunityRequest(w *responseWriter, r *request) error {
 		return w.writeJSON(items)
 	} else { // r.Method == "POST"
 
-		if err := s.rateLimit(r, "req_comm_1_"+r.viewer.String(), time.Hour*12, 5); err != nil {
+		if err := s.rateLimit(r, "request_community", r.viewer.String()); err != nil {
 			return err
 		}
 
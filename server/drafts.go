@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// /api/drafts [GET, POST]
+func (s *Server) handleDrafts(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if r.req.Method == "POST" {
+		if err := s.rateLimit(r, "create_draft", r.viewer.String()); err != nil {
+			return err
+		}
+
+		draft := &core.PostDraft{}
+		if err := r.unmarshalJSONBody(draft); err != nil {
+			return err
+		}
+		draft, err := core.CreatePostDraft(r.ctx, s.db, *r.viewer, draft)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(draft)
+	}
+
+	drafts, err := core.GetPostDrafts(r.ctx, s.db, *r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(drafts)
+}
+
+// getViewerDraft returns the draft in the URL, if it belongs to the viewer.
+func (s *Server) getViewerDraft(r *request) (*core.PostDraft, error) {
+	errNotFound := httperr.NewNotFound("draft-not-found", "Draft not found.")
+	id, err := strconv.Atoi(r.muxVar("draftId"))
+	if err != nil {
+		return nil, errNotFound
+	}
+	draft, err := core.GetPostDraft(r.ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.UserID != *r.viewer {
+		return nil, errNotFound
+	}
+	return draft, nil
+}
+
+// /api/drafts/{draftId} [GET, PUT, DELETE]
+func (s *Server) handleDraft(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	draft, err := s.getViewerDraft(r)
+	if err != nil {
+		return err
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		if err := s.rateLimit(r, "update_content", r.viewer.String()); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r.req.Body)
+		if err != nil {
+			return err
+		}
+		if err := draft.UnmarshalUpdatableFieldsJSON(data); err != nil {
+			return httperr.NewBadRequest("", "Bad JSON body.")
+		}
+		if err := draft.Update(r.ctx, s.db); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := draft.Delete(r.ctx, s.db); err != nil {
+			return err
+		}
+	}
+
+	return w.writeJSON(draft)
+}
+
+// /api/drafts/{draftId}/publish [POST]
+func (s *Server) publishDraft(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimit(r, "add_post", r.viewer.String()); err != nil {
+		return err
+	}
+
+	draft, err := s.getViewerDraft(r)
+	if err != nil {
+		return err
+	}
+
+	post, err := draft.Publish(r.ctx, s.db)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateCache(cacheFeeds)
+	s.invalidateUserCache(*r.viewer)
+	return w.writeJSON(post)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -69,7 +70,7 @@ func (s *Server) getUsersFeed(w *responseWriter, r *request) error {
 			return core.ErrInvalidFeedCursor
 		}
 	}
-	set, err := core.GetUserFeed(r.ctx, s.db, r.viewer, user.ID, query.Get("filter"), limit, next)
+	set, err := core.GetUserFeed(r.ctx, s.readDB(r), r.viewer, user.ID, query.Get("filter"), limit, next)
 	if err != nil {
 		return err
 	}
@@ -114,10 +115,14 @@ func (s *Server) feed(w *responseWriter, r *request) error {
 	}
 	var set *core.FeedResultSet
 
-	feed := query.Get("feed") // All or home or community.
+	feed := query.Get("feed") // All or home or following or community.
 	if filter == "" {
 		// Home, all and community feeds.
 		homeFeed := feed == "home"
+		following := feed == "following"
+		if following && !r.loggedIn {
+			return errNotLoggedIn
+		}
 		var cid *uid.ID
 		if communityIDText != "" {
 			c, err := strToID(communityIDText)
@@ -127,20 +132,43 @@ func (s *Server) feed(w *responseWriter, r *request) error {
 			cid = &c
 		}
 		if cid != nil {
-			homeFeed = false
+			homeFeed, following = false, false
+		}
+		var flair *int
+		if flairText := query.Get("flair"); flairText != "" {
+			id, err := strconv.Atoi(flairText)
+			if err != nil {
+				return httperr.NewBadRequest("invalid-flair-id", "Invalid flair id.")
+			}
+			flair = &id
 		}
-		set, err = core.GetFeed(r.ctx, s.db, &core.FeedOptions{
+		var cacheKey string
+		if !r.loggedIn && nextText == "" {
+			cacheKey = fmt.Sprintf("%s:%d:%s:%d:%s", feed, sort, communityIDText, limit, query.Get("flair"))
+			if ok, err := s.writeFromCache(w, r, cacheFeeds, cacheKey); ok || err != nil {
+				return err
+			}
+		}
+		set, err = core.GetFeed(r.ctx, s.readDB(r), &core.FeedOptions{
 			Sort:        sort,
 			DefaultSort: sort == s.config.DefaultFeedSort,
 			Viewer:      r.viewer,
 			Community:   cid,
 			Homefeed:    homeFeed,
+			Following:   following,
+			Flair:       flair,
 			Limit:       limit,
 			Next:        nextText,
 		})
 		if err != nil {
 			return err
 		}
+		if cacheKey != "" {
+			if !s.cacheBypassed(r) {
+				s.cacheFeedPostIDs(set)
+			}
+			return s.writeJSONAndCache(w, r, cacheFeeds, cacheKey, set)
+		}
 	} else {
 		// Modtools feeds.
 		if !r.loggedIn {
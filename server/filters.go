@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// /api/filters [GET, POST]
+func (s *Server) handleContentFilters(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if r.req.Method == "POST" {
+		if err := s.rateLimit(r, "create_filter", r.viewer.String()); err != nil {
+			return err
+		}
+
+		filter := &core.ContentFilter{}
+		if err := r.unmarshalJSONBody(filter); err != nil {
+			return err
+		}
+		filter, err := core.CreateContentFilter(r.ctx, s.db, *r.viewer, filter)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(filter)
+	}
+
+	filters, err := core.GetContentFilters(r.ctx, s.db, *r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(filters)
+}
+
+// /api/filters/{filterId} [DELETE]
+func (s *Server) deleteContentFilter(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	id, err := strconv.Atoi(r.muxVar("filterId"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid-filter-id", "Invalid filter id.")
+	}
+	if err := core.DeleteContentFilter(r.ctx, s.db, *r.viewer, id); err != nil {
+		return err
+	}
+	return w.writeString(`{"success":true}`)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// /api/communities/{communityID}/flairs [GET]
+func (s *Server) getCommunityFlairs(w *responseWriter, r *request) error {
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+
+	var t *core.FlairType // If the type param is empty, flairs of both types are returned.
+	if text := r.urlQueryParamsValue("type"); text != "" {
+		t = new(core.FlairType)
+		if err := t.UnmarshalText([]byte(text)); err != nil {
+			return err
+		}
+	}
+
+	flairs, err := core.GetCommunityFlairs(r.ctx, s.readDB(r), cid, t)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(flairs)
+}
+
+// /api/communities/{communityID}/flairs [POST]
+func (s *Server) addCommunityFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	flair := &core.Flair{}
+	if err := r.unmarshalJSONBody(flair); err != nil {
+		return err
+	}
+
+	if err := comm.AddFlair(r.ctx, s.db, flair, *r.viewer); err != nil {
+		return err
+	}
+
+	s.invalidateCache(cacheFeeds)
+	return w.writeJSON(flair)
+}
+
+// getCommunityFlair returns the flair in the URL, after checking that it
+// belongs to the community in the URL.
+func (s *Server) getCommunityFlair(r *request) (*core.Flair, error) {
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return nil, err
+	}
+
+	flairID, err := strconv.Atoi(r.muxVar("flairID"))
+	if err != nil {
+		return nil, httperr.NewNotFound("flair-not-found", "Flair not found.")
+	}
+
+	flair, err := core.GetFlair(r.ctx, s.db, flairID)
+	if err != nil {
+		return nil, err
+	}
+	if flair.CommunityID != cid {
+		return nil, httperr.NewNotFound("flair-not-found", "Flair not found.")
+	}
+	return flair, nil
+}
+
+// /api/communities/{communityID}/flairs/{flairID} [PUT]
+func (s *Server) updateCommunityFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	flair, err := s.getCommunityFlair(r)
+	if err != nil {
+		return err
+	}
+
+	form := struct {
+		Text     *string `json:"text"`
+		Color    *string `json:"color"`
+		ModsOnly *bool   `json:"modsOnly"`
+		ZIndex   *int    `json:"zIndex"`
+	}{}
+	if err := r.unmarshalJSONBody(&form); err != nil {
+		return err
+	}
+	if form.Text != nil {
+		flair.Text = *form.Text
+	}
+	if form.Color != nil {
+		flair.Color = *form.Color
+	}
+	if form.ModsOnly != nil {
+		flair.ModsOnly = *form.ModsOnly
+	}
+	if form.ZIndex != nil {
+		flair.ZIndex = *form.ZIndex
+	}
+
+	if err := flair.Update(r.ctx, s.db, *r.viewer); err != nil {
+		return err
+	}
+
+	s.invalidateCache(cacheFeeds)
+	return w.writeJSON(flair)
+}
+
+// /api/communities/{communityID}/flairs/{flairID} [DELETE]
+func (s *Server) deleteCommunityFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	flair, err := s.getCommunityFlair(r)
+	if err != nil {
+		return err
+	}
+
+	if err := flair.Delete(r.ctx, s.db, *r.viewer); err != nil {
+		return err
+	}
+
+	s.invalidateCache(cacheFeeds)
+	return w.writeJSON(flair)
+}
+
+// /api/communities/{communityID}/user_flairs/{username} [GET, PUT, DELETE]
+func (s *Server) handleUserFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn && r.req.Method != "GET" {
+		return errNotLoggedIn
+	}
+
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return err
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		form := struct {
+			FlairID int `json:"flairId"`
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		if err := core.SetUserFlair(r.ctx, s.db, cid, user.ID, &form.FlairID, *r.viewer); err != nil {
+			return err
+		}
+		s.invalidateCache(cacheFeeds)
+	case "DELETE":
+		if err := core.SetUserFlair(r.ctx, s.db, cid, user.ID, nil, *r.viewer); err != nil {
+			return err
+		}
+		s.invalidateCache(cacheFeeds)
+	}
+
+	flair, err := core.GetUserFlair(r.ctx, s.db, cid, user.ID)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(flair) // null if the user has no flair.
+}
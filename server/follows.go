@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// /api/users/{username}/follow [POST, DELETE]
+func (s *Server) handleFollow(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimit(r, "follow", r.viewer.String()); err != nil {
+		return err
+	}
+
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return err
+	}
+
+	switch r.req.Method {
+	case "POST":
+		err = core.FollowUser(r.ctx, s.db, *r.viewer, user.ID)
+	case "DELETE":
+		err = core.UnfollowUser(r.ctx, s.db, *r.viewer, user.ID)
+	default:
+		return httperr.NewBadRequest("invalid_http_method", "Unsupported HTTP method.")
+	}
+	if err != nil {
+		return err
+	}
+	s.invalidateUserCache(user.ID, *r.viewer)
+
+	// Get the user again, for the updated counts.
+	if user, err = core.GetUser(r.ctx, s.db, user.ID, r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(user)
+}
+
+// /api/users/{username}/followers [GET]
+func (s *Server) getFollowers(w *responseWriter, r *request) error {
+	return s.writeFollows(w, r, core.GetFollowers)
+}
+
+// /api/users/{username}/following [GET]
+func (s *Server) getFollowing(w *responseWriter, r *request) error {
+	return s.writeFollows(w, r, core.GetFollowing)
+}
+
+type getFollowsFunc func(ctx context.Context, db *sql.DB, user uid.ID, viewer *uid.ID, limit int, next string) (*core.FollowsResultSet, error)
+
+func (s *Server) writeFollows(w *responseWriter, r *request, get getFollowsFunc) error {
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+
+	set, err := get(r.ctx, s.readDB(r), user.ID, r.viewer, limit, query.Get("next"))
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(set)
+}
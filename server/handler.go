@@ -61,6 +61,10 @@ type request struct {
 	// Contains the url query parameter variables. Do not access directly, as
 	// this may be nil.
 	queryParams url.Values
+
+	// The rate limit group of the viewer. Do not access directly, use
+	// Server.rateLimitGroup instead.
+	rateLimitGroup *string
 }
 
 func newRequest(r *http.Request, ses *sessions.Session) *request {
@@ -6,7 +6,6 @@ import (
 	"io"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/discuitnet/discuit/core"
 	"github.com/discuitnet/discuit/internal/httperr"
@@ -62,11 +61,7 @@ func (s *Server) handleLists(w *responseWriter, r *request) error {
 			form.DisplayName = form.Name
 		}
 
-		if err := s.rateLimit(r, "list_c_1_"+r.viewer.String(), time.Second*2, 1); err != nil {
-			return err
-		}
-
-		if err := s.rateLimit(r, "list_c_2_"+r.viewer.String(), time.Hour*24, 100); err != nil {
+		if err := s.rateLimit(r, "create_list", r.viewer.String()); err != nil {
 			return err
 		}
 
@@ -128,7 +123,7 @@ func (s *Server) handeList(w *responseWriter, r *request, list *core.List) error
 	}
 
 	if r.req.Method != "GET" {
-		if err := s.rateLimit(r, "list_e_1_"+r.viewer.String(), time.Second*1, 1); err != nil {
+		if err := s.rateLimit(r, "edit_list", r.viewer.String()); err != nil {
 			return err
 		}
 	}
@@ -209,10 +204,7 @@ func (s *Server) handleListItems(w *responseWriter, r *request, list *core.List)
 	}
 
 	if r.req.Method == "POST" {
-		if err := s.rateLimit(r, "l_item_c_1_"+r.viewer.String(), time.Second, 2); err != nil {
-			return err
-		}
-		if err := s.rateLimit(r, "l_item_c_2_"+r.viewer.String(), time.Hour, 1000); err != nil {
+		if err := s.rateLimit(r, "add_list_item", r.viewer.String()); err != nil {
 			return err
 		}
 	}
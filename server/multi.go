@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// /api/users/{username}/multis [GET, POST]
+func (s *Server) handleMultis(w *responseWriter, r *request) error {
+	user, err := core.GetUserByUsername(r.ctx, s.db, strings.ToLower(r.muxVar("username")), r.viewer)
+	if err != nil {
+		return err
+	}
+	userIsViewer := r.loggedIn && user.ID == *r.viewer
+
+	if r.req.Method == "POST" {
+		// Create a new multi.
+		if !r.loggedIn {
+			return errNotLoggedIn
+		}
+		if !userIsViewer {
+			return httperr.NewForbidden("not-your-multi", "Not your multi.")
+		}
+
+		form := struct {
+			Name        string          `json:"name"`
+			DisplayName string          `json:"displayName"` // Optional field, defaults to Name.
+			Description msql.NullString `json:"description"`
+			Public      bool            `json:"public"` // Optional field, defaults to false.
+			Sort        *core.FeedSort  `json:"sort"`   // Optional field, defaults to the site's default feed sort.
+			Communities []uid.ID        `json:"communities"`
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+
+		if form.Name == "" {
+			return httperr.NewBadRequest("multi-name-empty", "Multi name cannot be empty.")
+		}
+		if form.DisplayName == "" {
+			form.DisplayName = form.Name
+		}
+		sort := s.config.DefaultFeedSort
+		if form.Sort != nil {
+			sort = *form.Sort
+		}
+
+		if err := s.rateLimit(r, "create_multi", r.viewer.String()); err != nil {
+			return err
+		}
+
+		multi, err := core.CreateMulti(r.ctx, s.db, *r.viewer, form.Name, form.DisplayName, form.Description, form.Public, sort)
+		if err != nil {
+			return err
+		}
+		if len(form.Communities) > 0 {
+			if err := multi.SetCommunities(r.ctx, s.db, form.Communities); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Viewers see only the public multis of others.
+	multis, err := core.GetUsersMultis(r.ctx, s.db, user.ID, !userIsViewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(multis)
+}
+
+// checkMultiViewable returns an error if the viewer cannot see multi.
+func checkMultiViewable(r *request, multi *core.Multi) error {
+	if !multi.Viewable(r.viewer) {
+		return httperr.NewNotFound("multi-not-found", "Multi not found.")
+	}
+	return nil
+}
+
+// [GET, PUT, DELETE]
+func (s *Server) handleMulti(w *responseWriter, r *request, multi *core.Multi) error {
+	if !r.loggedIn && r.req.Method != "GET" {
+		return errNotLoggedIn
+	}
+	if err := checkMultiViewable(r, multi); err != nil {
+		return err
+	}
+	if r.req.Method != "GET" {
+		if multi.UserID != *r.viewer {
+			return httperr.NewForbidden("not-multi-owner", "Not multi owner.")
+		}
+		if err := s.rateLimit(r, "edit_multi", r.viewer.String()); err != nil {
+			return err
+		}
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		data, err := io.ReadAll(r.req.Body)
+		if err != nil {
+			return err
+		}
+		if err := multi.UnmarshalUpdatableFieldsJSON(data); err != nil {
+			return httperr.NewBadRequest("", "Bad JSON body.")
+		}
+		form := struct {
+			Communities *[]uid.ID `json:"communities"` // If nil, the communities are not changed.
+		}{}
+		if err := json.Unmarshal(data, &form); err != nil {
+			return httperr.NewBadRequest("", "Bad JSON body.")
+		}
+		if err := multi.Update(r.ctx, s.db); err != nil {
+			return err
+		}
+		if form.Communities != nil {
+			if err := multi.SetCommunities(r.ctx, s.db, *form.Communities); err != nil {
+				return err
+			}
+		}
+	case "DELETE":
+		if err := multi.Delete(r.ctx, s.db); err != nil {
+			return err
+		}
+		s.invalidateUserCache(multi.UserID) // The multi may have been the user's home feed.
+		return w.writeJSON(multi)
+	}
+
+	if err := multi.FetchCommunities(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(multi)
+}
+
+// [GET]
+func (s *Server) getMultiFeed(w *responseWriter, r *request, multi *core.Multi) error {
+	if err := checkMultiViewable(r, multi); err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	sort := multi.Sort
+	if query.Get("sort") != "" {
+		if err := sort.UnmarshalText([]byte(query.Get("sort"))); err != nil {
+			return core.ErrInvalidFeedSort
+		}
+	}
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	nextText := query.Get("next")
+	if nextText == "null" || nextText == "undefined" {
+		nextText = ""
+	}
+
+	communities, err := multi.CommunityIDs(r.ctx, s.readDB(r))
+	if err != nil {
+		return err
+	}
+	set, err := core.GetFeed(r.ctx, s.readDB(r), &core.FeedOptions{
+		Sort:        sort,
+		Viewer:      r.viewer,
+		Communities: communities,
+		Limit:       limit,
+		Next:        nextText,
+	})
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(set)
+}
+
+func (s *Server) withMultiByName(f func(*responseWriter, *request, *core.Multi) error) handler {
+	return handler(func(w *responseWriter, r *request) error {
+		user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), nil)
+		if err != nil {
+			return err
+		}
+
+		multi, err := core.GetMultiByName(r.ctx, s.db, user.ID, r.muxVar("multiname"))
+		if err != nil {
+			return err
+		}
+
+		return f(w, r, multi)
+	})
+}
+
+func (s *Server) withMultiByID(f func(*responseWriter, *request, *core.Multi) error) handler {
+	return handler(func(w *responseWriter, r *request) error {
+		multiID, err := strconv.Atoi(r.muxVar("multiId"))
+		if err != nil {
+			return httperr.NewBadRequest("invalid-multi-id", "Invalid multi id.")
+		}
+
+		multi, err := core.GetMulti(r.ctx, s.db, multiID)
+		if err != nil {
+			return err
+		}
+
+		return f(w, r, multi)
+	})
+}
@@ -3,8 +3,8 @@ package server
 import (
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/discuitnet/discuit/core"
 	"github.com/discuitnet/discuit/internal/httperr"
@@ -17,10 +17,7 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "add_post_1_"+r.viewer.String(), time.Second*10, 1); err != nil {
-		return err
-	}
-	if err := s.rateLimit(r, "add_post_2_"+r.viewer.String(), time.Hour*24, 70); err != nil {
+	if err := s.rateLimit(r, "add_post", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -33,6 +30,12 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		UserGroup core.UserGroup      `json:"userGroup"`
 		ImageId   string              `json:"imageId"`
 		Images    []*core.ImageUpload `json:"images"`
+		FlairID   *int                `json:"flairId"`
+		Poll      *core.NewPoll       `json:"poll"`
+
+		// If true, the link is posted even if it was posted in the community
+		// recently.
+		IgnoreDuplicateLink bool `json:"ignoreDuplicateLink"`
 	}{
 		PostType:  core.PostTypeText,
 		UserGroup: core.UserGroupNormal,
@@ -54,7 +57,7 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 	var post *core.Post
 	switch req.PostType {
 	case core.PostTypeText:
-		post, err = core.CreateTextPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.Body)
+		post, err = core.CreateTextPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.Body, req.FlairID)
 	case core.PostTypeImage:
 		var images []*core.ImageUpload
 		if req.Images != nil {
@@ -71,9 +74,16 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		if len(images) > s.config.MaxImagesPerPost {
 			return httperr.NewBadRequest("too-many-images", "Maximum images count exceeded.")
 		}
-		post, err = core.CreateImagePost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, images)
+		post, err = core.CreateImagePost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, images, req.FlairID)
 	case core.PostTypeLink:
-		post, err = core.CreateLinkPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.URL)
+		if !req.IgnoreDuplicateLink {
+			if err := core.CheckDuplicateLink(r.ctx, s.db, comm.ID, req.URL); err != nil {
+				return err
+			}
+		}
+		post, err = core.CreateLinkPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.URL, req.FlairID)
+	case core.PostTypePoll:
+		post, err = core.CreatePollPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.Body, req.Poll, req.FlairID)
 	default:
 		return httperr.NewBadRequest("invalid_post_type", "Invalid post type.")
 	}
@@ -89,30 +99,38 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 
 	// +1 your own post.
 	post.Vote(r.ctx, s.db, *r.viewer, true)
+
+	s.invalidateCache(cacheFeeds)
+	s.invalidateUserCache(*r.viewer)
 	return w.writeJSON(post)
 }
 
 // /api/posts/:postID [GET]
 func (s *Server) getPost(w *responseWriter, r *request) error {
 	postID := r.muxVar("postID") // public post id
-	post, err := core.GetPost(r.ctx, s.db, nil, postID, r.viewer, true)
+	db := s.readDB(r)
+	post, err := core.GetPost(r.ctx, db, nil, postID, r.viewer, true)
 	if err != nil {
 		return err
 	}
 
-	if _, err = post.GetComments(r.ctx, s.db, r.viewer, nil); err != nil {
+	sort, err := commentSort(r, db, post)
+	if err != nil {
+		return err
+	}
+	if _, err = post.GetComments(r.ctx, db, r.viewer, sort, nil); err != nil {
 		return err
 	}
 
 	if fetchCommunity := r.urlQueryParamsValue("fetchCommunity"); fetchCommunity == "" || fetchCommunity == "true" {
-		comm, err := core.GetCommunityByID(r.ctx, s.db, post.CommunityID, r.viewer)
+		comm, err := core.GetCommunityByID(r.ctx, db, post.CommunityID, r.viewer)
 		if err != nil {
 			return err
 		}
-		if err = comm.FetchRules(r.ctx, s.db); err != nil {
+		if err = comm.FetchRules(r.ctx, db); err != nil {
 			return err
 		}
-		if err = comm.PopulateMods(r.ctx, s.db); err != nil {
+		if err = comm.PopulateMods(r.ctx, db); err != nil {
 			return err
 		}
 		post.Community = comm
@@ -121,6 +139,20 @@ func (s *Server) getPost(w *responseWriter, r *request) error {
 	return w.writeJSON(post)
 }
 
+// /api/posts/:postID/revisions [GET]
+func (s *Server) getPostRevisions(w *responseWriter, r *request) error {
+	post, err := core.GetPost(r.ctx, s.db, nil, r.muxVar("postID"), r.viewer, true)
+	if err != nil {
+		return err
+	}
+
+	revs, err := post.GetRevisions(r.ctx, s.db, r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(revs)
+}
+
 // /api/posts/:postID [PUT]
 func (s *Server) updatePost(w *responseWriter, r *request) error {
 	postID := r.muxVar("postID") // public post id
@@ -128,7 +160,7 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+	if err := s.rateLimit(r, "update_content", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -137,6 +169,8 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 		return err
 	}
 
+	invalidateFeeds := false // Whether the feeds are changed, not just this post.
+
 	query := r.urlQueryParams()
 	action := query.Get("action")
 	if action == "" {
@@ -150,7 +184,7 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 
 		// override updatable fields
 		needSaving := false
-		if post.Type == core.PostTypeText && !post.DeletedContent {
+		if (post.Type == core.PostTypeText || post.Type == core.PostTypePoll) && !post.DeletedContent {
 			if post.Body != tpost.Body {
 				needSaving = true
 				post.Body = tpost.Body
@@ -165,10 +199,12 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 			if err = post.Save(r.ctx, s.db, *r.viewer); err != nil {
 				return err
 			}
+			s.invalidatePostFeeds(post.ID)
 		}
 	} else {
 		switch action {
 		case "lock", "unlock":
+			invalidateFeeds = true
 			var as core.UserGroup
 			if err = as.UnmarshalText([]byte(query.Get("lockAs"))); err != nil {
 				return err
@@ -190,6 +226,7 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 				return err
 			}
 		case "pin", "unpin":
+			invalidateFeeds = true
 			siteWide := strings.ToLower(query.Get("siteWide")) == "true"
 			if err = post.Pin(r.ctx, s.db, *r.viewer, siteWide, action == "unpin", false); err != nil {
 				return err
@@ -198,11 +235,27 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 			if err := post.AnnounceToAllUsers(r.ctx, s.db, *r.viewer); err != nil {
 				return err
 			}
+		case "changeFlair":
+			var flair *int // If the flairId param is empty, the flair is removed.
+			if text := query.Get("flairId"); text != "" {
+				id, err := strconv.Atoi(text)
+				if err != nil {
+					return httperr.NewBadRequest("invalid-flair-id", "Invalid flair id.")
+				}
+				flair = &id
+			}
+			if err := post.SetFlair(r.ctx, s.db, *r.viewer, flair); err != nil {
+				return err
+			}
+			invalidateFeeds = true // For the feeds of flairs.
 		default:
 			return httperr.NewBadRequest("invalid_action", "Unsupported action.")
 		}
 	}
 
+	if invalidateFeeds {
+		s.invalidateCache(cacheFeeds)
+	}
 	return w.writeJSON(post)
 }
 
@@ -213,7 +266,7 @@ func (s *Server) deletePost(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+	if err := s.rateLimit(r, "update_content", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -239,6 +292,8 @@ func (s *Server) deletePost(w *responseWriter, r *request) error {
 		return err
 	}
 
+	s.invalidateCache(cacheFeeds)
+	s.invalidateUserCache(post.AuthorID)
 	return w.writeJSON(post)
 }
 
@@ -248,7 +303,7 @@ func (s *Server) postVote(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimitVoting(r, *r.viewer); err != nil {
+	if err := s.rateLimit(r, "vote", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -278,6 +333,114 @@ func (s *Server) postVote(w *responseWriter, r *request) error {
 		return err
 	}
 
+	// The feeds with this post are invalidated once the vote counts are
+	// updated, by the vote queue flush.
+	s.invalidateUserCache(post.AuthorID)
+	return w.writeJSON(post)
+}
+
+// /api/posts/{postID}/poll_votes [POST]
+func (s *Server) pollVote(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimit(r, "vote", r.viewer.String()); err != nil {
+		return err
+	}
+
+	req := struct {
+		Options []int `json:"options"` // The ids of the selected options.
+	}{}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+
+	post, err := core.GetPost(r.ctx, s.db, nil, r.muxVar("postID"), r.viewer, true)
+	if err != nil {
+		return err
+	}
+
+	if err := post.VotePoll(r.ctx, s.db, *r.viewer, req.Options); err != nil {
+		return err
+	}
+
+	s.invalidatePostFeeds(post.ID)
+
+	return w.writeJSON(post)
+}
+
+// /api/posts/{postID}/other_discussions [GET]
+func (s *Server) getOtherDiscussions(w *responseWriter, r *request) error {
+	db := s.readDB(r)
+	post, err := core.GetPost(r.ctx, db, nil, r.muxVar("postID"), r.viewer, true)
+	if err != nil {
+		return err
+	}
+
+	posts, err := post.GetOtherDiscussions(r.ctx, db, r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(posts)
+}
+
+// /api/posts/{postID}/crossposts [GET, POST]
+func (s *Server) handleCrossposts(w *responseWriter, r *request) error {
+	original, err := core.GetPost(r.ctx, s.db, nil, r.muxVar("postID"), r.viewer, true)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method != "POST" {
+		posts, err := original.GetCrossposts(r.ctx, s.db, r.viewer)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(posts)
+	}
+
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimit(r, "add_post", r.viewer.String()); err != nil {
+		return err
+	}
+
+	req := struct {
+		Community string         `json:"community"` // The community to crosspost to.
+		Title     string         `json:"title"`     // Optional.
+		UserGroup core.UserGroup `json:"userGroup"`
+		FlairID   *int           `json:"flairId"`
+	}{
+		UserGroup: core.UserGroupNormal,
+	}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+
+	comm, err := core.GetCommunityByName(r.ctx, s.db, req.Community, nil)
+	if err != nil {
+		return err
+	}
+
+	post, err := core.CreateCrosspost(r.ctx, s.db, *r.viewer, comm.ID, original, req.Title, req.FlairID)
+	if err != nil {
+		return err
+	}
+
+	if req.UserGroup != core.UserGroupNormal {
+		if err := post.ChangeUserGroup(r.ctx, s.db, *r.viewer, req.UserGroup); err != nil {
+			return err
+		}
+	}
+
+	// +1 your own post.
+	post.Vote(r.ctx, s.db, *r.viewer, true)
+
+	s.invalidateCache(cacheFeeds)
+	s.invalidateUserCache(*r.viewer)
 	return w.writeJSON(post)
 }
 
@@ -290,10 +453,7 @@ func (s *Server) imageUpload(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "uploads_1_"+r.viewer.String(), time.Second*1, 5); err != nil {
-		return err
-	}
-	if err := s.rateLimit(r, "uploads_2_"+r.viewer.String(), time.Hour*24, 80); err != nil {
+	if err := s.rateLimit(r, "upload_image", r.viewer.String()); err != nil {
 		return err
 	}
 
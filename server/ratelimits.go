@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/ratelimits"
+)
+
+// The user groups of rate limit policies. Users who belong to more than one
+// are in the first of these in order.
+const (
+	rateLimitGroupMods    = "mods"    // Moderators of any community.
+	rateLimitGroupTrusted = "trusted" // Users with config.RateLimitTrustedPoints.
+	rateLimitGroupNew     = "new"     // Users younger than config.RateLimitNewUserAge.
+)
+
+// defaultRateLimits are the rate limit policies, by name, unless overridden
+// by config.RateLimits.
+var defaultRateLimits = map[string]*ratelimits.Policy{
+	"add_post":             rules(time.Second*10, 1, time.Hour*24, 70),
+	"add_comment":          rules(time.Second*5, 2, time.Hour*24, 300),
+	"update_content":       rules(time.Second, 1, time.Hour*24, 2000),
+	"vote":                 rules(time.Second, 4, time.Hour*24, 2000),
+	"upload_image":         rules(time.Second, 5, time.Hour*24, 80),
+	"join_community":       rules(time.Second, 1, time.Hour, 500),
+	"report":               rules(time.Second*5, 1, time.Hour*24, 50),
+	"appeal_ban":           rules(time.Minute, 1, time.Hour*24, 10),
+	"join_request":         rules(time.Minute, 1, time.Hour*24, 20),
+	"request_community":    rules(time.Hour*12, 5),
+	"create_draft":         rules(time.Second*2, 1, time.Hour*24, 100),
+	"create_filter":        rules(time.Second, 2, time.Hour*24, 200),
+	"follow":               rules(time.Second, 2, time.Hour*24, 500),
+	"create_list":          rules(time.Second*2, 1, time.Hour*24, 100),
+	"edit_list":            rules(time.Second, 1),
+	"add_list_item":        rules(time.Second, 2, time.Hour, 1000),
+	"create_multi":         rules(time.Second*2, 1, time.Hour*24, 50),
+	"edit_multi":           rules(time.Second, 1),
+	"link_info":            rules(time.Hour, 1000),
+	"analytics":            rules(time.Second, 2),
+	"delete_account":       rules(time.Second*5, 1),
+	"login":                rules(time.Second, 10),
+	"login_user":           rules(time.Hour, 20),
+	"signup":               rules(time.Minute, 2, time.Hour*6, 10),
+	"update_notifications": rules(time.Second, 5),
+	"update_settings":      rules(time.Second, 5, time.Hour, 100),
+}
+
+// rules returns a policy of the pairs of intervals and limits in args.
+func rules(args ...any) *ratelimits.Policy {
+	p := &ratelimits.Policy{}
+	for i := 0; i < len(args); i += 2 {
+		p.Rules = append(p.Rules, ratelimits.Rule{Interval: args[i].(time.Duration), Limit: args[i+1].(int)})
+	}
+	return p
+}
+
+// newRateLimiter returns the rate limiter of s, with the default policies
+// overridden by those in the config.
+func (s *Server) newRateLimiter() (*ratelimits.Limiter, error) {
+	policies := make(map[string]*ratelimits.Policy, len(defaultRateLimits))
+	for name, policy := range defaultRateLimits {
+		policies[name] = policy
+	}
+	for name, override := range s.config.RateLimits {
+		policy, ok := policies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rate limit policy %s", name)
+		}
+		merged := &ratelimits.Policy{Rules: policy.Rules, Groups: make(map[string][]ratelimits.Rule)}
+		if len(override.Rules) > 0 {
+			merged.Rules = override.Rules
+		}
+		for group, rules := range policy.Groups {
+			merged.Groups[group] = rules
+		}
+		for group, rules := range override.Groups {
+			merged.Groups[group] = rules
+		}
+		policies[name] = merged
+	}
+
+	var backend ratelimits.Backend
+	switch s.config.RateLimitBackend {
+	case "", "redis":
+		backend = ratelimits.NewRedisBackend(s.redisPool)
+	case "memory":
+		backend = ratelimits.NewMemoryBackend()
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %s", s.config.RateLimitBackend)
+	}
+	return ratelimits.NewLimiter(backend, policies)
+}
+
+// rateLimitError is the error returned by rateLimit when a request is
+// denied.
+type rateLimitError struct {
+	res ratelimits.Result
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited (retry after %v)", e.res.RetryAfter)
+}
+
+// setHeaders sets the Retry-After and RateLimit-* headers of the response.
+func (e *rateLimitError) setHeaders(h http.Header) {
+	seconds := func(d time.Duration) string {
+		return strconv.Itoa(int(math.Ceil(d.Seconds())))
+	}
+	h.Set("Retry-After", seconds(e.res.RetryAfter))
+	h.Set("RateLimit-Limit", strconv.Itoa(e.res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(e.res.Remaining))
+	h.Set("RateLimit-Reset", seconds(e.res.Reset))
+}
+
+func (e *rateLimitError) httpError() *httperr.Error {
+	return &httperr.Error{
+		HTTPStatus: http.StatusTooManyRequests,
+		Code:       "too_many_requests",
+		Message:    "Too many requests.",
+	}
+}
+
+// rateLimitGroup returns the rate limit group of the viewer, if any.
+func (s *Server) rateLimitGroup(r *request) (string, error) {
+	if !r.loggedIn {
+		return "", nil
+	}
+	if r.rateLimitGroup != nil {
+		return *r.rateLimitGroup, nil
+	}
+
+	user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+	if err != nil {
+		return "", err
+	}
+	group := ""
+	if is, err := core.UserModsAnyCommunity(r.ctx, s.db, user.ID); err != nil {
+		return "", err
+	} else if is {
+		group = rateLimitGroupMods
+	} else if s.config.RateLimitTrustedPoints > 0 && user.Points >= s.config.RateLimitTrustedPoints {
+		group = rateLimitGroupTrusted
+	} else if time.Since(user.CreatedAt) < time.Duration(s.config.RateLimitNewUserAge)*time.Hour {
+		group = rateLimitGroupNew
+	}
+	r.rateLimitGroup = &group
+	return group, nil
+}
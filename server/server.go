@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -21,11 +22,14 @@ import (
 
 	"github.com/discuitnet/discuit/config"
 	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/cache"
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/httputil"
 	"github.com/discuitnet/discuit/internal/images"
 	"github.com/discuitnet/discuit/internal/ratelimits"
 	"github.com/discuitnet/discuit/internal/sessions"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/taskrunner"
 	"github.com/discuitnet/discuit/internal/uid"
 	"github.com/discuitnet/discuit/internal/utils"
 	"github.com/gomodule/redigo/redis"
@@ -50,6 +54,11 @@ type Server struct {
 	db        *sql.DB
 	redisPool *redis.Pool
 
+	// Response cache. Nil if caching is disabled.
+	cache *cache.Cache
+
+	rateLimiter *ratelimits.Limiter
+
 	// for /api routes
 	router *mux.Router
 
@@ -68,6 +77,13 @@ type Server struct {
 	http500LoggerFile *os.File
 
 	webPushVAPIDKeys core.VAPIDKeys
+
+	// The background task runner of the program, if any. Used by admin
+	// actions to control tasks without waiting for the next sync.
+	taskRunner *taskrunner.TaskRunner
+
+	// Read replicas of db, if any. See readDB.
+	replicas *msql.ReplicaSet
 }
 
 func New(db *sql.DB, conf *config.Config) (*Server, error) {
@@ -94,6 +110,14 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 		reactIndex:   "index.html",
 	}
 
+	if !conf.CacheDisabled {
+		s.cache = cache.New(s.redisPool, "cache:")
+	}
+
+	if s.rateLimiter, err = s.newRateLimiter(); err != nil {
+		return nil, err
+	}
+
 	if keys, err := core.GetApplicationVAPIDKeys(context.Background(), db); err != nil {
 		log.Printf("Error generating vapid keys: %v (you might want to run migrations)\n", err)
 	} else {
@@ -114,6 +138,9 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/users/{username}", s.withHandler(s.getUser)).Methods("GET")
 	r.Handle("/api/users/{username}", s.withHandler(s.deleteUser)).Methods("DELETE")
 	r.Handle("/api/users/{username}/feed", s.withHandler(s.getUsersFeed)).Methods("GET")
+	r.Handle("/api/users/{username}/follow", s.withHandler(s.handleFollow)).Methods("POST", "DELETE")
+	r.Handle("/api/users/{username}/followers", s.withHandler(s.getFollowers)).Methods("GET")
+	r.Handle("/api/users/{username}/following", s.withHandler(s.getFollowing)).Methods("GET")
 	r.Handle("/api/users/{username}/pro_pic", s.withHandler(s.handleUserProPic)).Methods("POST", "DELETE")
 	r.Handle("/api/users/{username}/badges", s.withHandler(s.addBadge)).Methods("POST")
 	r.Handle("/api/users/{username}/badges/{badgeId}", s.withHandler(s.deleteBadge)).Methods("DELETE")
@@ -128,17 +155,34 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/lists/{listId}/items", s.withHandler(s.withListByID(s.handleListItems))).Methods("GET", "POST", "DELETE")
 	r.Handle("/api/lists/{listId}/items/{itemId}", s.withHandler(s.withListByID(s.deleteListItem))).Methods("DELETE")
 
+	r.Handle("/api/users/{username}/multis", s.withHandler(s.handleMultis)).Methods("GET", "POST")
+	r.Handle("/api/users/{username}/multis/{multiname}", s.withHandler(s.withMultiByName(s.handleMulti))).Methods("GET", "PUT", "DELETE")
+	r.Handle("/api/users/{username}/multis/{multiname}/feed", s.withHandler(s.withMultiByName(s.getMultiFeed))).Methods("GET")
+	r.Handle("/api/multis/{multiId}", s.withHandler(s.withMultiByID(s.handleMulti))).Methods("GET", "PUT", "DELETE")
+	r.Handle("/api/multis/{multiId}/feed", s.withHandler(s.withMultiByID(s.getMultiFeed))).Methods("GET")
+
 	r.Handle("/api/mutes", s.withHandler(s.handleMutes)).Methods("GET", "POST", "DELETE")
 	r.Handle("/api/mutes/users/{mutedUserID}", s.withHandler(s.deleteUserMute)).Methods("DELETE")
 	r.Handle("/api/mutes/communities/{mutedCommunityID}", s.withHandler(s.deleteCommunityMute)).Methods("DELETE")
 	r.Handle("/api/mutes/{muteID}", s.withHandler(s.deleteMute)).Methods("DELETE")
 
+	r.Handle("/api/filters", s.withHandler(s.handleContentFilters)).Methods("GET", "POST")
+	r.Handle("/api/filters/{filterId}", s.withHandler(s.deleteContentFilter)).Methods("DELETE")
+
+	r.Handle("/api/drafts", s.withHandler(s.handleDrafts)).Methods("GET", "POST")
+	r.Handle("/api/drafts/{draftId}", s.withHandler(s.handleDraft)).Methods("GET", "PUT", "DELETE")
+	r.Handle("/api/drafts/{draftId}/publish", s.withHandler(s.publishDraft)).Methods("POST")
+
 	r.Handle("/api/posts", s.withHandler(s.feed)).Methods("GET")
 	r.Handle("/api/posts", s.withHandler(s.addPost)).Methods("POST")
 	r.Handle("/api/posts/{postID}", s.withHandler(s.getPost)).Methods("GET")
 	r.Handle("/api/posts/{postID}", s.withHandler(s.updatePost)).Methods("PUT")
 	r.Handle("/api/posts/{postID}", s.withHandler(s.deletePost)).Methods("DELETE")
+	r.Handle("/api/posts/{postID}/revisions", s.withHandler(s.getPostRevisions)).Methods("GET")
 	r.Handle("/api/_postVote", s.withHandler(s.postVote)).Methods("POST")
+	r.Handle("/api/posts/{postID}/poll_votes", s.withHandler(s.pollVote)).Methods("POST")
+	r.Handle("/api/posts/{postID}/crossposts", s.withHandler(s.handleCrossposts)).Methods("GET", "POST")
+	r.Handle("/api/posts/{postID}/other_discussions", s.withHandler(s.getOtherDiscussions)).Methods("GET")
 	r.Handle("/api/_uploads", s.withHandler(s.imageUpload)).Methods("POST")
 
 	r.Handle("/api/posts/{postID}/comments", s.withHandler(s.getPostComments)).Methods("GET")
@@ -146,6 +190,7 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/posts/{postID}/comments/{commentID}", s.withHandler(s.updateComment)).Methods("PUT")
 	r.Handle("/api/posts/{postID}/comments/{commentID}", s.withHandler(s.deleteComment)).Methods("DELETE")
 	r.Handle("/api/comments/{commentID}", s.withHandler(s.getComment)).Methods("GET")
+	r.Handle("/api/comments/{commentID}/revisions", s.withHandler(s.getCommentRevisions)).Methods("GET")
 	r.Handle("/api/_commentVote", s.withHandler(s.commentVote)).Methods("POST")
 
 	r.Handle("/api/communities", s.withHandler(s.getCommunities)).Methods("GET")
@@ -159,6 +204,11 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.getCommunityRule)).Methods("GET")
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.updateCommunityRule)).Methods("PUT")
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.deleteCommunityRule)).Methods("DELETE")
+	r.Handle("/api/communities/{communityID}/flairs", s.withHandler(s.getCommunityFlairs)).Methods("GET")
+	r.Handle("/api/communities/{communityID}/flairs", s.withHandler(s.addCommunityFlair)).Methods("POST")
+	r.Handle("/api/communities/{communityID}/flairs/{flairID}", s.withHandler(s.updateCommunityFlair)).Methods("PUT")
+	r.Handle("/api/communities/{communityID}/flairs/{flairID}", s.withHandler(s.deleteCommunityFlair)).Methods("DELETE")
+	r.Handle("/api/communities/{communityID}/user_flairs/{username}", s.withHandler(s.handleUserFlair)).Methods("GET", "PUT", "DELETE")
 
 	r.Handle("/api/communities/{communityID}/mods", s.withHandler(s.getCommunityMods)).Methods("GET")
 	r.Handle("/api/communities/{communityID}/mods", s.withHandler(s.addCommunityMod)).Methods("POST")
@@ -168,6 +218,16 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/communities/{communityID}/reports/{reportID}", s.withHandler(s.deleteReport)).Methods("DELETE")
 
 	r.Handle("/api/communities/{communityID}/banned", s.withHandler(s.handleCommunityBanned)).Methods("GET", "POST", "DELETE")
+	r.Handle("/api/communities/{communityID}/appeals", s.withHandler(s.handleCommunityBanAppeals)).Methods("GET", "POST")
+	r.Handle("/api/communities/{communityID}/approved", s.withHandler(s.handleCommunityApprovedUsers)).Methods("GET", "POST", "DELETE")
+	r.Handle("/api/communities/{communityID}/join_requests", s.withHandler(s.handleCommunityJoinRequests)).Methods("GET", "POST")
+	r.Handle("/api/communities/{communityID}/invites", s.withHandler(s.handleCommunityInvites)).Methods("GET", "POST")
+	r.Handle("/api/communities/{communityID}/invites/{inviteID}", s.withHandler(s.deleteCommunityInvite)).Methods("DELETE")
+
+	r.Handle("/api/_appeal", s.withHandler(s.appealSiteBan)).Methods("POST")
+	r.Handle("/api/appeals/{appealId}", s.withHandler(s.reviewBanAppeal)).Methods("PUT")
+	r.Handle("/api/join_requests/{requestID}", s.withHandler(s.reviewJoinRequest)).Methods("PUT")
+	r.Handle("/api/invites/{code}", s.withHandler(s.acceptCommunityInvite)).Methods("POST")
 
 	r.Handle("/api/communities/{communityID}/pro_pic", s.withHandler(s.handleCommunityProPic)).Methods("POST", "DELETE")
 	r.Handle("/api/communities/{communityID}/banner_image", s.withHandler(s.handleCommunityBannerImage)).Methods("POST", "DELETE")
@@ -188,6 +248,13 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/_settings", s.withHandler(s.updateUserSettings)).Methods("POST")
 
 	r.Handle("/api/_admin", s.withHandler(s.adminActions)).Methods("POST")
+	r.Handle("/api/_admin/tasks", s.withHandler(s.getBackgroundTasks)).Methods("GET")
+	r.Handle("/api/_admin/ip_bans", s.withHandler(s.handleIPBans)).Methods("GET", "POST")
+	r.Handle("/api/_admin/ip_bans/{banId}", s.withHandler(s.deleteIPBan)).Methods("DELETE")
+	r.Handle("/api/_admin/users/{username}/alts", s.withHandler(s.getAltAccounts)).Methods("GET")
+	r.Handle("/api/_admin/users/{username}/suspensions", s.withHandler(s.getUserSuspensions)).Methods("GET")
+	r.Handle("/api/_admin/vote_flags", s.withHandler(s.handleVoteFlags)).Methods("GET", "POST")
+	r.Handle("/api/_admin/appeals", s.withHandler(s.getSiteBanAppeals)).Methods("GET")
 	r.Handle("/api/users", s.withHandler(s.getUsers)).Methods("GET")
 	r.Handle("/api/comments", s.withHandler(s.getComments)).Methods("GET")
 
@@ -262,6 +329,33 @@ func (s *Server) closeLoggers() {
 	s.http500LoggerFile.Close()
 }
 
+// SetTaskRunner lets admin actions control the background tasks in tr
+// directly. Without it, such actions only take effect when the runner syncs
+// with the database.
+func (s *Server) SetTaskRunner(tr *taskrunner.TaskRunner) {
+	s.taskRunner = tr
+}
+
+// SetReadReplicas makes some of the read-heavy API routes read from the
+// replicas in rs (see readDB).
+func (s *Server) SetReadReplicas(rs *msql.ReplicaSet) {
+	s.replicas = rs
+}
+
+// readDB returns the database to use for read-only queries that can tolerate
+// slightly stale data. That's one of the read replicas, if any are configured
+// and keeping up with the primary, and the primary otherwise.
+func (s *Server) readDB(r *request) *sql.DB {
+	if s.replicas == nil {
+		return s.db
+	}
+	key := ""
+	if r.loggedIn {
+		key = r.viewer.String()
+	}
+	return s.replicas.ReadDB(key)
+}
+
 // Close closes the server.
 func (s *Server) Close() error {
 	s.closeLoggers()
@@ -325,7 +419,19 @@ func (s *Server) withHandler(h handler) http.Handler {
 			}
 		}
 
-		if err = h(&responseWriter{w: w}, newRequest(r, ses)); err != nil {
+		req := newRequest(r, ses)
+		err = h(&responseWriter{w: w}, req)
+		if s.replicas != nil && r.Method != "GET" && req.loggedIn {
+			// Keep the user's reads on the primary for a while so that they
+			// see their own writes.
+			s.replicas.NoteWrite(req.viewer.String())
+		}
+		if err != nil {
+			var rlErr *rateLimitError
+			if errors.As(err, &rlErr) {
+				rlErr.setHeaders(w.Header())
+				err = rlErr.httpError()
+			}
 			s.writeError(w, r, err)
 			return
 		}
@@ -958,8 +1064,8 @@ func userSessionsSetRedisKey(username string) string {
 
 // loginUser persists the authenticated user onto the session.
 func (s *Server) loginUser(u *core.User, ses *sessions.Session, w http.ResponseWriter, r *http.Request) error {
-	if u.Banned {
-		return httperr.NewForbidden("account_suspended", "User account suspended.")
+	if err := u.CheckSuspension(r.Context(), s.db); err != nil {
+		return err
 	}
 
 	conn := s.redisPool.Get()
@@ -1018,10 +1124,11 @@ func strToID(s string) (id uid.ID, err error) {
 	return
 }
 
-// rateLimit returns an error if the rate limit is reached for the bucket or if
-// some other error occurs in the process of checking it. If rateLimit returns
-// a non-nil error, the handler should return immediately.
-func (s *Server) rateLimit(r *request, bucketID string, interval time.Duration, maxTokens int) error {
+// rateLimit returns an error if the rate limit policy (see defaultRateLimits)
+// is exceeded by key (the viewer's id, an IP address, etc.), or if some other
+// error occurs in the process of checking it. If rateLimit returns a non-nil
+// error, the handler should return immediately.
+func (s *Server) rateLimit(r *request, policy, key string) error {
 	if s.config.DisableRateLimits {
 		return nil // skip rate limits
 	}
@@ -1033,36 +1140,22 @@ func (s *Server) rateLimit(r *request, bucketID string, interval time.Duration,
 		}
 	}
 
-	conn, err := s.redisPool.Dial()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	if ok, err := ratelimits.Limit(conn, bucketID, interval, maxTokens); err != nil {
-		return err
-	} else if !ok {
-		return &httperr.Error{
-			HTTPStatus: http.StatusTooManyRequests,
-			Code:       "",
-			Message:    "",
+	group := ""
+	if p := s.rateLimiter.Policy(policy); p != nil && len(p.Groups) > 0 {
+		var err error
+		if group, err = s.rateLimitGroup(r); err != nil {
+			return err
 		}
 	}
-	return nil
-}
 
-func (s *Server) rateLimitUpdateContent(r *request, userID uid.ID) error {
-	if err := s.rateLimit(r, "update_stuff_1_"+userID.String(), time.Second*1, 1); err != nil {
+	res, err := s.rateLimiter.Limit(r.ctx, policy, group, key)
+	if err != nil {
 		return err
 	}
-	return s.rateLimit(r, "update_stuff_2_"+userID.String(), time.Hour*24, 2000)
-}
-
-func (s *Server) rateLimitVoting(r *request, userID uid.ID) error {
-	if err := s.rateLimit(r, "voting_1_"+userID.String(), time.Second, 4); err != nil {
-		return err
+	if !res.Allowed {
+		return &rateLimitError{res: res}
 	}
-	return s.rateLimit(r, "voting_2_"+userID.String(), time.Hour*24, 2000)
+	return nil
 }
 
 // /api/_get_link_info [GET]
@@ -1071,32 +1164,23 @@ func (s *Server) getLinkInfo(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "get_link_info_"+r.viewer.String(), time.Hour, 1000); err != nil {
+	if err := s.rateLimit(r, "link_info", r.viewer.String()); err != nil {
 		return err
 	}
 
-	url := r.urlQueryParamsValue("url")
-	res, err := httputil.Get(url)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	title, err := httputil.ExtractOpenGraphTitle(res.Body)
+	preview, err := core.GetLinkPreview(r.ctx, s.db, r.urlQueryParamsValue("url"))
 	if err != nil {
+		if httputil.IsFetchError(err) {
+			return httperr.NewBadRequest("link-fetch-failed", "Could not fetch the link.")
+		}
 		return err
 	}
-
-	out := struct {
-		Title string `json:"title"`
-	}{Title: title}
-
-	return w.writeJSON(out)
+	return w.writeJSON(preview)
 }
 
 func (s *Server) handleAnalytics(w *responseWriter, r *request) error {
 	ip := httputil.GetIP(r.req)
-	if err := s.rateLimit(r, "analytics_ip_1_"+ip, time.Second*1, 2); err != nil {
+	if err := s.rateLimit(r, "analytics", ip); err != nil {
 		return err
 	}
 
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/SherClockHolmes/webpush-go"
 	"github.com/discuitnet/discuit/core"
@@ -21,6 +20,16 @@ import (
 // /api/users/{username} [GET]
 func (s *Server) getUser(w *responseWriter, r *request) error {
 	username := r.muxVar("username")
+
+	cacheable := !r.loggedIn && r.urlQueryParamsValue("adminsView") != "true"
+	if cacheable {
+		if id, ok := s.cacheGet(r, cacheUsernames, strings.ToLower(username)); ok {
+			if ok, err := s.writeFromCache(w, r, cacheUsers, string(id)); ok || err != nil {
+				return err
+			}
+		}
+	}
+
 	user, err := core.GetUserByUsername(r.ctx, s.db, username, r.viewer)
 	if err != nil {
 		return err
@@ -50,6 +59,10 @@ func (s *Server) getUser(w *responseWriter, r *request) error {
 		return err
 	}
 
+	if cacheable {
+		s.cacheSet(cacheUsernames, strings.ToLower(username), []byte(user.ID.String()))
+		return s.writeJSONAndCache(w, r, cacheUsers, user.ID.String(), user)
+	}
 	return w.writeJSON(user)
 }
 
@@ -73,7 +86,7 @@ func (s *Server) deleteUser(w *responseWriter, r *request) error {
 	// user account.
 	username := r.muxVar("username")
 
-	if err := s.rateLimit(r, "del_account_1_"+r.viewer.String(), time.Second*5, 1); err != nil {
+	if err := s.rateLimit(r, "delete_account", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -114,6 +127,7 @@ func (s *Server) deleteUser(w *responseWriter, r *request) error {
 	if err := toDelete.Delete(r.ctx, s.db); err != nil {
 		return err
 	}
+	s.invalidateUserCache(toDelete.ID)
 
 	w.writeString(`{"success": true}`)
 	return nil
@@ -233,10 +247,13 @@ func (s *Server) login(w *responseWriter, r *request) error {
 	// TODO: Require a captcha if user is suspicious looking.
 
 	ip := httputil.GetIP(r.req)
-	if err := s.rateLimit(r, "login_1_"+ip, time.Second, 10); err != nil {
+	if err := s.rateLimit(r, "login", ip); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "login_user", ip+username); err != nil {
 		return err
 	}
-	if err := s.rateLimit(r, "login_2_"+ip+username, time.Hour, 20); err != nil {
+	if err := core.CheckIPBan(r.ctx, s.db, ip); err != nil {
 		return err
 	}
 
@@ -285,14 +302,14 @@ func (s *Server) signup(w *responseWriter, r *request) error {
 	}
 
 	ip := httputil.GetIP(r.req)
-	if err := s.rateLimit(r, "signup_1_"+ip, time.Minute, 2); err != nil {
+	if err := s.rateLimit(r, "signup", ip); err != nil {
 		return err
 	}
-	if err := s.rateLimit(r, "signup_2_"+ip, time.Hour*6, 10); err != nil {
+	if err := core.CheckIPBan(r.ctx, s.db, ip); err != nil {
 		return err
 	}
 
-	user, err := core.RegisterUser(r.ctx, s.db, username, email, password, httputil.GetIP(r.req))
+	user, err := core.RegisterUser(r.ctx, s.db, username, email, password, ip)
 	if err != nil {
 		return err
 	}
@@ -328,7 +345,7 @@ func (s *Server) updateNotifications(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "update_notifs_1_"+r.viewer.String(), time.Second*1, 5); err != nil {
+	if err := s.rateLimit(r, "update_notifications", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -479,10 +496,7 @@ func (s *Server) updateUserSettings(w *responseWriter, r *request) error {
 		return errNotLoggedIn
 	}
 
-	if err := s.rateLimit(r, "update_settings_1_"+r.viewer.String(), time.Second*1, 5); err != nil {
-		return err
-	}
-	if err := s.rateLimit(r, "update_settings_2_"+r.viewer.String(), time.Hour, 100); err != nil {
+	if err := s.rateLimit(r, "update_settings", r.viewer.String()); err != nil {
 		return err
 	}
 
@@ -519,6 +533,7 @@ func (s *Server) updateUserSettings(w *responseWriter, r *request) error {
 		return httperr.NewBadRequest("invalid_action", "Unsupported action.")
 	}
 
+	s.invalidateUserCache(user.ID)
 	return w.writeJSON(user)
 }
 
@@ -563,6 +578,7 @@ func (s *Server) handleUserProPic(w *responseWriter, r *request) error {
 		}
 	}
 
+	s.invalidateUserCache(user.ID)
 	return w.writeJSON(user)
 }
 
@@ -603,6 +619,7 @@ func (s *Server) deleteBadge(w *responseWriter, r *request) error {
 		}
 	}
 
+	s.invalidateUserCache(user.ID)
 	return w.writeString(`{"success":true}`)
 }
 
@@ -638,6 +655,7 @@ func (s *Server) addBadge(w *responseWriter, r *request) error {
 	if err := user.AddBadge(r.ctx, s.db, reqBody.BadgeType); err != nil {
 		return err
 	}
+	s.invalidateUserCache(user.ID)
 
 	return w.writeJSON(user.Badges)
 }
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// getModdedCommunity returns the community with the communityID url var of r,
+// if the viewer is a mod of it (or an admin).
+func (s *Server) getModdedCommunity(r *request) (*core.Community, error) {
+	if !r.loggedIn {
+		return nil, errNotLoggedIn
+	}
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return nil, err
+	}
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := userModOrAdmin(r.ctx, s.db, *r.viewer, comm); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errNotAdminNorMod
+	}
+	return comm, nil
+}
+
+// /api/communities/{communityID}/approved [GET, POST, DELETE]
+//
+// The approved users of a community are those that can post in it while it's
+// restricted.
+func (s *Server) handleCommunityApprovedUsers(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		users, err := comm.GetApprovedUsers(r.ctx, s.db)
+		if err != nil {
+			return err
+		}
+		if users == nil {
+			return w.writeString("[]")
+		}
+		return w.writeJSON(users)
+	}
+
+	values, err := r.unmarshalJSONBodyToStringsMap(true)
+	if err != nil {
+		return err
+	}
+	username, ok := values["username"]
+	if !ok {
+		return httperr.NewBadRequest("no_username", "No username.")
+	}
+	user, err := core.GetUserByUsername(r.ctx, s.db, username, nil)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		err = comm.ApproveUser(r.ctx, s.db, *r.viewer, user.ID)
+	} else {
+		err = comm.RemoveApprovedUser(r.ctx, s.db, *r.viewer, user.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(user)
+}
+
+// /api/communities/{communityID}/join_requests [GET, POST]
+func (s *Server) handleCommunityJoinRequests(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if r.req.Method == "POST" {
+		// Request to join the community.
+		if err := s.rateLimit(r, "join_request", r.viewer.String()); err != nil {
+			return err
+		}
+		cid, err := strToID(r.muxVar("communityID"))
+		if err != nil {
+			return err
+		}
+		comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+		if err != nil {
+			return err
+		}
+		values, err := r.unmarshalJSONBodyToStringsMap(false)
+		if err != nil {
+			return err
+		}
+		req, err := core.CreateCommunityJoinRequest(r.ctx, s.db, comm, *r.viewer, values["message"])
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(req)
+	}
+
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	var status core.CommunityJoinRequestStatus
+	if text := r.urlQueryParamsValue("status"); text != "" {
+		if err := status.UnmarshalText([]byte(text)); err != nil {
+			return err
+		}
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	requests, nextNext, err := core.GetCommunityJoinRequests(r.ctx, s.db, comm.ID, status, 50, nextPtr)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		Requests []*core.CommunityJoinRequest `json:"requests"`
+		Next     *string                      `json:"next"`
+	}{requests, nextNext}
+
+	return w.writeJSON(res)
+}
+
+// /api/join_requests/{requestID} [PUT]
+func (s *Server) reviewJoinRequest(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	id, err := strconv.Atoi(r.muxVar("requestID"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_join_request_id", "Invalid join request ID.")
+	}
+	req, err := core.GetCommunityJoinRequest(r.ctx, s.db, id)
+	if err != nil {
+		return err
+	}
+
+	values, err := r.unmarshalJSONBodyToStringsMap(false)
+	if err != nil {
+		return err
+	}
+	switch values["action"] {
+	case "approve":
+		if err := req.Approve(r.ctx, s.db, *r.viewer); err != nil {
+			return err
+		}
+	case "deny":
+		if err := req.Deny(r.ctx, s.db, *r.viewer); err != nil {
+			return err
+		}
+	default:
+		return httperr.NewBadRequest("invalid_action", "Unsupported action.")
+	}
+
+	return w.writeJSON(req)
+}
+
+// /api/communities/{communityID}/invites [GET, POST]
+func (s *Server) handleCommunityInvites(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		invites, err := comm.GetInvites(r.ctx, s.db)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(invites)
+	}
+
+	req := struct {
+		ExpiresAt *time.Time `json:"expiresAt"` // Never expires if null.
+		MaxUses   int        `json:"maxUses"`   // Unlimited if 0.
+	}{}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+	invite, err := comm.CreateInvite(r.ctx, s.db, *r.viewer, req.ExpiresAt, req.MaxUses)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(invite)
+}
+
+// /api/communities/{communityID}/invites/{inviteID} [DELETE]
+func (s *Server) deleteCommunityInvite(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(r.muxVar("inviteID"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_invite_id", "Invalid invite ID.")
+	}
+	if err := comm.DeleteInvite(r.ctx, s.db, *r.viewer, id); err != nil {
+		return err
+	}
+	return w.writeString(`{"success":true}`)
+}
+
+// /api/invites/{code} [POST]
+func (s *Server) acceptCommunityInvite(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimit(r, "join_community", r.viewer.String()); err != nil {
+		return err
+	}
+
+	comm, err := core.AcceptCommunityInvite(r.ctx, s.db, r.muxVar("code"), *r.viewer)
+	if err != nil {
+		return err
+	}
+
+	if err := comm.PopulateViewerFields(r.ctx, s.db, *r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(comm)
+}